@@ -0,0 +1,26 @@
+#!/bin/bash
+
+ddl_dir=$(dirname $0)/../baseline
+
+user=postgres
+db_user=${1:-$user}
+export PGPASSWORD=$2
+
+# A script to create the mtr_baseline database from the original schema (before migrations were added)
+# for testing the migrations in mtr-api (see TestMigrateBaseline).  Run initdb.sh first to create the users.
+#
+# usage: initdb-baseline.sh 'db_super_user_name' 'db_super_user_password'
+#
+# The schema is created by mtradmin (the DB owner) which runs the migrations.
+dropdb --host=127.0.0.1 --username=$db_user --if-exists mtr_baseline
+psql --host=127.0.0.1 -d postgres --username=$db_user -c "CREATE DATABASE mtr_baseline WITH OWNER mtradmin TEMPLATE template0 ENCODING 'UTF8'"
+psql --host=127.0.0.1 -d postgres --username=$db_user -c "ALTER DATABASE mtr_baseline SET timezone TO UTC"
+psql --host=127.0.0.1 -d mtr_baseline --username=$db_user -c 'create extension postgis;'
+
+export PGPASSWORD=test
+
+psql --host=127.0.0.1 --quiet --username=mtradmin --dbname=mtr_baseline --file=${ddl_dir}/mtr-schema.ddl
+psql --host=127.0.0.1 --quiet --username=mtradmin --dbname=mtr_baseline --file=${ddl_dir}/field-schema.ddl
+psql --host=127.0.0.1 --quiet --username=mtradmin --dbname=mtr_baseline --file=${ddl_dir}/app-schema.ddl
+psql --host=127.0.0.1 --quiet --username=mtradmin --dbname=mtr_baseline --file=${ddl_dir}/data-schema.ddl
+psql --host=127.0.0.1 --quiet --username=mtradmin mtr_baseline -f ${ddl_dir}/user-permissions.ddl
@@ -32,6 +32,9 @@ const (
 	MsgProc ID = 1203
 	MsgErr  ID = 1204
 
+	// Rows deleted e.g., old metrics.
+	Deleted ID = 1300
+
 	// Timer
 	AvgMean   ID = 2001
 	MaxFifty  ID = 2002
@@ -64,6 +67,8 @@ var idColours = map[int]string{
 	1203: "deepskyblue",
 	1204: "#e41a1c",
 
+	1300: "#ff7f00",
+
 	2001: "#ff0000",
 	2002: "#00ff00",
 	2003: "#0000ff",
@@ -94,6 +99,8 @@ var idLabels = map[int]string{
 	1203: "Msg Processed",
 	1204: "Msg Error",
 
+	1300: "Deleted",
+
 	2001: "Avg Mean",
 	2002: "Max Fifty",
 	2003: "Max Ninety",
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"math"
+	"sort"
+)
+
+// Percentile calculates the kth percentile of v.  v is sorted if needed.
+func Percentile(k float64, v []int) (value int) {
+	if !sort.IntsAreSorted(v) {
+		sort.Ints(v)
+	}
+
+	p := k * float64(len(v))
+
+	if p != math.Trunc(p) {
+		idx := int(math.Ceil(p))
+		if idx <= len(v) {
+			value = v[int(math.Ceil(p))-1]
+		}
+	} else {
+		idx := int(math.Trunc(p))
+		if idx < len(v) {
+			value = int((v[idx-1] + v[idx]) / 2)
+		}
+	}
+
+	return
+}
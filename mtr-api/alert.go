@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/GeoNet/mtr/mtrapp"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/weft"
+	"github.com/golang/protobuf/proto"
+	"log"
+	"net/http"
+	"time"
+)
+
+/*
+The states for field metrics and data latencies.  Alerts are kept in mtr.alert for bad and late metrics.
+Metrics that are bad or late while they are silenced are in maintenance instead (see silence.go).
+*/
+const (
+	metricOK          = "ok"
+	metricBad         = "bad"
+	metricLate        = "late"
+	metricUnknown     = "unknown"
+	metricMaintenance = "maintenance"
+)
+
+// Alert events for notifications.
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// lateDefault is the late window (seconds) for new field and data types.  It is the default for late in field.type and data.type.
+const lateDefault = 10800
+
+/*
+fieldLate and dataLate are the SQL for the late window (seconds) for a field metric or data latency.  This is
+the window for the device (site) and type if there is one, otherwise the window for the type.  Queries using them
+must join field.type and LEFT JOIN field.metric_late USING (devicePK, typePK), or join data.type and
+LEFT JOIN data.latency_late USING (sitePK, typePK).
+*/
+const (
+	fieldLate = `COALESCE(field.metric_late.late, field.type.late)`
+	dataLate  = `COALESCE(data.latency_late.late, data.type.late)`
+)
+
+// alertRetention is how long resolved alerts are kept for.
+const alertRetention = time.Hour * 24 * 90
+
+// alertLock is the key for the advisory lock that stops more than one mtr-api evaluating alerts at a time.
+const alertLock = 7311
+
+// isLate returns true if the latest value at t is older than the late window (seconds) at now.
+func isLate(now, t time.Time, late int) bool {
+	return t.Before(now.Add(time.Second * time.Duration(-late)))
+}
+
+/*
+threshold is the range for a metric.  A metric is bad when its value has been outside lower and upper for at
+least forSeconds and is ok again when the value is back inside the recovery band from lower + hysteresis to
+upper - hysteresis.  If lower == upper == 0 no threshold has been set.
+*/
+type threshold struct {
+	lower, upper float64
+	forSeconds   int
+	hysteresis   float64
+}
+
+/*
+metricState classifies the latest value v at t for a metric with threshold th and the late window (seconds).
+outSince is when the metric went outside the threshold and hasn't recovered since, it is zero if it
+hasn't.  anomaly is set (anomalyRate or anomalyBaseline) if v broke the anomaly thresholds for the metric.
+If no threshold has been set the metric is unknown unless it is late.
+*/
+func metricState(now, t time.Time, late int, v float64, th threshold, outSince time.Time, anomaly string) string {
+	switch {
+	case isLate(now, t, late):
+		return metricLate
+	case th.lower == 0 && th.upper == 0:
+		return metricUnknown
+	case anomaly != "":
+		return metricBad
+	case thresholdBad(now, v, th, outSince):
+		return metricBad
+	default:
+		return metricOK
+	}
+}
+
+/*
+thresholdBad returns true if v is outside the threshold th, or inside it but not yet back in the recovery band,
+and the metric has been out since at least th.forSeconds ago.  outSince can be zero for a value outside
+the threshold, e.g., when the threshold has changed since the value was saved, and then the metric has only just
+gone out.
+*/
+func thresholdBad(now time.Time, v float64, th threshold, outSince time.Time) bool {
+	out := v < th.lower || v > th.upper
+
+	switch {
+	case !out && v >= th.lower+th.hysteresis && v <= th.upper-th.hysteresis:
+		return false
+	case !out && outSince.IsZero():
+		return false
+	case outSince.IsZero():
+		outSince = now
+	}
+
+	return !outSince.After(now.Add(time.Second * time.Duration(-th.forSeconds)))
+}
+
+// alertKey identifies the metric for an alert.  id is the deviceID for field metrics or the siteID for data latencies.
+type alertKey struct {
+	schema string
+	id     string
+	typeID string
+}
+
+type alertMetric struct {
+	state string
+	value float64
+	lower float64
+	upper float64
+}
+
+/*
+alertChanges compares the current state of metrics to the open (firing) alerts.  It returns the open alerts
+that are resolved, because the metric is ok, unknown, gone, or has changed state, and the metrics that start an alert.
+A metric that changes from bad to late (or back) resolves one alert and starts another.
+*/
+func alertChanges(open map[alertKey]string, current map[alertKey]alertMetric) (resolved []alertKey, started []alertKey) {
+	for k, s := range open {
+		if c, ok := current[k]; !ok || c.state != s {
+			resolved = append(resolved, k)
+		}
+	}
+
+	for k, c := range current {
+		if c.state != metricBad && c.state != metricLate {
+			continue
+		}
+
+		if s, ok := open[k]; ok && s == c.state {
+			continue
+		}
+
+		started = append(started, k)
+	}
+
+	return
+}
+
+/*
+evaluateAlerts updates the alerts (see updateAlerts) once a minute.  Notifications are delivered separately
+(see sendNotifications).  The time taken is tracked as a timer.
+*/
+func evaluateAlerts() {
+	ticker := time.NewTicker(time.Minute).C
+	for {
+		select {
+		case <-ticker:
+			t := mtrapp.Start()
+
+			if err := updateAlerts(time.Now().UTC()); err != nil {
+				log.Println(err)
+			}
+
+			t.Track("evaluateAlerts")
+		}
+	}
+}
+
+/*
+updateAlerts classifies the latest value for every field metric and data latency (see metricState) and
+saves the changes to mtr.alert.  Silenced metrics don't alert and their firing alerts are resolved.  Notifications are queued for alerts that start or are resolved (see notify.go).
+Metrics for pending devices and sites are not evaluated.  If another mtr-api is already updating the alerts
+this returns without doing anything.
+*/
+func updateAlerts(now time.Time) error {
+	return storage.alertUpdate(now, func(open map[alertKey]string) (alertChange, error) {
+		var c alertChange
+
+		current, err := alertMetrics(now)
+		if err != nil {
+			return c, err
+		}
+
+		resolved, started := alertChanges(open, current)
+
+		var n []notifyAlert
+
+		for _, k := range resolved {
+			c.resolved = append(c.resolved, k)
+			n = append(n, newNotifyAlert(alertResolved, k, open[k], current[k], now))
+		}
+
+		for _, k := range started {
+			m := current[k]
+
+			c.started = append(c.started, alert{alertKey: k, state: m.state, value: m.value, start: now})
+			n = append(n, newNotifyAlert(alertFiring, k, m.state, m, now))
+		}
+
+		c.notifications, err = queueNotifications(n)
+
+		return c, err
+	})
+}
+
+// alertMetrics returns the current state of all field metrics and data latencies.
+func alertMetrics(now time.Time) (map[alertKey]alertMetric, error) {
+	fs, err := storage.fieldSummaries("")
+	if err != nil {
+		return nil, err
+	}
+
+	ds, err := storage.dataLatencySummaries("")
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[alertKey]alertMetric)
+
+	for _, s := range fs {
+		if s.pending {
+			continue
+		}
+
+		m[alertKey{schema: "field", id: s.deviceID, typeID: s.typeID}] = alertMetric{
+			state: maintenanceState(metricState(now, s.t, s.late, s.value, s.th, s.outSince, s.anomaly), s.silenced),
+			value: s.value,
+			lower: s.th.lower,
+			upper: s.th.upper,
+		}
+	}
+
+	for _, s := range ds {
+		if s.pending {
+			continue
+		}
+
+		m[alertKey{schema: "data", id: s.siteID, typeID: s.typeID}] = alertMetric{
+			state: maintenanceState(metricState(now, s.t, s.late, s.mean, s.th, s.outSince, s.anomaly), s.silenced),
+			value: s.mean,
+			lower: s.th.lower,
+			upper: s.th.upper,
+		}
+	}
+
+	return m, nil
+}
+
+// alertStart returns the startDate query parameter.  The default is 24 hours ago.
+func alertStart(r *http.Request) (time.Time, *weft.Result) {
+	t := time.Now().UTC().Add(time.Hour * -24)
+
+	if s := r.URL.Query().Get("startDate"); s != "" {
+		var err error
+		if t, err = time.Parse(time.RFC3339, s); err != nil {
+			return t, weft.BadRequest("invalid startDate")
+		}
+	}
+
+	return t, &weft.StatusOK
+}
+
+// alertProto returns the firing alerts and the alerts that were resolved after startDate, most recent first.
+func alertProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	t, res := alertStart(r)
+	if !res.Ok {
+		return res
+	}
+
+	alerts, err := storage.alerts(t)
+	if err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	var ar mtrpb.AlertResult
+
+	for _, a := range alerts {
+		p := mtrpb.Alert{
+			Schema:       a.schema,
+			TypeID:       a.typeID,
+			State:        a.state,
+			Value:        a.value,
+			StartSeconds: a.start.Unix(),
+		}
+
+		switch a.schema {
+		case "field":
+			p.DeviceID = a.id
+		case "data":
+			p.SiteID = a.id
+		}
+
+		if !a.end.IsZero() {
+			p.EndSeconds = a.end.Unix()
+		}
+
+		ar.Result = append(ar.Result, &p)
+	}
+
+	var by []byte
+	if by, err = proto.Marshal(&ar); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
+
+// alertJSONAlert is an alert returned by alertJSON.  The ID that doesn't apply to the schema, and end for a firing alert, are null.
+type alertJSONAlert struct {
+	Schema   string     `json:"schema"`
+	DeviceID *string    `json:"deviceID"`
+	SiteID   *string    `json:"siteID"`
+	TypeID   string     `json:"typeID"`
+	State    string     `json:"state"`
+	Value    float64    `json:"value"`
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end"`
+}
+
+// alertJSON returns the same alerts as alertProto as a JSON array.  end is null for firing alerts.
+func alertJSON(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	t, res := alertStart(r)
+	if !res.Ok {
+		return res
+	}
+
+	alerts, err := storage.alerts(t)
+	if err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	j := []alertJSONAlert{}
+
+	for _, a := range alerts {
+		a := a
+
+		v := alertJSONAlert{
+			Schema: a.schema,
+			TypeID: a.typeID,
+			State:  a.state,
+			Value:  a.value,
+			Start:  a.start,
+		}
+
+		switch a.schema {
+		case "field":
+			v.DeviceID = &a.id
+		case "data":
+			v.SiteID = &a.id
+		}
+
+		if !a.end.IsZero() {
+			v.End = &a.end
+		}
+
+		j = append(j, v)
+	}
+
+	var by []byte
+	if by, err = json.Marshal(j); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
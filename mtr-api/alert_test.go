@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/GeoNet/mtr/mtrpb"
+	wt "github.com/GeoNet/weft/wefttest"
+	"github.com/golang/protobuf/proto"
+	"testing"
+	"time"
+)
+
+func TestMetricState(t *testing.T) {
+	now := time.Date(2016, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	lateAfter := time.Second * lateDefault
+
+	in := []struct {
+		id       string
+		t        time.Time
+		late     int
+		v        float64
+		lower    float64
+		upper    float64
+		state    string
+		forS     int
+		h        float64
+		outSince time.Time
+		anomaly  string
+	}{
+		{id: wt.L(), t: now, late: lateDefault, v: 14000, lower: 12000, upper: 15000, state: metricOK},
+		{id: wt.L(), t: now, late: lateDefault, v: 12000, lower: 12000, upper: 15000, state: metricOK},
+		{id: wt.L(), t: now, late: lateDefault, v: 11999.5, lower: 12000, upper: 15000, state: metricBad},
+		{id: wt.L(), t: now, late: lateDefault, v: 15001, lower: 12000, upper: 15000, state: metricBad},
+		{id: wt.L(), t: now, late: lateDefault, v: 14000, state: metricUnknown},
+		{id: wt.L(), t: now.Add(-lateAfter), late: lateDefault, v: 14000, lower: 12000, upper: 15000, state: metricOK},
+		{id: wt.L(), t: now.Add(-lateAfter - time.Second), late: lateDefault, v: 14000, lower: 12000, upper: 15000, state: metricLate},
+		{id: wt.L(), t: now.Add(-lateAfter - time.Second), late: lateDefault, v: 14000, state: metricLate},
+		{id: wt.L(), t: now.Add(time.Minute * -2), late: 60, v: 14000, lower: 12000, upper: 15000, state: metricLate},
+		{id: wt.L(), t: now.Add(time.Minute * -2), late: 120, v: 14000, lower: 12000, upper: 15000, state: metricOK},
+		{id: wt.L(), t: now.Add(time.Hour * -4), late: 86400, v: 11000, lower: 12000, upper: 15000, state: metricBad},
+		// out for less than the for duration.
+		{id: wt.L(), t: now, late: lateDefault, v: 11000, lower: 12000, upper: 15000, forS: 600, outSince: now.Add(time.Minute * -5), state: metricOK},
+		{id: wt.L(), t: now, late: lateDefault, v: 11000, lower: 12000, upper: 15000, forS: 600, state: metricOK},
+		// out for the for duration.
+		{id: wt.L(), t: now, late: lateDefault, v: 11000, lower: 12000, upper: 15000, forS: 600, outSince: now.Add(time.Minute * -10), state: metricBad},
+		// back inside the thresholds but not the recovery band.
+		{id: wt.L(), t: now, late: lateDefault, v: 12100, lower: 12000, upper: 15000, h: 500, outSince: now.Add(time.Minute * -10), state: metricBad},
+		{id: wt.L(), t: now, late: lateDefault, v: 14600, lower: 12000, upper: 15000, h: 500, outSince: now.Add(time.Minute * -10), state: metricBad},
+		{id: wt.L(), t: now, late: lateDefault, v: 12100, lower: 12000, upper: 15000, h: 500, forS: 600, outSince: now.Add(time.Minute * -5), state: metricOK},
+		// never went out.
+		{id: wt.L(), t: now, late: lateDefault, v: 12100, lower: 12000, upper: 15000, h: 500, state: metricOK},
+		// back inside the recovery band.
+		{id: wt.L(), t: now, late: lateDefault, v: 12500, lower: 12000, upper: 15000, h: 500, outSince: now.Add(time.Minute * -10), state: metricOK},
+		{id: wt.L(), t: now, late: lateDefault, v: 14000, lower: 12000, upper: 15000, h: 500, forS: 600, outSince: now.Add(time.Minute * -10), state: metricOK},
+		// inside the thresholds but anomalous.
+		{id: wt.L(), t: now, late: lateDefault, v: 14000, lower: 12000, upper: 15000, anomaly: anomalyRate, state: metricBad},
+		{id: wt.L(), t: now, late: lateDefault, v: 14000, lower: 12000, upper: 15000, anomaly: anomalyBaseline, state: metricBad},
+		{id: wt.L(), t: now, late: lateDefault, v: 14000, anomaly: anomalyRate, state: metricUnknown},
+		{id: wt.L(), t: now.Add(-lateAfter - time.Second), late: lateDefault, v: 14000, lower: 12000, upper: 15000, anomaly: anomalyRate, state: metricLate},
+	}
+
+	for _, v := range in {
+		th := threshold{lower: v.lower, upper: v.upper, forSeconds: v.forS, hysteresis: v.h}
+
+		if s := metricState(now, v.t, v.late, v.v, th, v.outSince, v.anomaly); s != v.state {
+			t.Errorf("%s expected %s got %s", v.id, v.state, s)
+		}
+	}
+}
+
+func TestAlertChanges(t *testing.T) {
+	k := func(id string) alertKey {
+		return alertKey{schema: "field", id: id, typeID: "voltage"}
+	}
+
+	open := map[alertKey]string{
+		k("still-bad"):   metricBad,
+		k("now-ok"):      metricBad,
+		k("now-late"):    metricBad,
+		k("gone"):        metricLate,
+		k("now-unknown"): metricLate,
+	}
+
+	current := map[alertKey]alertMetric{
+		k("still-bad"):   {state: metricBad},
+		k("now-ok"):      {state: metricOK},
+		k("now-late"):    {state: metricLate},
+		k("now-unknown"): {state: metricUnknown},
+		k("new-bad"):     {state: metricBad},
+		k("new-ok"):      {state: metricOK},
+	}
+
+	resolved, started := alertChanges(open, current)
+
+	r := make(map[string]bool)
+	for _, v := range resolved {
+		r[v.id] = true
+	}
+
+	s := make(map[string]bool)
+	for _, v := range started {
+		s[v.id] = true
+	}
+
+	if len(r) != 4 || !r["now-ok"] || !r["now-late"] || !r["gone"] || !r["now-unknown"] {
+		t.Errorf("unexpected resolved alerts %v", resolved)
+	}
+
+	if len(s) != 2 || !s["now-late"] || !s["new-bad"] {
+		t.Errorf("unexpected started alerts %v", started)
+	}
+}
+
+// TestAlerts checks changes of state for a metric start and resolve alerts.
+func TestAlerts(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	if _, err := db.Exec(`DELETE FROM mtr.alert WHERE schema = 'field' AND id = 'test-alert'`); err != nil {
+		t.Fatal(err)
+	}
+
+	setupReq := wt.Requests{
+		{ID: wt.L(), URL: "/field/model?modelID=Trimble+NetR9", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/device?deviceID=test-alert&modelID=Trimble+NetR9&latitude=-38.74270&longitude=176.08100", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric?deviceID=test-alert&typeID=voltage", Method: "DELETE"},
+		{ID: wt.L(), URL: "/field/metric/threshold?deviceID=test-alert&typeID=voltage&lower=12000&upper=13000", Method: "PUT"},
+		// late
+		{ID: wt.L(), URL: "/field/metric?deviceID=test-alert&typeID=voltage&value=14000&time=" + now.Add(time.Hour*-4).Format(time.RFC3339), Method: "PUT"},
+	}
+
+	for _, v := range setupReq {
+		if err := doStatus(testServer.URL, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer doStatus(testServer.URL, wt.Request{ID: wt.L(), URL: "/field/device?deviceID=test-alert", Method: "DELETE"})
+
+	if err := updateAlerts(now); err != nil {
+		t.Fatal(err)
+	}
+
+	// bad
+	r := wt.Request{ID: wt.L(), URL: "/field/metric?deviceID=test-alert&typeID=voltage&value=14000&time=" + now.Add(time.Minute*-1).Format(time.RFC3339), Method: "PUT"}
+	if err := doStatus(testServer.URL, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := updateAlerts(now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	a := testAlerts(t)
+
+	if len(a) != 2 {
+		t.Fatalf("expected 2 alerts got %d", len(a))
+	}
+
+	if a[0].State != metricBad || a[0].EndSeconds != 0 || a[0].Value != 14000 || a[0].StartSeconds != now.Add(time.Second).Unix() {
+		t.Errorf("expected firing bad alert got %+v", a[0])
+	}
+
+	if a[1].State != metricLate || a[1].StartSeconds != now.Unix() || a[1].EndSeconds != now.Add(time.Second).Unix() {
+		t.Errorf("expected resolved late alert got %+v", a[1])
+	}
+
+	// ok
+	r = wt.Request{ID: wt.L(), URL: "/field/metric/threshold?deviceID=test-alert&typeID=voltage&lower=12000&upper=15000", Method: "PUT"}
+	if err := doStatus(testServer.URL, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := updateAlerts(now.Add(time.Second * 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	// evaluating again doesn't change anything.
+	if err := updateAlerts(now.Add(time.Second * 3)); err != nil {
+		t.Fatal(err)
+	}
+
+	a = testAlerts(t)
+
+	if len(a) != 2 {
+		t.Fatalf("expected 2 alerts got %d", len(a))
+	}
+
+	if a[0].State != metricBad || a[0].EndSeconds != now.Add(time.Second*2).Unix() {
+		t.Errorf("expected resolved bad alert got %+v", a[0])
+	}
+
+	r = wt.Request{ID: wt.L(), URL: "/alert", Accept: "application/json"}
+
+	b, err := r.Do(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var j []struct {
+		Schema   string  `json:"schema"`
+		DeviceID *string `json:"deviceID"`
+		SiteID   *string `json:"siteID"`
+		State    string  `json:"state"`
+		End      *string `json:"end"`
+	}
+
+	if err = json.Unmarshal(b, &j); err != nil {
+		t.Fatal(err)
+	}
+
+	var found int
+
+	for _, v := range j {
+		if v.DeviceID == nil || *v.DeviceID != "test-alert" {
+			continue
+		}
+
+		found++
+
+		if v.Schema != "field" || v.SiteID != nil || v.End == nil {
+			t.Errorf("unexpected JSON alert %+v", v)
+		}
+	}
+
+	if found != 2 {
+		t.Errorf("expected 2 JSON alerts got %d", found)
+	}
+}
+
+// TestThresholdFor checks a metric is only bad once it has been out for the for duration and stays bad until it is
+// back inside the recovery band.
+func TestThresholdFor(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	setupReq := wt.Requests{
+		{ID: wt.L(), URL: "/field/model?modelID=Trimble+NetR9", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/device?deviceID=test-for&modelID=Trimble+NetR9&latitude=-38.74270&longitude=176.08100", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric?deviceID=test-for&typeID=voltage", Method: "DELETE"},
+		{ID: wt.L(), URL: "/field/metric/threshold?deviceID=test-for&typeID=voltage&lower=12000&upper=13000&for=600&hysteresis=200", Method: "PUT"},
+	}
+
+	for _, v := range setupReq {
+		if err := doStatus(testServer.URL, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer doStatus(testServer.URL, wt.Request{ID: wt.L(), URL: "/field/device?deviceID=test-for", Method: "DELETE"})
+
+	in := []struct {
+		id  string
+		t   time.Time
+		v   string
+		bad bool
+	}{
+		// out for 20 minutes.
+		{id: wt.L(), t: now.Add(time.Minute * -20), v: "11000", bad: true},
+		// inside the threshold but not the recovery band.
+		{id: wt.L(), t: now.Add(time.Minute * -10), v: "12100", bad: true},
+		// back inside the recovery band.
+		{id: wt.L(), t: now.Add(time.Minute * -9), v: "12500", bad: false},
+		// out for less than 10 minutes.
+		{id: wt.L(), t: now.Add(time.Minute * -5), v: "11000", bad: false},
+		{id: wt.L(), t: now.Add(time.Minute * -1), v: "14000", bad: false},
+	}
+
+	for _, v := range in {
+		r := wt.Request{ID: v.id, URL: "/field/metric?deviceID=test-for&typeID=voltage&value=" + v.v + "&time=" + v.t.Format(time.RFC3339), Method: "PUT"}
+		if err := doStatus(testServer.URL, r); err != nil {
+			t.Fatal(err)
+		}
+
+		if m := testFieldSummary(t, "test-for"); m.Bad != v.bad {
+			t.Errorf("%s expected bad %t got %t", v.id, v.bad, m.Bad)
+		}
+	}
+}
+
+// testAlerts returns the alerts for test-alert, most recent first.
+func testAlerts(t *testing.T) []*mtrpb.Alert {
+	r := wt.Request{ID: wt.L(), URL: "/alert", Accept: "application/x-protobuf"}
+
+	b, err := r.Do(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ar mtrpb.AlertResult
+
+	if err = proto.Unmarshal(b, &ar); err != nil {
+		t.Fatal(err)
+	}
+
+	var a []*mtrpb.Alert
+
+	for _, v := range ar.Result {
+		if v.DeviceID == "test-alert" {
+			a = append(a, v)
+		}
+	}
+
+	return a
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"github.com/GeoNet/mtr/mtrpb"
 	"github.com/GeoNet/weft"
 	"github.com/golang/protobuf/proto"
@@ -11,24 +10,15 @@ import (
 
 // write a protobuf to b of all applicationid's in app.application
 func appIdProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	var err error
-	var rows *sql.Rows
-
-	if rows, err = dbR.Query(`SELECT applicationid FROM app.application ORDER BY applicationid ASC`); err != nil {
+	ids, err := storage.appIDs()
+	if err != nil {
 		return weft.InternalServerError(err)
 	}
-	defer rows.Close()
 
 	var ar mtrpb.AppIDSummaryResult
 
-	for rows.Next() {
-		var ai mtrpb.AppIDSummary
-
-		if err = rows.Scan(&ai.ApplicationID); err != nil {
-			return weft.InternalServerError(err)
-		}
-
-		ar.Result = append(ar.Result, &ai)
+	for _, id := range ids {
+		ar.Result = append(ar.Result, &mtrpb.AppIDSummary{ApplicationID: id})
 	}
 
 	var by []byte
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/csv"
 	"fmt"
 	"github.com/GeoNet/mtr/internal"
@@ -30,7 +29,8 @@ func (t times) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
 // InstanceMetric for sorting instances for SVG plots.
 // public for use with sort.
 type InstanceMetric struct {
-	instancePK, typePK int
+	instanceID string
+	typePK     int
 }
 
 type InstanceMetrics []InstanceMetric
@@ -39,7 +39,7 @@ func (l InstanceMetrics) Len() int {
 	return len(l)
 }
 func (l InstanceMetrics) Less(i, j int) bool {
-	return l[i].instancePK < l[j].instancePK
+	return l[i].instanceID < l[j].instanceID
 }
 func (l InstanceMetrics) Swap(i, j int) {
 	l[i], l[j] = l[j], l[i]
@@ -286,61 +286,18 @@ func appMetricSvg(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result
 }
 
 func (a appMetric) loadCounters(applicationID, resolution string, timeRange []time.Time, p *ts.Plot) *weft.Result {
-	var err error
-	var rows *sql.Rows
-
-	switch resolution {
-	case "minute":
-		rows, err = dbR.Query(`SELECT typePK, date_trunc('`+resolution+`',time) as t, sum(count)
-		FROM app.counter
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND time >= $2 AND time <= $3
-		GROUP BY date_trunc('`+resolution+`',time), typePK
-		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1])
-	case "five_minutes":
-		rows, err = dbR.Query(`SELECT typePK,
-		date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min' as t, sum(count)
-		FROM app.counter
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND time >= $2 AND time <= $3
-		GROUP BY date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min', typePK
-		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1])
-	case "hour":
-		rows, err = dbR.Query(`SELECT typePK, date_trunc('`+resolution+`',time) as t, sum(count)
-		FROM app.counter
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND time >= $2 AND time <= $3
-		GROUP BY date_trunc('`+resolution+`',time), typePK
-		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1])
-	case "full":
-		rows, err = dbR.Query(`SELECT typePK, time, count
-		FROM app.counter
-		JOIN app.type USING (typepk)
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND time >= $2 AND time <= $3
-		ORDER BY time ASC`, applicationID, timeRange[0], timeRange[1])
-	default:
-		return weft.InternalServerError(fmt.Errorf("invalid resolution: %s", resolution))
-	}
+	counters, err := storage.appCounters(applicationID, resolution, timeRange)
 	if err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	defer rows.Close()
-
-	var t time.Time
-	var typePK, count int
 	pts := make(map[int][]ts.Point)
 	total := make(map[int]int)
 
-	for rows.Next() {
-		if err = rows.Scan(&typePK, &t, &count); err != nil {
-			return weft.InternalServerError(err)
-		}
-		pts[typePK] = append(pts[typePK], ts.Point{DateTime: t, Value: float64(count)})
-		total[typePK] += count
+	for _, c := range counters {
+		pts[c.typePK] = append(pts[c.typePK], ts.Point{DateTime: c.t, Value: float64(c.count)})
+		total[c.typePK] += c.count
 	}
-	rows.Close()
 
 	var keys []int
 	for k := range pts {
@@ -363,81 +320,31 @@ func (a appMetric) loadCounters(applicationID, resolution string, timeRange []ti
 }
 
 func (a appMetric) loadTimers(applicationID, resolution string, timeRange []time.Time, p *ts.Plot) *weft.Result {
-	var err error
-
-	var rows *sql.Rows
-
-	switch resolution {
-	case "minute":
-		rows, err = dbR.Query(`SELECT sourcePK, date_trunc('`+resolution+`',time) as t, max(ninety), sum(count)
-		FROM app.timer
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND time >= $2 AND time <= $3
-		GROUP BY date_trunc('`+resolution+`',time), sourcePK
-		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1])
-	case "five_minutes":
-		rows, err = dbR.Query(`SELECT sourcePK,
-		date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min' as t,
-		max(ninety), sum(count)
-		FROM app.timer
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND time >= $2 AND time <= $3
-		GROUP BY date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min', sourcePK
-		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1])
-	case "hour":
-		rows, err = dbR.Query(`SELECT sourcePK, date_trunc('`+resolution+`',time) as t, max(ninety), sum(count)
-		FROM app.timer
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND time >= $2 AND time <= $3
-		GROUP BY date_trunc('`+resolution+`',time), sourcePK
-		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1])
-	case "full":
-		rows, err = dbR.Query(`SELECT sourcePK, time, ninety, count
-		FROM app.timer
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND time >= $2 AND time <= $3
-		ORDER BY time ASC`, applicationID, timeRange[0], timeRange[1])
-	default:
-		return weft.InternalServerError(fmt.Errorf("invalid resolution: %s", resolution))
-	}
+	timers, err := storage.appTimers(applicationID, "", resolution, timeRange)
 	if err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	defer rows.Close()
+	// the sources are numbered in the order they are seen for ranking.
+	sources := make(map[string]int)
+	var sourceIDs []string
 
-	var t time.Time
-	var sourcePK, max, n int
-	var sourceID string
 	pts := make(map[int][]ts.Point)
 	total := make(map[int]int) // track the total counts (call) for each timer.
 
-	for rows.Next() {
-		if err = rows.Scan(&sourcePK, &t, &max, &n); err != nil {
-			return weft.InternalServerError(err)
+	for _, t := range timers {
+		k, ok := sources[t.sourceID]
+		if !ok {
+			k = len(sourceIDs)
+			sources[t.sourceID] = k
+			sourceIDs = append(sourceIDs, t.sourceID)
 		}
-		pts[sourcePK] = append(pts[sourcePK], ts.Point{DateTime: t, Value: float64(max)})
-		total[sourcePK] += n
-	}
-	rows.Close()
-
-	sourceIDs := make(map[int]string)
 
-	if rows, err = dbR.Query(`SELECT sourcePK, sourceID FROM app.source`); err != nil {
-		return weft.InternalServerError(err)
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		if err = rows.Scan(&sourcePK, &sourceID); err != nil {
-			return weft.InternalServerError(err)
-		}
-		sourceIDs[sourcePK] = sourceID
+		pts[k] = append(pts[k], ts.Point{DateTime: t.t, Value: float64(t.ninety)})
+		total[k] += t.count
 	}
-	rows.Close()
 
-	// sort the sourcePKs based on number of calls.
+	// sort the sources based on number of calls.
 	keys := rank(total)
 
 	var labels ts.Labels
@@ -454,68 +361,18 @@ func (a appMetric) loadTimers(applicationID, resolution string, timeRange []time
 }
 
 func (a appMetric) loadTimersWithSourceID(applicationID, sourceID, resolution string, timeRange []time.Time, p *ts.Plot) *weft.Result {
-	var err error
-
-	var rows *sql.Rows
-
-	switch resolution {
-	case "minute":
-		rows, err = dbR.Query(`SELECT date_trunc('minute',time) as t, avg(average), max(fifty), max(ninety), sum(count)
-		FROM app.timer
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND sourcePK = (SELECT sourcePK from app.source WHERE sourceID = $2)
-		AND time >= $3 AND time <= $4
-		GROUP BY date_trunc('minute',time)
-		ORDER BY t ASC`, applicationID, sourceID, timeRange[0], timeRange[1])
-	case "five_minutes":
-		rows, err = dbR.Query(`SELECT
-		date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min' as t,
-		avg(average), max(fifty), max(ninety), sum(count)
-		FROM app.timer
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND sourcePK = (SELECT sourcePK from app.source WHERE sourceID = $2)
-		AND time >= $3 AND time <= $4
-		GROUP BY date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min'
-		ORDER BY t ASC`, applicationID, sourceID, timeRange[0], timeRange[1])
-	case "hour":
-		rows, err = dbR.Query(`SELECT date_trunc('hour',time) as t, avg(average), max(fifty), max(ninety), sum(count)
-		FROM app.timer
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND sourcePK = (SELECT sourcePK from app.source WHERE sourceID = $2)
-		AND time >= $3 AND time <= $4
-		GROUP BY date_trunc('hour', time)
-		ORDER BY t ASC`, applicationID, sourceID, timeRange[0], timeRange[1])
-	case "full":
-		rows, err = dbR.Query(`SELECT time, average, fifty, ninety, count
-		FROM app.timer
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND sourcePK = (SELECT sourcePK from app.source WHERE sourceID = $2)
-		AND time >= $3 AND time <= $4
-		ORDER BY time ASC`, applicationID, sourceID, timeRange[0], timeRange[1])
-	default:
-		return weft.InternalServerError(fmt.Errorf("invalid resolution: %s", resolution))
-	}
+	timers, err := storage.appTimers(applicationID, sourceID, resolution, timeRange)
 	if err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	defer rows.Close()
-
-	var t time.Time
-	var avg_mean float64
-	var max_fifty, max_ninety, n int
 	pts := make(map[internal.ID][]ts.Point)
 
-	for rows.Next() {
-		if err = rows.Scan(&t, &avg_mean, &max_fifty, &max_ninety, &n); err != nil {
-			return weft.InternalServerError(err)
-		}
-
-		pts[internal.AvgMean] = append(pts[internal.AvgMean], ts.Point{DateTime: t, Value: avg_mean})
-		pts[internal.MaxFifty] = append(pts[internal.MaxFifty], ts.Point{DateTime: t, Value: float64(max_fifty)})
-		pts[internal.MaxNinety] = append(pts[internal.MaxNinety], ts.Point{DateTime: t, Value: float64(max_ninety)})
+	for _, t := range timers {
+		pts[internal.AvgMean] = append(pts[internal.AvgMean], ts.Point{DateTime: t.t, Value: t.average})
+		pts[internal.MaxFifty] = append(pts[internal.MaxFifty], ts.Point{DateTime: t.t, Value: float64(t.fifty)})
+		pts[internal.MaxNinety] = append(pts[internal.MaxNinety], ts.Point{DateTime: t.t, Value: float64(t.ninety)})
 	}
-	rows.Close()
 
 	var labels ts.Labels
 
@@ -532,89 +389,26 @@ func (a appMetric) loadTimersWithSourceID(applicationID, sourceID, resolution st
 }
 
 func (a appMetric) loadMemory(applicationID, resolution string, timeRange []time.Time, p *ts.Plot) *weft.Result {
-	var err error
-
-	var rows *sql.Rows
-
-	switch resolution {
-	case "minute":
-		rows, err = dbR.Query(`SELECT instancePK, typePK, date_trunc('`+resolution+`',time) as t, avg(value)
-		FROM app.metric
-		 WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND typePK IN (1000, 1001, 1002)
-		AND time >= $2 AND time <= $3
-		GROUP BY date_trunc('`+resolution+`',time), typePK, instancePK
-		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1])
-	case "five_minutes":
-		rows, err = dbR.Query(`SELECT instancePK, typePK,
-		date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min' as t, avg(value)
-		FROM app.metric
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND typePK IN (1000, 1001, 1002)
-		AND time >= $2 AND time <= $3
-		GROUP BY date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min', typePK, instancePK
-		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1])
-	case "hour":
-		rows, err = dbR.Query(`SELECT instancePK, typePK, date_trunc('`+resolution+`',time) as t, avg(value)
-		FROM app.metric
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND typePK IN (1000, 1001, 1002)
-		AND time >= $2 AND time <= $3
-		GROUP BY date_trunc('`+resolution+`',time), typePK, instancePK
-		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1])
-	case "full":
-		rows, err = dbR.Query(`SELECT instancePK, typePK, time, value
-		FROM app.metric
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND typePK IN (1000, 1001, 1002)
-		AND time >= $2 AND time <= $3
-		ORDER BY time ASC`, applicationID, timeRange[0], timeRange[1])
+	values, err := storage.appMetrics(applicationID, []int{int(internal.MemSys), int(internal.MemHeapAlloc), int(internal.MemHeapSys)},
+		resolution, timeRange)
+	switch err {
+	case nil, errNotFound:
 	default:
-		return weft.InternalServerError(fmt.Errorf("invalid resolution: %s", resolution))
-	}
-	if err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	defer rows.Close()
-
-	var t time.Time
-	var typePK, instancePK int
-	var avg float64
-	var instanceID string
 	pts := make(map[InstanceMetric][]ts.Point)
 
-	for rows.Next() {
-		if err = rows.Scan(&instancePK, &typePK, &t, &avg); err != nil {
-			fmt.Println(err)
-			return weft.InternalServerError(err)
-		}
-		key := InstanceMetric{instancePK: instancePK, typePK: typePK}
-		pts[key] = append(pts[key], ts.Point{DateTime: t, Value: avg})
-	}
-	rows.Close()
-
-	instanceIDs := make(map[int]string)
-
-	if rows, err = dbR.Query(`SELECT instancePK, instanceID FROM app.instance`); err != nil {
-		return weft.InternalServerError(err)
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		if err = rows.Scan(&instancePK, &instanceID); err != nil {
-			return weft.InternalServerError(err)
-		}
-		instanceIDs[instancePK] = instanceID
+	for _, v := range values {
+		key := InstanceMetric{instanceID: v.instanceID, typePK: v.typePK}
+		pts[key] = append(pts[key], ts.Point{DateTime: v.t, Value: v.value})
 	}
-	rows.Close()
 
 	var labels ts.Labels
 
 	for k := range pts {
 		p.AddSeries(ts.Series{Colour: internal.Colour(k.typePK), Points: pts[k]})
-		labels = append(labels, ts.Label{Colour: internal.Colour(k.typePK), Label: fmt.Sprintf("%s.%s", instanceIDs[k.instancePK], strings.TrimPrefix(internal.Label(k.typePK), `Mem `))})
+		labels = append(labels, ts.Label{Colour: internal.Colour(k.typePK), Label: fmt.Sprintf("%s.%s", k.instanceID, strings.TrimPrefix(internal.Label(k.typePK), `Mem `))})
 	}
 
 	p.SetLabels(labels)
@@ -624,102 +418,22 @@ func (a appMetric) loadMemory(applicationID, resolution string, timeRange []time
 }
 
 func (a appMetric) loadAppMetrics(applicationID, resolution string, typeID internal.ID, timeRange []time.Time, p *ts.Plot) *weft.Result {
-	var err error
-
-	var rows *sql.Rows
-
-	rows, err = dbR.Query(`SELECT COUNT(*)
-		FROM app.type, app.application
-		WHERE applicationID = $1
-		AND typePK = $2`, applicationID, int(typeID))
-	defer rows.Close()
-
-	var nRows int
-	for rows.Next() {
-		if err = rows.Scan(&nRows); err != nil {
-			return weft.InternalServerError(err)
-		}
-	}
-
-	// missing applicationID or typePK should return a 404 while no data can be 200.  See GeoNet/mtr#214
-	if nRows == 0 {
+	values, err := storage.appMetrics(applicationID, []int{int(typeID)}, resolution, timeRange)
+	switch err {
+	case nil:
+	case errNotFound:
+		// missing applicationID or typePK should return a 404 while no data can be 200.  See GeoNet/mtr#214
 		return &weft.NotFound
-	}
-
-	rows.Close()
-
-	switch resolution {
-	case "minute":
-		rows, err = dbR.Query(`SELECT instancePK, typePK, date_trunc('`+resolution+`',time) as t, avg(value)
-		FROM app.metric
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND typePK = $2
-		AND time >= $3 AND time <= $4
-		GROUP BY date_trunc('`+resolution+`',time), typePK, instancePK
-		ORDER BY t ASC`, applicationID, int(typeID), timeRange[0], timeRange[1])
-	case "five_minutes":
-		rows, err = dbR.Query(`SELECT instancePK, typePK,
-		date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min' as t, avg(value)
-		FROM app.metric
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND typePK = $2
-		AND time >= $3 AND time <= $4
-		GROUP BY date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min', typePK, instancePK
-		ORDER BY t ASC`, applicationID, int(typeID), timeRange[0], timeRange[1])
-	case "hour":
-		rows, err = dbR.Query(`SELECT instancePK, typePK, date_trunc('`+resolution+`',time) as t, avg(value)
-		FROM app.metric
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND typePK = $2
-		AND time >= $3 AND time <= $4
-		GROUP BY date_trunc('`+resolution+`',time), typePK, instancePK
-		ORDER BY t ASC`, applicationID, int(typeID), timeRange[0], timeRange[1])
-	case "full":
-		rows, err = dbR.Query(`SELECT instancePK, typePK, time as t, value
-		FROM app.metric
-		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
-		AND typePK = $2
-		AND time >= $3 AND time <= $4
-		ORDER BY time ASC`, applicationID, int(typeID), timeRange[0], timeRange[1])
 	default:
-		return weft.InternalServerError(fmt.Errorf("invalid resolution: %s", resolution))
-	}
-	if err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	defer rows.Close()
-
-	var t time.Time
-	var typePK, instancePK int
-	var avg float64
-	var instanceID string
 	pts := make(map[InstanceMetric][]ts.Point)
 
-	for rows.Next() {
-		if err = rows.Scan(&instancePK, &typePK, &t, &avg); err != nil {
-			return weft.InternalServerError(err)
-		}
-		key := InstanceMetric{instancePK: instancePK, typePK: typePK}
-		pts[key] = append(pts[key], ts.Point{DateTime: t, Value: avg})
-	}
-	rows.Close()
-
-	instanceIDs := make(map[int]string)
-
-	if rows, err = dbR.Query(`SELECT instancePK, instanceID FROM app.instance`); err != nil {
-		return weft.InternalServerError(err)
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		if err = rows.Scan(&instancePK, &instanceID); err != nil {
-			return weft.InternalServerError(err)
-		}
-		instanceIDs[instancePK] = instanceID
+	for _, v := range values {
+		key := InstanceMetric{instanceID: v.instanceID, typePK: v.typePK}
+		pts[key] = append(pts[key], ts.Point{DateTime: v.t, Value: v.value})
 	}
-	rows.Close()
 
 	var keys InstanceMetrics
 
@@ -739,7 +453,7 @@ func (a appMetric) loadAppMetrics(applicationID, resolution string, typeID inter
 		c := colours[i]
 
 		p.AddSeries(ts.Series{Colour: c, Points: pts[k]})
-		labels = append(labels, ts.Label{Colour: c, Label: fmt.Sprintf("%s.%s", instanceIDs[k.instancePK], internal.Label(k.typePK))})
+		labels = append(labels, ts.Label{Colour: c, Label: fmt.Sprintf("%s.%s", k.instanceID, internal.Label(k.typePK))})
 	}
 
 	p.SetLabels(labels)
@@ -786,6 +500,8 @@ func defaultTimeDelta(resolution string) (time.Duration, error) {
 		return time.Hour * 24 * 2, nil
 	case "hour":
 		return time.Hour * 24 * 28, nil
+	case "day":
+		return time.Hour * 24 * 365, nil
 	case "full":
 		return time.Hour * 24 * 40, nil
 	case "":
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/weft"
+	"github.com/golang/protobuf/proto"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// appTypePut adds or updates an app type.  The typePK for a new type is in the GET response.
+func appTypePut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	typeID := v.Get("typeID")
+
+	// statsd treats a numeric source as a typePK.
+	if _, err := strconv.Atoi(typeID); err == nil {
+		return weft.BadRequest("typeID can't be a number")
+	}
+
+	if strings.TrimSpace(v.Get("description")) == "" {
+		return weft.BadRequest("empty description")
+	}
+
+	if res := typeUnit(v.Get("unit")); !res.Ok {
+		return res
+	}
+
+	force, res := typeForce(v)
+	if !res.Ok {
+		return res
+	}
+
+	return typeSave(appTypeTable, typeID, []typeColumn{
+		{name: "description", value: v.Get("description")},
+		{name: "unit", value: v.Get("unit")},
+	}, force)
+}
+
+func appTypeDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	force, res := typeForce(v)
+	if !res.Ok {
+		return res
+	}
+
+	return typeDelete(appTypeTable, v.Get("typeID"), force)
+}
+
+func appTypeProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var err error
+	var ftr mtrpb.AppTypeResult
+
+	if ftr.Result, err = storage.appTypes(); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	var by []byte
+	if by, err = proto.Marshal(&ftr); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"github.com/GeoNet/weft"
 	"net/http"
 	"strconv"
@@ -32,48 +31,15 @@ func applicationCounterPut(r *http.Request, h http.Header, b *bytes.Buffer) *wef
 		return weft.BadRequest("invalid typeID")
 	}
 
-	applicationID := v.Get("applicationID")
-	instanceID := v.Get("instanceID")
-
-	var result sql.Result
-
-	// If we insert one row then return.
-	// This will be the most common outcome.
-	if result, err = db.Exec(`INSERT INTO app.counter(applicationPK, instancePK, typePK, time, count)
-				SELECT applicationPK, instancePK, $3, $4, $5
-				FROM app.application, app.instance
-				WHERE applicationID = $1
-				AND instanceID = $2`,
-		applicationID, instanceID, typePK, t, c); err == nil {
-		var i int64
-		if i, err = result.RowsAffected(); err != nil {
-			return weft.InternalServerError(err)
-		}
-		if i == 1 {
-			return &weft.StatusOK
-		}
-	}
-
-	// Most likely causes of error are missing application or instance.  Add them.
-	// Ignore errors - this could race from other handlers.
-	db.Exec(`INSERT INTO app.application(applicationID) VALUES($1)`, applicationID)
-	db.Exec(`INSERT INTO app.instance(instanceID) VALUES($1)`, instanceID)
+	return applicationCounterSave(v.Get("applicationID"), v.Get("instanceID"), typePK, t, c)
+}
 
-	// Try to insert again - if we insert one row then return.
-	if result, err = db.Exec(`INSERT INTO app.counter(applicationPK, instancePK, typePK, time, count)
-				SELECT applicationPK, instancePK, $3, $4, $5
-				FROM app.application, app.instance
-				WHERE applicationID = $1
-				AND instanceID = $2`,
-		applicationID, instanceID, typePK, t, c); err == nil {
-		var i int64
-		if i, err = result.RowsAffected(); err != nil {
-			return weft.InternalServerError(err)
-		}
-		if i == 1 {
-			return &weft.StatusOK
-		}
+// applicationCounterSave saves a count.  application and instance
+// are added to the DB if required.
+func applicationCounterSave(applicationID, instanceID string, typePK int, t time.Time, c int) *weft.Result {
+	if err := storage.appCounterSave(applicationID, instanceID, typePK, t, c); err != nil {
+		return weft.InternalServerError(err)
 	}
 
-	return weft.InternalServerError(err)
+	return &weft.StatusOK
 }
@@ -32,46 +32,15 @@ func applicationMetricPut(r *http.Request, h http.Header, b *bytes.Buffer) *weft
 		return weft.BadRequest("invalid typeID")
 	}
 
-	applicationID := v.Get("applicationID")
-	instanceID := v.Get("instanceID")
-
-	// If we insert one row then return.
-	// This will be the most common outcome.
-	if result, err := db.Exec(`INSERT INTO app.metric (applicationPK, instancePK, typePK, time, value)
-				SELECT applicationPK, instancePK, $3, $4, $5
-				FROM app.application, app.instance
-				WHERE applicationID = $1
-				AND instanceID = $2`,
-		applicationID, instanceID, typePK, t, value); err == nil {
-		var i int64
-		if i, err = result.RowsAffected(); err != nil {
-			return weft.InternalServerError(err)
-		}
-		if i == 1 {
-			return &weft.StatusOK
-		}
-	}
-
-	// Most likely causes of error are missing application or instance.  Add them.
-	// Ignore errors - this could race from other handlers.
-	db.Exec(`INSERT INTO app.application(applicationID) VALUES($1)`, applicationID)
-	db.Exec(`INSERT INTO app.instance(instanceID) VALUES($1)`, instanceID)
+	return applicationMetricSave(v.Get("applicationID"), v.Get("instanceID"), typePK, t, value)
+}
 
-	// Try to insert again - if we insert one row then return.
-	if result, err := db.Exec(`INSERT INTO app.metric (applicationPK, instancePK, typePK, time, value)
-				SELECT applicationPK, instancePK, $3, $4, $5
-				FROM app.application, app.instance
-				WHERE applicationID = $1
-				AND instanceID = $2`,
-		applicationID, instanceID, typePK, t, value); err == nil {
-		var i int64
-		if i, err = result.RowsAffected(); err != nil {
-			return weft.InternalServerError(err)
-		}
-		if i == 1 {
-			return &weft.StatusOK
-		}
+// applicationMetricSave saves a metric value.  application and instance
+// are added to the DB if required.
+func applicationMetricSave(applicationID, instanceID string, typePK int, t time.Time, value int64) *weft.Result {
+	if err := storage.appMetricSave(applicationID, instanceID, typePK, t, value); err != nil {
+		return weft.InternalServerError(err)
 	}
 
-	return weft.InternalServerError(err)
+	return &weft.StatusOK
 }
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"github.com/GeoNet/weft"
 	"net/http"
 	"strconv"
@@ -43,48 +42,15 @@ func applicationTimerPut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.
 		return weft.BadRequest("invalid time")
 	}
 
-	var result sql.Result
-
-	// If we insert one row then return.
-	// This will be the most common outcome.
-	if result, err = db.Exec(`INSERT INTO app.timer(applicationPK, instancePK, sourcePK, time, average, count, fifty, ninety)
-	 			SELECT applicationPK, instancePK, sourcePK, $4, $5, $6, $7, $8
-	 			FROM app.application, app.instance, app.source
-				WHERE applicationID = $1
-				AND instanceID = $2
-				AND sourceID = $3`,
-		applicationID, instanceID, sourceID, t, average, count, fifty, ninety); err == nil {
-		var i int64
-		if i, err = result.RowsAffected(); err != nil {
-			return weft.InternalServerError(err)
-		}
-		if i == 1 {
-			return &weft.StatusOK
-		}
-	}
-
-	// Most likely causes of error are missing application or instance.  Add them.
-	// Ignore errors - this could race from other handlers.
-	db.Exec(`INSERT INTO app.application(applicationID) VALUES($1)`, applicationID)
-	db.Exec(`INSERT INTO app.instance(instanceID) VALUES($1)`, instanceID)
-	db.Exec(`INSERT INTO app.source(sourceID) VALUES($1)`, sourceID)
+	return applicationTimerSave(applicationID, instanceID, sourceID, t, count, average, fifty, ninety)
+}
 
-	// Try to insert again - if we insert one row then return.
-	if result, err = db.Exec(`INSERT INTO app.timer(applicationPK, instancePK, sourcePK, time, average, count, fifty, ninety)
-	 			SELECT applicationPK, instancePK, sourcePK, $4, $5, $6, $7, $8
-	 			FROM app.application, app.instance, app.source
-				WHERE applicationID = $1
-				AND instanceID = $2
-				AND sourceID = $3`,
-		applicationID, instanceID, sourceID, t, average, count, fifty, ninety); err == nil {
-		var i int64
-		if i, err = result.RowsAffected(); err != nil {
-			return weft.InternalServerError(err)
-		}
-		if i == 1 {
-			return &weft.StatusOK
-		}
+// applicationTimerSave saves a timer.  application, instance, and source
+// are added to the DB if required.
+func applicationTimerSave(applicationID, instanceID, sourceID string, t time.Time, count, average, fifty, ninety int) *weft.Result {
+	if err := storage.appTimerSave(applicationID, instanceID, sourceID, t, count, average, fifty, ninety); err != nil {
+		return weft.InternalServerError(err)
 	}
 
-	return weft.InternalServerError(err)
+	return &weft.StatusOK
 }
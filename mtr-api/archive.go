@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/weft"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+/*
+archiveDir is the directory that raw values are archived to before they are deleted, one
+gzip compressed CSV file per partition e.g., <archiveDir>/field/metric_20160102.csv.gz
+Archiving is disabled if archiveDir is empty.
+*/
+var archiveDir = os.Getenv("MTR_ARCHIVE_DIR")
+
+// archiveRestoreHold is how long values restored from an archive file are kept for.
+const archiveRestoreHold = time.Hour * 24 * 7
+
+// archiveFileRe matches archive files relative to archiveDir.  The submatches are the schema, table, and day.
+var archiveFileRe = regexp.MustCompile(`^(field|data|app)/([a-z]+)_([0-9]{8})\.csv\.gz$`)
+
+/*
+archiveTable describes how to archive and restore the values in the partitions of a table.
+Archive files use IDs not PKs so that they can be restored after the PKs change.
+*/
+type archiveTable struct {
+	id      string   // the query parameter for the first column, used to restore values for one device, site, or application.
+	columns []string // the CSV header.
+	query   string   // selects columns from the partition (%s).
+	restore string   // inserts a row of the CSV ($1...) into the parent table.  Values that are already in the table are skipped.
+}
+
+var archiveTables = map[string]archiveTable{
+	"field.metric": {
+		id:      "deviceID",
+		columns: []string{"deviceID", "typeID", "time", "value"},
+		query: `SELECT deviceID, typeID, time, value FROM %s
+			JOIN field.device USING (devicePK)
+			JOIN field.type USING (typePK)
+			ORDER BY deviceID ASC, typeID ASC, time ASC`,
+		restore: `INSERT INTO field.metric_parent(devicePK, typePK, rate_limit, time, value)
+			SELECT d.devicePK, t.typePK, extract(epoch FROM $3::timestamptz)::bigint / min_interval * min_interval, $3::timestamptz, $4::integer
+			FROM field.device d, field.type t
+			WHERE d.deviceID = $1 AND t.typeID = $2
+			AND NOT EXISTS (SELECT 1 FROM field.metric m
+				WHERE m.devicePK = d.devicePK AND m.typePK = t.typePK AND m.time = $3::timestamptz)
+			ON CONFLICT DO NOTHING`,
+	},
+	"data.latency": {
+		id:      "siteID",
+		columns: []string{"siteID", "typeID", "time", "mean", "min", "max", "fifty", "ninety"},
+		query: `SELECT siteID, typeID, time, mean, min, max, fifty, ninety FROM %s
+			JOIN data.site USING (sitePK)
+			JOIN data.type USING (typePK)
+			ORDER BY siteID ASC, typeID ASC, time ASC`,
+		restore: `INSERT INTO data.latency_parent(sitePK, typePK, rate_limit, time, mean, min, max, fifty, ninety)
+			SELECT s.sitePK, t.typePK, extract(epoch FROM $3::timestamptz)::bigint / min_interval * min_interval, $3::timestamptz,
+			$4::integer, $5::integer, $6::integer, $7::integer, $8::integer
+			FROM data.site s, data.type t
+			WHERE s.siteID = $1 AND t.typeID = $2
+			AND NOT EXISTS (SELECT 1 FROM data.latency l
+				WHERE l.sitePK = s.sitePK AND l.typePK = t.typePK AND l.time = $3::timestamptz)
+			ON CONFLICT DO NOTHING`,
+	},
+	"data.completeness": {
+		id:      "siteID",
+		columns: []string{"siteID", "typeID", "time", "count"},
+		query: `SELECT siteID, typeID, time, count FROM %s
+			JOIN data.site USING (sitePK)
+			JOIN data.completeness_type USING (typePK)
+			ORDER BY siteID ASC, typeID ASC, time ASC`,
+		restore: `INSERT INTO data.completeness_parent(sitePK, typePK, rate_limit, time, count)
+			SELECT s.sitePK, t.typePK, extract(epoch FROM $3::timestamptz)::bigint / min_interval * min_interval, $3::timestamptz, $4::integer
+			FROM data.site s, data.completeness_type t
+			WHERE s.siteID = $1 AND t.typeID = $2
+			AND NOT EXISTS (SELECT 1 FROM data.completeness c
+				WHERE c.sitePK = s.sitePK AND c.typePK = t.typePK AND c.time = $3::timestamptz)
+			ON CONFLICT DO NOTHING`,
+	},
+	"app.metric": {
+		id:      "applicationID",
+		columns: []string{"applicationID", "instanceID", "typeID", "time", "value"},
+		query: `SELECT applicationID, instanceID, typeID, time, value FROM %s
+			JOIN app.application USING (applicationPK)
+			JOIN app.instance USING (instancePK)
+			JOIN app.type USING (typePK)
+			ORDER BY applicationID ASC, instanceID ASC, typeID ASC, time ASC`,
+		restore: `INSERT INTO app.metric_parent(applicationPK, instancePK, typePK, time, value)
+			SELECT a.applicationPK, i.instancePK, t.typePK, $4::timestamptz, $5::bigint
+			FROM app.application a, app.instance i, app.type t
+			WHERE a.applicationID = $1 AND i.instanceID = $2 AND t.typeID = $3
+			AND NOT EXISTS (SELECT 1 FROM app.metric m
+				WHERE m.applicationPK = a.applicationPK AND m.instancePK = i.instancePK
+				AND m.typePK = t.typePK AND m.time = $4::timestamptz)
+			ON CONFLICT DO NOTHING`,
+	},
+	"app.counter": {
+		id:      "applicationID",
+		columns: []string{"applicationID", "instanceID", "typeID", "time", "count"},
+		query: `SELECT applicationID, instanceID, typeID, time, count FROM %s
+			JOIN app.application USING (applicationPK)
+			JOIN app.instance USING (instancePK)
+			JOIN app.type USING (typePK)
+			ORDER BY applicationID ASC, instanceID ASC, typeID ASC, time ASC`,
+		restore: `INSERT INTO app.counter_parent(applicationPK, instancePK, typePK, time, count)
+			SELECT a.applicationPK, i.instancePK, t.typePK, $4::timestamptz, $5::integer
+			FROM app.application a, app.instance i, app.type t
+			WHERE a.applicationID = $1 AND i.instanceID = $2 AND t.typeID = $3
+			AND NOT EXISTS (SELECT 1 FROM app.counter c
+				WHERE c.applicationPK = a.applicationPK AND c.instancePK = i.instancePK
+				AND c.typePK = t.typePK AND c.time = $4::timestamptz)
+			ON CONFLICT DO NOTHING`,
+	},
+	"app.timer": {
+		id:      "applicationID",
+		columns: []string{"applicationID", "instanceID", "sourceID", "time", "average", "count", "fifty", "ninety"},
+		query: `SELECT applicationID, instanceID, sourceID, time, average, count, fifty, ninety FROM %s
+			JOIN app.application USING (applicationPK)
+			JOIN app.instance USING (instancePK)
+			JOIN app.source USING (sourcePK)
+			ORDER BY applicationID ASC, instanceID ASC, sourceID ASC, time ASC`,
+		restore: `INSERT INTO app.timer_parent(applicationPK, instancePK, sourcePK, time, average, count, fifty, ninety)
+			SELECT a.applicationPK, i.instancePK, s.sourcePK, $4::timestamptz, $5::integer, $6::integer, $7::integer, $8::integer
+			FROM app.application a, app.instance i, app.source s
+			WHERE a.applicationID = $1 AND i.instanceID = $2 AND s.sourceID = $3
+			AND NOT EXISTS (SELECT 1 FROM app.timer tm
+				WHERE tm.applicationPK = a.applicationPK AND tm.instancePK = i.instancePK
+				AND tm.sourcePK = s.sourcePK AND tm.time = $4::timestamptz)
+			ON CONFLICT DO NOTHING`,
+	},
+}
+
+// archiveFile returns the archive file, relative to archiveDir, for partition p e.g., field.metric_20160102 is field/metric_20160102.csv.gz
+func archiveFile(p partition) string {
+	return strings.Replace(p.name, ".", "/", 1) + ".csv.gz"
+}
+
+/*
+archivePartition writes the values in partition p of table to an archive file.  It is called before
+any values are deleted from the partition so the file has all the values for the day.  Existing archive
+files are not overwritten so values added to the partition after it is archived (e.g., by a backfill)
+are not archived.  Does nothing if archiving is disabled.
+*/
+func archivePartition(table string, p partition) error {
+	if archiveDir == "" {
+		return nil
+	}
+
+	a, ok := archiveTables[table]
+	if !ok {
+		return nil
+	}
+
+	f := filepath.Join(archiveDir, filepath.FromSlash(archiveFile(p)))
+
+	if _, err := os.Stat(f); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+		return err
+	}
+
+	// write to a temp file and rename it so an incomplete archive is never seen as done.
+	tmp := f + ".tmp"
+
+	if err := writeArchive(tmp, a, p); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, f)
+}
+
+func writeArchive(file string, a archiveTable, p partition) error {
+	rows, err := db.Query(fmt.Sprintf(a.query, p.name))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	w, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	gz := gzip.NewWriter(w)
+	c := csv.NewWriter(gz)
+
+	if err = c.Write(a.columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(a.columns))
+	dest := make([]interface{}, len(a.columns))
+	for i := range record {
+		dest[i] = &record[i]
+	}
+
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		if err = c.Write(record); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	c.Flush()
+	if err = c.Error(); err != nil {
+		return err
+	}
+
+	if err = gz.Close(); err != nil {
+		return err
+	}
+
+	return w.Sync()
+}
+
+// archiveProto lists the archive files.
+func archiveProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var ar mtrpb.ArchiveResult
+
+	if archiveDir != "" {
+		for _, schema := range []string{"app", "data", "field"} {
+			files, err := filepath.Glob(filepath.Join(archiveDir, schema, "*.csv.gz"))
+			if err != nil {
+				return weft.InternalServerError(err)
+			}
+
+			for _, f := range files {
+				file := schema + "/" + filepath.Base(f)
+
+				table, day, ok := parseArchiveFile(file)
+				if !ok {
+					continue
+				}
+
+				fi, err := os.Stat(f)
+				if err != nil {
+					return weft.InternalServerError(err)
+				}
+
+				ar.Result = append(ar.Result, &mtrpb.Archive{
+					File:    file,
+					Table:   table,
+					Seconds: day.Unix(),
+					Size:    fi.Size(),
+				})
+			}
+		}
+	}
+
+	var by []byte
+	var err error
+	if by, err = proto.Marshal(&ar); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
+
+/*
+archivePut restores the values in an archive file for one device, site, or application (or all of them if
+no ID is given) to the parent of the partitions for the table e.g., field.metric_parent.  Values in the parent
+are read with the table but don't change rollups.  They are deleted archiveRestoreHold after the last restore.
+*/
+func archivePut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	if archiveDir == "" {
+		return weft.BadRequest("archiving is not enabled")
+	}
+
+	v := r.URL.Query()
+	file := v.Get("file")
+
+	table, _, ok := parseArchiveFile(file)
+	if !ok {
+		return weft.BadRequest("invalid file")
+	}
+
+	a, ok := archiveTables[table]
+	if !ok {
+		return weft.BadRequest("invalid file")
+	}
+
+	for _, k := range []string{"deviceID", "siteID", "applicationID"} {
+		if k != a.id && v.Get(k) != "" {
+			return weft.BadRequest(k + " can't be used to restore " + table)
+		}
+	}
+
+	id := v.Get(a.id)
+
+	f, err := os.Open(filepath.Join(archiveDir, filepath.FromSlash(file)))
+	switch {
+	case os.IsNotExist(err):
+		return &weft.NotFound
+	case err != nil:
+		return weft.InternalServerError(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return weft.InternalServerError(err)
+	}
+	defer gz.Close()
+
+	c := csv.NewReader(gz)
+	c.FieldsPerRecord = len(a.columns)
+
+	// the header.
+	if _, err = c.Read(); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	var txn *sql.Tx
+	if txn, err = db.Begin(); err != nil {
+		return weft.InternalServerError(err)
+	}
+	defer txn.Rollback()
+
+	stmt, err := txn.Prepare(a.restore)
+	if err != nil {
+		return weft.InternalServerError(err)
+	}
+	defer stmt.Close()
+
+	args := make([]interface{}, len(a.columns))
+
+	for {
+		record, err := c.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return weft.InternalServerError(err)
+		}
+
+		if id != "" && record[0] != id {
+			continue
+		}
+
+		for i := range record {
+			args[i] = record[i]
+		}
+
+		if _, err = stmt.Exec(args...); err != nil {
+			return weft.InternalServerError(err)
+		}
+	}
+
+	if _, err = txn.Exec(`INSERT INTO mtr.archive_restore(tbl, restored) VALUES($1, now())
+			ON CONFLICT (tbl) DO UPDATE SET restored = EXCLUDED.restored`, table); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	if err = txn.Commit(); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	return &weft.StatusOK
+}
+
+// parseArchiveFile returns the table and day for an archive file relative to archiveDir.
+func parseArchiveFile(file string) (string, time.Time, bool) {
+	m := archiveFileRe.FindStringSubmatch(file)
+	if m == nil {
+		return "", time.Time{}, false
+	}
+
+	day, err := time.Parse("20060102", m[3])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	return m[1] + "." + m[2], day, true
+}
+
+// expireRestored deletes values that were restored from archive files more than archiveRestoreHold ago.
+func expireRestored() (int64, error) {
+	rows, err := db.Query(`SELECT tbl FROM mtr.archive_restore WHERE restored < $1`, time.Now().UTC().Add(-archiveRestoreHold))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var tables []string
+
+	for rows.Next() {
+		var t string
+		if err = rows.Scan(&t); err != nil {
+			return 0, err
+		}
+		tables = append(tables, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+
+	for _, t := range tables {
+		if _, ok := archiveTables[t]; !ok {
+			continue
+		}
+
+		n, err := deleteChunks(`ONLY `+t+`_parent`, `time < $1`, time.Now().UTC())
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+
+		if _, err = db.Exec(`DELETE FROM mtr.archive_restore WHERE tbl = $1`, t); err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
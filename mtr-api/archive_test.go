@@ -0,0 +1,197 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"github.com/GeoNet/mtr/mtrpb"
+	wt "github.com/GeoNet/weft/wefttest"
+	"github.com/golang/protobuf/proto"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseArchiveFile(t *testing.T) {
+	in := []struct {
+		id    string
+		file  string
+		table string
+		ok    bool
+	}{
+		{id: wt.L(), file: "field/metric_20160102.csv.gz", table: "field.metric", ok: true},
+		{id: wt.L(), file: "data/completeness_20160102.csv.gz", table: "data.completeness", ok: true},
+		{id: wt.L(), file: "../field/metric_20160102.csv.gz"},
+		{id: wt.L(), file: "field/metric_2016010.csv.gz"},
+		{id: wt.L(), file: "nope/metric_20160102.csv.gz"},
+		{id: wt.L(), file: "field/metric_20161302.csv.gz"},
+	}
+
+	for _, v := range in {
+		table, day, ok := parseArchiveFile(v.file)
+		if ok != v.ok {
+			t.Errorf("%s expected ok %t got %t", v.id, v.ok, ok)
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		if table != v.table {
+			t.Errorf("%s expected table %s got %s", v.id, v.table, table)
+		}
+
+		if !day.Equal(time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s expected day 2016-01-02 got %s", v.id, day)
+		}
+	}
+}
+
+func TestArchive(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	dir, err := ioutil.TempDir("", "mtr-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archiveDir = dir
+	defer func() { archiveDir = "" }()
+
+	old := time.Now().UTC().Add(time.Hour * -24 * 50).Truncate(time.Minute)
+
+	r := wt.Request{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&value=14000&time=" + old.Format(time.RFC3339), Method: "PUT"}
+	if _, err = r.Do(testServer.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// the partition is archived before it is dropped.
+	if _, err = managePartitions(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := archiveFile(partition{name: partitionName("field.metric", old)})
+
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(gz).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected header and 1 value in the archive got %d rows", len(records))
+	}
+
+	if records[1][0] != "gps-taupoairport" || records[1][1] != "voltage" || records[1][3] != "14000" {
+		t.Errorf("unexpected archived value %v", records[1])
+	}
+
+	var c int
+
+	if err = db.QueryRow(`SELECT count(*) FROM field.metric WHERE time = $1`, old).Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c != 0 {
+		t.Errorf("expected old values to be dropped got %d", c)
+	}
+
+	// the archive file is listed.
+	r = wt.Request{ID: wt.L(), URL: "/archive", Accept: "application/x-protobuf"}
+
+	b, err := r.Do(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ar mtrpb.ArchiveResult
+
+	if err = proto.Unmarshal(b, &ar); err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+
+	for _, v := range ar.Result {
+		if v.File == file {
+			found = true
+
+			if v.Table != "field.metric" {
+				t.Errorf("expected table field.metric got %s", v.Table)
+			}
+
+			if v.Seconds != old.Truncate(time.Hour*24).Unix() {
+				t.Errorf("expected seconds %d got %d", old.Truncate(time.Hour*24).Unix(), v.Seconds)
+			}
+
+			if v.Size == 0 {
+				t.Error("expected non zero size")
+			}
+		}
+	}
+
+	if !found {
+		t.Errorf("expected %s in the archive list", file)
+	}
+
+	// restore the archived values for the device.  Restoring twice doesn't duplicate them.
+	for _, v := range []wt.Request{
+		{ID: wt.L(), URL: "/archive?file=" + file + "&deviceID=gps-taupoairport", Method: "PUT"},
+		{ID: wt.L(), URL: "/archive?file=" + file + "&deviceID=gps-taupoairport", Method: "PUT"},
+		{ID: wt.L(), URL: "/archive?file=" + file + "&siteID=TAUP", Method: "PUT", Status: http.StatusBadRequest},
+		{ID: wt.L(), URL: "/archive?file=field/metric_19700101.csv.gz", Method: "PUT", Status: http.StatusNotFound},
+		{ID: wt.L(), URL: "/archive?file=../metric_19700101.csv.gz", Method: "PUT", Status: http.StatusBadRequest},
+	} {
+		v.User = userW
+		v.Password = keyW
+		if _, err = v.Do(testServer.URL); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = db.QueryRow(`SELECT count(*) FROM field.metric WHERE time = $1`, old).Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c != 1 {
+		t.Errorf("expected 1 restored value got %d", c)
+	}
+
+	// restored values are deleted after archiveRestoreHold.
+	if _, err = db.Exec(`UPDATE mtr.archive_restore SET restored = $1 WHERE tbl = 'field.metric'`,
+		time.Now().UTC().Add(-archiveRestoreHold-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = expireRestored(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.QueryRow(`SELECT count(*) FROM field.metric WHERE time = $1`, old).Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c != 0 {
+		t.Errorf("expected restored values to be deleted got %d", c)
+	}
+}
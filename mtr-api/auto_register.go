@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+)
+
+// unknownModel is the field.model for devices that are auto registered.
+const unknownModel = "unknown"
+
+// execer is satisfied by *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+/*
+registerDevice creates deviceID in field.device if it doesn't exist and typeID is in field.type.
+The device is pending with the unknown model and location (0,0) until it is confirmed with PUT /field/device.
+The unknown model is created as needed.  Only used when autoRegister is true.
+Concurrent requests can register the same model or device so conflicts are ignored and the device
+is always inserted after the model.
+*/
+func registerDevice(e execer, deviceID, typeID string) error {
+	if _, err := e.Exec(`INSERT INTO field.model(modelID)
+				SELECT $1
+				WHERE NOT EXISTS (SELECT 1 FROM field.model WHERE modelID = $1)
+				AND NOT EXISTS (SELECT 1 FROM field.device WHERE deviceID = $2)
+				AND EXISTS (SELECT 1 FROM field.type WHERE typeID = $3)
+				ON CONFLICT (modelID) DO NOTHING`,
+		unknownModel, deviceID, typeID); err != nil {
+		return err
+	}
+
+	_, err := e.Exec(`INSERT INTO field.device(deviceID, modelPK, latitude, longitude, pending)
+				SELECT $1, modelPK, 0, 0, true
+				FROM field.model
+				WHERE modelID = $2
+				AND NOT EXISTS (SELECT 1 FROM field.device WHERE deviceID = $1)
+				AND EXISTS (SELECT 1 FROM field.type WHERE typeID = $3)
+				ON CONFLICT (deviceID) DO NOTHING`,
+		deviceID, unknownModel, typeID)
+
+	return err
+}
+
+/*
+registerSite creates siteID in data.site if it doesn't exist and typeID is in typeTable.
+The site is pending with an unknown location (0,0) until it is confirmed with PUT /data/site.
+Only used when autoRegister is true.
+*/
+func registerSite(e execer, siteID, typeTable, typeID string) error {
+	_, err := e.Exec(`INSERT INTO data.site(siteID, latitude, longitude, pending)
+				SELECT $1, 0, 0, true
+				WHERE NOT EXISTS (SELECT 1 FROM data.site WHERE siteID = $1)
+				AND EXISTS (SELECT 1 FROM `+typeTable+` WHERE typeID = $2)`,
+		siteID, typeID)
+
+	return err
+}
+
+// isUniqueViolation returns true if err is from a concurrent insert of the same row.
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == errorUniqueViolation
+}
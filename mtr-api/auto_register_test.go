@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	wt "github.com/GeoNet/weft/wefttest"
+	"github.com/golang/protobuf/proto"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestAutoRegister(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	autoRegister = true
+	defer func() { autoRegister = false }()
+
+	put := wt.Requests{
+		{ID: wt.L(), URL: "/field/device?deviceID=gps-pending", Method: "DELETE"},
+		{ID: wt.L(), URL: "/data/site?siteID=PEND", Method: "DELETE"},
+
+		// unknown device and site are registered as pending
+		{ID: wt.L(), URL: "/field/metric?deviceID=gps-pending&typeID=voltage&time=2015-05-14T21:40:30Z&value=14100", Method: "PUT"},
+		{ID: wt.L(), URL: "/data/latency?siteID=PEND&typeID=latency.strong&time=2015-05-14T21:40:30Z&mean=10000", Method: "PUT"},
+
+		// not registered for an unknown type
+		{ID: wt.L(), URL: "/field/metric?deviceID=gps-pending-no-type&typeID=NOT_THERE&time=2015-05-14T21:40:30Z&value=14100", Method: "PUT", Status: http.StatusBadRequest},
+	}
+
+	for i := range put {
+		put[i].User = userW
+		put[i].Password = keyW
+
+		if _, err := put[i].Do(testServer.URL); err != nil {
+			t.Error(err)
+		}
+	}
+
+	r := wt.Request{ID: wt.L(), URL: "/field/device/pending", Accept: "application/x-protobuf"}
+
+	var b []byte
+	var err error
+
+	if b, err = r.Do(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	var fdr mtrpb.FieldDeviceResult
+
+	if err = proto.Unmarshal(b, &fdr); err != nil {
+		t.Error(err)
+	}
+
+	if len(fdr.Result) != 1 {
+		t.Fatalf("expected 1 pending device got %d", len(fdr.Result))
+	}
+
+	if fdr.Result[0].DeviceID != "gps-pending" {
+		t.Errorf("expected gps-pending got %s", fdr.Result[0].DeviceID)
+	}
+
+	if fdr.Result[0].ModelID != unknownModel {
+		t.Errorf("expected %s got %s", unknownModel, fdr.Result[0].ModelID)
+	}
+
+	if !fdr.Result[0].Pending {
+		t.Error("expected device to be pending")
+	}
+
+	r = wt.Request{ID: wt.L(), URL: "/data/site/pending", Accept: "application/x-protobuf"}
+
+	if b, err = r.Do(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	var dsr mtrpb.DataSiteResult
+
+	if err = proto.Unmarshal(b, &dsr); err != nil {
+		t.Error(err)
+	}
+
+	if len(dsr.Result) != 1 {
+		t.Fatalf("expected 1 pending site got %d", len(dsr.Result))
+	}
+
+	if dsr.Result[0].SiteID != "PEND" {
+		t.Errorf("expected PEND got %s", dsr.Result[0].SiteID)
+	}
+
+	// confirm the device and site.
+	confirm := wt.Requests{
+		{ID: wt.L(), URL: "/field/device?deviceID=gps-pending&modelID=Trimble+NetR9&latitude=-38.74270&longitude=176.08100", Method: "PUT"},
+		{ID: wt.L(), URL: "/data/site?siteID=PEND&latitude=-38.74270&longitude=176.08100", Method: "PUT"},
+	}
+
+	for i := range confirm {
+		confirm[i].User = userW
+		confirm[i].Password = keyW
+
+		if _, err := confirm[i].Do(testServer.URL); err != nil {
+			t.Error(err)
+		}
+	}
+
+	r = wt.Request{ID: wt.L(), URL: "/field/device/pending", Accept: "application/x-protobuf"}
+
+	if b, err = r.Do(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	fdr.Reset()
+
+	if err = proto.Unmarshal(b, &fdr); err != nil {
+		t.Error(err)
+	}
+
+	if len(fdr.Result) != 0 {
+		t.Errorf("expected 0 pending devices got %d", len(fdr.Result))
+	}
+
+	r = wt.Request{ID: wt.L(), URL: "/data/site/pending", Accept: "application/x-protobuf"}
+
+	if b, err = r.Do(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	dsr.Reset()
+
+	if err = proto.Unmarshal(b, &dsr); err != nil {
+		t.Error(err)
+	}
+
+	if len(dsr.Result) != 0 {
+		t.Errorf("expected 0 pending sites got %d", len(dsr.Result))
+	}
+
+	// clean up so the other tests have the expected devices, sites, and models.
+	del := wt.Requests{
+		{ID: wt.L(), URL: "/field/device?deviceID=gps-pending", Method: "DELETE"},
+		{ID: wt.L(), URL: "/data/site?siteID=PEND", Method: "DELETE"},
+		{ID: wt.L(), URL: "/field/model?modelID=" + unknownModel, Method: "DELETE"},
+	}
+
+	for i := range del {
+		del[i].User = userW
+		del[i].Password = keyW
+
+		if _, err := del[i].Do(testServer.URL); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// TestAutoRegisterConcurrent sends the first metric for new devices at the same time so that
+// the unknown model is registered concurrently.  All the metrics should be saved.
+func TestAutoRegisterConcurrent(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	autoRegister = true
+	defer func() { autoRegister = false }()
+
+	// no unknown model to start with.
+	if _, err := db.Exec(`DELETE FROM field.model WHERE modelID = $1`, unknownModel); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			r := wt.Request{ID: wt.L(), URL: fmt.Sprintf("/field/metric?deviceID=gps-concurrent-%d&typeID=voltage&time=2015-05-14T21:40:30Z&value=14100", i),
+				Method: "PUT", User: userW, Password: keyW}
+
+			if _, err := r.Do(testServer.URL); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	var c int
+
+	if err := db.QueryRow(`SELECT count(*) FROM field.metric
+				JOIN field.device USING (devicePK)
+				WHERE deviceID LIKE 'gps-concurrent-%'`).Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c != n {
+		t.Errorf("expected %d metrics got %d", n, c)
+	}
+
+	// clean up so the other tests have the expected devices and models.
+	if _, err := db.Exec(`DELETE FROM field.model WHERE modelID = $1`, unknownModel); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,645 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/weft"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxParams keeps multi row inserts below the Postgres limit on bind parameters.
+const maxParams = 60000
+
+// dataBatchValue is a single value from a data batch request.
+// values are the columns after sitePK, typePK, rate_limit, and time.
+type dataBatchValue struct {
+	siteID, typeID string
+	seconds        int64
+	values         []interface{}
+}
+
+// valid returns an error if any of the float values in v are NaN or Inf.  The same values are
+// valid as for dataLatencyPut.
+func (v dataBatchValue) valid() error {
+	for _, f := range v.values {
+		if d, ok := f.(float64); ok {
+			if err := validValue(d); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// dataBatchTable describes the tables a data batch is saved to.
+type dataBatchTable struct {
+	table, summary, typeTable string
+	columns                   []string
+	columnType                string // the type of columns e.g., integer
+}
+
+var dataLatencyBatchTable = dataBatchTable{
+	table:      "data.latency",
+	summary:    "data.latency_summary",
+	typeTable:  "data.type",
+	columns:    []string{"mean", "min", "max", "fifty", "ninety"},
+	columnType: "float8",
+}
+
+var dataCompletenessBatchTable = dataBatchTable{
+	table:      "data.completeness",
+	summary:    "data.completeness_summary",
+	typeTable:  "data.completeness_type",
+	columns:    []string{"count"},
+	columnType: "integer",
+}
+
+type dataBatchKey struct {
+	sitePK, typePK int
+	rateLimit      int64
+}
+
+type batchType struct {
+	typePK      int
+	minInterval int64
+}
+
+type sitePKTypePK struct {
+	sitePK, typePK int
+}
+
+/*
+dataLatencyBatchPost saves the values in a protobuf mtrpb.DataLatencyBatch sent as the request body.
+The status of each value is returned in a mtrpb.DataBatchResult in the same order as the request.
+*/
+func dataLatencyBatchPost(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var req mtrpb.DataLatencyBatch
+
+	if res := readBatch(r, &req); !res.Ok {
+		return res
+	}
+
+	in := make([]dataBatchValue, len(req.Value))
+
+	for i, v := range req.Value {
+		in[i] = dataBatchValue{
+			siteID:  v.SiteID,
+			typeID:  v.TypeID,
+			seconds: v.Seconds,
+			values:  latencyBatchValues(v),
+		}
+	}
+
+	return saveDataBatch(in, backfill(r), storage.dataLatencyBatchSave, h, b)
+}
+
+// latencyBatchValues returns the values for v.  The doubles are used if Doubles is set or any of them
+// are not 0, otherwise the integers from older clients.
+func latencyBatchValues(v *mtrpb.DataLatencyBatchValue) []interface{} {
+	if v.Doubles || v.MeanDouble != 0 || v.MinDouble != 0 || v.MaxDouble != 0 || v.FiftyDouble != 0 || v.NinetyDouble != 0 {
+		return []interface{}{v.MeanDouble, v.MinDouble, v.MaxDouble, v.FiftyDouble, v.NinetyDouble}
+	}
+
+	return []interface{}{float64(v.Mean), float64(v.Min), float64(v.Max), float64(v.Fifty), float64(v.Ninety)}
+}
+
+/*
+dataCompletenessBatchPost saves the values in a protobuf mtrpb.DataCompletenessBatch sent as the request body.
+The status of each value is returned in a mtrpb.DataBatchResult in the same order as the request.
+*/
+func dataCompletenessBatchPost(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var req mtrpb.DataCompletenessBatch
+
+	if res := readBatch(r, &req); !res.Ok {
+		return res
+	}
+
+	in := make([]dataBatchValue, len(req.Value))
+
+	for i, v := range req.Value {
+		in[i] = dataBatchValue{
+			siteID:  v.SiteID,
+			typeID:  v.TypeID,
+			seconds: v.Seconds,
+			values:  []interface{}{v.Count},
+		}
+	}
+
+	return saveDataBatch(in, backfill(r), storage.dataCompletenessBatchSave, h, b)
+}
+
+/*
+saveDataBatch saves the values from in with save.  The result for each value is written to b
+as a protobuf mtrpb.DataBatchResult.  NaN or Inf values get 400 and are not passed to save.
+*/
+func saveDataBatch(in []dataBatchValue, backfill bool, save func([]dataBatchValue, bool) ([]*mtrpb.BatchStatus, error),
+	h http.Header, b *bytes.Buffer) *weft.Result {
+	if len(in) > maxBatch {
+		return weft.BadRequest("too many values in batch")
+	}
+
+	result := mtrpb.DataBatchResult{Result: make([]*mtrpb.BatchStatus, len(in))}
+	var valid []dataBatchValue
+	var index []int // the index in in for each value in valid
+
+	for i, v := range in {
+		if err := v.valid(); err != nil {
+			result.Result[i] = &mtrpb.BatchStatus{Code: http.StatusBadRequest, Msg: "invalid value"}
+			continue
+		}
+
+		valid = append(valid, v)
+		index = append(index, i)
+	}
+
+	status, err := save(valid, backfill)
+	if err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	for j, i := range index {
+		result.Result[i] = status[j]
+	}
+
+	return writeBatchResult(&result, h, b)
+}
+
+/*
+save saves in to d using multi row inserts in a single transaction and updates the summary
+table with the newest value for each site and type.  The status for each value is returned in the same order as in.
+Unknown sites or types get 400 and values that already
+have data for the interval (in the database or earlier in the batch) get 429.  If backfill is true
+the values must be in time order for each site and type and values that are already saved
+with the same time and values get 200, see backfill.
+*/
+func (d dataBatchTable) save(in []dataBatchValue, backfill bool) ([]*mtrpb.BatchStatus, error) {
+	var err error
+	var txn *sql.Tx
+
+	if txn, err = db.Begin(); err != nil {
+		return nil, err
+	}
+
+	var sites map[string]int
+	var types map[string]batchType
+
+	siteIDs := make([]string, len(in))
+	typeIDs := make([]string, len(in))
+	for i := range in {
+		siteIDs[i] = in[i].siteID
+		typeIDs[i] = in[i].typeID
+	}
+
+	if sites, err = pkMap(txn, "data.site", "siteID", "sitePK", siteIDs); err != nil {
+		txn.Rollback()
+		return nil, err
+	}
+
+	if types, err = typeMap(txn, d.typeTable, typeIDs); err != nil {
+		txn.Rollback()
+		return nil, err
+	}
+
+	if autoRegister {
+		if sites, err = d.register(txn, in, sites, types); err != nil {
+			txn.Rollback()
+			return nil, err
+		}
+	}
+
+	result := make([]*mtrpb.BatchStatus, len(in))
+	keys := make([]dataBatchKey, len(in))
+	seen := make(map[dataBatchKey]int) // index of the first value for the key
+	last := make(map[sitePKTypePK]int64)
+	dup := make(map[int]int) // backfill values repeated in the batch and the index of the first value
+	var rows []int
+
+	for i, v := range in {
+		sitePK, okS := sites[v.siteID]
+		typ, okT := types[v.typeID]
+
+		if !okS || !okT {
+			result[i] = &mtrpb.BatchStatus{Code: http.StatusBadRequest, Msg: "Didn't create row, check your query parameters exist"}
+			continue
+		}
+
+		if backfill {
+			k := sitePKTypePK{sitePK: sitePK, typePK: typ.typePK}
+			if l, ok := last[k]; ok && v.seconds < l {
+				result[i] = &mtrpb.BatchStatus{Code: int32(statusNotInOrder.Code), Msg: statusNotInOrder.Msg}
+				continue
+			}
+			last[k] = v.seconds
+		}
+
+		keys[i] = dataBatchKey{
+			sitePK:    sitePK,
+			typePK:    typ.typePK,
+			rateLimit: v.seconds / typ.minInterval * typ.minInterval,
+		}
+
+		if j, ok := seen[keys[i]]; ok {
+			if backfill && v.seconds == in[j].seconds && sameValues(v.values, in[j].values) {
+				dup[i] = j
+				continue
+			}
+			result[i] = &mtrpb.BatchStatus{Code: int32(statusTooManyRequests.Code), Msg: statusTooManyRequests.Msg}
+			continue
+		}
+
+		seen[keys[i]] = i
+		rows = append(rows, i)
+	}
+
+	var inserted map[dataBatchKey]bool
+
+	if inserted, err = d.insert(txn, in, keys, rows); err != nil {
+		txn.Rollback()
+		return nil, err
+	}
+
+	var saved map[dataBatchKey]bool
+
+	if backfill {
+		var notInserted []int
+		for _, i := range rows {
+			if !inserted[keys[i]] {
+				notInserted = append(notInserted, i)
+			}
+		}
+
+		if saved, err = d.duplicates(txn, in, keys, notInserted); err != nil {
+			txn.Rollback()
+			return nil, err
+		}
+	}
+
+	latest := make(map[sitePKTypePK]int)
+
+	for _, i := range rows {
+		if !inserted[keys[i]] {
+			if saved[keys[i]] {
+				result[i] = &mtrpb.BatchStatus{Code: http.StatusOK}
+				continue
+			}
+			result[i] = &mtrpb.BatchStatus{Code: int32(statusTooManyRequests.Code), Msg: statusTooManyRequests.Msg}
+			continue
+		}
+
+		result[i] = &mtrpb.BatchStatus{Code: http.StatusOK}
+
+		k := sitePKTypePK{sitePK: keys[i].sitePK, typePK: keys[i].typePK}
+		if l, ok := latest[k]; !ok || in[i].seconds > in[l].seconds {
+			latest[k] = i
+		}
+	}
+
+	for i, j := range dup {
+		result[i] = result[j]
+	}
+
+	var summary []int
+	for _, i := range latest {
+		summary = append(summary, i)
+	}
+
+	if err = d.updateSummary(txn, in, keys, summary); err != nil {
+		txn.Rollback()
+		return nil, err
+	}
+
+	if err = txn.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// register creates pending sites for siteIDs in that are not in sites and have a known type.
+// Returns sites updated with the new sites.
+func (d dataBatchTable) register(txn *sql.Tx, in []dataBatchValue, sites map[string]int, types map[string]batchType) (map[string]int, error) {
+	var siteIDs []string
+	u := make(map[string]bool)
+
+	for _, v := range in {
+		if _, ok := sites[v.siteID]; ok || u[v.siteID] || v.siteID == "" {
+			continue
+		}
+
+		if _, ok := types[v.typeID]; !ok {
+			continue
+		}
+
+		if err := registerSite(txn, v.siteID, d.typeTable, v.typeID); err != nil {
+			return nil, err
+		}
+
+		u[v.siteID] = true
+		siteIDs = append(siteIDs, v.siteID)
+	}
+
+	if len(siteIDs) == 0 {
+		return sites, nil
+	}
+
+	n, err := pkMap(txn, "data.site", "siteID", "sitePK", siteIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range n {
+		sites[k] = v
+	}
+
+	return sites, nil
+}
+
+// insert saves the rows from in to d.table.  Returns the keys for the rows that were
+// inserted.  Rows that are not inserted already have data for the interval.
+// d.table is partitioned so the rows are inserted to the partition for their day
+// which supports ON CONFLICT (the view for d.table doesn't).
+func (d dataBatchTable) insert(txn *sql.Tx, in []dataBatchValue, keys []dataBatchKey, rows []int) (map[dataBatchKey]bool, error) {
+	inserted := make(map[dataBatchKey]bool)
+
+	cols := 4 + len(d.columns)
+	chunk := maxParams / cols
+
+	var names []string
+	byName := make(map[string][]int)
+
+	for _, i := range rows {
+		p := partitionName(d.table, time.Unix(in[i].seconds, 0))
+		if _, ok := byName[p]; !ok {
+			if err := createPartition(txn, d.table, time.Unix(in[i].seconds, 0)); err != nil {
+				return nil, err
+			}
+			names = append(names, p)
+		}
+		byName[p] = append(byName[p], i)
+	}
+
+	for _, p := range names {
+		rows := byName[p]
+
+		for len(rows) > 0 {
+			n := len(rows)
+			if n > chunk {
+				n = chunk
+			}
+
+			var args []interface{}
+			var values []string
+
+			for _, i := range rows[:n] {
+				values = append(values, placeholders(len(args), cols))
+				args = append(args, keys[i].sitePK, keys[i].typePK, keys[i].rateLimit, time.Unix(in[i].seconds, 0).UTC())
+				args = append(args, in[i].values...)
+			}
+
+			q := fmt.Sprintf(`INSERT INTO %s(sitePK, typePK, rate_limit, time, %s) VALUES %s
+				ON CONFLICT DO NOTHING
+				RETURNING sitePK, typePK, rate_limit`,
+				p, strings.Join(d.columns, ", "), strings.Join(values, ", "))
+
+			rs, err := txn.Query(q, args...)
+			if err != nil {
+				return nil, err
+			}
+
+			for rs.Next() {
+				var k dataBatchKey
+				if err = rs.Scan(&k.sitePK, &k.typePK, &k.rateLimit); err != nil {
+					rs.Close()
+					return nil, err
+				}
+				inserted[k] = true
+			}
+			rs.Close()
+
+			if err = rs.Err(); err != nil {
+				return nil, err
+			}
+
+			rows = rows[n:]
+		}
+	}
+
+	return inserted, nil
+}
+
+// duplicates returns the keys for the rows from in that are already in d.table with the same time and values.
+func (d dataBatchTable) duplicates(txn *sql.Tx, in []dataBatchValue, keys []dataBatchKey, rows []int) (map[dataBatchKey]bool, error) {
+	saved := make(map[dataBatchKey]bool)
+
+	cols := 4 + len(d.columns)
+	chunk := maxParams / cols
+
+	casts := []string{"integer", "integer", "bigint", "timestamptz"}
+	on := []string{"t.sitePK = v.sitePK", "t.typePK = v.typePK", "t.rate_limit = v.rate_limit", "t.time = v.time"}
+	for _, c := range d.columns {
+		casts = append(casts, d.columnType)
+		on = append(on, "t."+c+" = v."+c)
+	}
+
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > chunk {
+			n = chunk
+		}
+
+		var args []interface{}
+		var values []string
+
+		for _, i := range rows[:n] {
+			values = append(values, castPlaceholders(len(args), casts))
+			args = append(args, keys[i].sitePK, keys[i].typePK, keys[i].rateLimit, time.Unix(in[i].seconds, 0).UTC())
+			args = append(args, in[i].values...)
+		}
+
+		q := fmt.Sprintf(`SELECT t.sitePK, t.typePK, t.rate_limit FROM %s t
+				JOIN (VALUES %s) AS v(sitePK, typePK, rate_limit, time, %s)
+				ON %s`,
+			d.table, strings.Join(values, ", "), strings.Join(d.columns, ", "), strings.Join(on, " AND "))
+
+		rs, err := txn.Query(q, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rs.Next() {
+			var k dataBatchKey
+			if err = rs.Scan(&k.sitePK, &k.typePK, &k.rateLimit); err != nil {
+				rs.Close()
+				return nil, err
+			}
+			saved[k] = true
+		}
+		rs.Close()
+
+		if err = rs.Err(); err != nil {
+			return nil, err
+		}
+
+		rows = rows[n:]
+	}
+
+	return saved, nil
+}
+
+// updateSummary updates d.summary with rows from in if they are newer than the current summary.
+// rows should have only one value for each site and type.
+func (d dataBatchTable) updateSummary(txn *sql.Tx, in []dataBatchValue, keys []dataBatchKey, rows []int) error {
+	cols := 3 + len(d.columns)
+	chunk := maxParams / cols
+
+	var set []string
+	for _, c := range append([]string{"time"}, d.columns...) {
+		set = append(set, c+" = EXCLUDED."+c)
+	}
+
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > chunk {
+			n = chunk
+		}
+
+		var args []interface{}
+		var values []string
+
+		for _, i := range rows[:n] {
+			values = append(values, placeholders(len(args), cols))
+			args = append(args, keys[i].sitePK, keys[i].typePK, time.Unix(in[i].seconds, 0).UTC())
+			args = append(args, in[i].values...)
+		}
+
+		q := fmt.Sprintf(`INSERT INTO %s AS s(sitePK, typePK, time, %s) VALUES %s
+				ON CONFLICT (sitePK, typePK) DO UPDATE SET %s
+				WHERE s.time < EXCLUDED.time`,
+			d.summary, strings.Join(d.columns, ", "), strings.Join(values, ", "), strings.Join(set, ", "))
+
+		if _, err := txn.Exec(q, args...); err != nil {
+			return err
+		}
+
+		rows = rows[n:]
+	}
+
+	return nil
+}
+
+// pkMap returns a map of ID to PK from table for the ids.
+func pkMap(txn *sql.Tx, table, idCol, pkCol string, ids []string) (map[string]int, error) {
+	m := make(map[string]int)
+
+	args := unique(ids)
+	if len(args) == 0 {
+		return m, nil
+	}
+
+	rows, err := txn.Query(fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s IN %s`,
+		idCol, pkCol, table, idCol, placeholders(0, len(args))), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var pk int
+
+		if err = rows.Scan(&id, &pk); err != nil {
+			return nil, err
+		}
+
+		m[id] = pk
+	}
+
+	return m, rows.Err()
+}
+
+// typeMap returns a map of typeID to the PK and min_interval from table for the ids.
+func typeMap(txn *sql.Tx, table string, ids []string) (map[string]batchType, error) {
+	m := make(map[string]batchType)
+
+	args := unique(ids)
+	if len(args) == 0 {
+		return m, nil
+	}
+
+	rows, err := txn.Query(fmt.Sprintf(`SELECT typeID, typePK, min_interval FROM %s WHERE typeID IN %s`,
+		table, placeholders(0, len(args))), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var t batchType
+
+		if err = rows.Scan(&id, &t.typePK, &t.minInterval); err != nil {
+			return nil, err
+		}
+
+		m[id] = t
+	}
+
+	return m, rows.Err()
+}
+
+// unique returns the non empty unique values from ids as query args.
+func unique(ids []string) []interface{} {
+	var args []interface{}
+	u := make(map[string]bool)
+
+	for _, id := range ids {
+		if id == "" || u[id] {
+			continue
+		}
+		u[id] = true
+		args = append(args, id)
+	}
+
+	return args
+}
+
+// castPlaceholders is like placeholders with a type cast for each parameter e.g., ($3::integer, $4::bigint).
+// Parameters in a VALUES list need a type.
+func castPlaceholders(offset int, casts []string) string {
+	p := make([]string, len(casts))
+	for i := range p {
+		p[i] = fmt.Sprintf("$%d::%s", offset+i+1, casts[i])
+	}
+
+	return "(" + strings.Join(p, ", ") + ")"
+}
+
+// sameValues returns true if a and b have equal values.
+func sameValues(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// placeholders returns a list of n bind parameters e.g., ($3, $4, $5) starting after offset.
+func placeholders(offset, n int) string {
+	p := make([]string, n)
+	for i := range p {
+		p[i] = fmt.Sprintf("$%d", offset+i+1)
+	}
+
+	return "(" + strings.Join(p, ", ") + ")"
+}
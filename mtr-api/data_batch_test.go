@@ -0,0 +1,222 @@
+package main
+
+import (
+	"github.com/GeoNet/mtr/mtrpb"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func checkBatchResult(r []*mtrpb.BatchStatus, expected []int32, t *testing.T) {
+	if len(r) != len(expected) {
+		t.Fatalf("expected %d results got %d", len(expected), len(r))
+	}
+
+	for i := range expected {
+		if r[i].Code != expected[i] {
+			t.Errorf("value %d expected code %d got %d", i, expected[i], r[i].Code)
+		}
+	}
+}
+
+func TestDataLatencyBatch(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	b := mtrpb.DataLatencyBatch{
+		Value: []*mtrpb.DataLatencyBatchValue{
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: now.Add(time.Minute * -2).Unix(), Mean: 1000, Min: 10, Max: 2000, Fifty: 900, Ninety: 1800},
+			{SiteID: "WGTN", TypeID: "latency.strong", Seconds: now.Add(time.Minute * -1).Unix(), Mean: 1100},
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: now.Add(time.Minute * -1).Unix(), Mean: 1200},
+			// same minute as the value before.
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: now.Add(time.Second * -30).Unix(), Mean: 1300},
+			// already in the db from routes.
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: time.Date(2015, 5, 14, 21, 40, 10, 0, time.UTC).Unix(), Mean: 1400},
+			{SiteID: "NOT_THERE", TypeID: "latency.strong", Seconds: now.Unix(), Mean: 1500},
+			{SiteID: "TAUP", TypeID: "NOT_THERE", Seconds: now.Unix(), Mean: 1600},
+			// invalid values are rejected the same as for dataLatencyPut.
+			{SiteID: "WGTN", TypeID: "latency.strong", Seconds: now.Unix(), MeanDouble: math.NaN()},
+			{SiteID: "WGTN", TypeID: "latency.strong", Seconds: now.Unix(), MeanDouble: 10, NinetyDouble: math.Inf(-1)},
+		},
+	}
+
+	var r mtrpb.DataBatchResult
+
+	postBatch("/data/latency/batch", &b, &r, t)
+
+	checkBatchResult(r.Result, []int32{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests,
+		http.StatusTooManyRequests, http.StatusBadRequest, http.StatusBadRequest, http.StatusBadRequest, http.StatusBadRequest}, t)
+
+	// The summary should have the newest value.
+	var mean float64
+	var tm time.Time
+
+	if err := db.QueryRow(`SELECT time, mean FROM data.latency_summary
+				JOIN data.site USING (sitepk)
+				JOIN data.type USING (typepk)
+				WHERE siteID = 'TAUP' AND typeID = 'latency.strong'`).Scan(&tm, &mean); err != nil {
+		t.Fatal(err)
+	}
+
+	if mean != 1200 {
+		t.Errorf("expected summary mean 1200 got %g", mean)
+	}
+
+	if !tm.Equal(now.Add(time.Minute * -1)) {
+		t.Errorf("expected summary time %s got %s", now.Add(time.Minute*-1), tm)
+	}
+}
+
+func TestDataCompletenessBatch(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	b := mtrpb.DataCompletenessBatch{
+		Value: []*mtrpb.DataCompletenessBatchValue{
+			{SiteID: "TAUP", TypeID: "completeness.gnss.1hz", Seconds: now.Add(time.Minute * -5).Unix(), Count: 300},
+			{SiteID: "TAUP", TypeID: "completeness.gnss.1hz", Seconds: now.Add(time.Minute * -5).Unix(), Count: 299},
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: now.Unix(), Count: 300},
+		},
+	}
+
+	var r mtrpb.DataBatchResult
+
+	postBatch("/data/completeness/batch", &b, &r, t)
+
+	checkBatchResult(r.Result, []int32{http.StatusOK, http.StatusTooManyRequests, http.StatusBadRequest}, t)
+}
+
+func TestDataLatencyBackfill(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	b := mtrpb.DataLatencyBatch{
+		Value: []*mtrpb.DataLatencyBatchValue{
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: now.Add(time.Minute * -1).Unix(), Mean: 1200},
+		},
+	}
+
+	var r mtrpb.DataBatchResult
+
+	postBatch("/data/latency/batch", &b, &r, t)
+
+	checkBatchResult(r.Result, []int32{http.StatusOK}, t)
+
+	b = mtrpb.DataLatencyBatch{
+		Value: []*mtrpb.DataLatencyBatchValue{
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: now.Add(time.Minute * -10).Unix(), Mean: 1000},
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: now.Add(time.Minute * -9).Unix(), Mean: 1100, Fifty: 1000},
+			// resent value in the same batch.
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: now.Add(time.Minute * -9).Unix(), Mean: 1100, Fifty: 1000},
+			// different value for the interval.
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: now.Add(time.Minute * -9).Unix(), Mean: 1150},
+			// out of order.
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: now.Add(time.Minute * -20).Unix(), Mean: 1300},
+			// already saved.
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: now.Add(time.Minute * -1).Unix(), Mean: 1200},
+			// different value to the one already saved.
+			{SiteID: "TAUP", TypeID: "latency.strong", Seconds: now.Add(time.Minute * -1).Unix(), Mean: 1250},
+		},
+	}
+
+	r.Reset()
+
+	postBatch("/data/latency/batch?backfill=true", &b, &r, t)
+
+	checkBatchResult(r.Result, []int32{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests,
+		http.StatusBadRequest, http.StatusOK, http.StatusTooManyRequests}, t)
+
+	// The summary should not be changed by old values.
+	var mean float64
+	var tm time.Time
+
+	if err := db.QueryRow(`SELECT time, mean FROM data.latency_summary
+				JOIN data.site USING (sitepk)
+				JOIN data.type USING (typepk)
+				WHERE siteID = 'TAUP' AND typeID = 'latency.strong'`).Scan(&tm, &mean); err != nil {
+		t.Fatal(err)
+	}
+
+	if mean != 1200 || !tm.Equal(now.Add(time.Minute*-1)) {
+		t.Errorf("expected summary mean 1200 at %s got %g at %s", now.Add(time.Minute*-1), mean, tm)
+	}
+}
+
+func TestLatencyBatchValues(t *testing.T) {
+	in := []struct {
+		v        mtrpb.DataLatencyBatchValue
+		expected []float64
+	}{
+		// a zero mean with the doubles flag set.
+		{mtrpb.DataLatencyBatchValue{Doubles: true, MinDouble: 0, MaxDouble: 0.25, FiftyDouble: 0, NinetyDouble: 0.1},
+			[]float64{0.0, 0.0, 0.25, 0.0, 0.1}},
+		// all zero doubles with the flag set.
+		{mtrpb.DataLatencyBatchValue{Doubles: true, Mean: 10},
+			[]float64{0.0, 0.0, 0.0, 0.0, 0.0}},
+		// a zero mean from a client that doesn't set the flag.
+		{mtrpb.DataLatencyBatchValue{MinDouble: 0.5},
+			[]float64{0.0, 0.5, 0.0, 0.0, 0.0}},
+		// integers from older clients.
+		{mtrpb.DataLatencyBatchValue{Mean: 1000, Min: 10, Max: 2000, Fifty: 900, Ninety: 1800},
+			[]float64{1000, 10, 2000, 900, 1800}},
+	}
+
+	for i, v := range in {
+		r := latencyBatchValues(&v.v)
+
+		if len(r) != len(v.expected) {
+			t.Errorf("%d expected %d values got %d", i, len(v.expected), len(r))
+			continue
+		}
+
+		for j := range r {
+			if f, ok := r[j].(float64); !ok || f != v.expected[j] {
+				t.Errorf("%d value %d expected %v got %v", i, j, v.expected[j], r[j])
+			}
+		}
+	}
+}
+
+func TestDataBatchValueValid(t *testing.T) {
+	for _, v := range []dataBatchValue{
+		{values: []interface{}{math.NaN(), 0.0, 0.0, 0.0, 0.0}},
+		{values: []interface{}{1.0, 0.0, math.Inf(1), 0.0, 0.0}},
+		{values: []interface{}{1.0, 0.0, 0.0, 0.0, math.Inf(-1)}},
+	} {
+		if err := v.valid(); err == nil {
+			t.Errorf("expected error for %v", v.values)
+		}
+	}
+
+	for _, v := range []dataBatchValue{
+		{values: []interface{}{0.0, 0.0, 0.0, 0.0, 0.0}},
+		{values: []interface{}{1.5, -1.0, 2.0, 1.0, 1.9}},
+		{values: []interface{}{int32(10)}},
+	} {
+		if err := v.valid(); err != nil {
+			t.Errorf("unexpected error for %v: %s", v.values, err)
+		}
+	}
+}
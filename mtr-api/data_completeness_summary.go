@@ -2,67 +2,30 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"fmt"
-	"github.com/GeoNet/map180"
 	"github.com/GeoNet/mtr/mtrpb"
 	"github.com/GeoNet/weft"
 	"github.com/golang/protobuf/proto"
-	"math"
 	"net/http"
-	"strconv"
 	"time"
 )
 
 func dataCompletenessSummaryProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	typeID := r.URL.Query().Get("typeID")
-
-	var err error
-	var rows *sql.Rows
-	var expected int
-
-	switch typeID {
-	case "":
-		rows, err = dbR.Query(`SELECT siteID, typeID, count, expected
-		FROM data.completeness_summary
-		JOIN data.site USING (sitePK)
-		JOIN data.completeness_type USING (typePK)`)
+	summaries, err := storage.dataCompletenessSummaries(r.URL.Query().Get("typeID"))
+	switch err {
+	case nil:
+	case errNotFound:
+		return &weft.NotFound
 	default:
-		var typePK int
-		if err = dbR.QueryRow(`SELECT typePK FROM data.completeness_type WHERE typeID = $1`,
-			typeID).Scan(&typePK); err != nil {
-			if err == sql.ErrNoRows {
-				return &weft.NotFound
-			}
-			return weft.InternalServerError(err)
-		}
-
-		rows, err = dbR.Query(`SELECT siteID, typeID, count, expected
-		FROM data.completeness_summary
-		JOIN data.site USING (sitePK)
-		JOIN data.completeness_type USING (typePK)
-		WHERE typeID = $1;`, typeID)
-	}
-
-	if err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	defer rows.Close()
-
 	var t time.Time
 	var dcr mtrpb.DataCompletenessSummaryResult
 
-	for rows.Next() {
-		var count int
-		var siteID string
-
-		if err = rows.Scan(&siteID, &typeID, &count, &expected); err != nil {
-			return weft.InternalServerError(err)
-		}
-
-		c := float32(count) / (float32(expected) / 288)
-		dc := mtrpb.DataCompletenessSummary{TypeID: typeID, SiteID: siteID, Completeness: c, Seconds: t.Unix()}
+	for _, s := range summaries {
+		c := float32(s.count) / (float32(s.expected) / 288)
+		dc := mtrpb.DataCompletenessSummary{TypeID: s.typeID, SiteID: s.siteID, Completeness: c, Seconds: t.Unix(), Pending: s.pending}
 		dcr.Result = append(dcr.Result, &dc)
 	}
 
@@ -78,45 +41,18 @@ func dataCompletenessSummaryProto(r *http.Request, h http.Header, b *bytes.Buffe
 }
 
 func dataCompletenessSummarySvg(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	var rows *sql.Rows
-	var width int
-	var err error
-
-	typeID := r.URL.Query().Get("typeID")
-	bbox := r.URL.Query().Get("bbox")
-
-	if err = map180.ValidBbox(bbox); err != nil {
-		return weft.BadRequest(err.Error())
-	}
-
-	if width, err = strconv.Atoi(r.URL.Query().Get("width")); err != nil {
-		return weft.BadRequest("invalid width")
-	}
-
-	var raw map180.Raw
-	if raw, err = wm.MapRaw(bbox, width); err != nil {
-		return weft.InternalServerError(err)
+	raw, llx, lly, urx, ury, res := mapRaw(r)
+	if !res.Ok {
+		return res
 	}
 
-	var bboxWkt string
-	if bboxWkt, err = map180.BboxToWKTPolygon(bbox); err != nil {
-		return weft.InternalServerError(err)
-	}
-
-	if rows, err = dbR.Query(`with p as (select geom, time, count, expected,
-			st_transform(geom::geometry, 3857) as pt
-			FROM data.completeness_summary
-			JOIN data.site USING (sitePK)
-			JOIN data.completeness_type USING (typePK)
-			where typeID = $1)
-			select ST_X(pt), ST_Y(pt)*-1, ST_X(geom::geometry),ST_Y(geom::geometry), time,
-			count, expected from p
-			WHERE ST_Within(geom::geometry, ST_GeomFromText($2, 4326))`, typeID, bboxWkt); err != nil {
+	summaries, err := storage.dataCompletenessSummaries(r.URL.Query().Get("typeID"))
+	switch err {
+	case nil, errNotFound:
+	default:
 		return weft.InternalServerError(err)
 	}
 
-	defer rows.Close()
-
 	//ago := time.Now().UTC().Add(time.Hour * -3)
 
 	var late []point
@@ -124,32 +60,18 @@ func dataCompletenessSummarySvg(r *http.Request, h http.Header, b *bytes.Buffer)
 	var bad []point
 	var dunno []point
 
-	for rows.Next() {
-		var p point
-		var t time.Time
-		var count int
-		var expected int
-
-		if err = rows.Scan(&p.x, &p.y, &p.longitude, &p.latitude, &t, &count, &expected); err != nil {
-			return weft.InternalServerError(err)
+	for _, s := range summaries {
+		if s.pending {
+			continue
 		}
 
-		// Does not handle crossing the equator.
-		switch {
-		case raw.CrossesCentral && p.longitude > -180.0 && p.longitude < 0.0:
-			p.x = (p.x + map180.Width3857 - raw.LLX) * raw.DX
-			p.y = (p.y - math.Abs(raw.YShift)) * raw.DX
-		case p.longitude > 0.0:
-			p.x = (p.x - math.Abs(raw.XShift)) * raw.DX
-			p.y = (p.y - math.Abs(raw.YShift)) * raw.DX
-		default:
-			p.x = (p.x + math.Abs(raw.XShift)) * raw.DX
-			p.y = (p.y - math.Abs(raw.YShift)) * raw.DX
-
+		p, ok := mapPoint(raw, llx, lly, urx, ury, s.latitude, s.longitude)
+		if !ok {
+			continue
 		}
 
 		// TODO: Define what is "Bad"
-		completeness := float64(count) / (float64(expected) / 288)
+		completeness := float64(s.count) / (float64(s.expected) / 288)
 		if completeness >= 1.0 {
 			good = append(good, p)
 		} else {
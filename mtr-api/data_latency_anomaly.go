@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/weft"
+	"github.com/golang/protobuf/proto"
+	"net/http"
+)
+
+// dataLatencyAnomalyPut sets the rate of change and baseline thresholds for a site and type.
+func dataLatencyAnomalyPut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	a, res := anomalyQuery(v)
+	if res != nil {
+		return res
+	}
+
+	switch err := storage.dataLatencyAnomalySave(v.Get("siteID"), v.Get("typeID"), a); err {
+	case nil:
+		return &weft.StatusOK
+	case errNotFound:
+		return weft.InternalServerError(fmt.Errorf("no rows affected, check your query."))
+	default:
+		return weft.InternalServerError(err)
+	}
+}
+
+// dataLatencyAnomalyDelete deletes the rate of change and baseline thresholds for a site and type.
+func dataLatencyAnomalyDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	if err := storage.dataLatencyAnomalyDelete(v.Get("siteID"), v.Get("typeID")); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	return &weft.StatusOK
+}
+
+func dataLatencyAnomalyProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var err error
+	var ar mtrpb.DataLatencyAnomalyResult
+
+	if ar.Result, err = storage.dataLatencyAnomalies(); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	var by []byte
+	if by, err = proto.Marshal(&ar); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
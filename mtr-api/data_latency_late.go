@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/weft"
+	"github.com/golang/protobuf/proto"
+	"net/http"
+	"strconv"
+)
+
+// dataLatencyLatePut sets the late window for a site and type.  It overrides the late window for the type.
+func dataLatencyLatePut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	late, err := strconv.Atoi(v.Get("late"))
+	if err != nil || late <= 0 {
+		return weft.BadRequest("late must be a number of seconds greater than 0")
+	}
+
+	switch err = storage.dataLatencyLateSave(v.Get("siteID"), v.Get("typeID"), late); err {
+	case nil:
+		return &weft.StatusOK
+	case errNotFound:
+		return weft.InternalServerError(fmt.Errorf("no rows affected, check your query."))
+	default:
+		return weft.InternalServerError(err)
+	}
+}
+
+// dataLatencyLateDelete deletes the late window for a site and type.  The late window for the type is used instead.
+func dataLatencyLateDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	if err := storage.dataLatencyLateDelete(v.Get("siteID"), v.Get("typeID")); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	return &weft.StatusOK
+}
+
+func dataLatencyLateProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var err error
+	var lr mtrpb.DataLatencyLateResult
+
+	if lr.Result, err = storage.dataLatencyLates(); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	var by []byte
+	if by, err = proto.Marshal(&lr); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
@@ -2,63 +2,52 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"fmt"
-	"github.com/GeoNet/map180"
 	"github.com/GeoNet/mtr/mtrpb"
 	"github.com/GeoNet/weft"
 	"github.com/golang/protobuf/proto"
-	"math"
 	"net/http"
-	"strconv"
 	"time"
 )
 
 // TODO: returns weft.NotFound when query result is empty?
 func dataLatencySummaryProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	typeID := r.URL.Query().Get("typeID")
-
-	var err error
-	var rows *sql.Rows
-
-	switch typeID {
-	case "":
-		rows, err = dbR.Query(`SELECT siteID, typeID, time, mean, fifty, ninety, lower, upper, scale
-		FROM data.latency_summary
-		JOIN data.site USING (sitePK)
-		JOIN data.latency_threshold USING (sitePK, typePK)
-		JOIN data.type USING (typePK)`)
-	default:
-		rows, err = dbR.Query(`SELECT siteID, typeID, time, mean, fifty, ninety, lower, upper, scale
-		FROM data.latency_summary
-		JOIN data.site USING (sitePK)
-		JOIN data.latency_threshold USING (sitePK, typePK)
-		JOIN data.type USING (typePK)
-		WHERE typeID = $1;`, typeID)
-	}
+	summaries, err := storage.dataLatencySummaries(r.URL.Query().Get("typeID"))
 	if err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	defer rows.Close()
-
-	var t time.Time
 	var dlsr mtrpb.DataLatencySummaryResult
 
-	for rows.Next() {
+	now := time.Now().UTC()
 
-		var dls mtrpb.DataLatencySummary
-
-		if err = rows.Scan(&dls.SiteID, &dls.TypeID, &t, &dls.Mean, &dls.Fifty, &dls.Ninety,
-			&dls.Lower, &dls.Upper, &dls.Scale); err != nil {
-			return weft.InternalServerError(err)
+	for _, s := range summaries {
+		if !s.hasThreshold {
+			continue
 		}
 
-		dls.Seconds = t.Unix()
+		state := metricState(now, s.t, s.late, s.mean, s.th, s.outSince, s.anomaly)
+
+		dls := mtrpb.DataLatencySummary{
+			SiteID:       s.siteID,
+			TypeID:       s.typeID,
+			Seconds:      s.t.Unix(),
+			MeanDouble:   s.mean,
+			FiftyDouble:  s.fifty,
+			NinetyDouble: s.ninety,
+			LowerDouble:  s.th.lower,
+			UpperDouble:  s.th.upper,
+			Anomaly:      s.anomaly,
+			Scale:        s.scale,
+			Pending:      s.pending,
+			Late:         isLate(now, s.t, s.late),
+			Bad:          state == metricBad,
+			Maintenance:  maintenanceState(state, s.silenced) == metricMaintenance,
+		}
+		dataLatencySummaryRound(&dls)
 
 		dlsr.Result = append(dlsr.Result, &dls)
 	}
-	rows.Close()
 
 	var by []byte
 
@@ -72,87 +61,47 @@ func dataLatencySummaryProto(r *http.Request, h http.Header, b *bytes.Buffer) *w
 }
 
 func dataLatencySummarySvg(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	var rows *sql.Rows
-	var width int
-	var err error
-
-	typeID := r.URL.Query().Get("typeID")
-	bbox := r.URL.Query().Get("bbox")
-
-	if err = map180.ValidBbox(bbox); err != nil {
-		return weft.BadRequest(err.Error())
-	}
-
-	if width, err = strconv.Atoi(r.URL.Query().Get("width")); err != nil {
-		return weft.BadRequest("invalid width")
-	}
-
-	var raw map180.Raw
-	if raw, err = wm.MapRaw(bbox, width); err != nil {
-		return weft.InternalServerError(err)
-	}
-
-	var bboxWkt string
-	if bboxWkt, err = map180.BboxToWKTPolygon(bbox); err != nil {
-		return weft.InternalServerError(err)
+	raw, llx, lly, urx, ury, res := mapRaw(r)
+	if !res.Ok {
+		return res
 	}
 
-	if rows, err = dbR.Query(`with p as (select geom, time, mean, lower, upper,
-			st_transform(geom::geometry, 3857) as pt
-			FROM data.latency_summary
-			JOIN data.site USING (sitePK)
-			JOIN data.type USING (typePK)
-			JOIN data.latency_threshold USING (sitePK, typePK)
-			where typeID = $1)
-			select ST_X(pt), ST_Y(pt)*-1, ST_X(geom::geometry),ST_Y(geom::geometry), time,
-			mean, lower,upper from p
-			WHERE ST_Within(geom::geometry, ST_GeomFromText($2, 4326))`, typeID, bboxWkt); err != nil {
+	summaries, err := storage.dataLatencySummaries(r.URL.Query().Get("typeID"))
+	if err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	defer rows.Close()
-
-	ago := time.Now().UTC().Add(time.Hour * -3)
+	now := time.Now().UTC()
 
 	var late []point
+	var maintenance []point
 	var good []point
 	var bad []point
 	var dunno []point
 
-	for rows.Next() {
-		var p point
-		var t time.Time
-		var min, max, v int
-
-		if err = rows.Scan(&p.x, &p.y, &p.longitude, &p.latitude, &t, &v, &min, &max); err != nil {
-			return weft.InternalServerError(err)
+	for _, s := range summaries {
+		if !s.hasThreshold || s.pending {
+			continue
 		}
 
-		// Does not handle crossing the equator.
-		switch {
-		case raw.CrossesCentral && p.longitude > -180.0 && p.longitude < 0.0:
-			p.x = (p.x + map180.Width3857 - raw.LLX) * raw.DX
-			p.y = (p.y - math.Abs(raw.YShift)) * raw.DX
-		case p.longitude > 0.0:
-			p.x = (p.x - math.Abs(raw.XShift)) * raw.DX
-			p.y = (p.y - math.Abs(raw.YShift)) * raw.DX
-		default:
-			p.x = (p.x + math.Abs(raw.XShift)) * raw.DX
-			p.y = (p.y - math.Abs(raw.YShift)) * raw.DX
-
+		p, ok := mapPoint(raw, llx, lly, urx, ury, s.latitude, s.longitude)
+		if !ok {
+			continue
 		}
-		switch {
-		case t.Before(ago):
+
+		switch maintenanceState(metricState(now, s.t, s.late, s.mean, s.th, s.outSince, s.anomaly), s.silenced) {
+		case metricMaintenance:
+			maintenance = append(maintenance, p)
+		case metricLate:
 			late = append(late, p)
-		case min == 0 && max == 0:
+		case metricUnknown:
 			dunno = append(dunno, p)
-		case v < min || v > max:
+		case metricBad:
 			bad = append(bad, p)
 		default:
 			good = append(good, p)
 		}
 	}
-	rows.Close()
 
 	b.WriteString(`<?xml version="1.0"?>`)
 	b.WriteString(fmt.Sprintf("<svg  viewBox=\"0 0 %d %d\"  xmlns=\"http://www.w3.org/2000/svg\">",
@@ -185,7 +134,22 @@ func dataLatencySummarySvg(r *http.Request, h http.Header, b *bytes.Buffer) *wef
 	}
 	b.WriteString("</g>")
 
+	b.WriteString("<g style=\"stroke: #999999; fill: #999999; \">") // grey
+	for _, p := range maintenance {
+		b.WriteString(fmt.Sprintf("<circle cx=\"%.1f\" cy=\"%.1f\" r=\"%d\"/>", p.x, p.y, 5))
+	}
+	b.WriteString("</g>")
+
 	b.WriteString("</svg>")
 
 	return &weft.StatusOK
 }
+
+// dataLatencySummaryRound sets the integer values and thresholds in s, for older clients, from the doubles.
+func dataLatencySummaryRound(s *mtrpb.DataLatencySummary) {
+	s.Mean = roundInt32(s.MeanDouble)
+	s.Fifty = roundInt32(s.FiftyDouble)
+	s.Ninety = roundInt32(s.NinetyDouble)
+	s.Lower = roundInt32(s.LowerDouble)
+	s.Upper = roundInt32(s.UpperDouble)
+}
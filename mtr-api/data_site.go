@@ -2,12 +2,9 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
-	"fmt"
 	"github.com/GeoNet/mtr/mtrpb"
 	"github.com/GeoNet/weft"
 	"github.com/golang/protobuf/proto"
-	"github.com/lib/pq"
 	"net/http"
 	"strconv"
 )
@@ -28,45 +25,15 @@ func dataSitePut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 		return weft.BadRequest("longitude invalid")
 	}
 
-	var result sql.Result
-
-	// TODO - use upsert with PG 9.5?
-
-	// return if insert succeeds
-	if result, err = db.Exec(`INSERT INTO data.site(siteID, latitude, longitude) VALUES($1, $2, $3)`,
-		siteID, latitude, longitude); err == nil {
-		var i int64
-		if i, err = result.RowsAffected(); err != nil {
-			return weft.InternalServerError(err)
-		}
-		if i == 1 {
-			return &weft.StatusOK
-		}
-	}
-
-	// return if update one row
-	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == errorUniqueViolation {
-		if result, err = db.Exec(`UPDATE data.site SET latitude=$2, longitude=$3 where siteID=$1`,
-			siteID, latitude, longitude); err == nil {
-			var i int64
-			if i, err = result.RowsAffected(); err != nil {
-				return weft.InternalServerError(err)
-			}
-			if i == 1 {
-				return &weft.StatusOK
-			}
-		}
-	}
-
-	if err == nil {
-		err = fmt.Errorf("no rows affected, check your query.")
+	if err = storage.dataSiteSave(siteID, latitude, longitude); err != nil {
+		return weft.InternalServerError(err)
 	}
 
-	return weft.InternalServerError(err)
+	return &weft.StatusOK
 }
 
 func dataSiteDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	if _, err := db.Exec(`DELETE FROM data.site where siteID = $1`, r.URL.Query().Get("siteID")); err != nil {
+	if err := storage.dataSiteDelete(r.URL.Query().Get("siteID")); err != nil {
 		return weft.InternalServerError(err)
 	}
 
@@ -74,23 +41,21 @@ func dataSiteDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Resul
 }
 
 func dataSiteProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	var err error
-	var rows *sql.Rows
+	return dataSites(false, b)
+}
 
-	if rows, err = dbR.Query(`SELECT siteID, latitude, longitude FROM data.site`); err != nil {
-		return weft.InternalServerError(err)
-	}
+// dataSitePendingProto returns sites that have been auto registered and not confirmed.
+func dataSitePendingProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	return dataSites(true, b)
+}
 
+// dataSites writes the sites, or only the pending sites, to b as a protobuf mtrpb.DataSiteResult.
+func dataSites(pending bool, b *bytes.Buffer) *weft.Result {
+	var err error
 	var ts mtrpb.DataSiteResult
 
-	for rows.Next() {
-		var t mtrpb.DataSite
-
-		if err = rows.Scan(&t.SiteID, &t.Latitude, &t.Longitude); err != nil {
-			return weft.InternalServerError(err)
-		}
-
-		ts.Result = append(ts.Result, &t)
+	if ts.Result, err = storage.dataSites(pending); err != nil {
+		return weft.InternalServerError(err)
 	}
 
 	var by []byte
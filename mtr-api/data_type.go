@@ -2,32 +2,56 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"github.com/GeoNet/mtr/mtrpb"
 	"github.com/GeoNet/weft"
 	"github.com/golang/protobuf/proto"
 	"net/http"
+	"strconv"
 )
 
-func dataTypeProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	var err error
-	var rows *sql.Rows
+func dataTypePut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
 
-	if rows, err = dbR.Query(`SELECT typeID, display FROM data.type ORDER BY typeID ASC`); err != nil {
-		return weft.InternalServerError(err)
+	cols, res := typeScale(v)
+	if !res.Ok {
+		return res
 	}
-	defer rows.Close()
 
-	var ftr mtrpb.DataTypeResult
+	m, res := typeMinInterval(v)
+	if !res.Ok {
+		return res
+	}
+
+	l, res := typeLate(v)
+	if !res.Ok {
+		return res
+	}
+
+	force, res := typeForce(v)
+	if !res.Ok {
+		return res
+	}
 
-	for rows.Next() {
-		var ft mtrpb.DataType
+	return typeSave(dataTypeTable, v.Get("typeID"), append(append(cols, m...), l...), force)
+}
+
+func dataTypeDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
 
-		if err = rows.Scan(&ft.TypeID, &ft.Display); err != nil {
-			return weft.InternalServerError(err)
-		}
+	force, res := typeForce(v)
+	if !res.Ok {
+		return res
+	}
+
+	return typeDelete(dataTypeTable, v.Get("typeID"), force)
+}
+
+func dataTypeProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var err error
+	var ftr mtrpb.DataTypeResult
 
-		ftr.Result = append(ftr.Result, &ft)
+	if ftr.Result, err = storage.dataTypes(); err != nil {
+		return weft.InternalServerError(err)
 	}
 
 	var by []byte
@@ -40,25 +64,44 @@ func dataTypeProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result
 	return &weft.StatusOK
 }
 
-func dataCompletenessTypeProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	var err error
-	var rows *sql.Rows
+func dataCompletenessTypePut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
 
-	if rows, err = dbR.Query(`SELECT typeID FROM data.completeness_type ORDER BY typeID ASC`); err != nil {
-		return weft.InternalServerError(err)
+	expected, err := strconv.Atoi(v.Get("expected"))
+	if err != nil || expected <= 0 {
+		return weft.BadRequest("expected must be a number greater than 0")
 	}
-	defer rows.Close()
 
-	var ftr mtrpb.DataTypeResult
+	m, res := typeMinInterval(v)
+	if !res.Ok {
+		return res
+	}
+
+	force, res := typeForce(v)
+	if !res.Ok {
+		return res
+	}
+
+	return typeSave(dataCompletenessTypeTable, v.Get("typeID"), append([]typeColumn{{name: "expected", value: expected}}, m...), force)
+}
 
-	for rows.Next() {
-		var ft mtrpb.DataType
+func dataCompletenessTypeDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
 
-		if err = rows.Scan(&ft.TypeID); err != nil {
-			return weft.InternalServerError(err)
-		}
+	force, res := typeForce(v)
+	if !res.Ok {
+		return res
+	}
 
-		ftr.Result = append(ftr.Result, &ft)
+	return typeDelete(dataCompletenessTypeTable, v.Get("typeID"), force)
+}
+
+func dataCompletenessTypeProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var err error
+	var ftr mtrpb.DataTypeResult
+
+	if ftr.Result, err = storage.dataCompletenessTypes(); err != nil {
+		return weft.InternalServerError(err)
 	}
 
 	var by []byte
@@ -2,22 +2,20 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/csv"
-	"errors"
 	"fmt"
 	"github.com/GeoNet/mtr/mtrpb"
 	"github.com/GeoNet/mtr/ts"
 	"github.com/GeoNet/weft"
 	"github.com/golang/protobuf/proto"
-	"github.com/lib/pq"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
-var statusTooManyRequests = weft.Result{Ok: false, Code: http.StatusTooManyRequests, Msg: "Already data for the minute"}
+var statusTooManyRequests = weft.Result{Ok: false, Code: http.StatusTooManyRequests, Msg: "Already data for the interval"}
 
 // fieldMetric - table field.metric
 type fieldMetric struct {
@@ -27,10 +25,10 @@ func fieldMetricPut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Resul
 	v := r.URL.Query()
 
 	var err error
-	var val int
+	var val float64
 	var t time.Time
 
-	if val, err = strconv.Atoi(v.Get("value")); err != nil {
+	if val, err = metricValue(v.Get("value")); err != nil {
 		return weft.BadRequest("invalid value")
 	}
 
@@ -38,87 +36,54 @@ func fieldMetricPut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Resul
 		return weft.BadRequest("invalid time")
 	}
 
-	deviceID := v.Get("deviceID")
-	typeID := v.Get("typeID")
-
-	var result sql.Result
-
-	if result, err = db.Exec(`INSERT INTO field.metric(devicePK, typePK, rate_limit, time, value)
-				SELECT devicePK, typePK, $3, $4, $5
-				FROM field.device, field.type
-				WHERE deviceID = $1
-				AND typeID = $2`,
-		deviceID, typeID, t.Truncate(time.Minute).Unix(), t, int32(val)); err != nil {
-		if err, ok := err.(*pq.Error); ok && err.Code == errorUniqueViolation {
-			return &statusTooManyRequests
-		} else {
-			return weft.InternalServerError(err)
-		}
-	}
+	f := fieldMetric{}
 
-	var i int64
-	if i, err = result.RowsAffected(); err != nil {
-		return weft.InternalServerError(err)
-	}
-	if i != 1 {
-		return weft.BadRequest("Didn't create row, check your query parameters exist")
-	}
+	return f.save(v.Get("deviceID"), v.Get("typeID"), t, val)
+}
 
-	// Update the summary value if the incoming value is newer.
-	if result, err = db.Exec(`UPDATE field.metric_summary SET time = $3, value = $4
-				WHERE time < $3
-				AND devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
-				AND typePK = (SELECT typePK FROM field.type WHERE typeID = $2)`,
-		deviceID, typeID, t, int32(val)); err != nil {
-		return weft.InternalServerError(err)
+// metricValue parses a metric value.  Integers and decimals are valid, NaN and Inf are not.
+func metricValue(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
 	}
 
-	// If no rows change either the value is old or it's the first time we've seen this metric.
-	if i, err = result.RowsAffected(); err != nil {
-		return weft.InternalServerError(err)
-	}
-	if i != 1 {
-		if result, err = db.Exec(`INSERT INTO field.metric_summary(devicePK, typePK, time, value)
-				SELECT devicePK, typePK, $3, $4
-				FROM field.device, field.type
-				WHERE deviceID = $1
-				AND typeID = $2`,
-			deviceID, typeID, t, int32(val)); err != nil {
-			if err, ok := err.(*pq.Error); ok && err.Code == errorUniqueViolation {
-				// incoming value was old
-			} else {
-				return weft.InternalServerError(err)
-			}
-		}
+	if err = validValue(v); err != nil {
+		return 0, err
 	}
 
-	return &weft.StatusOK
+	return v, nil
 }
 
-func fieldMetricDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	v := r.URL.Query()
-
-	deviceID := v.Get("deviceID")
-	typeID := v.Get("typeID")
+// validValue returns an error if v is NaN or Inf.  It is for values that aren't parsed
+// by metricValue e.g., from batch requests.
+func validValue(v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("invalid value %g", v)
+	}
 
-	var err error
-	var txn *sql.Tx
+	return nil
+}
 
-	if txn, err = db.Begin(); err != nil {
+// save saves a metric value for the device and type and updates the summary
+// if the value is newer.
+func (f fieldMetric) save(deviceID, typeID string, t time.Time, val float64) *weft.Result {
+	switch err := storage.fieldMetricSave(deviceID, typeID, t, val); err {
+	case nil:
+		return &weft.StatusOK
+	case errRateLimit:
+		return &statusTooManyRequests
+	case errNotFound:
+		return weft.BadRequest("Didn't create row, check your query parameters exist")
+	default:
 		return weft.InternalServerError(err)
 	}
+}
 
-	for _, table := range []string{"field.metric", "field.metric_summary", "field.metric_tag", "field.threshold"} {
-		if _, err = txn.Exec(`DELETE FROM `+table+` WHERE
-				devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
-				 AND typePK = (SELECT typePK from field.type WHERE typeID = $2)`,
-			deviceID, typeID); err != nil {
-			txn.Rollback()
-			return weft.InternalServerError(err)
-		}
-	}
+func fieldMetricDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
 
-	if err = txn.Commit(); err != nil {
+	if err := storage.fieldMetricDelete(v.Get("deviceID"), v.Get("typeID")); err != nil {
 		return weft.InternalServerError(err)
 	}
 
@@ -172,10 +137,8 @@ func fieldMetricCsv(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Resul
 		return weft.InternalServerError(err)
 	}
 
-	var devicePK int
-	if err = dbR.QueryRow(`SELECT devicePK FROM field.device WHERE deviceID = $1`,
-		deviceID).Scan(&devicePK); err != nil {
-		if err == sql.ErrNoRows {
+	if _, err = storage.fieldDeviceModel(deviceID); err != nil {
+		if err == errNotFound {
 			return &weft.NotFound
 		}
 		return weft.InternalServerError(err)
@@ -188,39 +151,29 @@ func fieldMetricCsv(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Resul
 
 	for _, typeID := range typeIDs {
 		err = func() error {
-			var typePK int
-			var scale float64
-			if err = dbR.QueryRow(`SELECT typePK, scale FROM field.type WHERE typeID = $1`,
-				typeID).Scan(&typePK, &scale); err != nil {
+			var ft fieldType
+			if ft, err = storage.fieldTypeByID(typeID); err != nil {
 				return err
 			}
 
-			var rows *sql.Rows
-			if rows, err = queryMetricRows(devicePK, typePK, resolution, timeRange); err != nil {
+			pts, err := storage.fieldMetrics(deviceID, typeID, resolution, timeRange)
+			if err != nil {
 				return err
 			}
-			defer rows.Close()
-
-			var t time.Time
-			var val float64
-			for rows.Next() {
-
-				if err = rows.Scan(&t, &val); err != nil {
-					return err
-				}
 
-				if _, ok := values[t]; ok == true {
-					values[t][typeID] = val * scale
+			for _, pt := range pts {
+				if _, ok := values[pt.DateTime]; ok == true {
+					values[pt.DateTime][typeID] = pt.Value * ft.scale
 				} else {
-					values[t] = map[string]float64{typeID: val * scale}
-					ts = append(ts, t)
+					values[pt.DateTime] = map[string]float64{typeID: pt.Value * ft.scale}
+					ts = append(ts, pt.DateTime)
 				}
 			}
 
 			return nil
 		}()
 
-		if err == sql.ErrNoRows {
+		if err == errNotFound {
 			return &weft.NotFound
 		} else if err != nil {
 			return weft.InternalServerError(err)
@@ -275,52 +228,37 @@ func fieldMetricProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Res
 	fmr.DeviceID = deviceID
 	fmr.TypeID = typeID
 
-	var devicePK int
-	if err = dbR.QueryRow(`SELECT devicePK FROM field.device WHERE deviceID = $1`,
-		deviceID).Scan(&devicePK); err != nil {
-		if err == sql.ErrNoRows {
+	var ft fieldType
+	if ft, err = storage.fieldTypeByID(typeID); err != nil {
+		if err == errNotFound {
 			return &weft.NotFound
 		}
 		return weft.InternalServerError(err)
 	}
 
-	var typePK int
+	fmr.Scale = ft.scale
 
-	if err = dbR.QueryRow(`SELECT typePK, scale FROM field.type WHERE typeID = $1`,
-		typeID).Scan(&typePK, &fmr.Scale); err != nil {
-		if err == sql.ErrNoRows {
-			return &weft.NotFound
-		}
+	if fmr.LowerDouble, fmr.UpperDouble, fmr.ThresholdSource, err = storage.fieldThreshold(deviceID, typeID); err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	if err := dbR.QueryRow(`SELECT lower,upper FROM field.threshold
-		WHERE devicePK = $1 AND typePK = $2`,
-		devicePK, typePK).Scan(&fmr.Lower, &fmr.Upper); err != nil && err != sql.ErrNoRows {
-		return weft.InternalServerError(err)
-	}
+	fmr.Lower, fmr.Upper = roundInt32(fmr.LowerDouble), roundInt32(fmr.UpperDouble)
 
 	var timeRange []time.Time
 	if timeRange, err = parseTimeRange(v); err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	var rows *sql.Rows
-	rows, err = queryMetricRows(devicePK, typePK, resolution, timeRange)
+	pts, err := storage.fieldMetrics(deviceID, typeID, resolution, timeRange)
 	if err != nil {
+		if err == errNotFound {
+			return &weft.NotFound
+		}
 		return weft.InternalServerError(err)
 	}
 
-	defer rows.Close()
-	for rows.Next() {
-		var fm mtrpb.FieldMetric
-		var t time.Time
-		if err = rows.Scan(&t, &fm.Value); err != nil {
-			return weft.InternalServerError(err)
-		}
-
-		fm.Seconds = t.Unix()
-		fmr.Result = append(fmr.Result, &fm)
+	for _, pt := range pts {
+		fmr.Result = append(fmr.Result, &mtrpb.FieldMetric{Seconds: pt.DateTime.Unix(), Value: float32(pt.Value), ValueDouble: pt.Value})
 	}
 
 	var by []byte
@@ -336,26 +274,20 @@ func fieldMetricProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Res
 
 /*
 plot draws an svg plot to b.
-Valid values for resolution are 'minute', 'five_minutes', 'hour'.
+Valid values for resolution are 'minute', 'five_minutes', 'hour', 'day'.
 */
 func (f fieldMetric) plot(deviceID, typeID, resolution string, plotter ts.SVGPlot, b *bytes.Buffer) *weft.Result {
-	// we need the devicePK often so read it once.
-	var devicePK int
-	if err := dbR.QueryRow(`SELECT devicePK FROM field.device WHERE deviceID = $1`,
-		deviceID).Scan(&devicePK); err != nil {
-		if err == sql.ErrNoRows {
+	mod, err := storage.fieldDeviceModel(deviceID)
+	if err != nil {
+		if err == errNotFound {
 			return &weft.NotFound
 		}
 		return weft.InternalServerError(err)
 	}
 
-	var typePK int
-	var scale float64
-	var display string
-
-	if err := dbR.QueryRow(`SELECT typePK, scale, display FROM field.type WHERE typeID = $1`,
-		typeID).Scan(&typePK, &scale, &display); err != nil {
-		if err == sql.ErrNoRows {
+	var ft fieldType
+	if ft, err = storage.fieldTypeByID(typeID); err != nil {
+		if err == errNotFound {
 			return &weft.NotFound
 		}
 		return weft.InternalServerError(err)
@@ -363,53 +295,30 @@ func (f fieldMetric) plot(deviceID, typeID, resolution string, plotter ts.SVGPlo
 
 	var p ts.Plot
 
-	p.SetUnit(display)
+	p.SetUnit(ft.display)
 
-	var rows *sql.Rows
-	var err error
-	var lower, upper int
+	var lower, upper float64
 
-	if err := dbR.QueryRow(`SELECT lower,upper FROM field.threshold
-		WHERE devicePK = $1 AND typePK = $2`,
-		devicePK, typePK).Scan(&lower, &upper); err != nil && err != sql.ErrNoRows {
+	if lower, upper, _, err = storage.fieldThreshold(deviceID, typeID); err != nil {
 		return weft.InternalServerError(err)
 	}
 
 	if !(lower == 0 && upper == 0) {
-		p.SetThreshold(float64(lower)*scale, float64(upper)*scale)
+		p.SetThreshold(lower*ft.scale, upper*ft.scale)
 	}
 
-	var tags []string
-
-	if rows, err = dbR.Query(`SELECT tag FROM field.metric_tag JOIN mtr.tag USING (tagpk) WHERE
-		devicePK = $1 AND typePK = $2
-		ORDER BY tag asc`,
-		devicePK, typePK); err != nil {
+	var mt []*mtrpb.FieldMetricTag
+	if mt, err = storage.fieldMetricTags(deviceID, typeID); err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	defer rows.Close()
-
-	for rows.Next() {
-		var s string
-		if err = rows.Scan(&s); err != nil {
-			return weft.InternalServerError(err)
-		}
-		tags = append(tags, s)
+	var tags []string
+	for _, t := range mt {
+		tags = append(tags, t.Tag)
 	}
 
-	rows.Close()
-
 	p.SetSubTitle("Tags: " + strings.Join(tags, ","))
 
-	var mod string
-	// TODO move into first select for devicePK
-	if err = dbR.QueryRow(`SELECT modelid FROM field.device JOIN field.model using (modelpk)
-		WHERE devicePK = $1`,
-		devicePK).Scan(&mod); err != nil && err != sql.ErrNoRows {
-		return weft.InternalServerError(err)
-	}
-
 	p.SetTitle(fmt.Sprintf("Device: %s, Model: %s, Metric: %s", deviceID, mod, strings.Title(typeID)))
 
 	switch resolution {
@@ -422,6 +331,9 @@ func (f fieldMetric) plot(deviceID, typeID, resolution string, plotter ts.SVGPlo
 	case "hour":
 		p.SetXAxis(time.Now().UTC().Add(time.Hour*-24*28), time.Now().UTC())
 		p.SetXLabel("4 weeks")
+	case "day":
+		p.SetXAxis(time.Now().UTC().Add(time.Hour*-24*365), time.Now().UTC())
+		p.SetXLabel("1 year")
 	default:
 		return weft.BadRequest("invalid resolution")
 	}
@@ -431,37 +343,23 @@ func (f fieldMetric) plot(deviceID, typeID, resolution string, plotter ts.SVGPlo
 		return weft.InternalServerError(err)
 	}
 
-	rows, err = queryMetricRows(devicePK, typePK, resolution, timeRange)
-	if err != nil {
+	var pts []ts.Point
+	if pts, err = storage.fieldMetrics(deviceID, typeID, resolution, timeRange); err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	defer rows.Close()
-
-	var pts []ts.Point
-
-	for rows.Next() {
-		var pt ts.Point
-		if err = rows.Scan(&pt.DateTime, &pt.Value); err != nil {
-			return weft.InternalServerError(err)
-		}
-		pt.Value = pt.Value * scale
-		pts = append(pts, pt)
+	for i := range pts {
+		pts[i].Value = pts[i].Value * ft.scale
 	}
-	rows.Close()
 
 	// Add the latest value to the plot - this may be different to the average at minute or hour resolution.
 	var pt ts.Point
 
-	if err = dbR.QueryRow(`SELECT time, value FROM field.metric WHERE
-			devicePK = $1 AND typePK = $2
-			ORDER BY time DESC
-			LIMIT 1`,
-		devicePK, typePK).Scan(&pt.DateTime, &pt.Value); err != nil {
+	if pt, err = storage.fieldMetricLatest(deviceID, typeID); err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	pt.Value = pt.Value * scale
+	pt.Value = pt.Value * ft.scale
 
 	pts = append(pts, pt)
 	p.SetLatest(pt, "deepskyblue")
@@ -479,34 +377,15 @@ func (f fieldMetric) plot(deviceID, typeID, resolution string, plotter ts.SVGPlo
 func (f fieldMetric) spark(deviceID, typeID string, b *bytes.Buffer) *weft.Result {
 	var p ts.Plot
 
-	p.SetXAxis(time.Now().UTC().Add(time.Hour*-12), time.Now().UTC())
+	now := time.Now().UTC()
 
-	var err error
-	var rows *sql.Rows
-
-	if rows, err = dbR.Query(`SELECT date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min' as t,
-		 avg(value) FROM field.metric
-		 WHERE devicePK = (SELECT devicePK from field.device WHERE deviceID = $1)
-		AND typePK = (SELECT typePK from field.type WHERE typeID = $2)
-		AND time > now() - interval '12 hours'
-		GROUP BY date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min'
-		ORDER BY t ASC`,
-		deviceID, typeID); err != nil {
-		return weft.InternalServerError(err)
-	}
-	defer rows.Close()
+	p.SetXAxis(now.Add(time.Hour*-12), now)
 
-	var pts []ts.Point
-
-	for rows.Next() {
-		var pt ts.Point
-		if err = rows.Scan(&pt.DateTime, &pt.Value); err != nil {
-			return weft.InternalServerError(err)
-		}
-		// No need to scale spark data for display.
-		pts = append(pts, pt)
+	// No need to scale spark data for display.
+	pts, err := storage.fieldMetrics(deviceID, typeID, "five_minutes", []time.Time{now.Add(time.Hour * -12), now})
+	if err != nil && err != errNotFound {
+		return weft.InternalServerError(err)
 	}
-	rows.Close()
 
 	p.AddSeries(ts.Series{Colour: "deepskyblue", Points: pts})
 
@@ -516,47 +395,3 @@ func (f fieldMetric) spark(deviceID, typeID string, b *bytes.Buffer) *weft.Resul
 
 	return &weft.StatusOK
 }
-
-func queryMetricRows(devicePK, typePK int, resolution string, timeRange []time.Time) (*sql.Rows, error) {
-	var err error
-	var rows *sql.Rows
-
-	switch resolution {
-	case "minute":
-		rows, err = dbR.Query(`SELECT date_trunc('`+resolution+`',time) as t, avg(value) FROM field.metric WHERE
-		devicePK = $1 AND typePK = $2
-		AND time >= $3 AND time <= $4
-		GROUP BY date_trunc('`+resolution+`',time)
-		ORDER BY t ASC`,
-			devicePK, typePK, timeRange[0], timeRange[1])
-	case "five_minutes":
-		rows, err = dbR.Query(`SELECT date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min' as t,
-		 avg(value) FROM field.metric WHERE
-		devicePK = $1 AND typePK = $2
-		AND time >= $3 AND time <= $4
-		GROUP BY date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min'
-		ORDER BY t ASC`,
-			devicePK, typePK, timeRange[0], timeRange[1])
-	case "hour":
-		rows, err = dbR.Query(`SELECT date_trunc('`+resolution+`',time) as t, avg(value) FROM field.metric WHERE
-		devicePK = $1 AND typePK = $2
-		AND time >= $3 AND time <= $4
-		GROUP BY date_trunc('`+resolution+`',time)
-		ORDER BY t ASC`,
-			devicePK, typePK, timeRange[0], timeRange[1])
-	case "full":
-		rows, err = dbR.Query(`SELECT time, value
-		FROM field.metric
-		WHERE devicePK = $1
-		AND typePK = $2
-		AND time >= $3 AND time <= $4
-		ORDER BY time ASC`,
-			devicePK, typePK, timeRange[0], timeRange[1])
-	default:
-		return nil, errors.New("invalid resolution")
-	}
-	if err != nil {
-		return nil, err
-	}
-	return rows, nil
-}
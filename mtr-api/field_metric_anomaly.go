@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/weft"
+	"github.com/golang/protobuf/proto"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+/*
+The anomalies for field metrics and data latencies.  They are set in the summary tables by triggers
+(see field.metric_summary_anomaly and data.latency_summary_anomaly) when a new value breaks the anomaly thresholds.
+*/
+const (
+	anomalyRate     = "rate"     // the value changed faster than the rate per hour.
+	anomalyBaseline = "baseline" // the value is too far from the mean for the same hour on previous days.
+)
+
+// anomalyThreshold is the rate of change and baseline thresholds for a metric.  0 rate or deviations turns them off.
+type anomalyThreshold struct {
+	rate       float64
+	deviations float64
+	days       int
+}
+
+/*
+anomalyQuery returns the anomaly thresholds from the optional rate, deviations, and baselineDays (default 7)
+query parameters.  At least one of rate or deviations must be set.
+*/
+func anomalyQuery(v url.Values) (anomalyThreshold, *weft.Result) {
+	a := anomalyThreshold{days: 7}
+	var err error
+
+	if s := v.Get("rate"); s != "" {
+		if a.rate, err = metricValue(s); err != nil || a.rate < 0 {
+			return a, weft.BadRequest("rate must be greater than or equal to 0")
+		}
+	}
+
+	if s := v.Get("deviations"); s != "" {
+		if a.deviations, err = metricValue(s); err != nil || a.deviations < 0 {
+			return a, weft.BadRequest("deviations must be greater than or equal to 0")
+		}
+	}
+
+	if s := v.Get("baselineDays"); s != "" {
+		if a.days, err = strconv.Atoi(s); err != nil || a.days < 3 {
+			return a, weft.BadRequest("baselineDays must be a number of days greater than or equal to 3")
+		}
+	}
+
+	if a.rate == 0 && a.deviations == 0 {
+		return a, weft.BadRequest("an anomaly threshold needs a rate or deviations")
+	}
+
+	return a, nil
+}
+
+// fieldMetricAnomalyPut sets the rate of change and baseline thresholds for a device and type.
+func fieldMetricAnomalyPut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	a, res := anomalyQuery(v)
+	if res != nil {
+		return res
+	}
+
+	switch err := storage.fieldMetricAnomalySave(v.Get("deviceID"), v.Get("typeID"), a); err {
+	case nil:
+		return &weft.StatusOK
+	case errNotFound:
+		return weft.InternalServerError(fmt.Errorf("no rows affected, check your query."))
+	default:
+		return weft.InternalServerError(err)
+	}
+}
+
+// fieldMetricAnomalyDelete deletes the rate of change and baseline thresholds for a device and type.
+func fieldMetricAnomalyDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	if err := storage.fieldMetricAnomalyDelete(v.Get("deviceID"), v.Get("typeID")); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	return &weft.StatusOK
+}
+
+func fieldMetricAnomalyProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var err error
+	var ar mtrpb.FieldMetricAnomalyResult
+
+	if ar.Result, err = storage.fieldMetricAnomalies(); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	var by []byte
+	if by, err = proto.Marshal(&ar); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
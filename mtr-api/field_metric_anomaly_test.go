@@ -0,0 +1,95 @@
+package main
+
+import (
+	wt "github.com/GeoNet/weft/wefttest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAnomalyQuery(t *testing.T) {
+	in := []struct {
+		id       string
+		query    string
+		ok       bool
+		expected anomalyThreshold
+	}{
+		{id: wt.L(), query: "rate=500", ok: true, expected: anomalyThreshold{rate: 500, days: 7}},
+		{id: wt.L(), query: "deviations=3&baselineDays=14", ok: true, expected: anomalyThreshold{deviations: 3, days: 14}},
+		{id: wt.L(), query: "rate=0.5&deviations=2.5", ok: true, expected: anomalyThreshold{rate: 0.5, deviations: 2.5, days: 7}},
+		{id: wt.L(), query: ""},
+		{id: wt.L(), query: "rate=0&deviations=0"},
+		{id: wt.L(), query: "rate=-1"},
+		{id: wt.L(), query: "rate=fast"},
+		{id: wt.L(), query: "deviations=NaN"},
+		{id: wt.L(), query: "deviations=3&baselineDays=2"},
+	}
+
+	for _, v := range in {
+		q, err := url.ParseQuery(v.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a, res := anomalyQuery(q)
+
+		switch {
+		case v.ok && res != nil:
+			t.Errorf("%s unexpected error %+v", v.id, res)
+		case !v.ok && res == nil:
+			t.Errorf("%s expected an error for %s", v.id, v.query)
+		case v.ok && a != v.expected:
+			t.Errorf("%s expected %+v got %+v", v.id, v.expected, a)
+		}
+	}
+}
+
+// TestAnomalyRate checks a metric inside its thresholds is bad when it changes faster than the rate.
+func TestAnomalyRate(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	setupReq := wt.Requests{
+		{ID: wt.L(), URL: "/field/model?modelID=Trimble+NetR9", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/device?deviceID=test-anomaly&modelID=Trimble+NetR9&latitude=-38.74270&longitude=176.08100", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric?deviceID=test-anomaly&typeID=voltage", Method: "DELETE"},
+		{ID: wt.L(), URL: "/field/metric/threshold?deviceID=test-anomaly&typeID=voltage&lower=11000&upper=14000", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric/anomaly?deviceID=test-anomaly&typeID=voltage&rate=500", Method: "PUT"},
+	}
+
+	for _, v := range setupReq {
+		if err := doStatus(testServer.URL, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer doStatus(testServer.URL, wt.Request{ID: wt.L(), URL: "/field/device?deviceID=test-anomaly", Method: "DELETE"})
+
+	in := []struct {
+		id      string
+		t       time.Time
+		v       string
+		anomaly string
+	}{
+		{id: wt.L(), t: now.Add(time.Minute * -90), v: "12000"},
+		// 200 per hour.
+		{id: wt.L(), t: now.Add(time.Minute * -30), v: "12200"},
+		// about 650 per hour since the value 90 minutes ago.
+		{id: wt.L(), t: now.Add(time.Minute * -1), v: "13000", anomaly: anomalyRate},
+	}
+
+	for _, v := range in {
+		r := wt.Request{ID: v.id, URL: "/field/metric?deviceID=test-anomaly&typeID=voltage&value=" + v.v + "&time=" + v.t.Format(time.RFC3339), Method: "PUT"}
+		if err := doStatus(testServer.URL, r); err != nil {
+			t.Fatal(err)
+		}
+
+		m := testFieldSummary(t, "test-anomaly")
+
+		if m.Anomaly != v.anomaly || m.Bad != (v.anomaly != "") {
+			t.Errorf("%s expected anomaly %q got %q bad %t", v.id, v.anomaly, m.Anomaly, m.Bad)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/GeoNet/mtr/mtrapp"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/weft"
+	"github.com/golang/protobuf/proto"
+	"github.com/lib/pq"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxBatch is the largest number of values accepted in a single batch request.
+const maxBatch = 10000
+
+// maxBatchBytes limits the size of a batch request body.
+const maxBatchBytes = 8 << 20
+
+var batchBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func init() {
+	mux.HandleFunc("/field/metric/batch", makeHandlerBatch("fieldMetricBatch", fieldMetricBatchPost))
+	mux.HandleFunc("/data/latency/batch", makeHandlerBatch("dataLatencyBatch", dataLatencyBatchPost))
+	mux.HandleFunc("/data/completeness/batch", makeHandlerBatch("dataCompletenessBatch", dataCompletenessBatchPost))
+}
+
+// makeHandlerBatch is like weft.MakeHandlerAPI but only allows POST and writes
+// the response body from f to the client.  It is for batch ingest requests
+// that return a status for each value sent.
+func makeHandlerBatch(name string, f weft.RequestHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := mtrapp.Start()
+		var res *weft.Result
+
+		b := batchBufferPool.Get().(*bytes.Buffer)
+		defer batchBufferPool.Put(b)
+		b.Reset()
+
+		switch r.Method {
+		case "POST":
+			res = f(r, w.Header(), b)
+		default:
+			res = &weft.MethodNotAllowed
+		}
+
+		t.Stop()
+		weft.WriteBytes(w, r, res, b, false)
+
+		t.Track(name + "." + r.Method)
+		res.Count()
+
+		if res.Code == http.StatusInternalServerError {
+			log.Printf("%d serving %s: %s", res.Code, r.RequestURI, res.Msg)
+		}
+	}
+}
+
+// readBatch reads a protobuf batch request body into m.
+func readBatch(r *http.Request, m proto.Message) *weft.Result {
+	if res := weft.CheckQuery(r, []string{}, []string{"backfill"}); !res.Ok {
+		return res
+	}
+
+	switch r.URL.Query().Get("backfill") {
+	case "", "true", "false":
+	default:
+		return weft.BadRequest("invalid backfill")
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxBatchBytes))
+	if err != nil {
+		return weft.BadRequest("error reading request body")
+	}
+
+	if err = proto.Unmarshal(body, m); err != nil {
+		return weft.BadRequest("invalid protobuf in request body")
+	}
+
+	return &weft.StatusOK
+}
+
+// writeBatchResult writes the per value results for a batch request to b.
+func writeBatchResult(result proto.Message, h http.Header, b *bytes.Buffer) *weft.Result {
+	by, err := proto.Marshal(result)
+	if err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+	h.Set("Content-Type", "application/x-protobuf")
+
+	return &weft.StatusOK
+}
+
+/*
+backfill returns true if the batch request is for backfilling old data (backfill=true) e.g., data
+buffered during a comms outage.  Backfill batches must be in time order for each series.  A value that is
+the same (time and value) as one already saved is treated as saved (200) instead of 429 so that
+batches can be resent safely.  Summaries are only updated with values newer than the current summary.
+*/
+func backfill(r *http.Request) bool {
+	return r.URL.Query().Get("backfill") == "true"
+}
+
+// statusNotInOrder is for backfill values that are older than a previous value for the same series in the batch.
+var statusNotInOrder = weft.Result{Ok: false, Code: http.StatusBadRequest, Msg: "backfill values must be in time order"}
+
+type deviceType struct {
+	deviceID, typeID string
+}
+
+/*
+fieldMetricBatchPost saves the values in a protobuf mtrpb.FieldMetricBatch sent as the request body.
+Values are saved in a single transaction.  The status of each value is returned in a
+mtrpb.FieldMetricBatchResult in the same order as the request.  Codes for each value are the same
+as for a single value sent to fieldMetricPut e.g., 400 for NaN or Inf.  A value that fails does not stop the other
+values in the batch from being saved.  See backfill for sending old data.
+*/
+func fieldMetricBatchPost(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var req mtrpb.FieldMetricBatch
+
+	if res := readBatch(r, &req); !res.Ok {
+		return res
+	}
+
+	if len(req.Value) > maxBatch {
+		return weft.BadRequest("too many values in batch")
+	}
+
+	result := mtrpb.FieldMetricBatchResult{Result: make([]*mtrpb.BatchStatus, len(req.Value))}
+	bf := backfill(r)
+	last := make(map[deviceType]int64)
+	var in []*mtrpb.FieldMetricBatchValue
+	var index []int // the index in req.Value for each value in in
+
+	for i, v := range req.Value {
+		if bf {
+			k := deviceType{deviceID: v.DeviceID, typeID: v.TypeID}
+			if l, ok := last[k]; ok && v.Seconds < l {
+				result.Result[i] = &mtrpb.BatchStatus{Code: int32(statusNotInOrder.Code), Msg: statusNotInOrder.Msg}
+				continue
+			}
+			last[k] = v.Seconds
+		}
+
+		if v.DeviceID == "" || v.TypeID == "" {
+			result.Result[i] = &mtrpb.BatchStatus{Code: http.StatusBadRequest, Msg: "missing deviceID or typeID"}
+			continue
+		}
+
+		// the same values are valid as for fieldMetricPut.
+		if err := validValue(batchValue(v)); err != nil {
+			result.Result[i] = &mtrpb.BatchStatus{Code: http.StatusBadRequest, Msg: "invalid value"}
+			continue
+		}
+
+		in = append(in, v)
+		index = append(index, i)
+	}
+
+	status, err := storage.fieldMetricBatchSave(in, bf)
+	if err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	for j, i := range index {
+		result.Result[i] = status[j]
+	}
+
+	return writeBatchResult(&result, h, b)
+}
+
+// batchValue returns ValueDouble if Doubles is set or it is not 0, otherwise Value from older clients.
+func batchValue(v *mtrpb.FieldMetricBatchValue) float64 {
+	if v.Doubles || v.ValueDouble != 0 {
+		return v.ValueDouble
+	}
+
+	return float64(v.Value)
+}
+
+// fieldMetricBatchInsert saves v in txn.  A savepoint is used so that a failed insert
+// does not abort txn.  If backfill is true a value that is already saved is not an error.
+func fieldMetricBatchInsert(txn *sql.Tx, v *mtrpb.FieldMetricBatchValue, backfill bool) *weft.Result {
+	var err error
+
+	if _, err = txn.Exec(`SAVEPOINT batch_value`); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	if autoRegister {
+		if err = registerDevice(txn, v.DeviceID, v.TypeID); err != nil {
+			if _, errR := txn.Exec(`ROLLBACK TO SAVEPOINT batch_value`); errR != nil {
+				return weft.InternalServerError(errR)
+			}
+			if !isUniqueViolation(err) {
+				return weft.InternalServerError(err)
+			}
+		}
+	}
+
+	t := time.Unix(v.Seconds, 0).UTC()
+
+	var result sql.Result
+
+	if result, err = txn.Exec(`INSERT INTO field.metric(devicePK, typePK, rate_limit, time, value)
+				SELECT devicePK, typePK, $3::bigint / min_interval * min_interval, $4, $5
+				FROM field.device, field.type
+				WHERE deviceID = $1
+				AND typeID = $2`,
+		v.DeviceID, v.TypeID, t.Unix(), t, batchValue(v)); err != nil {
+		if _, errR := txn.Exec(`ROLLBACK TO SAVEPOINT batch_value`); errR != nil {
+			return weft.InternalServerError(errR)
+		}
+		if err, ok := err.(*pq.Error); ok && err.Code == errorUniqueViolation {
+			if backfill {
+				return fieldMetricDuplicate(txn, v)
+			}
+			return &statusTooManyRequests
+		} else {
+			return weft.InternalServerError(err)
+		}
+	}
+
+	if _, err = txn.Exec(`RELEASE SAVEPOINT batch_value`); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	var i int64
+	if i, err = result.RowsAffected(); err != nil {
+		return weft.InternalServerError(err)
+	}
+	if i != 1 {
+		return weft.BadRequest("Didn't create row, check your query parameters exist")
+	}
+
+	return &weft.StatusOK
+}
+
+// fieldMetricDuplicate returns 200 if v is already saved with the same time and value
+// otherwise 429 (there is a different value for the interval).
+func fieldMetricDuplicate(txn *sql.Tx, v *mtrpb.FieldMetricBatchValue) *weft.Result {
+	var exists bool
+
+	if err := txn.QueryRow(`SELECT EXISTS(SELECT 1 FROM field.metric
+				JOIN field.device USING (devicePK)
+				JOIN field.type USING (typePK)
+				WHERE deviceID = $1
+				AND typeID = $2
+				AND time = $3
+				AND value = $4)`,
+		v.DeviceID, v.TypeID, time.Unix(v.Seconds, 0).UTC(), batchValue(v)).Scan(&exists); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	if exists {
+		return &weft.StatusOK
+	}
+
+	return &statusTooManyRequests
+}
+
+// fieldMetricSummary updates the summary value for the device and type in txn if t is newer.
+func fieldMetricSummary(txn *sql.Tx, deviceID, typeID string, t time.Time, value float64) *weft.Result {
+	var err error
+	var result sql.Result
+
+	if result, err = txn.Exec(`UPDATE field.metric_summary SET time = $3, value = $4
+				WHERE time < $3
+				AND devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
+				AND typePK = (SELECT typePK FROM field.type WHERE typeID = $2)`,
+		deviceID, typeID, t, value); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	var i int64
+	if i, err = result.RowsAffected(); err != nil {
+		return weft.InternalServerError(err)
+	}
+	if i == 1 {
+		return &weft.StatusOK
+	}
+
+	// Either the value is old or it's the first time we've seen this metric.
+	// Insert only if there is no summary row yet so the transaction isn't aborted.
+	if _, err = txn.Exec(`INSERT INTO field.metric_summary(devicePK, typePK, time, value)
+				SELECT devicePK, typePK, $3, $4
+				FROM field.device, field.type
+				WHERE deviceID = $1
+				AND typeID = $2
+				AND NOT EXISTS (SELECT 1 FROM field.metric_summary
+					WHERE devicePK = field.device.devicePK AND typePK = field.type.typePK)`,
+		deviceID, typeID, t, value); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	return &weft.StatusOK
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"github.com/GeoNet/mtr/mtrpb"
+	wt "github.com/GeoNet/weft/wefttest"
+	"github.com/golang/protobuf/proto"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// postBatch posts m to the url on the test server and unmarshals the response into res.
+func postBatch(url string, m, res proto.Message, t *testing.T) {
+	by, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", testServer.URL+url, bytes.NewReader(by))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth(userW, keyW)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+
+	resp, err := wt.Client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", resp.StatusCode, string(b))
+	}
+
+	if err = proto.Unmarshal(b, res); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFieldMetricBatch(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	b := mtrpb.FieldMetricBatch{
+		Value: []*mtrpb.FieldMetricBatchValue{
+			{DeviceID: "gps-taupoairport", TypeID: "voltage", Seconds: now.Add(time.Minute * -2).Unix(), Value: 14000},
+			{DeviceID: "gps-taupoairport", TypeID: "voltage", Seconds: now.Add(time.Minute * -1).Unix(), Value: 14100},
+			// same minute as the value before.
+			{DeviceID: "gps-taupoairport", TypeID: "voltage", Seconds: now.Add(time.Second * -30).Unix(), Value: 14200},
+			{DeviceID: "NOT_THERE", TypeID: "voltage", Seconds: now.Unix(), Value: 14300},
+			// invalid values are rejected the same as for fieldMetricPut.
+			{DeviceID: "gps-taupoairport", TypeID: "voltage", Seconds: now.Unix(), ValueDouble: math.NaN()},
+			{DeviceID: "gps-taupoairport", TypeID: "voltage", Seconds: now.Unix(), ValueDouble: math.Inf(1)},
+		},
+	}
+
+	var r mtrpb.FieldMetricBatchResult
+
+	postBatch("/field/metric/batch", &b, &r, t)
+
+	checkBatchResult(r.Result, []int32{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusBadRequest,
+		http.StatusBadRequest, http.StatusBadRequest}, t)
+
+	// The summary should have the newest value.
+	var v float64
+	var tm time.Time
+
+	if err := db.QueryRow(`SELECT time, value FROM field.metric_summary
+				JOIN field.device USING (devicepk)
+				JOIN field.type USING (typepk)
+				WHERE deviceID = 'gps-taupoairport' AND typeID = 'voltage'`).Scan(&tm, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v != 14100 {
+		t.Errorf("expected summary value 14100 got %g", v)
+	}
+
+	if !tm.Equal(now.Add(time.Minute * -1)) {
+		t.Errorf("expected summary time %s got %s", now.Add(time.Minute*-1), tm)
+	}
+
+	// Only POST is allowed.
+	get := wt.Request{ID: wt.L(), URL: "/field/metric/batch", Method: "GET", Status: http.StatusMethodNotAllowed}
+	if _, err := get.Do(testServer.URL); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFieldMetricBackfill(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	b := mtrpb.FieldMetricBatch{
+		Value: []*mtrpb.FieldMetricBatchValue{
+			{DeviceID: "gps-taupoairport", TypeID: "voltage", Seconds: now.Add(time.Minute * -1).Unix(), Value: 14100},
+		},
+	}
+
+	var r mtrpb.FieldMetricBatchResult
+
+	postBatch("/field/metric/batch", &b, &r, t)
+
+	checkBatchResult(r.Result, []int32{http.StatusOK}, t)
+
+	b = mtrpb.FieldMetricBatch{
+		Value: []*mtrpb.FieldMetricBatchValue{
+			{DeviceID: "gps-taupoairport", TypeID: "voltage", Seconds: now.Add(time.Minute * -10).Unix(), Value: 13000},
+			{DeviceID: "gps-taupoairport", TypeID: "voltage", Seconds: now.Add(time.Minute * -9).Unix(), Value: 13100},
+			// resent value is saved.
+			{DeviceID: "gps-taupoairport", TypeID: "voltage", Seconds: now.Add(time.Minute * -9).Unix(), Value: 13100},
+			// different value for the interval.
+			{DeviceID: "gps-taupoairport", TypeID: "voltage", Seconds: now.Add(time.Minute * -9).Unix(), Value: 13200},
+			// out of order.
+			{DeviceID: "gps-taupoairport", TypeID: "voltage", Seconds: now.Add(time.Minute * -20).Unix(), Value: 13300},
+			// already saved.
+			{DeviceID: "gps-taupoairport", TypeID: "voltage", Seconds: now.Add(time.Minute * -1).Unix(), Value: 14100},
+		},
+	}
+
+	r.Reset()
+
+	postBatch("/field/metric/batch?backfill=true", &b, &r, t)
+
+	checkBatchResult(r.Result, []int32{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests,
+		http.StatusBadRequest, http.StatusOK}, t)
+
+	// The summary should not be changed by old values.
+	var v float64
+
+	if err := db.QueryRow(`SELECT value FROM field.metric_summary
+				JOIN field.device USING (devicepk)
+				JOIN field.type USING (typepk)
+				WHERE deviceID = 'gps-taupoairport' AND typeID = 'voltage'`).Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v != 14100 {
+		t.Errorf("expected summary value 14100 got %g", v)
+	}
+}
+
+func TestBatchValue(t *testing.T) {
+	in := []struct {
+		v        mtrpb.FieldMetricBatchValue
+		expected float64
+	}{
+		// an explicit 0 double.
+		{mtrpb.FieldMetricBatchValue{Doubles: true, Value: 14000}, 0},
+		{mtrpb.FieldMetricBatchValue{Doubles: true, ValueDouble: 12.5}, 12.5},
+		// a client that doesn't set the flag.
+		{mtrpb.FieldMetricBatchValue{ValueDouble: 12.5, Value: 12}, 12.5},
+		// integers from older clients.
+		{mtrpb.FieldMetricBatchValue{Value: 14000}, 14000},
+	}
+
+	for i, v := range in {
+		if r := batchValue(&v.v); r != v.expected {
+			t.Errorf("%d expected %g got %g", i, v.expected, r)
+		}
+	}
+}
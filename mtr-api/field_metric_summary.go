@@ -2,7 +2,7 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
+	"encoding/json"
 	"fmt"
 	"github.com/GeoNet/map180"
 	"github.com/GeoNet/mtr/mtrpb"
@@ -20,52 +20,130 @@ type point struct {
 	x, y                float64
 }
 
-// TODO: returns weft.NotFound when query result is empty?
-func fieldLatestProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	typeID := r.URL.Query().Get("typeID")
+// webMercatorRadius is the radius (m) of the sphere for EPSG:3857.
+const webMercatorRadius = 6378137.0
+
+/*
+mapBounds returns the lower left and upper right corners (EPSG:4326) for the bbox query parameter.
+It is the same as the polygon from map180.BboxToWKTPolygon.
+*/
+func mapBounds(bbox string) (llx, lly, urx, ury float64, err error) {
+	var wkt string
+	if wkt, err = map180.BboxToWKTPolygon(bbox); err != nil {
+		return
+	}
+
+	var x, y float64
+
+	_, err = fmt.Sscanf(wkt, "POLYGON((%f %f,%f %f,%f %f,%f %f,%f %f))", &llx, &lly, &x, &y, &urx, &ury, &x, &y, &x, &y)
+
+	return
+}
+
+/*
+mapPoint returns the point on the SVG map raw for latitude and longitude.  ok is false if the point isn't
+inside the bounds (see mapBounds).  Does not handle maps that cross 180 or crossing the equator.
+*/
+func mapPoint(raw map180.Raw, llx, lly, urx, ury, latitude, longitude float64) (p point, ok bool) {
+	if longitude <= llx || longitude >= urx || latitude <= lly || latitude >= ury {
+		return
+	}
 
-	var err error
-	var rows *sql.Rows
-
-	switch typeID {
-	case "":
-		rows, err = dbR.Query(`select deviceID, modelID, typeid, time, value, lower, upper, scale
-		FROM field.metric_summary
-		JOIN field.device using (devicePK)
-		JOIN field.model using (modelPK)
-		JOIN field.threshold using (devicePK, typePK)
-		JOIN field.type using (typePK)`)
+	p = point{
+		latitude:  latitude,
+		longitude: longitude,
+		x:         webMercatorRadius * longitude * math.Pi / 180.0,
+		y:         webMercatorRadius * math.Log(math.Tan(math.Pi/4.0+latitude*math.Pi/360.0)) * -1,
+	}
+
+	switch {
+	case raw.CrossesCentral && p.longitude > -180.0 && p.longitude < 0.0:
+		p.x = (p.x + map180.Width3857 - raw.LLX) * raw.DX
+		p.y = (p.y - math.Abs(raw.YShift)) * raw.DX
+	case p.longitude > 0.0:
+		p.x = (p.x - math.Abs(raw.XShift)) * raw.DX
+		p.y = (p.y - math.Abs(raw.YShift)) * raw.DX
 	default:
-		rows, err = dbR.Query(`select deviceID, modelID, typeid, time, value, lower, upper, scale
-		FROM field.metric_summary
-		JOIN field.device using (devicePK)
-		JOIN field.model using (modelPK)
-		JOIN field.threshold using (devicePK, typePK)
-		JOIN field.type using (typePK)
-		WHERE typeID = $1;`, typeID)
+		p.x = (p.x + math.Abs(raw.XShift)) * raw.DX
+		p.y = (p.y - math.Abs(raw.YShift)) * raw.DX
+	}
+
+	return p, true
+}
+
+// mapRaw returns the SVG map for the bbox and width query parameters.  It is unavailable without the
+// map data in the database (see MTR_STORE).
+func mapRaw(r *http.Request) (raw map180.Raw, llx, lly, urx, ury float64, res *weft.Result) {
+	bbox := r.URL.Query().Get("bbox")
+
+	if err := map180.ValidBbox(bbox); err != nil {
+		res = weft.BadRequest(err.Error())
+		return
 	}
+
+	width, err := strconv.Atoi(r.URL.Query().Get("width"))
 	if err != nil {
-		return weft.InternalServerError(err)
+		res = weft.BadRequest("invalid width")
+		return
 	}
 
-	defer rows.Close()
+	if wm == nil {
+		res = weft.ServiceUnavailableError(fmt.Errorf("no map data"))
+		return
+	}
+
+	if raw, err = wm.MapRaw(bbox, width); err != nil {
+		res = weft.InternalServerError(err)
+		return
+	}
+
+	if llx, lly, urx, ury, err = mapBounds(bbox); err != nil {
+		res = weft.InternalServerError(err)
+		return
+	}
+
+	res = &weft.StatusOK
+	return
+}
+
+// TODO: returns weft.NotFound when query result is empty?
+func fieldLatestProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	summaries, err := storage.fieldSummaries(r.URL.Query().Get("typeID"))
+	if err != nil {
+		return weft.InternalServerError(err)
+	}
 
-	var t time.Time
 	var fmlr mtrpb.FieldMetricSummaryResult
 
-	for rows.Next() {
-		var fmr mtrpb.FieldMetricSummary
+	now := time.Now().UTC()
 
-		if err = rows.Scan(&fmr.DeviceID, &fmr.ModelID, &fmr.TypeID, &t, &fmr.Value,
-			&fmr.Lower, &fmr.Upper, &fmr.Scale); err != nil {
-			return weft.InternalServerError(err)
+	for _, s := range summaries {
+		if s.thresholdSource == "" {
+			continue
 		}
 
-		fmr.Seconds = t.Unix()
+		state := metricState(now, s.t, s.late, s.value, s.th, s.outSince, s.anomaly)
+
+		fmr := mtrpb.FieldMetricSummary{
+			DeviceID:        s.deviceID,
+			ModelID:         s.modelID,
+			TypeID:          s.typeID,
+			Seconds:         s.t.Unix(),
+			ValueDouble:     s.value,
+			LowerDouble:     s.th.lower,
+			UpperDouble:     s.th.upper,
+			ThresholdSource: s.thresholdSource,
+			Anomaly:         s.anomaly,
+			Scale:           s.scale,
+			Pending:         s.pending,
+			Late:            isLate(now, s.t, s.late),
+			Bad:             state == metricBad,
+			Maintenance:     maintenanceState(state, s.silenced) == metricMaintenance,
+		}
+		fieldMetricSummaryRound(&fmr)
 
 		fmlr.Result = append(fmlr.Result, &fmr)
 	}
-	rows.Close()
 
 	var by []byte
 
@@ -79,86 +157,47 @@ func fieldLatestProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Res
 }
 
 func fieldLatestSvg(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	var rows *sql.Rows
-	var width int
-	var err error
-
-	typeID := r.URL.Query().Get("typeID")
-	bbox := r.URL.Query().Get("bbox")
-
-	if err = map180.ValidBbox(bbox); err != nil {
-		return weft.BadRequest(err.Error())
-	}
-
-	if width, err = strconv.Atoi(r.URL.Query().Get("width")); err != nil {
-		return weft.BadRequest("invalid width")
-	}
-
-	var raw map180.Raw
-	if raw, err = wm.MapRaw(bbox, width); err != nil {
-		return weft.InternalServerError(err)
+	raw, llx, lly, urx, ury, res := mapRaw(r)
+	if !res.Ok {
+		return res
 	}
 
-	var bboxWkt string
-	if bboxWkt, err = map180.BboxToWKTPolygon(bbox); err != nil {
-		return weft.InternalServerError(err)
-	}
-
-	// TODO: handle maps that cross 180 (ST_Within)
-	if rows, err = dbR.Query(`WITH p as (SELECT geom, time, value, lower, upper,
-			ST_Transform(geom::geometry, 3857) as pt
-			FROM field.metric_summary
-			JOIN field.device using (devicePK)
-			JOIN field.threshold using (devicePK, typePK)
-			JOIN field.type using (typePK)
-			WHERE typeID = $1)
-			SELECT ST_X(pt), ST_Y(pt)*-1, ST_X(geom::geometry), ST_Y(geom::geometry), time, value, lower, upper FROM p
-			WHERE ST_Within(geom::geometry, ST_GeomFromText($2, 4326))`, typeID, bboxWkt); err != nil {
+	summaries, err := storage.fieldSummaries(r.URL.Query().Get("typeID"))
+	if err != nil {
 		return weft.InternalServerError(err)
 	}
-	defer rows.Close()
 
-	ago := time.Now().UTC().Add(time.Hour * -3)
+	now := time.Now().UTC()
 
 	var late []point
+	var maintenance []point
 	var good []point
 	var bad []point
 	var dunno []point
 
-	for rows.Next() {
-		var p point
-		var t time.Time
-		var min, max, v int
-
-		if err = rows.Scan(&p.x, &p.y, &p.longitude, &p.latitude, &t, &v, &min, &max); err != nil {
-			return weft.InternalServerError(err)
+	for _, s := range summaries {
+		if s.thresholdSource == "" || s.pending {
+			continue
 		}
 
-		// Does not handle crossing the equator.
-		switch {
-		case raw.CrossesCentral && p.longitude > -180.0 && p.longitude < 0.0:
-			p.x = (p.x + map180.Width3857 - raw.LLX) * raw.DX
-			p.y = (p.y - math.Abs(raw.YShift)) * raw.DX
-		case p.longitude > 0.0:
-			p.x = (p.x - math.Abs(raw.XShift)) * raw.DX
-			p.y = (p.y - math.Abs(raw.YShift)) * raw.DX
-		default:
-			p.x = (p.x + math.Abs(raw.XShift)) * raw.DX
-			p.y = (p.y - math.Abs(raw.YShift)) * raw.DX
-
+		p, ok := mapPoint(raw, llx, lly, urx, ury, s.latitude, s.longitude)
+		if !ok {
+			continue
 		}
-		switch {
-		case t.Before(ago):
+
+		switch maintenanceState(metricState(now, s.t, s.late, s.value, s.th, s.outSince, s.anomaly), s.silenced) {
+		case metricMaintenance:
+			maintenance = append(maintenance, p)
+		case metricLate:
 			late = append(late, p)
-		case min == 0 && max == 0:
+		case metricUnknown:
 			dunno = append(dunno, p)
-		case v < min || v > max:
+		case metricBad:
 			bad = append(bad, p)
 		default:
 			good = append(good, p)
 		}
 	}
-	rows.Close()
 
 	b.WriteString(`<?xml version="1.0"?>`)
 	b.WriteString(fmt.Sprintf("<svg  viewBox=\"0 0 %d %d\"  xmlns=\"http://www.w3.org/2000/svg\">",
@@ -191,67 +230,109 @@ func fieldLatestSvg(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Resul
 	}
 	b.WriteString("</g>")
 
+	b.WriteString("<g style=\"stroke: #999999; fill: #999999; \">") // grey
+	for _, p := range maintenance {
+		b.WriteString(fmt.Sprintf("<circle cx=\"%.1f\" cy=\"%.1f\" r=\"%d\"/>", p.x, p.y, 5))
+	}
+	b.WriteString("</g>")
+
 	b.WriteString("</svg>")
 
 	return &weft.StatusOK
 }
 
-func fieldLatestGeoJSON(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	var rows *sql.Rows
-	var err error
+// geoJSONPoint is a GeoJSON point feature.
+type geoJSONPoint struct {
+	Type     string `json:"type"`
+	Geometry struct {
+		Type        string     `json:"type"`
+		Coordinates [2]float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties interface{} `json:"properties"`
+}
 
-	typeID := r.URL.Query().Get("typeID")
+// geoJSONFeatures is a GeoJSON feature collection.
+type geoJSONFeatures struct {
+	Type     string         `json:"type"`
+	Features []geoJSONPoint `json:"features"`
+}
+
+func newGeoJSONPoint(latitude, longitude float64, properties interface{}) geoJSONPoint {
+	p := geoJSONPoint{Type: "Feature", Properties: properties}
+	p.Geometry.Type = "Point"
+	p.Geometry.Coordinates = [2]float64{longitude, latitude}
+
+	return p
+}
+
+// fieldLatestFeature is the properties for a field metric in fieldLatestGeoJSON.
+type fieldLatestFeature struct {
+	Time            time.Time `json:"time"`
+	Value           float64   `json:"value"`
+	Lower           float64   `json:"lower"`
+	Upper           float64   `json:"upper"`
+	ThresholdSource string    `json:"thresholdsource"`
+	DeviceID        string    `json:"deviceid"`
+	TypeID          string    `json:"typeid"`
+	Late            bool      `json:"late"`
+	Anomaly         string    `json:"anomaly"`
+	Maintenance     bool      `json:"maintenance"`
+}
 
-	var d string
-	err = db.QueryRow("select typeID FROM field.type where typeID = $1", typeID).Scan(&d)
+func fieldLatestGeoJSON(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	typeID := r.URL.Query().Get("typeID")
 
-	if err == sql.ErrNoRows {
+	switch _, err := storage.fieldTypeByID(typeID); err {
+	case nil:
+	case errNotFound:
 		return &weft.NotFound
-	}
-	if err != nil {
+	default:
 		return weft.ServiceUnavailableError(err)
 	}
 
-	if rows, err = dbR.Query(`
-		WITH p as (SELECT geom, time, value, lower, upper, deviceid, typeid
-		FROM field.metric_summary
-		JOIN field.device using (devicePK)
-		JOIN field.threshold using (devicePK, typePK)
-		JOIN field.type using (typePK)
-		WHERE typeID = $1)
-		SELECT row_to_json(fc)
-		FROM ( SELECT 'FeatureCollection' as type, COALESCE(array_to_json(array_agg(f)), '[]') as features
-		from (SELECT 'Feature' as type,
-				ST_AsGeoJSON(p.geom)::json as geometry,
-				row_to_json(
-					(SELECT l FROM
-						(
-						SELECT
-						"time",
-						value,
-						lower,
-						upper,
-						deviceid,
-						typeid
-						) as l
-					)
-				) as properties FROM p
-		) as f ) as fc`, typeID); err != nil {
+	summaries, err := storage.fieldSummaries(typeID)
+	if err != nil {
 		return weft.InternalServerError(err)
 	}
-	defer rows.Close()
 
-	var gj string
+	now := time.Now().UTC()
 
-	if rows.Next() {
+	fc := geoJSONFeatures{Type: "FeatureCollection", Features: []geoJSONPoint{}}
 
-		if err = rows.Scan(&gj); err != nil {
-			return weft.InternalServerError(err)
+	for _, s := range summaries {
+		if s.thresholdSource == "" || s.pending {
+			continue
 		}
+
+		state := metricState(now, s.t, s.late, s.value, s.th, s.outSince, s.anomaly)
+
+		fc.Features = append(fc.Features, newGeoJSONPoint(s.latitude, s.longitude, fieldLatestFeature{
+			Time:            s.t,
+			Value:           s.value,
+			Lower:           s.th.lower,
+			Upper:           s.th.upper,
+			ThresholdSource: s.thresholdSource,
+			DeviceID:        s.deviceID,
+			TypeID:          s.typeID,
+			Late:            isLate(now, s.t, s.late),
+			Anomaly:         s.anomaly,
+			Maintenance:     maintenanceState(state, s.silenced) == metricMaintenance,
+		}))
+	}
+
+	var by []byte
+	if by, err = json.Marshal(fc); err != nil {
+		return weft.InternalServerError(err)
 	}
 
-	rows.Close()
-	b.WriteString(gj)
+	b.Write(by)
 
 	return &weft.StatusOK
 }
+
+// fieldMetricSummaryRound sets the integer value and thresholds in s, for older clients, from the doubles.
+func fieldMetricSummaryRound(s *mtrpb.FieldMetricSummary) {
+	s.Value = roundInt32(s.ValueDouble)
+	s.Lower = roundInt32(s.LowerDouble)
+	s.Upper = roundInt32(s.UpperDouble)
+}
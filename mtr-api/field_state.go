@@ -2,74 +2,88 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
+	"encoding/csv"
+	"fmt"
 	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/mtr/ts"
 	"github.com/GeoNet/weft"
 	"github.com/golang/protobuf/proto"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// severities for field states.
+const (
+	stateOK       = 0
+	stateWarning  = 1
+	stateCritical = 2
+)
+
+// fieldStateSeverity is SQL for the severity of a state (aliased s) joined to field.state_value (aliased v).
+// On is ok and off is critical for on/off states.
+const fieldStateSeverity = `COALESCE(v.severity, CASE WHEN s.value THEN 0 ELSE 2 END)`
+
 func fieldStatePut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	q := r.URL.Query()
 	deviceID := q.Get("deviceID")
 	typeID := q.Get("typeID")
 
-	var err error
-	var value bool
-	if value, err = strconv.ParseBool(q.Get("value")); err != nil {
-		return weft.BadRequest("invalid value")
+	value, state, res := fieldStateValue(typeID, q.Get("value"))
+	if !res.Ok {
+		return res
 	}
 
+	var err error
 	var t time.Time
 	if t, err = time.Parse(time.RFC3339, q.Get("time")); err != nil {
 		return weft.BadRequest("invalid time")
 	}
 
-	var result sql.Result
-	if result, err = db.Exec(`UPDATE field.state SET
-				time = $3, value = $4
-				WHERE devicePK = (SELECT devicePK from field.device WHERE deviceID = $1)
-				AND typePK = (SELECT typePK from field.state_type WHERE typeID = $2)`,
-		deviceID, typeID, t, value); err != nil {
+	switch err = storage.fieldStateSave(deviceID, typeID, t, value, state); err {
+	case nil:
+		return &weft.StatusOK
+	case errNotFound:
+		return weft.InternalServerError(fmt.Errorf("no rows affected, check your query."))
+	default:
 		return weft.InternalServerError(err)
 	}
+}
 
-	// If no rows change either the values are old or it's the first time we've seen this metric.
-	var u int64
-	if u, err = result.RowsAffected(); err != nil {
-		return weft.InternalServerError(err)
+/*
+fieldStateValue returns the on/off value and the enumerated state for v.  Types with values (see
+fieldStateValuePut) only accept those values and value is true when the severity is ok.  Other types
+are on/off and state is empty.
+*/
+func fieldStateValue(typeID, v string) (bool, string, *weft.Result) {
+	values, err := storage.fieldStateValues(typeID)
+	if err != nil {
+		return false, "", weft.InternalServerError(err)
 	}
 
-	if u == 1 {
-		return &weft.StatusOK
-	} else if result, err = db.Exec(`INSERT INTO field.state(devicePK, typePK, time, value)
-					SELECT devicePK, typePK, $3, $4
-					FROM field.device, field.state_type
-					WHERE deviceID = $1
-					AND typeID = $2`,
-		deviceID, typeID, t, value); err == nil {
-
-		var i int64
-		if i, err = result.RowsAffected(); err != nil {
-			return weft.InternalServerError(err)
-		}
-		if i == 1 {
-			return &weft.StatusOK
+	for _, s := range values {
+		if s.Value == v {
+			return s.Severity == stateOK, v, &weft.StatusOK
 		}
 	}
 
-	return weft.InternalServerError(err)
+	if len(values) > 0 {
+		return false, "", weft.BadRequest("invalid value " + v + " for " + typeID)
+	}
+
+	value, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, "", weft.BadRequest("invalid value")
+	}
+
+	return value, "", &weft.StatusOK
 }
 
 func fieldStateDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	q := r.URL.Query()
 
-	if _, err := db.Exec(`DELETE FROM field.state
-			WHERE devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
-			AND typePK = (SELECT typePK from field.state_type WHERE typeID = $2)`,
-		q.Get("deviceID"), q.Get("typeID")); err != nil {
+	if err := storage.fieldStateDelete(q.Get("deviceID"), q.Get("typeID")); err != nil {
 		return weft.InternalServerError(err)
 	}
 
@@ -78,29 +92,86 @@ func fieldStateDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Res
 
 func fieldStateProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	var err error
-	var rows *sql.Rows
+	var fr mtrpb.FieldStateResult
 
-	if rows, err = dbR.Query(`SELECT deviceID, typeID, time, value
-				FROM field.state
-				JOIN field.device USING (devicePK)
-				JOIN field.state_type USING (typePK)`); err != nil {
+	if fr.Result, err = storage.fieldStates(); err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	var fr mtrpb.FieldStateResult
-	var t time.Time
+	var by []byte
+	if by, err = proto.Marshal(&fr); err != nil {
+		return weft.InternalServerError(err)
+	}
 
-	for rows.Next() {
-		var s mtrpb.FieldState
+	b.Write(by)
 
-		if err = rows.Scan(&s.DeviceID, &s.TypeID, &t, &s.Value); err != nil {
-			return weft.InternalServerError(err)
+	return &weft.StatusOK
+}
+
+// fieldStateChange is a row in field.state_history.
+type fieldStateChange struct {
+	t        time.Time
+	value    bool
+	state    string
+	severity int32
+}
+
+// fieldStateTimeRange returns the startDate and endDate query parameters.  The default is the last 4 weeks.
+func fieldStateTimeRange(r *http.Request) ([]time.Time, *weft.Result) {
+	v := r.URL.Query()
+
+	t1 := time.Now().UTC()
+	t0 := t1.Add(time.Hour * -24 * 28)
+
+	var err error
+
+	if v.Get("startDate") != "" {
+		if t0, err = time.Parse(time.RFC3339, v.Get("startDate")); err != nil {
+			return nil, weft.BadRequest("invalid startDate")
+		}
+	}
+
+	if v.Get("endDate") != "" {
+		if t1, err = time.Parse(time.RFC3339, v.Get("endDate")); err != nil {
+			return nil, weft.BadRequest("invalid endDate")
 		}
+	}
+
+	if !t1.After(t0) {
+		return nil, weft.BadRequest("endDate must be after startDate")
+	}
+
+	return []time.Time{t0, t1}, &weft.StatusOK
+}
+
+func fieldStateHistoryProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
 
-		// Convert from Go's time.Time to unix seconds since epoch discarding nanosecs
-		s.Seconds = t.Unix()
+	timeRange, res := fieldStateTimeRange(r)
+	if !res.Ok {
+		return res
+	}
+
+	_, changes, err := storage.fieldStateHistory(v.Get("deviceID"), v.Get("typeID"), timeRange)
+	switch err {
+	case nil:
+	case errNotFound:
+		return &weft.NotFound
+	default:
+		return weft.InternalServerError(err)
+	}
+
+	var fr mtrpb.FieldStateResult
 
-		fr.Result = append(fr.Result, &s)
+	for _, c := range changes {
+		fr.Result = append(fr.Result, &mtrpb.FieldState{
+			DeviceID: v.Get("deviceID"),
+			TypeID:   v.Get("typeID"),
+			Seconds:  c.t.Unix(),
+			Value:    c.value,
+			State:    c.state,
+			Severity: c.severity,
+		})
 	}
 
 	var by []byte
@@ -112,3 +183,105 @@ func fieldStateProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Resu
 
 	return &weft.StatusOK
 }
+
+func fieldStateHistoryCsv(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	timeRange, res := fieldStateTimeRange(r)
+	if !res.Ok {
+		return res
+	}
+
+	_, changes, err := storage.fieldStateHistory(v.Get("deviceID"), v.Get("typeID"), timeRange)
+	switch err {
+	case nil:
+	case errNotFound:
+		return &weft.NotFound
+	default:
+		return weft.InternalServerError(err)
+	}
+
+	w := csv.NewWriter(b)
+
+	if err = w.Write([]string{"time", v.Get("typeID")}); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	for _, c := range changes {
+		state := c.state
+		if state == "" {
+			state = strconv.FormatBool(c.value)
+		}
+
+		if err = w.Write([]string{c.t.Format(DYGRAPH_TIME_FORMAT), state}); err != nil {
+			return weft.InternalServerError(err)
+		}
+	}
+
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	return &weft.StatusOK
+}
+
+func fieldStateHistorySvg(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	deviceID := v.Get("deviceID")
+	typeID := v.Get("typeID")
+
+	timeRange, res := fieldStateTimeRange(r)
+	if !res.Ok {
+		return res
+	}
+
+	initial, changes, err := storage.fieldStateHistory(deviceID, typeID, timeRange)
+	switch err {
+	case nil:
+	case errNotFound:
+		return &weft.NotFound
+	default:
+		return weft.InternalServerError(err)
+	}
+
+	// the number of times the state changed to off (or not ok) in timeRange.
+	var off int
+
+	for _, c := range changes {
+		if c.severity != stateOK {
+			off++
+		}
+	}
+
+	if initial != nil {
+		changes = append([]fieldStateChange{*initial}, changes...)
+	}
+
+	var s ts.Series
+
+	for _, c := range changes {
+		var value float64
+		switch c.severity {
+		case stateOK:
+			value = 1.0
+		case stateWarning:
+			value = 0.5
+		}
+
+		s.Points = append(s.Points, ts.Point{DateTime: c.t, Value: value})
+	}
+
+	p := ts.Plot{}
+	p.SetXAxis(timeRange[0], timeRange[1])
+	p.SetTitle(fmt.Sprintf("Device: %s, State: %s", deviceID, strings.Title(typeID)))
+	p.SetSubTitle(fmt.Sprintf("%s to %s, off %d times", timeRange[0].Format(time.RFC3339), timeRange[1].Format(time.RFC3339), off))
+	p.AddSeries(s)
+
+	if err = ts.StateTimeline.Draw(p, b); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	return &weft.StatusOK
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/mtr/ts"
+	wt "github.com/GeoNet/weft/wefttest"
+	"github.com/golang/protobuf/proto"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFieldStateHistory checks only changes of state are kept in field.state_history.
+func TestFieldStateHistory(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	in := wt.Requests{
+		{ID: wt.L(), URL: "/field/model?modelID=Trimble+NetR9", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/device?deviceID=test-state-history&modelID=Trimble+NetR9&latitude=-38.74270&longitude=176.08100", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-history&typeID=mains", Method: "DELETE"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-history&typeID=mains&time=2015-05-13T12:00:00Z&value=true", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-history&typeID=mains&time=2015-05-14T01:00:00Z&value=true", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-history&typeID=mains&time=2015-05-14T02:00:00Z&value=false", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-history&typeID=mains&time=2015-05-14T02:30:00Z&value=false", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-history&typeID=mains&time=2015-05-14T03:00:00Z&value=true", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-history&typeID=mains&time=2015-05-14T10:00:00Z&value=false", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-history&typeID=mains&time=2015-05-14T11:00:00Z&value=true", Method: "PUT"},
+		// resending a state is ok.
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-history&typeID=mains&time=2015-05-14T11:00:00Z&value=true", Method: "PUT"},
+	}
+
+	for _, v := range in {
+		if err := doStatus(testServer.URL, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer doStatus(testServer.URL, wt.Request{ID: wt.L(), URL: "/field/device?deviceID=test-state-history", Method: "DELETE"})
+
+	r := wt.Request{ID: wt.L(), URL: "/field/state/history?deviceID=test-state-history&typeID=mains&startDate=2015-05-14T00:00:00Z&endDate=2015-05-15T00:00:00Z",
+		Accept: "application/x-protobuf"}
+
+	b, err := r.Do(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fr mtrpb.FieldStateResult
+
+	if err = proto.Unmarshal(b, &fr); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first change is before startDate and the repeated values are not changes.
+	expected := []struct {
+		t     string
+		value bool
+	}{
+		{t: "2015-05-14T02:00:00Z", value: false},
+		{t: "2015-05-14T03:00:00Z", value: true},
+		{t: "2015-05-14T10:00:00Z", value: false},
+		{t: "2015-05-14T11:00:00Z", value: true},
+	}
+
+	if len(fr.Result) != len(expected) {
+		t.Fatalf("expected %d changes got %d", len(expected), len(fr.Result))
+	}
+
+	for i, v := range expected {
+		tm, err := time.Parse(time.RFC3339, v.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fr.Result[i].Seconds != tm.Unix() || fr.Result[i].Value != v.value {
+			t.Errorf("change %d expected %s %t got %d %t", i, v.t, v.value, fr.Result[i].Seconds, fr.Result[i].Value)
+		}
+	}
+
+	r = wt.Request{ID: wt.L(), URL: "/field/state/history?deviceID=test-state-history&typeID=mains&startDate=2015-05-14T00:00:00Z&endDate=2015-05-15T00:00:00Z",
+		Content: "image/svg+xml"}
+
+	if b, err = r.Do(testServer.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(b), "off 2 times") {
+		t.Error("expected the plot to count 2 off periods")
+	}
+}
+
+// TestFieldStateHistoryOutOfOrder checks that a state sent out of order doesn't leave a later row
+// that is no longer a change of state.
+func TestFieldStateHistoryOutOfOrder(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	in := wt.Requests{
+		{ID: wt.L(), URL: "/field/model?modelID=Trimble+NetR9", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/device?deviceID=test-state-order&modelID=Trimble+NetR9&latitude=-38.74270&longitude=176.08100", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-order&typeID=mains", Method: "DELETE"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-order&typeID=mains&time=2015-05-14T01:00:00Z&value=false", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-order&typeID=mains&time=2015-05-14T03:00:00Z&value=true", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-order&typeID=mains&time=2015-05-14T05:00:00Z&value=false", Method: "PUT"},
+		// out of order.  The mains was on from 02:00 so the change at 03:00 is a repeat.
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-order&typeID=mains&time=2015-05-14T02:00:00Z&value=true", Method: "PUT"},
+		// out of order.  Changes the state at 05:00 to the same as before it.
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-order&typeID=mains&time=2015-05-14T05:00:00Z&value=true", Method: "PUT"},
+	}
+
+	for _, v := range in {
+		if err := doStatus(testServer.URL, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer doStatus(testServer.URL, wt.Request{ID: wt.L(), URL: "/field/device?deviceID=test-state-order", Method: "DELETE"})
+
+	rows, err := db.Query(`SELECT time, value FROM field.state_history
+				JOIN field.device USING (devicePK)
+				JOIN field.state_type USING (typePK)
+				WHERE deviceID = 'test-state-order' AND typeID = 'mains'
+				ORDER BY time ASC`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	expected := []struct {
+		t     string
+		value bool
+	}{
+		{t: "2015-05-14T01:00:00Z", value: false},
+		{t: "2015-05-14T02:00:00Z", value: true},
+	}
+
+	var i int
+
+	for rows.Next() {
+		var tm time.Time
+		var value bool
+
+		if err = rows.Scan(&tm, &value); err != nil {
+			t.Fatal(err)
+		}
+
+		if i < len(expected) && (tm.UTC().Format(time.RFC3339) != expected[i].t || value != expected[i].value) {
+			t.Errorf("change %d expected %s %t got %s %t", i, expected[i].t, expected[i].value, tm.UTC().Format(time.RFC3339), value)
+		}
+
+		i++
+	}
+
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if i != len(expected) {
+		t.Errorf("expected %d changes got %d", len(expected), i)
+	}
+}
+
+// TestFieldStateValue checks enumerated states have the severity declared for their value.
+func TestFieldStateValue(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	in := wt.Requests{
+		{ID: wt.L(), URL: "/field/model?modelID=Trimble+NetR9", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/device?deviceID=test-state-value&modelID=Trimble+NetR9&latitude=-38.74270&longitude=176.08100", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state/type?typeID=test.pump", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state/value?typeID=test.pump&value=running&severity=0", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state/value?typeID=test.pump&value=standby&severity=1", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state/value?typeID=test.pump&value=fault&severity=2", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-value&typeID=test.pump&time=2015-05-14T01:00:00Z&value=running", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-value&typeID=test.pump&time=2015-05-14T02:00:00Z&value=standby", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-value&typeID=test.pump&time=2015-05-14T03:00:00Z&value=fault", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/state?deviceID=test-state-value&typeID=test.pump&time=2015-05-14T04:00:00Z&value=stopped", Method: "PUT", Status: http.StatusBadRequest},
+	}
+
+	for _, v := range in {
+		if err := doStatus(testServer.URL, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer doStatus(testServer.URL, wt.Request{ID: wt.L(), URL: "/field/device?deviceID=test-state-value", Method: "DELETE"})
+	defer doStatus(testServer.URL, wt.Request{ID: wt.L(), URL: "/field/state/type?typeID=test.pump&force=true", Method: "DELETE"})
+
+	r := wt.Request{ID: wt.L(), URL: "/field/state", Accept: "application/x-protobuf"}
+
+	b, err := r.Do(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fr mtrpb.FieldStateResult
+
+	if err = proto.Unmarshal(b, &fr); err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+
+	for _, v := range fr.Result {
+		if v.DeviceID == "test-state-value" && v.TypeID == "test.pump" {
+			found = true
+
+			if v.State != "fault" || v.Severity != stateCritical || v.Value {
+				t.Errorf("expected fault critical false got %s %d %t", v.State, v.Severity, v.Value)
+			}
+		}
+	}
+
+	if !found {
+		t.Error("didn't find the state for test-state-value")
+	}
+
+	r = wt.Request{ID: wt.L(), URL: "/field/state/history?deviceID=test-state-value&typeID=test.pump&startDate=2015-05-14T00:00:00Z&endDate=2015-05-15T00:00:00Z",
+		Accept: "application/x-protobuf"}
+
+	if b, err = r.Do(testServer.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	fr.Reset()
+
+	if err = proto.Unmarshal(b, &fr); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		state    string
+		severity int32
+	}{
+		{state: "running", severity: stateOK},
+		{state: "standby", severity: stateWarning},
+		{state: "fault", severity: stateCritical},
+	}
+
+	if len(fr.Result) != len(expected) {
+		t.Fatalf("expected %d changes got %d", len(expected), len(fr.Result))
+	}
+
+	for i, v := range expected {
+		if fr.Result[i].State != v.state || fr.Result[i].Severity != v.severity {
+			t.Errorf("change %d expected %s %d got %s %d", i, v.state, v.severity, fr.Result[i].State, fr.Result[i].Severity)
+		}
+	}
+
+	r = wt.Request{ID: wt.L(), URL: "/field/state/history?deviceID=test-state-value&typeID=test.pump&startDate=2015-05-14T00:00:00Z&endDate=2015-05-15T00:00:00Z",
+		Content: "image/svg+xml"}
+
+	if b, err = r.Do(testServer.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(b), `fill="orange"`) {
+		t.Error("expected a warning band in the plot")
+	}
+}
+
+func TestStateTimeline(t *testing.T) {
+	t0 := time.Date(2015, 5, 14, 0, 0, 0, 0, time.UTC)
+
+	p := ts.Plot{}
+	p.SetXAxis(t0, t0.Add(time.Hour*24))
+	p.AddSeries(ts.Series{Points: []ts.Point{
+		{DateTime: t0, Value: 1},
+		{DateTime: t0.Add(time.Hour * 6), Value: 0},
+		{DateTime: t0.Add(time.Hour * 12), Value: 1},
+		{DateTime: t0.Add(time.Hour * 18), Value: 0.5},
+	}})
+
+	var b bytes.Buffer
+
+	if err := ts.StateTimeline.Draw(p, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{
+		`<rect x="0" y="0" width="195" height="60" fill="mediumseagreen"/>`,
+		`<rect x="195" y="0" width="195" height="60" fill="tomato"/>`,
+		`<rect x="390" y="0" width="195" height="60" fill="mediumseagreen"/>`,
+		`<rect x="585" y="0" width="195" height="60" fill="orange"/>`,
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("expected %s in the plot", s)
+		}
+	}
+
+	b.Reset()
+
+	if err := ts.StateTimeline.Draw(ts.Plot{}, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(b.String(), "NO DATA") {
+		t.Error("expected NO DATA for an empty plot")
+	}
+}
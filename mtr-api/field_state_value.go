@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/weft"
+	"github.com/golang/protobuf/proto"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/*
+fieldStateValuePut adds or updates an allowed value for a field state type.  A state type with values
+is enumerated and only accepts those values.  Severity is 0 ok, 1 warning, or 2 critical.
+*/
+func fieldStateValuePut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	q := r.URL.Query()
+	typeID := q.Get("typeID")
+	value := q.Get("value")
+
+	if strings.TrimSpace(value) == "" {
+		return weft.BadRequest("empty value")
+	}
+
+	severity, err := strconv.Atoi(q.Get("severity"))
+	if err != nil || severity < stateOK || severity > stateCritical {
+		return weft.BadRequest("severity must be 0 (ok), 1 (warning), or 2 (critical)")
+	}
+
+	switch err = storage.fieldStateValueSave(typeID, value, severity); err {
+	case nil:
+		return &weft.StatusOK
+	case errNotFound:
+		return weft.BadRequest("unknown typeID " + typeID)
+	default:
+		return weft.InternalServerError(err)
+	}
+}
+
+// fieldStateValueDelete deletes an allowed value.  It is a bad request if a device is currently in that state.
+func fieldStateValueDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	q := r.URL.Query()
+	typeID := q.Get("typeID")
+	value := q.Get("value")
+
+	switch err := storage.fieldStateValueDelete(typeID, value); err {
+	case nil:
+		return &weft.StatusOK
+	case errInUse:
+		return weft.BadRequest("there are devices in state " + value + " for " + typeID)
+	default:
+		return weft.InternalServerError(err)
+	}
+}
+
+func fieldStateValueProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var err error
+	var fr mtrpb.FieldStateValueResult
+
+	if fr.Result, err = storage.fieldStateValues(""); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	var by []byte
+	if by, err = proto.Marshal(&fr); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
@@ -2,85 +2,98 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
-	"fmt"
 	"github.com/GeoNet/mtr/mtrpb"
 	"github.com/GeoNet/weft"
 	"github.com/golang/protobuf/proto"
-	"github.com/lib/pq"
 	"net/http"
+	"net/url"
 	"strconv"
 )
 
-func fieldThresholdPut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	v := r.URL.Query()
-	var err error
+// Where the threshold for a field metric comes from.
+const (
+	thresholdDevice = "device"
+	thresholdModel  = "model"
+)
 
-	var lower, upper int
+/*
+fieldThresholdJoin, fieldLower, fieldUpper, fieldFor, fieldHysteresis, and fieldThresholdSource are the SQL for the
+threshold for a field metric.  This is the threshold for the device if there is one, otherwise the threshold for the
+type for the device's model.  If there is no threshold fieldHasThreshold is false, the values are 0, and the source is empty.  Queries using
+them must join field.device and field.type and then fieldThresholdJoin.
+*/
+const (
+	fieldThresholdJoin = `LEFT JOIN field.threshold ON field.threshold.devicePK = field.device.devicePK
+		AND field.threshold.typePK = field.type.typePK
+		LEFT JOIN field.model_threshold ON field.model_threshold.modelPK = field.device.modelPK
+		AND field.model_threshold.typePK = field.type.typePK`
+	fieldLower           = `COALESCE(field.threshold.lower, field.model_threshold.lower, 0)`
+	fieldUpper           = `COALESCE(field.threshold.upper, field.model_threshold.upper, 0)`
+	fieldFor             = `COALESCE(field.threshold.for_seconds, field.model_threshold.for_seconds, 0)`
+	fieldHysteresis      = `COALESCE(field.threshold.hysteresis, field.model_threshold.hysteresis, 0)`
+	fieldThresholdSource = `CASE WHEN field.threshold.devicePK IS NOT NULL THEN 'device'
+		WHEN field.model_threshold.modelPK IS NOT NULL THEN 'model' ELSE '' END`
+	fieldHasThreshold = `(field.threshold.devicePK IS NOT NULL OR field.model_threshold.modelPK IS NOT NULL)`
+)
 
-	if lower, err = strconv.Atoi(v.Get("lower")); err != nil {
-		return weft.BadRequest("invalid lower")
-	}
+/*
+thresholdQuery returns the threshold from the lower and upper query parameters and the optional for (seconds)
+and hysteresis, which default to 0.  With a hysteresis the recovery band, lower + hysteresis to upper - hysteresis,
+must not be empty or a bad metric could never recover.
+*/
+func thresholdQuery(v url.Values) (threshold, *weft.Result) {
+	var th threshold
+	var err error
 
-	if upper, err = strconv.Atoi(v.Get("upper")); err != nil {
-		return weft.BadRequest("invalid upper")
+	if th.lower, err = metricValue(v.Get("lower")); err != nil {
+		return th, weft.BadRequest("invalid lower")
 	}
 
-	deviceID := v.Get("deviceID")
-	typeID := v.Get("typeID")
-
-	var result sql.Result
-
-	// TODO - use upsert with PG 9.5?
+	if th.upper, err = metricValue(v.Get("upper")); err != nil {
+		return th, weft.BadRequest("invalid upper")
+	}
 
-	// return if insert succeeds
-	if result, err = db.Exec(`INSERT INTO field.threshold(devicePK, typePK, lower, upper)
-		SELECT devicePK, typePK, $3, $4
-				FROM field.device, field.type
-				WHERE deviceID = $1
-				AND typeID = $2`,
-		deviceID, typeID, lower, upper); err == nil {
-		var i int64
-		if i, err = result.RowsAffected(); err != nil {
-			return weft.InternalServerError(err)
-		}
-		if i == 1 {
-			return &weft.StatusOK
+	if s := v.Get("for"); s != "" {
+		if th.forSeconds, err = strconv.Atoi(s); err != nil || th.forSeconds < 0 {
+			return th, weft.BadRequest("for must be a number of seconds greater than or equal to 0")
 		}
 	}
 
-	// return if update one row
-	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == errorUniqueViolation {
-		if result, err = db.Exec(`UPDATE field.threshold SET lower=$3, upper=$4
-		WHERE devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
-		AND typePK = (SELECT typePK FROM field.type WHERE typeID = $2)`,
-			deviceID, typeID, lower, upper); err == nil {
-			var i int64
-			if i, err = result.RowsAffected(); err != nil {
-				return weft.InternalServerError(err)
-			}
-			if i == 1 {
-				return &weft.StatusOK
-			}
+	if s := v.Get("hysteresis"); s != "" {
+		if th.hysteresis, err = metricValue(s); err != nil || th.hysteresis < 0 {
+			return th, weft.BadRequest("hysteresis must be greater than or equal to 0")
+		}
+
+		if th.hysteresis > 0 && th.lower+th.hysteresis > th.upper-th.hysteresis {
+			return th, weft.BadRequest("hysteresis is too large for lower and upper")
 		}
 	}
 
-	if err == nil {
-		err = fmt.Errorf("no rows affected, check your query.")
+	return th, nil
+}
+
+func fieldThresholdPut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	th, res := thresholdQuery(v)
+	if res != nil {
+		return res
 	}
 
-	return weft.InternalServerError(err)
+	switch err := storage.fieldThresholdSave(v.Get("deviceID"), v.Get("typeID"), th); err {
+	case nil:
+		return &weft.StatusOK
+	case errNotFound:
+		return weft.BadRequest("Didn't create row, check your query parameters exist")
+	default:
+		return weft.InternalServerError(err)
+	}
 }
 
 func fieldThresholdDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	var err error
-
 	v := r.URL.Query()
 
-	if _, err = db.Exec(`DELETE FROM field.threshold
-		WHERE devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
-		AND typePK = (SELECT typePK FROM field.type WHERE typeID = $2)`,
-		v.Get("deviceID"), v.Get("typeID")); err != nil {
+	if err := storage.fieldThresholdDelete(v.Get("deviceID"), v.Get("typeID")); err != nil {
 		return weft.InternalServerError(err)
 	}
 
@@ -89,25 +102,57 @@ func fieldThresholdDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft
 
 func fieldThresholdProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	var err error
-	var rows *sql.Rows
+	var ts mtrpb.FieldMetricThresholdResult
 
-	if rows, err = dbR.Query(`SELECT deviceID, typeID, lower, upper, scale
-		FROM
-		field.threshold JOIN field.device USING (devicepk)
-		JOIN field.type USING (typepk)`); err != nil {
+	if ts.Result, err = storage.fieldThresholds(); err != nil {
 		return weft.InternalServerError(err)
 	}
 
-	var ts mtrpb.FieldMetricThresholdResult
+	var by []byte
+	if by, err = proto.Marshal(&ts); err != nil {
+		return weft.InternalServerError(err)
+	}
 
-	for rows.Next() {
-		var t mtrpb.FieldMetricThreshold
+	b.Write(by)
 
-		if err = rows.Scan(&t.DeviceID, &t.TypeID, &t.Lower, &t.Upper, &t.Scale); err != nil {
-			return weft.InternalServerError(err)
-		}
+	return &weft.StatusOK
+}
 
-		ts.Result = append(ts.Result, &t)
+// fieldModelThresholdPut sets the threshold for a type for all devices of a model.  A threshold for a device overrides it.
+func fieldModelThresholdPut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	th, res := thresholdQuery(v)
+	if res != nil {
+		return res
+	}
+
+	switch err := storage.fieldModelThresholdSave(v.Get("modelID"), v.Get("typeID"), th); err {
+	case nil:
+		return &weft.StatusOK
+	case errNotFound:
+		return weft.BadRequest("Didn't create row, check your query parameters exist")
+	default:
+		return weft.InternalServerError(err)
+	}
+}
+
+func fieldModelThresholdDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	if err := storage.fieldModelThresholdDelete(v.Get("modelID"), v.Get("typeID")); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	return &weft.StatusOK
+}
+
+func fieldModelThresholdProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var err error
+	var ts mtrpb.FieldModelThresholdResult
+
+	if ts.Result, err = storage.fieldModelThresholds(); err != nil {
+		return weft.InternalServerError(err)
 	}
 
 	var by []byte
@@ -2,32 +2,88 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"github.com/GeoNet/mtr/mtrpb"
 	"github.com/GeoNet/weft"
 	"github.com/golang/protobuf/proto"
 	"net/http"
 )
 
+func fieldTypePut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	cols, res := typeScale(v)
+	if !res.Ok {
+		return res
+	}
+
+	m, res := typeMinInterval(v)
+	if !res.Ok {
+		return res
+	}
+
+	l, res := typeLate(v)
+	if !res.Ok {
+		return res
+	}
+
+	force, res := typeForce(v)
+	if !res.Ok {
+		return res
+	}
+
+	return typeSave(fieldTypeTable, v.Get("typeID"), append(append(cols, m...), l...), force)
+}
+
+func fieldTypeDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	force, res := typeForce(v)
+	if !res.Ok {
+		return res
+	}
+
+	return typeDelete(fieldTypeTable, v.Get("typeID"), force)
+}
+
 func fieldTypeProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	var err error
-	var rows *sql.Rows
+	var ftr mtrpb.FieldTypeResult
 
-	if rows, err = dbR.Query(`SELECT typeID, display FROM field.type ORDER BY typeID ASC`); err != nil {
+	if ftr.Result, err = storage.fieldTypes(); err != nil {
 		return weft.InternalServerError(err)
 	}
-	defer rows.Close()
 
-	var ftr mtrpb.FieldTypeResult
+	var by []byte
+	if by, err = proto.Marshal(&ftr); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
 
-	for rows.Next() {
-		var ft mtrpb.FieldType
+func fieldStateTypePut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	return typeSave(fieldStateTypeTable, r.URL.Query().Get("typeID"), nil, false)
+}
+
+func fieldStateTypeDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
 
-		if err = rows.Scan(&ft.TypeID, &ft.Display); err != nil {
-			return weft.InternalServerError(err)
-		}
+	force, res := typeForce(v)
+	if !res.Ok {
+		return res
+	}
+
+	return typeDelete(fieldStateTypeTable, v.Get("typeID"), force)
+}
 
-		ftr.Result = append(ftr.Result, &ft)
+func fieldStateTypeProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var err error
+	var ftr mtrpb.FieldTypeResult
+
+	if ftr.Result, err = storage.fieldStateTypes(); err != nil {
+		return weft.InternalServerError(err)
 	}
 
 	var by []byte
@@ -14,30 +14,47 @@ var mux = http.NewServeMux()
 
 func init() {
 	mux.HandleFunc("/api-docs", weft.MakeHandlerPage(docHandler))
+	mux.HandleFunc("/alert", weft.MakeHandlerAPI(alertHandler))
 	mux.HandleFunc("/app", weft.MakeHandlerAPI(appHandler))
 	mux.HandleFunc("/app/metric", weft.MakeHandlerAPI(appmetricHandler))
+	mux.HandleFunc("/app/type", weft.MakeHandlerAPI(apptypeHandler))
 	mux.HandleFunc("/application/counter", weft.MakeHandlerAPI(applicationcounterHandler))
 	mux.HandleFunc("/application/metric", weft.MakeHandlerAPI(applicationmetricHandler))
 	mux.HandleFunc("/application/timer", weft.MakeHandlerAPI(applicationtimerHandler))
+	mux.HandleFunc("/archive", weft.MakeHandlerAPI(archiveHandler))
 	mux.HandleFunc("/data/completeness", weft.MakeHandlerAPI(datacompletenessHandler))
 	mux.HandleFunc("/data/completeness/summary", weft.MakeHandlerAPI(datacompletenesssummaryHandler))
 	mux.HandleFunc("/data/completeness/tag", weft.MakeHandlerAPI(datacompletenesstagHandler))
 	mux.HandleFunc("/data/completeness/type", weft.MakeHandlerAPI(datacompletenesstypeHandler))
 	mux.HandleFunc("/data/latency", weft.MakeHandlerAPI(datalatencyHandler))
+	mux.HandleFunc("/data/latency/anomaly", weft.MakeHandlerAPI(datalatencyanomalyHandler))
+	mux.HandleFunc("/data/latency/late", weft.MakeHandlerAPI(datalatencylateHandler))
 	mux.HandleFunc("/data/latency/summary", weft.MakeHandlerAPI(datalatencysummaryHandler))
 	mux.HandleFunc("/data/latency/tag", weft.MakeHandlerAPI(datalatencytagHandler))
 	mux.HandleFunc("/data/latency/threshold", weft.MakeHandlerAPI(datalatencythresholdHandler))
 	mux.HandleFunc("/data/site", weft.MakeHandlerAPI(datasiteHandler))
+	mux.HandleFunc("/data/site/pending", weft.MakeHandlerAPI(datasitependingHandler))
 	mux.HandleFunc("/data/type", weft.MakeHandlerAPI(datatypeHandler))
 	mux.HandleFunc("/field/device", weft.MakeHandlerAPI(fielddeviceHandler))
+	mux.HandleFunc("/field/device/pending", weft.MakeHandlerAPI(fielddevicependingHandler))
 	mux.HandleFunc("/field/metric", weft.MakeHandlerAPI(fieldmetricHandler))
+	mux.HandleFunc("/field/metric/anomaly", weft.MakeHandlerAPI(fieldmetricanomalyHandler))
+	mux.HandleFunc("/field/metric/late", weft.MakeHandlerAPI(fieldmetriclateHandler))
 	mux.HandleFunc("/field/metric/summary", weft.MakeHandlerAPI(fieldmetricsummaryHandler))
 	mux.HandleFunc("/field/metric/tag", weft.MakeHandlerAPI(fieldmetrictagHandler))
 	mux.HandleFunc("/field/metric/threshold", weft.MakeHandlerAPI(fieldmetricthresholdHandler))
 	mux.HandleFunc("/field/model", weft.MakeHandlerAPI(fieldmodelHandler))
+	mux.HandleFunc("/field/model/threshold", weft.MakeHandlerAPI(fieldmodelthresholdHandler))
 	mux.HandleFunc("/field/state", weft.MakeHandlerAPI(fieldstateHandler))
+	mux.HandleFunc("/field/state/history", weft.MakeHandlerAPI(fieldstatehistoryHandler))
 	mux.HandleFunc("/field/state/tag", weft.MakeHandlerAPI(fieldstatetagHandler))
+	mux.HandleFunc("/field/state/type", weft.MakeHandlerAPI(fieldstatetypeHandler))
+	mux.HandleFunc("/field/state/value", weft.MakeHandlerAPI(fieldstatevalueHandler))
 	mux.HandleFunc("/field/type", weft.MakeHandlerAPI(fieldtypeHandler))
+	mux.HandleFunc("/notification", weft.MakeHandlerAPI(notificationHandler))
+	mux.HandleFunc("/prometheus/unmatched", weft.MakeHandlerAPI(prometheusunmatchedHandler))
+	mux.HandleFunc("/retention", weft.MakeHandlerAPI(retentionHandler))
+	mux.HandleFunc("/silence", weft.MakeHandlerAPI(silenceHandler))
 	mux.HandleFunc("/tag", weft.MakeHandlerAPI(tagHandler))
 	mux.HandleFunc("/tag/", weft.MakeHandlerAPI(tagsHandler))
 }
@@ -55,6 +72,34 @@ func docHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 		return &weft.MethodNotAllowed
 	}
 }
+func alertHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{"startDate"}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return alertProto(r, h, b)
+		case "application/json":
+			if res := weft.CheckQuery(r, []string{}, []string{"startDate"}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/json")
+			return alertJSON(r, h, b)
+		default:
+			if res := weft.CheckQuery(r, []string{}, []string{"startDate"}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return alertProto(r, h, b)
+		}
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
 func appHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	switch r.Method {
 	case "GET":
@@ -101,6 +146,34 @@ func appmetricHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Res
 	}
 }
 
+func apptypeHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return appTypeProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"description", "typeID", "unit"}, []string{"force"}); !res.Ok {
+			return res
+		}
+		return appTypePut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"typeID"}, []string{"force"}); !res.Ok {
+			return res
+		}
+		return appTypeDelete(r, h, b)
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
 func applicationcounterHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	switch r.Method {
 	case "PUT":
@@ -137,6 +210,29 @@ func applicationtimerHandler(r *http.Request, h http.Header, b *bytes.Buffer) *w
 	}
 }
 
+func archiveHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return archiveProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"file"}, []string{"applicationID", "deviceID", "siteID"}); !res.Ok {
+			return res
+		}
+		return archivePut(r, h, b)
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
 func datacompletenessHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	switch r.Method {
 	case "GET":
@@ -238,6 +334,16 @@ func datacompletenesstypeHandler(r *http.Request, h http.Header, b *bytes.Buffer
 		default:
 			return &weft.NotAcceptable
 		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"expected", "typeID"}, []string{"force", "minInterval"}); !res.Ok {
+			return res
+		}
+		return dataCompletenessTypePut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"typeID"}, []string{"force"}); !res.Ok {
+			return res
+		}
+		return dataCompletenessTypeDelete(r, h, b)
 	default:
 		return &weft.MethodNotAllowed
 	}
@@ -287,6 +393,62 @@ func datalatencyHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.R
 	}
 }
 
+func datalatencyanomalyHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return dataLatencyAnomalyProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"siteID", "typeID"}, []string{"baselineDays", "deviations", "rate"}); !res.Ok {
+			return res
+		}
+		return dataLatencyAnomalyPut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"siteID", "typeID"}, []string{}); !res.Ok {
+			return res
+		}
+		return dataLatencyAnomalyDelete(r, h, b)
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
+func datalatencylateHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return dataLatencyLateProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"late", "siteID", "typeID"}, []string{}); !res.Ok {
+			return res
+		}
+		return dataLatencyLatePut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"siteID", "typeID"}, []string{}); !res.Ok {
+			return res
+		}
+		return dataLatencyLateDelete(r, h, b)
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
 func datalatencysummaryHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	switch r.Method {
 	case "GET":
@@ -357,7 +519,7 @@ func datalatencythresholdHandler(r *http.Request, h http.Header, b *bytes.Buffer
 			return &weft.NotAcceptable
 		}
 	case "PUT":
-		if res := weft.CheckQuery(r, []string{"lower", "siteID", "typeID", "upper"}, []string{}); !res.Ok {
+		if res := weft.CheckQuery(r, []string{"lower", "siteID", "typeID", "upper"}, []string{"for", "hysteresis"}); !res.Ok {
 			return res
 		}
 		return dataLatencyThresholdPut(r, h, b)
@@ -399,6 +561,24 @@ func datasiteHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Resu
 	}
 }
 
+func datasitependingHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return dataSitePendingProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
 func datatypeHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	switch r.Method {
 	case "GET":
@@ -412,6 +592,16 @@ func datatypeHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Resu
 		default:
 			return &weft.NotAcceptable
 		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"description", "display", "scale", "typeID", "unit"}, []string{"force", "late", "minInterval"}); !res.Ok {
+			return res
+		}
+		return dataTypePut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"typeID"}, []string{"force"}); !res.Ok {
+			return res
+		}
+		return dataTypeDelete(r, h, b)
 	default:
 		return &weft.MethodNotAllowed
 	}
@@ -445,6 +635,24 @@ func fielddeviceHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.R
 	}
 }
 
+func fielddevicependingHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return fieldDevicePendingProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
 func fieldmetricHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	switch r.Method {
 	case "GET":
@@ -489,6 +697,62 @@ func fieldmetricHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.R
 	}
 }
 
+func fieldmetricanomalyHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return fieldMetricAnomalyProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"deviceID", "typeID"}, []string{"baselineDays", "deviations", "rate"}); !res.Ok {
+			return res
+		}
+		return fieldMetricAnomalyPut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"deviceID", "typeID"}, []string{}); !res.Ok {
+			return res
+		}
+		return fieldMetricAnomalyDelete(r, h, b)
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
+func fieldmetriclateHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return fieldMetricLateProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"deviceID", "late", "typeID"}, []string{}); !res.Ok {
+			return res
+		}
+		return fieldMetricLatePut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"deviceID", "typeID"}, []string{}); !res.Ok {
+			return res
+		}
+		return fieldMetricLateDelete(r, h, b)
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
 func fieldmetricsummaryHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	switch r.Method {
 	case "GET":
@@ -565,7 +829,7 @@ func fieldmetricthresholdHandler(r *http.Request, h http.Header, b *bytes.Buffer
 			return &weft.NotAcceptable
 		}
 	case "PUT":
-		if res := weft.CheckQuery(r, []string{"deviceID", "lower", "typeID", "upper"}, []string{}); !res.Ok {
+		if res := weft.CheckQuery(r, []string{"deviceID", "lower", "typeID", "upper"}, []string{"for", "hysteresis"}); !res.Ok {
 			return res
 		}
 		return fieldThresholdPut(r, h, b)
@@ -607,6 +871,34 @@ func fieldmodelHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Re
 	}
 }
 
+func fieldmodelthresholdHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return fieldModelThresholdProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"lower", "modelID", "typeID", "upper"}, []string{"for", "hysteresis"}); !res.Ok {
+			return res
+		}
+		return fieldModelThresholdPut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"modelID", "typeID"}, []string{}); !res.Ok {
+			return res
+		}
+		return fieldModelThresholdDelete(r, h, b)
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
 func fieldstateHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	switch r.Method {
 	case "GET":
@@ -635,6 +927,40 @@ func fieldstateHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Re
 	}
 }
 
+func fieldstatehistoryHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "image/svg+xml":
+			if res := weft.CheckQuery(r, []string{"deviceID", "typeID"}, []string{"endDate", "startDate"}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "image/svg+xml")
+			return fieldStateHistorySvg(r, h, b)
+		case "text/csv":
+			if res := weft.CheckQuery(r, []string{"deviceID", "typeID"}, []string{"endDate", "startDate"}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "text/csv")
+			return fieldStateHistoryCsv(r, h, b)
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{"deviceID", "typeID"}, []string{"endDate", "startDate"}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return fieldStateHistoryProto(r, h, b)
+		default:
+			if res := weft.CheckQuery(r, []string{"deviceID", "typeID"}, []string{"endDate", "startDate"}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "image/svg+xml")
+			return fieldStateHistorySvg(r, h, b)
+		}
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
 func fieldstatetagHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	switch r.Method {
 	case "GET":
@@ -663,6 +989,62 @@ func fieldstatetagHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft
 	}
 }
 
+func fieldstatetypeHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return fieldStateTypeProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"typeID"}, []string{}); !res.Ok {
+			return res
+		}
+		return fieldStateTypePut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"typeID"}, []string{"force"}); !res.Ok {
+			return res
+		}
+		return fieldStateTypeDelete(r, h, b)
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
+func fieldstatevalueHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return fieldStateValueProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"severity", "typeID", "value"}, []string{}); !res.Ok {
+			return res
+		}
+		return fieldStateValuePut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"typeID", "value"}, []string{}); !res.Ok {
+			return res
+		}
+		return fieldStateValueDelete(r, h, b)
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
 func fieldtypeHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	switch r.Method {
 	case "GET":
@@ -676,6 +1058,112 @@ func fieldtypeHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Res
 		default:
 			return &weft.NotAcceptable
 		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"description", "display", "scale", "typeID", "unit"}, []string{"force", "late", "minInterval"}); !res.Ok {
+			return res
+		}
+		return fieldTypePut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"typeID"}, []string{"force"}); !res.Ok {
+			return res
+		}
+		return fieldTypeDelete(r, h, b)
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
+func notificationHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{"startDate"}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return notificationProto(r, h, b)
+		default:
+			if res := weft.CheckQuery(r, []string{}, []string{"startDate"}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return notificationProto(r, h, b)
+		}
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
+func prometheusunmatchedHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return prometheusUnmatchedProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
+func retentionHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return retentionProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"days", "schema"}, []string{"typeID"}); !res.Ok {
+			return res
+		}
+		return retentionPut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"schema", "typeID"}, []string{}); !res.Ok {
+			return res
+		}
+		return retentionDelete(r, h, b)
+	default:
+		return &weft.MethodNotAllowed
+	}
+}
+
+func silenceHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	switch r.Method {
+	case "GET":
+		switch r.Header.Get("Accept") {
+		case "application/x-protobuf":
+			if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+				return res
+			}
+			h.Set("Content-Type", "application/x-protobuf")
+			return silenceProto(r, h, b)
+		default:
+			return &weft.NotAcceptable
+		}
+	case "PUT":
+		if res := weft.CheckQuery(r, []string{"endDate", "reason", "startDate"}, []string{"deviceID", "silenceID", "siteID", "tag", "typeID"}); !res.Ok {
+			return res
+		}
+		return silencePut(r, h, b)
+	case "DELETE":
+		if res := weft.CheckQuery(r, []string{"silenceID"}, []string{}); !res.Ok {
+			return res
+		}
+		return silenceDelete(r, h, b)
 	default:
 		return &weft.MethodNotAllowed
 	}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/GeoNet/weft"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxInfluxErrors limits the number of line errors returned to the client.
+const maxInfluxErrors = 20
+
+var statusNoContent = weft.Result{Ok: true, Code: http.StatusNoContent}
+
+/*
+influxConfig maps InfluxDB line protocol into mtr.  It is read from the JSON file
+in the env var MTR_INFLUX_CONFIG e.g.,
+
+	{"rules": [
+		{"measurement": "disk", "match": {"path": "/"}, "table": "field.metric", "fields": {"used_percent": "disk.hd1"}},
+		{"measurement": "latency", "table": "data.latency", "typeID": "latency.strong"}
+	]}
+
+Rules are tried in order and the first rule for the measurement where all the match tags are equal is used.
+*/
+type influxConfig struct {
+	Rules []influxRule `json:"rules"`
+}
+
+/*
+influxRule maps matching lines into a table.
+
+For "field.metric" the deviceID is the value of DeviceTag (default host).  Fields maps field keys
+to typeIDs, a value is saved for each field in the line that is in Fields.
+
+For "data.latency" the siteID is the value of SiteTag (default site) and the typeID is TypeID or the
+value of TypeTag (default type).  The latency values are read from the fields named by Mean, Min,
+Max, Fifty, and Ninety (defaults mean, min, max, fifty, ninety).  Mean is required.
+
+Values are multiplied by Scale (default 1).
+*/
+type influxRule struct {
+	Measurement string            `json:"measurement"`
+	Match       map[string]string `json:"match"`
+	Table       string            `json:"table"`
+	DeviceTag   string            `json:"deviceTag"`
+	Fields      map[string]string `json:"fields"`
+	SiteTag     string            `json:"siteTag"`
+	TypeID      string            `json:"typeID"`
+	TypeTag     string            `json:"typeTag"`
+	Mean        string            `json:"mean"`
+	Min         string            `json:"min"`
+	Max         string            `json:"max"`
+	Fifty       string            `json:"fifty"`
+	Ninety      string            `json:"ninety"`
+	Scale       float64           `json:"scale"`
+}
+
+var influx = struct {
+	sync.Mutex
+	rules []influxRule
+}{}
+
+// influxPoint is a parsed line of line protocol.
+type influxPoint struct {
+	measurement string
+	tags        map[string]string
+	fields      map[string]float64
+	t           time.Time
+}
+
+func init() {
+	mux.HandleFunc("/write", makeHandlerBatch("influxWrite", influxWrite))
+}
+
+// loadInfluxConfig reads the line protocol mapping rules from the JSON file.
+// An empty file name is no rules (all lines are unmatched).
+func loadInfluxConfig(file string) error {
+	if file == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	return setInfluxConfig(b)
+}
+
+// setInfluxConfig parses and validates the rules in b and makes them the current rules.
+func setInfluxConfig(b []byte) error {
+	var c influxConfig
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return err
+	}
+
+	for i := range c.Rules {
+		r := &c.Rules[i]
+
+		if r.Measurement == "" {
+			return fmt.Errorf("rule %d: empty measurement", i)
+		}
+
+		if r.Scale == 0 {
+			r.Scale = 1
+		}
+
+		switch r.Table {
+		case "field.metric":
+			if r.DeviceTag == "" {
+				r.DeviceTag = "host"
+			}
+			if len(r.Fields) == 0 {
+				return fmt.Errorf("rule %d: empty fields for %s", i, r.Table)
+			}
+		case "data.latency":
+			if r.SiteTag == "" {
+				r.SiteTag = "site"
+			}
+			if r.TypeTag == "" {
+				r.TypeTag = "type"
+			}
+			for _, f := range []struct {
+				s *string
+				d string
+			}{{&r.Mean, "mean"}, {&r.Min, "min"}, {&r.Max, "max"}, {&r.Fifty, "fifty"}, {&r.Ninety, "ninety"}} {
+				if *f.s == "" {
+					*f.s = f.d
+				}
+			}
+		default:
+			return fmt.Errorf("rule %d: invalid table: %s", i, r.Table)
+		}
+	}
+
+	influx.Lock()
+	influx.rules = c.Rules
+	influx.Unlock()
+
+	return nil
+}
+
+/*
+influxWrite receives InfluxDB line protocol.  The optional precision query parameter
+sets the timestamp units (n, u, ms, s; default n).  Lines without a timestamp use the server time.
+
+If any line can't be parsed the request fails with the line numbers of the errors and nothing is saved.
+Otherwise each line is saved using the first matching rule.  Lines that can't be saved
+(e.g., unknown devices or already data for the interval) are returned with their line numbers as a 400 but
+the other lines are still saved (a partial write).  Lines that match no rule are logged and ignored.
+*/
+func influxWrite(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	if res := weft.CheckQuery(r, []string{}, []string{"db", "rp", "precision", "consistency"}); !res.Ok {
+		return res
+	}
+
+	var precision time.Duration
+
+	switch r.URL.Query().Get("precision") {
+	case "", "n", "ns":
+		precision = time.Nanosecond
+	case "u", "us":
+		precision = time.Microsecond
+	case "ms":
+		precision = time.Millisecond
+	case "s":
+		precision = time.Second
+	default:
+		return weft.BadRequest("invalid precision")
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxBatchBytes))
+	if err != nil {
+		return weft.BadRequest("error reading request body")
+	}
+
+	points, lines, errs := parseInflux(string(body), precision, time.Now().UTC())
+	if len(errs) > 0 {
+		return weft.BadRequest(strings.Join(errs, "\n"))
+	}
+
+	influx.Lock()
+	rules := influx.rules
+	influx.Unlock()
+
+	var unmatched int
+
+	for i, p := range points {
+		var rule *influxRule
+		for j := range rules {
+			if rules[j].match(p) {
+				rule = &rules[j]
+				break
+			}
+		}
+
+		if rule == nil {
+			unmatched++
+			continue
+		}
+
+		for _, res := range rule.save(p) {
+			switch {
+			case res.Ok:
+			case res.Code == http.StatusInternalServerError:
+				return res
+			default:
+				errs = append(errs, fmt.Sprintf("line %d: %s", lines[i], res.Msg))
+			}
+		}
+	}
+
+	if unmatched > 0 {
+		log.Printf("influx write: %d lines unmatched", unmatched)
+	}
+
+	if len(errs) > 0 {
+		if len(errs) > maxInfluxErrors {
+			errs = append(errs[:maxInfluxErrors], fmt.Sprintf("and %d more errors", len(errs)-maxInfluxErrors))
+		}
+		return weft.BadRequest("partial write\n" + strings.Join(errs, "\n"))
+	}
+
+	return &statusNoContent
+}
+
+// match returns true if p is for r.Measurement and has all the tag values in r.Match.
+func (r influxRule) match(p influxPoint) bool {
+	if p.measurement != r.Measurement {
+		return false
+	}
+
+	for k, v := range r.Match {
+		if p.tags[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// save saves the values from p.  Returns a result for each value saved.
+func (r influxRule) save(p influxPoint) []*weft.Result {
+	var res []*weft.Result
+
+	scale := func(v float64) float64 {
+		return v * r.Scale
+	}
+
+	switch r.Table {
+	case "field.metric":
+		f := fieldMetric{}
+
+		for k, typeID := range r.Fields {
+			if v, ok := p.fields[k]; ok {
+				res = append(res, f.save(p.tags[r.DeviceTag], typeID, p.t, scale(v)))
+			}
+		}
+	case "data.latency":
+		typeID := r.TypeID
+		if typeID == "" {
+			typeID = p.tags[r.TypeTag]
+		}
+
+		mean, ok := p.fields[r.Mean]
+		if !ok {
+			return []*weft.Result{weft.BadRequest("missing field " + r.Mean)}
+		}
+
+		res = append(res, dataLatencySave(p.tags[r.SiteTag], typeID, p.t, scale(mean),
+			scale(p.fields[r.Min]), scale(p.fields[r.Max]), scale(p.fields[r.Fifty]), scale(p.fields[r.Ninety])))
+	}
+
+	return res
+}
+
+// parseInflux parses the lines in s.  Returns the points and their line numbers and
+// any errors prefixed with the line number.  Blank lines and comments are skipped.
+func parseInflux(s string, precision time.Duration, now time.Time) ([]influxPoint, []int, []string) {
+	var points []influxPoint
+	var lines []int
+	var errs []string
+
+	for i, l := range strings.Split(s, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		p, err := parseInfluxLine(l, precision, now)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("line %d: %s", i+1, err.Error()))
+			if len(errs) == maxInfluxErrors {
+				errs = append(errs, "too many errors")
+				break
+			}
+			continue
+		}
+
+		points = append(points, p)
+		lines = append(lines, i+1)
+	}
+
+	return points, lines, errs
+}
+
+// parseInfluxLine parses a single line of line protocol e.g.,
+//
+//	weather,location=us-midwest temperature=82,humidity=71i 1465839830100400200
+//
+// String field values are ignored.  Booleans are saved as 1 or 0.  NaN and Inf are invalid (see metricValue).
+func parseInfluxLine(l string, precision time.Duration, now time.Time) (influxPoint, error) {
+	p := influxPoint{tags: make(map[string]string), fields: make(map[string]float64), t: now}
+
+	sections := splitUnescaped(l, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return p, fmt.Errorf("expected measurement, fields, and optional timestamp")
+	}
+
+	key := splitUnescaped(sections[0], ',', false)
+	p.measurement = unescape(key[0])
+	if p.measurement == "" {
+		return p, fmt.Errorf("missing measurement")
+	}
+
+	for _, t := range key[1:] {
+		kv := splitUnescaped(t, '=', false)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return p, fmt.Errorf("invalid tag: %s", t)
+		}
+		p.tags[unescape(kv[0])] = unescape(kv[1])
+	}
+
+	for _, f := range splitUnescaped(sections[1], ',', true) {
+		kv := splitUnescaped(f, '=', true)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return p, fmt.Errorf("invalid field: %s", f)
+		}
+
+		k := unescape(kv[0])
+		v := kv[1]
+
+		switch {
+		case strings.HasPrefix(v, `"`):
+			if len(v) < 2 || !strings.HasSuffix(v, `"`) {
+				return p, fmt.Errorf("invalid string value for field %s", k)
+			}
+		case v == "t" || v == "T" || v == "true" || v == "True" || v == "TRUE":
+			p.fields[k] = 1
+		case v == "f" || v == "F" || v == "false" || v == "False" || v == "FALSE":
+			p.fields[k] = 0
+		case strings.HasSuffix(v, "i") || strings.HasSuffix(v, "u"):
+			n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+			if err != nil {
+				return p, fmt.Errorf("invalid integer value for field %s: %s", k, v)
+			}
+			p.fields[k] = float64(n)
+		default:
+			n, err := metricValue(v)
+			if err != nil {
+				return p, fmt.Errorf("invalid value for field %s: %s", k, v)
+			}
+			p.fields[k] = n
+		}
+	}
+
+	if len(sections) == 3 {
+		n, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("invalid timestamp: %s", sections[2])
+		}
+		p.t = time.Unix(0, n*int64(precision)).UTC()
+	}
+
+	return p, nil
+}
+
+// splitUnescaped splits s on sep ignoring backslash escaped seps and, if quotes is true,
+// seps in double quotes.
+func splitUnescaped(s string, sep byte, quotes bool) []string {
+	var parts []string
+	var quoted bool
+
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"' && quotes:
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// unescape removes backslash escapes from measurements, tag keys and values, and field keys.
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+
+	var b bytes.Buffer
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case ',', ' ', '=', '"', '\\':
+				i++
+			}
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	wt "github.com/GeoNet/weft/wefttest"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInfluxLine(t *testing.T) {
+	now := time.Now().UTC()
+
+	p, err := parseInfluxLine(`disk\ usage,path=/,host=gps-taupoairport used_percent=12.5,inodes=100i,ok=t,note="a b,c" 1465839830100400200`, time.Nanosecond, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.measurement != "disk usage" {
+		t.Errorf("expected disk usage got %s", p.measurement)
+	}
+
+	if p.tags["host"] != "gps-taupoairport" || p.tags["path"] != "/" {
+		t.Errorf("unexpected tags %v", p.tags)
+	}
+
+	if p.fields["used_percent"] != 12.5 || p.fields["inodes"] != 100 || p.fields["ok"] != 1 {
+		t.Errorf("unexpected fields %v", p.fields)
+	}
+
+	if _, ok := p.fields["note"]; ok {
+		t.Error("expected string field to be ignored")
+	}
+
+	if p.t.UnixNano() != 1465839830100400200 {
+		t.Errorf("unexpected time %d", p.t.UnixNano())
+	}
+
+	p, err = parseInfluxLine(`latency mean=10 1465839830`, time.Second, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.t.Unix() != 1465839830 {
+		t.Errorf("unexpected time %d", p.t.Unix())
+	}
+
+	p, err = parseInfluxLine(`latency mean=10`, time.Nanosecond, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.t.Equal(now) {
+		t.Errorf("expected server time got %s", p.t)
+	}
+
+	for _, l := range []string{
+		`latency`,
+		`latency mean=`,
+		`latency mean=abc`,
+		`latency,site mean=10`,
+		`latency mean=10 abc`,
+		`latency mean=10i0`,
+		`latency mean=NaN`,
+		`latency mean=10,min=Inf`,
+		`latency mean=+Inf`,
+		`latency mean=-infinity`,
+		`,site=TAUP mean=10`,
+	} {
+		if _, err = parseInfluxLine(l, time.Nanosecond, now); err == nil {
+			t.Errorf("expected error for %s", l)
+		}
+	}
+
+	_, lines, errs := parseInflux("# comment\n\nlatency mean=10\nlatency mean=abc\r\nlatency mean=1", time.Nanosecond, now)
+	if len(lines) != 2 || lines[0] != 3 || lines[1] != 5 {
+		t.Errorf("unexpected line numbers %v", lines)
+	}
+
+	if len(errs) != 1 || !strings.HasPrefix(errs[0], "line 4:") {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestInfluxWrite(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	if err := setInfluxConfig([]byte(`{"rules": [
+		{"measurement": "power", "table": "field.metric", "deviceTag": "device", "fields": {"volts": "voltage"}, "scale": 1000},
+		{"measurement": "latency", "table": "data.latency", "typeID": "latency.strong"}
+	]}`)); err != nil {
+		t.Fatal(err)
+	}
+	defer setInfluxConfig([]byte(`{}`))
+
+	if err := setInfluxConfig([]byte(`{"rules": [{"measurement": "a", "table": "not.a.table"}]}`)); err == nil {
+		t.Error("expected error for invalid table.")
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	write := func(body string) (int, string) {
+		req, err := http.NewRequest("POST", testServer.URL+"/write?db=mtr&precision=s", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth(userW, keyW)
+
+		res, err := wt.Client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return res.StatusCode, string(b)
+	}
+
+	// parse errors fail the request with the line number.
+	if code, msg := write("power,device=gps-taupoairport volts=13.5\npower volts=\n"); code != http.StatusBadRequest || !strings.Contains(msg, "line 2:") {
+		t.Errorf("expected 400 for line 2 got %d %s", code, msg)
+	}
+
+	ts := strconv.FormatInt(now.Add(time.Minute*-1).Unix(), 10)
+
+	body := "power,device=gps-taupoairport volts=13.5 " + ts + "\n"
+	body += "latency,site=TAUP mean=10000,fifty=9000,ninety=11000 " + ts + "\n"
+	body += "cpu,host=a usage=10\n"
+
+	if code, msg := write(body); code != http.StatusNoContent {
+		t.Errorf("expected 204 got %d %s", code, msg)
+	}
+
+	var v float64
+
+	if err := db.QueryRow(`SELECT value FROM field.metric_summary
+				JOIN field.device USING (devicepk)
+				JOIN field.type USING (typepk)
+				WHERE deviceID = 'gps-taupoairport' AND typeID = 'voltage'`).Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v != 13500 {
+		t.Errorf("expected 13500 got %g", v)
+	}
+
+	if err := db.QueryRow(`SELECT mean FROM data.latency_summary
+				JOIN data.site USING (sitepk)
+				JOIN data.type USING (typepk)
+				WHERE siteID = 'TAUP' AND typeID = 'latency.strong'`).Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v != 10000 {
+		t.Errorf("expected 10000 got %g", v)
+	}
+
+	// values that fail validation are a partial write with the line number.
+	if code, msg := write("latency,site=TAUP mean=1\npower,device=NOT_THERE volts=1\n"); code != http.StatusBadRequest || !strings.Contains(msg, "line 2:") {
+		t.Errorf("expected 400 for line 2 got %d %s", code, msg)
+	}
+}
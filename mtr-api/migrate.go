@@ -0,0 +1,1092 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+)
+
+// migration changes the schema from version-1 to version (up) and back (down).
+type migration struct {
+	version     int
+	description string
+	up          string
+	down        string
+}
+
+// schemaBaseline is the version of the original schema (database/baseline).  There is no down migration for it.
+const schemaBaseline = 1
+
+// migrateLock is the key for the advisory lock that stops more than one migration running at a time.
+const migrateLock = 7310
+
+/*
+migrations upgrade the schema from schemaBaseline.  Add new migrations to the end with the next version
+and make the same change in database/ddl, including a row for the version in mtr.schema_version,
+so that new databases start at the latest version.
+*/
+var migrations = []migration{
+	{
+		version:     2,
+		description: "type min intervals",
+		up: `ALTER TABLE field.type ADD COLUMN min_interval INTEGER NOT NULL DEFAULT 60 CHECK (min_interval > 0);
+		ALTER TABLE data.type ADD COLUMN min_interval INTEGER NOT NULL DEFAULT 60 CHECK (min_interval > 0);
+		ALTER TABLE data.completeness_type ADD COLUMN min_interval INTEGER NOT NULL DEFAULT 60 CHECK (min_interval > 0);
+		UPDATE field.type SET min_interval = 600 WHERE typeID IN ('disk.hd1', 'disk.hd2', 'disk.hd3', 'disk.hd4');
+		UPDATE data.type SET min_interval = 10 WHERE typeID = 'latency.gnss.1hz';`,
+		down: `ALTER TABLE field.type DROP COLUMN min_interval;
+		ALTER TABLE data.type DROP COLUMN min_interval;
+		ALTER TABLE data.completeness_type DROP COLUMN min_interval;`,
+	},
+	{
+		version:     3,
+		description: "pending devices and sites",
+		up: `ALTER TABLE field.device ADD COLUMN pending BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE data.site ADD COLUMN pending BOOLEAN NOT NULL DEFAULT false;`,
+		down: `ALTER TABLE field.device DROP COLUMN pending;
+		ALTER TABLE data.site DROP COLUMN pending;`,
+	},
+	{
+		// the rollups are filled from the values already in the metric tables before the triggers are added.
+		version:     4,
+		description: "rollups",
+		up: `CREATE FUNCTION mtr.rollup_time(t TIMESTAMP WITH TIME ZONE, resolution TEXT)
+		RETURNS TIMESTAMP WITH TIME ZONE AS
+		$$
+		SELECT CASE resolution
+			WHEN 'five_minutes' THEN date_trunc('hour', t) + extract(minute from t)::int / 5 * interval '5 min'
+			ELSE date_trunc(resolution, t)
+		END
+		$$
+		LANGUAGE SQL STABLE;
+
+		DO $$
+		DECLARE
+			r TEXT;
+		BEGIN
+		FOREACH r IN ARRAY ARRAY['five_minutes', 'hour', 'day'] LOOP
+			EXECUTE format('CREATE TABLE field.metric_%s (
+				devicePK SMALLINT REFERENCES field.device(devicePK) ON DELETE CASCADE NOT NULL,
+				typePK SMALLINT REFERENCES field.type(typePK) ON DELETE CASCADE NOT NULL,
+				time TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+				count INTEGER NOT NULL,
+				sum BIGINT NOT NULL,
+				min INTEGER NOT NULL,
+				max INTEGER NOT NULL,
+				PRIMARY KEY(devicePK, typePK, time))', r);
+			EXECUTE format('CREATE INDEX ON field.metric_%s (time)', r);
+			EXECUTE format('INSERT INTO field.metric_%s(devicePK, typePK, time, count, sum, min, max)
+				SELECT devicePK, typePK, mtr.rollup_time(time, %L), count(*), sum(value), min(value), max(value)
+				FROM field.metric GROUP BY 1, 2, 3', r, r);
+
+			EXECUTE format('CREATE TABLE data.latency_%s (
+				sitePK INTEGER REFERENCES data.site(sitePK) ON DELETE CASCADE NOT NULL,
+				typePK SMALLINT REFERENCES data.type(typePK) ON DELETE CASCADE NOT NULL,
+				time TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+				count INTEGER NOT NULL,
+				mean_sum BIGINT NOT NULL,
+				min INTEGER NOT NULL,
+				max INTEGER NOT NULL,
+				fifty INTEGER NOT NULL,
+				ninety INTEGER NOT NULL,
+				PRIMARY KEY(sitePK, typePK, time))', r);
+			EXECUTE format('CREATE INDEX ON data.latency_%s (time)', r);
+			EXECUTE format('INSERT INTO data.latency_%s(sitePK, typePK, time, count, mean_sum, min, max, fifty, ninety)
+				SELECT sitePK, typePK, mtr.rollup_time(time, %L), count(*), sum(mean), min(min), max(max), max(fifty), max(ninety)
+				FROM data.latency GROUP BY 1, 2, 3', r, r);
+
+			EXECUTE format('CREATE TABLE data.completeness_%s (
+				sitePK INTEGER REFERENCES data.site(sitePK) ON DELETE CASCADE NOT NULL,
+				typePK SMALLINT REFERENCES data.completeness_type(typePK) ON DELETE CASCADE NOT NULL,
+				time TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+				count INTEGER NOT NULL,
+				sum BIGINT NOT NULL,
+				min INTEGER NOT NULL,
+				max INTEGER NOT NULL,
+				PRIMARY KEY(sitePK, typePK, time))', r);
+			EXECUTE format('CREATE INDEX ON data.completeness_%s (time)', r);
+			EXECUTE format('INSERT INTO data.completeness_%s(sitePK, typePK, time, count, sum, min, max)
+				SELECT sitePK, typePK, mtr.rollup_time(time, %L), count(*), sum(count), min(count), max(count)
+				FROM data.completeness GROUP BY 1, 2, 3', r, r);
+
+			EXECUTE format('CREATE TABLE app.metric_%s (
+				applicationPK SMALLINT REFERENCES app.application(applicationPK) ON DELETE CASCADE NOT NULL,
+				instancePK SMALLINT REFERENCES app.instance(instancePK) ON DELETE CASCADE NOT NULL,
+				typePK SMALLINT REFERENCES app.type(typePK) ON DELETE CASCADE NOT NULL,
+				time TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+				count INTEGER NOT NULL,
+				sum NUMERIC NOT NULL,
+				min BIGINT NOT NULL,
+				max BIGINT NOT NULL,
+				PRIMARY KEY(applicationPK, instancePK, typePK, time))', r);
+			EXECUTE format('CREATE INDEX ON app.metric_%s (time)', r);
+			EXECUTE format('INSERT INTO app.metric_%s(applicationPK, instancePK, typePK, time, count, sum, min, max)
+				SELECT applicationPK, instancePK, typePK, mtr.rollup_time(time, %L), count(*), sum(value), min(value), max(value)
+				FROM app.metric GROUP BY 1, 2, 3, 4', r, r);
+
+			EXECUTE format('GRANT ALL ON field.metric_%s, data.latency_%s, data.completeness_%s, app.metric_%s TO mtr_w', r, r, r, r);
+			EXECUTE format('GRANT SELECT ON field.metric_%s, data.latency_%s, data.completeness_%s, app.metric_%s TO mtr_r', r, r, r, r);
+		END LOOP;
+		END;
+		$$;
+
+		CREATE FUNCTION field.metric_rollup()
+		RETURNS TRIGGER AS
+		$$
+		DECLARE
+			r TEXT;
+		BEGIN
+		FOREACH r IN ARRAY ARRAY['five_minutes', 'hour', 'day'] LOOP
+			EXECUTE format('INSERT INTO field.metric_%s AS m (devicePK, typePK, time, count, sum, min, max)
+				VALUES ($1, $2, mtr.rollup_time($3, %L), 1, $4, $4, $4)
+				ON CONFLICT (devicePK, typePK, time) DO UPDATE SET count = m.count + 1, sum = m.sum + EXCLUDED.sum,
+				min = least(m.min, EXCLUDED.min), max = greatest(m.max, EXCLUDED.max)', r, r)
+			USING NEW.devicePK, NEW.typePK, NEW.time, NEW.value;
+		END LOOP;
+		RETURN NULL; END;
+		$$
+		LANGUAGE plpgsql;
+
+		CREATE TRIGGER metric_rollup_trigger AFTER INSERT ON field.metric
+		FOR EACH ROW EXECUTE PROCEDURE field.metric_rollup();
+
+		CREATE FUNCTION data.latency_rollup()
+		RETURNS TRIGGER AS
+		$$
+		DECLARE
+			r TEXT;
+		BEGIN
+		FOREACH r IN ARRAY ARRAY['five_minutes', 'hour', 'day'] LOOP
+			EXECUTE format('INSERT INTO data.latency_%s AS l (sitePK, typePK, time, count, mean_sum, min, max, fifty, ninety)
+				VALUES ($1, $2, mtr.rollup_time($3, %L), 1, $4, $5, $6, $7, $8)
+				ON CONFLICT (sitePK, typePK, time) DO UPDATE SET count = l.count + 1, mean_sum = l.mean_sum + EXCLUDED.mean_sum,
+				min = least(l.min, EXCLUDED.min), max = greatest(l.max, EXCLUDED.max),
+				fifty = greatest(l.fifty, EXCLUDED.fifty), ninety = greatest(l.ninety, EXCLUDED.ninety)', r, r)
+			USING NEW.sitePK, NEW.typePK, NEW.time, NEW.mean, NEW.min, NEW.max, NEW.fifty, NEW.ninety;
+		END LOOP;
+		RETURN NULL; END;
+		$$
+		LANGUAGE plpgsql;
+
+		CREATE TRIGGER latency_rollup_trigger AFTER INSERT ON data.latency
+		FOR EACH ROW EXECUTE PROCEDURE data.latency_rollup();
+
+		CREATE FUNCTION data.completeness_rollup()
+		RETURNS TRIGGER AS
+		$$
+		DECLARE
+			r TEXT;
+		BEGIN
+		FOREACH r IN ARRAY ARRAY['five_minutes', 'hour', 'day'] LOOP
+			EXECUTE format('INSERT INTO data.completeness_%s AS c (sitePK, typePK, time, count, sum, min, max)
+				VALUES ($1, $2, mtr.rollup_time($3, %L), 1, $4, $4, $4)
+				ON CONFLICT (sitePK, typePK, time) DO UPDATE SET count = c.count + 1, sum = c.sum + EXCLUDED.sum,
+				min = least(c.min, EXCLUDED.min), max = greatest(c.max, EXCLUDED.max)', r, r)
+			USING NEW.sitePK, NEW.typePK, NEW.time, NEW.count;
+		END LOOP;
+		RETURN NULL; END;
+		$$
+		LANGUAGE plpgsql;
+
+		CREATE TRIGGER completeness_rollup_trigger AFTER INSERT ON data.completeness
+		FOR EACH ROW EXECUTE PROCEDURE data.completeness_rollup();
+
+		CREATE FUNCTION app.metric_rollup()
+		RETURNS TRIGGER AS
+		$$
+		DECLARE
+			r TEXT;
+		BEGIN
+		FOREACH r IN ARRAY ARRAY['five_minutes', 'hour', 'day'] LOOP
+			EXECUTE format('INSERT INTO app.metric_%s AS m (applicationPK, instancePK, typePK, time, count, sum, min, max)
+				VALUES ($1, $2, $3, mtr.rollup_time($4, %L), 1, $5, $5, $5)
+				ON CONFLICT (applicationPK, instancePK, typePK, time) DO UPDATE SET count = m.count + 1, sum = m.sum + EXCLUDED.sum,
+				min = least(m.min, EXCLUDED.min), max = greatest(m.max, EXCLUDED.max)', r, r)
+			USING NEW.applicationPK, NEW.instancePK, NEW.typePK, NEW.time, NEW.value;
+		END LOOP;
+		RETURN NULL; END;
+		$$
+		LANGUAGE plpgsql;
+
+		CREATE TRIGGER metric_rollup_trigger AFTER INSERT ON app.metric
+		FOR EACH ROW EXECUTE PROCEDURE app.metric_rollup();`,
+		down: `DROP TRIGGER metric_rollup_trigger ON field.metric;
+		DROP TRIGGER latency_rollup_trigger ON data.latency;
+		DROP TRIGGER completeness_rollup_trigger ON data.completeness;
+		DROP TRIGGER metric_rollup_trigger ON app.metric;
+		DROP FUNCTION field.metric_rollup();
+		DROP FUNCTION data.latency_rollup();
+		DROP FUNCTION data.completeness_rollup();
+		DROP FUNCTION app.metric_rollup();
+		DROP TABLE field.metric_five_minutes, field.metric_hour, field.metric_day;
+		DROP TABLE data.latency_five_minutes, data.latency_hour, data.latency_day;
+		DROP TABLE data.completeness_five_minutes, data.completeness_hour, data.completeness_day;
+		DROP TABLE app.metric_five_minutes, app.metric_hour, app.metric_day;
+		DROP FUNCTION mtr.rollup_time(TIMESTAMP WITH TIME ZONE, TEXT);`,
+	},
+	{
+		version:     5,
+		description: "retention",
+		up: `CREATE TABLE mtr.retention (
+			schema TEXT NOT NULL CHECK (schema IN ('field', 'data', 'app')),
+			typeID TEXT NOT NULL DEFAULT '',
+			days INTEGER NOT NULL CHECK (days > 0),
+			PRIMARY KEY (schema, typeID)
+		);
+		INSERT INTO mtr.retention(schema, days) VALUES('field', 40);
+		INSERT INTO mtr.retention(schema, days) VALUES('data', 40);
+		INSERT INTO mtr.retention(schema, days) VALUES('app', 28);
+		INSERT INTO app.type(typePK, typeID, description, unit) VALUES(1300, 'Deleted', 'rows deleted', 'n')
+			ON CONFLICT DO NOTHING;
+		GRANT ALL ON mtr.retention TO mtr_w;
+		GRANT SELECT ON mtr.retention TO mtr_r;`,
+		down: `DROP TABLE mtr.retention;
+		DELETE FROM app.type WHERE typePK = 1300;`,
+	},
+	{
+		// each table is renamed to <table>_parent and its values are moved to the partitions (with the
+		// rollup triggers off as the rollups already have them).  partition_existing and partition_revert
+		// are only needed while migrating.
+		version:     6,
+		description: "partitions",
+		up: `ALTER DEFAULT PRIVILEGES IN SCHEMA field GRANT ALL ON TABLES TO mtr_w;
+		ALTER DEFAULT PRIVILEGES IN SCHEMA field GRANT SELECT ON TABLES TO mtr_r;
+		ALTER DEFAULT PRIVILEGES IN SCHEMA app GRANT ALL ON TABLES TO mtr_w;
+		ALTER DEFAULT PRIVILEGES IN SCHEMA app GRANT SELECT ON TABLES TO mtr_r;
+		ALTER DEFAULT PRIVILEGES IN SCHEMA data GRANT ALL ON TABLES TO mtr_w;
+		ALTER DEFAULT PRIVILEGES IN SCHEMA data GRANT SELECT ON TABLES TO mtr_r;
+
+		CREATE FUNCTION mtr.create_partition(tbl TEXT, day DATE)
+		RETURNS BOOLEAN AS
+		$$
+		DECLARE
+			p TEXT := tbl || '_' || to_char(day, 'YYYYMMDD');
+			c RECORD;
+		BEGIN
+		IF to_regclass(p) IS NOT NULL THEN
+			RETURN false;
+		END IF;
+
+		EXECUTE format('CREATE TABLE %s (LIKE %s INCLUDING ALL, CHECK (time >= %L AND time < %L)) INHERITS (%s)',
+			p, tbl || '_parent', day::timestamp AT TIME ZONE 'UTC', (day + 1)::timestamp AT TIME ZONE 'UTC', tbl || '_parent');
+
+		FOR c IN SELECT pg_get_constraintdef(oid) AS def FROM pg_constraint
+			WHERE conrelid = (tbl || '_parent')::regclass AND contype = 'f' LOOP
+			EXECUTE format('ALTER TABLE %s ADD %s', p, c.def);
+		END LOOP;
+
+		IF to_regproc(tbl || '_rollup') IS NOT NULL THEN
+			EXECUTE format('CREATE TRIGGER rollup_trigger AFTER INSERT ON %s FOR EACH ROW EXECUTE PROCEDURE %s()', p, tbl || '_rollup');
+		END IF;
+
+		RETURN true;
+		END;
+		$$
+		LANGUAGE plpgsql SECURITY DEFINER;
+
+		CREATE FUNCTION mtr.drop_partitions(tbl TEXT, day DATE)
+		RETURNS BIGINT AS
+		$$
+		DECLARE
+			p RECORD;
+			n BIGINT := 0;
+		BEGIN
+		FOR p IN SELECT c.oid::regclass AS name, c.reltuples FROM pg_inherits i
+			JOIN pg_class c ON c.oid = i.inhrelid
+			WHERE i.inhparent = (tbl || '_parent')::regclass
+			AND to_date(right(c.relname, 8), 'YYYYMMDD') < day LOOP
+			EXECUTE format('DROP TABLE %s', p.name);
+			n := n + p.reltuples::bigint;
+		END LOOP;
+
+		RETURN n;
+		END;
+		$$
+		LANGUAGE plpgsql SECURITY DEFINER;
+
+		CREATE FUNCTION mtr.partition_insert()
+		RETURNS TRIGGER AS
+		$$
+		DECLARE
+			tbl TEXT := TG_TABLE_SCHEMA || '.' || TG_TABLE_NAME;
+			day DATE := (NEW.time AT TIME ZONE 'UTC')::date;
+		BEGIN
+		PERFORM mtr.create_partition(tbl, day);
+
+		EXECUTE format('INSERT INTO %s SELECT ($1).*', tbl || '_' || to_char(day, 'YYYYMMDD')) USING NEW;
+
+		RETURN NEW;
+		END;
+		$$
+		LANGUAGE plpgsql;
+
+		CREATE FUNCTION mtr.partition_existing(tbl TEXT)
+		RETURNS VOID AS
+		$$
+		DECLARE
+			t TEXT := split_part(tbl, '.', 2);
+			day DATE;
+			p TEXT;
+		BEGIN
+		EXECUTE format('DROP TRIGGER IF EXISTS %s_rollup_trigger ON %s', t, tbl);
+		EXECUTE format('ALTER TABLE %s RENAME TO %s_parent', tbl, t);
+		EXECUTE format('ALTER INDEX %s_pkey RENAME TO %s_parent_pkey', tbl, t);
+		EXECUTE format('ALTER INDEX %s_time_idx RENAME TO %s_parent_time_idx', tbl, t);
+
+		FOR day IN EXECUTE format('SELECT DISTINCT (time AT TIME ZONE ''UTC'')::date FROM ONLY %s_parent', tbl) LOOP
+			p := tbl || '_' || to_char(day, 'YYYYMMDD');
+			PERFORM mtr.create_partition(tbl, day);
+
+			IF to_regproc(tbl || '_rollup') IS NOT NULL THEN
+				EXECUTE format('ALTER TABLE %s DISABLE TRIGGER rollup_trigger', p);
+			END IF;
+
+			EXECUTE format('INSERT INTO %s SELECT * FROM ONLY %s_parent WHERE (time AT TIME ZONE ''UTC'')::date = %L', p, tbl, day);
+
+			IF to_regproc(tbl || '_rollup') IS NOT NULL THEN
+				EXECUTE format('ALTER TABLE %s ENABLE TRIGGER rollup_trigger', p);
+			END IF;
+		END LOOP;
+
+		EXECUTE format('DELETE FROM ONLY %s_parent', tbl);
+
+		EXECUTE format('CREATE VIEW %s AS SELECT * FROM %s_parent', tbl, tbl);
+		EXECUTE format('CREATE TRIGGER %s_insert_trigger INSTEAD OF INSERT ON %s FOR EACH ROW EXECUTE PROCEDURE mtr.partition_insert()', t, tbl);
+		EXECUTE format('GRANT ALL ON %s TO mtr_w', tbl);
+		EXECUTE format('GRANT SELECT ON %s TO mtr_r', tbl);
+		END;
+		$$
+		LANGUAGE plpgsql;
+
+		SELECT mtr.partition_existing('field.metric');
+		SELECT mtr.partition_existing('data.latency');
+		SELECT mtr.partition_existing('data.completeness');
+		SELECT mtr.partition_existing('app.metric');
+		SELECT mtr.partition_existing('app.counter');
+		SELECT mtr.partition_existing('app.timer');
+		DROP FUNCTION mtr.partition_existing(TEXT);`,
+		down: `CREATE FUNCTION mtr.partition_revert(tbl TEXT)
+		RETURNS VOID AS
+		$$
+		DECLARE
+			t TEXT := split_part(tbl, '.', 2);
+			p RECORD;
+		BEGIN
+		EXECUTE format('DROP VIEW %s', tbl);
+
+		FOR p IN SELECT c.oid::regclass AS name FROM pg_inherits i
+			JOIN pg_class c ON c.oid = i.inhrelid
+			WHERE i.inhparent = (tbl || '_parent')::regclass LOOP
+			EXECUTE format('INSERT INTO %s_parent SELECT * FROM ONLY %s', tbl, p.name);
+			EXECUTE format('DROP TABLE %s', p.name);
+		END LOOP;
+
+		EXECUTE format('ALTER TABLE %s_parent RENAME TO %s', tbl, t);
+		EXECUTE format('ALTER INDEX %s_parent_pkey RENAME TO %s_pkey', tbl, t);
+		EXECUTE format('ALTER INDEX %s_parent_time_idx RENAME TO %s_time_idx', tbl, t);
+
+		IF to_regproc(tbl || '_rollup') IS NOT NULL THEN
+			EXECUTE format('CREATE TRIGGER %s_rollup_trigger AFTER INSERT ON %s FOR EACH ROW EXECUTE PROCEDURE %s_rollup()', t, tbl, tbl);
+		END IF;
+		END;
+		$$
+		LANGUAGE plpgsql;
+
+		SELECT mtr.partition_revert('field.metric');
+		SELECT mtr.partition_revert('data.latency');
+		SELECT mtr.partition_revert('data.completeness');
+		SELECT mtr.partition_revert('app.metric');
+		SELECT mtr.partition_revert('app.counter');
+		SELECT mtr.partition_revert('app.timer');
+		DROP FUNCTION mtr.partition_revert(TEXT);
+		DROP FUNCTION mtr.partition_insert();
+		DROP FUNCTION mtr.drop_partitions(TEXT, DATE);
+		DROP FUNCTION mtr.create_partition(TEXT, DATE);
+		ALTER DEFAULT PRIVILEGES IN SCHEMA field REVOKE ALL ON TABLES FROM mtr_w;
+		ALTER DEFAULT PRIVILEGES IN SCHEMA field REVOKE SELECT ON TABLES FROM mtr_r;
+		ALTER DEFAULT PRIVILEGES IN SCHEMA app REVOKE ALL ON TABLES FROM mtr_w;
+		ALTER DEFAULT PRIVILEGES IN SCHEMA app REVOKE SELECT ON TABLES FROM mtr_r;
+		ALTER DEFAULT PRIVILEGES IN SCHEMA data REVOKE ALL ON TABLES FROM mtr_w;
+		ALTER DEFAULT PRIVILEGES IN SCHEMA data REVOKE SELECT ON TABLES FROM mtr_r;`,
+	},
+	{
+		version:     7,
+		description: "archive restores",
+		up: `CREATE TABLE mtr.archive_restore (
+			tbl TEXT PRIMARY KEY,
+			restored TIMESTAMP(0) WITH TIME ZONE NOT NULL
+		);
+		GRANT ALL ON mtr.archive_restore TO mtr_w;
+		GRANT SELECT ON mtr.archive_restore TO mtr_r;`,
+		down: `DROP TABLE mtr.archive_restore`,
+	},
+	{
+		version:     8,
+		description: "field state history",
+		up: `CREATE TABLE field.state_history (
+			devicePK SMALLINT REFERENCES field.device(devicePK) ON DELETE CASCADE NOT NULL,
+			typePK SMALLINT REFERENCES field.state_type(typePK) ON DELETE CASCADE NOT NULL,
+			time TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+			value BOOLEAN NOT NULL,
+			PRIMARY KEY(devicePK, typePK, time)
+		);
+		INSERT INTO field.state_history(devicePK, typePK, time, value) SELECT devicePK, typePK, time, value FROM field.state;
+		GRANT ALL ON field.state_history TO mtr_w;
+		GRANT SELECT ON field.state_history TO mtr_r;`,
+		down: `DROP TABLE field.state_history`,
+	},
+	{
+		version:     9,
+		description: "enumerated field states",
+		up: `CREATE TABLE field.state_value (
+			typePK SMALLINT REFERENCES field.state_type(typePK) ON DELETE CASCADE NOT NULL,
+			value TEXT NOT NULL,
+			severity SMALLINT NOT NULL CHECK (severity >= 0 AND severity <= 2),
+			PRIMARY KEY(typePK, value)
+		);
+		ALTER TABLE field.state ADD COLUMN state TEXT;
+		ALTER TABLE field.state_history ADD COLUMN state TEXT;
+		GRANT ALL ON field.state_value TO mtr_w;
+		GRANT SELECT ON field.state_value TO mtr_r;`,
+		down: `DROP TABLE field.state_value;
+		ALTER TABLE field.state DROP COLUMN state;
+		ALTER TABLE field.state_history DROP COLUMN state;`,
+	},
+	{
+		// the views for the partitioned tables are recreated as a column used by a view can't be changed.
+		// Changing the parent tables changes the partitions.
+		version:     10,
+		description: "float metric values",
+		up: `DROP VIEW field.metric;
+		ALTER TABLE field.metric_parent ALTER COLUMN value TYPE DOUBLE PRECISION;
+		CREATE VIEW field.metric AS SELECT * FROM field.metric_parent;
+		CREATE TRIGGER metric_insert_trigger INSTEAD OF INSERT ON field.metric
+			FOR EACH ROW EXECUTE PROCEDURE mtr.partition_insert();
+		GRANT ALL ON field.metric TO mtr_w;
+		GRANT SELECT ON field.metric TO mtr_r;
+		ALTER TABLE field.metric_summary ALTER COLUMN value TYPE DOUBLE PRECISION;
+		ALTER TABLE field.metric_five_minutes ALTER COLUMN sum TYPE DOUBLE PRECISION,
+			ALTER COLUMN min TYPE DOUBLE PRECISION, ALTER COLUMN max TYPE DOUBLE PRECISION;
+		ALTER TABLE field.metric_hour ALTER COLUMN sum TYPE DOUBLE PRECISION,
+			ALTER COLUMN min TYPE DOUBLE PRECISION, ALTER COLUMN max TYPE DOUBLE PRECISION;
+		ALTER TABLE field.metric_day ALTER COLUMN sum TYPE DOUBLE PRECISION,
+			ALTER COLUMN min TYPE DOUBLE PRECISION, ALTER COLUMN max TYPE DOUBLE PRECISION;
+		ALTER TABLE field.threshold ALTER COLUMN lower TYPE DOUBLE PRECISION, ALTER COLUMN upper TYPE DOUBLE PRECISION;
+		DROP VIEW data.latency;
+		ALTER TABLE data.latency_parent ALTER COLUMN mean TYPE DOUBLE PRECISION,
+			ALTER COLUMN min TYPE DOUBLE PRECISION, ALTER COLUMN max TYPE DOUBLE PRECISION,
+			ALTER COLUMN fifty TYPE DOUBLE PRECISION, ALTER COLUMN ninety TYPE DOUBLE PRECISION;
+		CREATE VIEW data.latency AS SELECT * FROM data.latency_parent;
+		CREATE TRIGGER latency_insert_trigger INSTEAD OF INSERT ON data.latency
+			FOR EACH ROW EXECUTE PROCEDURE mtr.partition_insert();
+		GRANT ALL ON data.latency TO mtr_w;
+		GRANT SELECT ON data.latency TO mtr_r;
+		ALTER TABLE data.latency_summary ALTER COLUMN mean TYPE DOUBLE PRECISION,
+			ALTER COLUMN min TYPE DOUBLE PRECISION, ALTER COLUMN max TYPE DOUBLE PRECISION,
+			ALTER COLUMN fifty TYPE DOUBLE PRECISION, ALTER COLUMN ninety TYPE DOUBLE PRECISION;
+		ALTER TABLE data.latency_five_minutes ALTER COLUMN mean_sum TYPE DOUBLE PRECISION,
+			ALTER COLUMN min TYPE DOUBLE PRECISION, ALTER COLUMN max TYPE DOUBLE PRECISION,
+			ALTER COLUMN fifty TYPE DOUBLE PRECISION, ALTER COLUMN ninety TYPE DOUBLE PRECISION;
+		ALTER TABLE data.latency_hour ALTER COLUMN mean_sum TYPE DOUBLE PRECISION,
+			ALTER COLUMN min TYPE DOUBLE PRECISION, ALTER COLUMN max TYPE DOUBLE PRECISION,
+			ALTER COLUMN fifty TYPE DOUBLE PRECISION, ALTER COLUMN ninety TYPE DOUBLE PRECISION;
+		ALTER TABLE data.latency_day ALTER COLUMN mean_sum TYPE DOUBLE PRECISION,
+			ALTER COLUMN min TYPE DOUBLE PRECISION, ALTER COLUMN max TYPE DOUBLE PRECISION,
+			ALTER COLUMN fifty TYPE DOUBLE PRECISION, ALTER COLUMN ninety TYPE DOUBLE PRECISION;
+		ALTER TABLE data.latency_threshold ALTER COLUMN lower TYPE DOUBLE PRECISION, ALTER COLUMN upper TYPE DOUBLE PRECISION;`,
+		// fractional values are rounded.
+		down: `DROP VIEW field.metric;
+		ALTER TABLE field.metric_parent ALTER COLUMN value TYPE INTEGER USING round(value);
+		CREATE VIEW field.metric AS SELECT * FROM field.metric_parent;
+		CREATE TRIGGER metric_insert_trigger INSTEAD OF INSERT ON field.metric
+			FOR EACH ROW EXECUTE PROCEDURE mtr.partition_insert();
+		GRANT ALL ON field.metric TO mtr_w;
+		GRANT SELECT ON field.metric TO mtr_r;
+		ALTER TABLE field.metric_summary ALTER COLUMN value TYPE INTEGER USING round(value);
+		ALTER TABLE field.metric_five_minutes ALTER COLUMN sum TYPE BIGINT USING round(sum),
+			ALTER COLUMN min TYPE INTEGER USING round(min), ALTER COLUMN max TYPE INTEGER USING round(max);
+		ALTER TABLE field.metric_hour ALTER COLUMN sum TYPE BIGINT USING round(sum),
+			ALTER COLUMN min TYPE INTEGER USING round(min), ALTER COLUMN max TYPE INTEGER USING round(max);
+		ALTER TABLE field.metric_day ALTER COLUMN sum TYPE BIGINT USING round(sum),
+			ALTER COLUMN min TYPE INTEGER USING round(min), ALTER COLUMN max TYPE INTEGER USING round(max);
+		ALTER TABLE field.threshold ALTER COLUMN lower TYPE INTEGER USING round(lower),
+			ALTER COLUMN upper TYPE INTEGER USING round(upper);
+		DROP VIEW data.latency;
+		ALTER TABLE data.latency_parent ALTER COLUMN mean TYPE INTEGER USING round(mean),
+			ALTER COLUMN min TYPE INTEGER USING round(min), ALTER COLUMN max TYPE INTEGER USING round(max),
+			ALTER COLUMN fifty TYPE INTEGER USING round(fifty), ALTER COLUMN ninety TYPE INTEGER USING round(ninety);
+		CREATE VIEW data.latency AS SELECT * FROM data.latency_parent;
+		CREATE TRIGGER latency_insert_trigger INSTEAD OF INSERT ON data.latency
+			FOR EACH ROW EXECUTE PROCEDURE mtr.partition_insert();
+		GRANT ALL ON data.latency TO mtr_w;
+		GRANT SELECT ON data.latency TO mtr_r;
+		ALTER TABLE data.latency_summary ALTER COLUMN mean TYPE INTEGER USING round(mean),
+			ALTER COLUMN min TYPE INTEGER USING round(min), ALTER COLUMN max TYPE INTEGER USING round(max),
+			ALTER COLUMN fifty TYPE INTEGER USING round(fifty), ALTER COLUMN ninety TYPE INTEGER USING round(ninety);
+		ALTER TABLE data.latency_five_minutes ALTER COLUMN mean_sum TYPE BIGINT USING round(mean_sum),
+			ALTER COLUMN min TYPE INTEGER USING round(min), ALTER COLUMN max TYPE INTEGER USING round(max),
+			ALTER COLUMN fifty TYPE INTEGER USING round(fifty), ALTER COLUMN ninety TYPE INTEGER USING round(ninety);
+		ALTER TABLE data.latency_hour ALTER COLUMN mean_sum TYPE BIGINT USING round(mean_sum),
+			ALTER COLUMN min TYPE INTEGER USING round(min), ALTER COLUMN max TYPE INTEGER USING round(max),
+			ALTER COLUMN fifty TYPE INTEGER USING round(fifty), ALTER COLUMN ninety TYPE INTEGER USING round(ninety);
+		ALTER TABLE data.latency_day ALTER COLUMN mean_sum TYPE BIGINT USING round(mean_sum),
+			ALTER COLUMN min TYPE INTEGER USING round(min), ALTER COLUMN max TYPE INTEGER USING round(max),
+			ALTER COLUMN fifty TYPE INTEGER USING round(fifty), ALTER COLUMN ninety TYPE INTEGER USING round(ninety);
+		ALTER TABLE data.latency_threshold ALTER COLUMN lower TYPE INTEGER USING round(lower),
+			ALTER COLUMN upper TYPE INTEGER USING round(upper);`,
+	},
+	{
+		version:     11,
+		description: "alerts",
+		up: `CREATE TABLE mtr.alert (
+			alertPK BIGSERIAL PRIMARY KEY,
+			schema TEXT NOT NULL CHECK (schema IN ('field', 'data')),
+			id TEXT NOT NULL,
+			typeID TEXT NOT NULL,
+			state TEXT NOT NULL CHECK (state IN ('bad', 'late')),
+			value DOUBLE PRECISION NOT NULL,
+			start TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+			"end" TIMESTAMP(0) WITH TIME ZONE,
+			CHECK ("end" IS NULL OR "end" >= start)
+		);
+		CREATE UNIQUE INDEX ON mtr.alert (schema, id, typeID) WHERE "end" IS NULL;
+		CREATE INDEX ON mtr.alert ("end");
+		GRANT ALL ON mtr.alert TO mtr_w;
+		GRANT ALL ON mtr.alert_alertpk_seq TO mtr_w;
+		GRANT SELECT ON mtr.alert TO mtr_r;`,
+		down: `DROP TABLE mtr.alert`,
+	},
+	{
+		version:     12,
+		description: "alert notifications",
+		up: `CREATE TABLE mtr.notification (
+			notificationPK BIGSERIAL PRIMARY KEY,
+			target TEXT NOT NULL,
+			method TEXT NOT NULL CHECK (method IN ('webhook', 'email')),
+			address TEXT NOT NULL,
+			body TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+			attempts INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			created TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+			next_attempt TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+			sent TIMESTAMP(0) WITH TIME ZONE
+		);
+		CREATE INDEX ON mtr.notification (next_attempt) WHERE status = 'pending';
+		CREATE INDEX ON mtr.notification (created);
+		GRANT ALL ON mtr.notification TO mtr_w;
+		GRANT ALL ON mtr.notification_notificationpk_seq TO mtr_w;
+		GRANT SELECT ON mtr.notification TO mtr_r;`,
+		down: `DROP TABLE mtr.notification`,
+	},
+	{
+		version:     13,
+		description: "late windows",
+		up: `ALTER TABLE field.type ADD COLUMN late INTEGER NOT NULL DEFAULT 10800 CHECK (late > 0);
+		ALTER TABLE data.type ADD COLUMN late INTEGER NOT NULL DEFAULT 10800 CHECK (late > 0);
+		CREATE TABLE field.metric_late (
+			devicePK SMALLINT REFERENCES field.device(devicePK) ON DELETE CASCADE NOT NULL,
+			typePK SMALLINT REFERENCES field.type(typePK) ON DELETE CASCADE NOT NULL,
+			late INTEGER NOT NULL CHECK (late > 0),
+			PRIMARY KEY(devicePK, typePK)
+		);
+		CREATE TABLE data.latency_late (
+			sitePK SMALLINT REFERENCES data.site(sitePK) ON DELETE CASCADE NOT NULL,
+			typePK SMALLINT REFERENCES data.type(typePK) ON DELETE CASCADE NOT NULL,
+			late INTEGER NOT NULL CHECK (late > 0),
+			PRIMARY KEY(sitePK, typePK)
+		);
+		GRANT ALL ON field.metric_late TO mtr_w;
+		GRANT SELECT ON field.metric_late TO mtr_r;
+		GRANT ALL ON data.latency_late TO mtr_w;
+		GRANT SELECT ON data.latency_late TO mtr_r;`,
+		down: `DROP TABLE field.metric_late;
+		DROP TABLE data.latency_late;
+		ALTER TABLE field.type DROP COLUMN late;
+		ALTER TABLE data.type DROP COLUMN late;`,
+	},
+	{
+		version:     14,
+		description: "silences",
+		up: `CREATE TABLE mtr.silence (
+			silencePK SERIAL PRIMARY KEY,
+			deviceID TEXT NOT NULL DEFAULT '',
+			siteID TEXT NOT NULL DEFAULT '',
+			tag TEXT NOT NULL DEFAULT '',
+			typeID TEXT NOT NULL DEFAULT '',
+			start TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+			"end" TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+			reason TEXT NOT NULL,
+			CHECK ("end" > start),
+			CHECK (deviceID <> '' OR siteID <> '' OR tag <> '' OR typeID <> '')
+		);
+		CREATE INDEX ON mtr.silence ("end");
+		GRANT ALL ON mtr.silence TO mtr_w;
+		GRANT ALL ON mtr.silence_silencepk_seq TO mtr_w;
+		GRANT SELECT ON mtr.silence TO mtr_r;`,
+		down: `DROP TABLE mtr.silence`,
+	},
+	{
+		version:     15,
+		description: "model thresholds",
+		up: `CREATE TABLE field.model_threshold (
+			modelPK SMALLINT REFERENCES field.model(modelPK) ON DELETE CASCADE NOT NULL,
+			typePK SMALLINT REFERENCES field.type(typePK) ON DELETE CASCADE NOT NULL,
+			lower DOUBLE PRECISION NOT NULL,
+			upper DOUBLE PRECISION NOT NULL,
+			PRIMARY KEY(modelPK, typePK)
+		);
+		GRANT ALL ON field.model_threshold TO mtr_w;
+		GRANT SELECT ON field.model_threshold TO mtr_r;`,
+		down: `DROP TABLE field.model_threshold`,
+	},
+	{
+		version:     16,
+		description: "threshold for and hysteresis",
+		up: `ALTER TABLE field.threshold ADD COLUMN for_seconds INTEGER NOT NULL DEFAULT 0 CHECK (for_seconds >= 0),
+			ADD COLUMN hysteresis DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (hysteresis >= 0);
+		ALTER TABLE field.model_threshold ADD COLUMN for_seconds INTEGER NOT NULL DEFAULT 0 CHECK (for_seconds >= 0),
+			ADD COLUMN hysteresis DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (hysteresis >= 0);
+		ALTER TABLE data.latency_threshold ADD COLUMN for_seconds INTEGER NOT NULL DEFAULT 0 CHECK (for_seconds >= 0),
+			ADD COLUMN hysteresis DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (hysteresis >= 0);
+		ALTER TABLE field.metric_summary ADD COLUMN out_since TIMESTAMP(0) WITH TIME ZONE;
+		ALTER TABLE data.latency_summary ADD COLUMN out_since TIMESTAMP(0) WITH TIME ZONE;
+		CREATE FUNCTION field.metric_summary_out()
+		RETURNS TRIGGER AS
+		$$
+		DECLARE
+			lo DOUBLE PRECISION;
+			hi DOUBLE PRECISION;
+			h DOUBLE PRECISION;
+		BEGIN
+		SELECT COALESCE(t.lower, m.lower), COALESCE(t.upper, m.upper), COALESCE(t.hysteresis, m.hysteresis) INTO lo, hi, h
+			FROM field.device d
+			LEFT JOIN field.threshold t ON t.devicePK = d.devicePK AND t.typePK = NEW.typePK
+			LEFT JOIN field.model_threshold m ON m.modelPK = d.modelPK AND m.typePK = NEW.typePK
+			WHERE d.devicePK = NEW.devicePK;
+		IF lo IS NULL OR (NEW.value >= lo + h AND NEW.value <= hi - h) THEN
+			NEW.out_since = NULL;
+		ELSIF NEW.value < lo OR NEW.value > hi THEN
+			NEW.out_since = COALESCE(NEW.out_since, NEW.time);
+		END IF;
+		RETURN NEW; END;
+		$$
+		LANGUAGE plpgsql;
+
+		CREATE TRIGGER metric_summary_out_trigger BEFORE INSERT OR UPDATE ON field.metric_summary
+		FOR EACH ROW EXECUTE PROCEDURE field.metric_summary_out();
+		CREATE FUNCTION data.latency_summary_out()
+		RETURNS TRIGGER AS
+		$$
+		DECLARE
+			lo DOUBLE PRECISION;
+			hi DOUBLE PRECISION;
+			h DOUBLE PRECISION;
+		BEGIN
+		SELECT lower, upper, hysteresis INTO lo, hi, h
+			FROM data.latency_threshold
+			WHERE sitePK = NEW.sitePK AND typePK = NEW.typePK;
+		IF lo IS NULL OR (NEW.mean >= lo + h AND NEW.mean <= hi - h) THEN
+			NEW.out_since = NULL;
+		ELSIF NEW.mean < lo OR NEW.mean > hi THEN
+			NEW.out_since = COALESCE(NEW.out_since, NEW.time);
+		END IF;
+		RETURN NEW; END;
+		$$
+		LANGUAGE plpgsql;
+
+		CREATE TRIGGER latency_summary_out_trigger BEFORE INSERT OR UPDATE ON data.latency_summary
+		FOR EACH ROW EXECUTE PROCEDURE data.latency_summary_out();
+		UPDATE field.metric_summary SET value = value;
+		UPDATE data.latency_summary SET mean = mean;`,
+		down: `DROP TRIGGER metric_summary_out_trigger ON field.metric_summary;
+		DROP FUNCTION field.metric_summary_out();
+		DROP TRIGGER latency_summary_out_trigger ON data.latency_summary;
+		DROP FUNCTION data.latency_summary_out();
+		ALTER TABLE field.metric_summary DROP COLUMN out_since;
+		ALTER TABLE data.latency_summary DROP COLUMN out_since;
+		ALTER TABLE field.threshold DROP COLUMN for_seconds, DROP COLUMN hysteresis;
+		ALTER TABLE field.model_threshold DROP COLUMN for_seconds, DROP COLUMN hysteresis;
+		ALTER TABLE data.latency_threshold DROP COLUMN for_seconds, DROP COLUMN hysteresis`,
+	},
+	{
+		version:     17,
+		description: "anomaly thresholds",
+		up: `CREATE TABLE field.metric_anomaly (
+			devicePK SMALLINT REFERENCES field.device(devicePK) ON DELETE CASCADE NOT NULL,
+			typePK SMALLINT REFERENCES field.type(typePK) ON DELETE CASCADE NOT NULL,
+			rate DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (rate >= 0),
+			deviations DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (deviations >= 0),
+			days INTEGER NOT NULL DEFAULT 7 CHECK (days >= 3),
+			PRIMARY KEY(devicePK, typePK)
+		);
+		CREATE TABLE data.latency_anomaly (
+			sitePK SMALLINT REFERENCES data.site(sitePK) ON DELETE CASCADE NOT NULL,
+			typePK SMALLINT REFERENCES data.type(typePK) ON DELETE CASCADE NOT NULL,
+			rate DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (rate >= 0),
+			deviations DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (deviations >= 0),
+			days INTEGER NOT NULL DEFAULT 7 CHECK (days >= 3),
+			PRIMARY KEY(sitePK, typePK)
+		);
+		GRANT ALL ON field.metric_anomaly TO mtr_w;
+		GRANT SELECT ON field.metric_anomaly TO mtr_r;
+		GRANT ALL ON data.latency_anomaly TO mtr_w;
+		GRANT SELECT ON data.latency_anomaly TO mtr_r;
+		ALTER TABLE field.metric_summary ADD COLUMN anomaly TEXT NOT NULL DEFAULT '';
+		ALTER TABLE data.latency_summary ADD COLUMN anomaly TEXT NOT NULL DEFAULT '';
+		CREATE FUNCTION field.metric_summary_anomaly()
+		RETURNS TRIGGER AS
+		$$
+		DECLARE
+			a field.metric_anomaly%ROWTYPE;
+			t0 TIMESTAMP WITH TIME ZONE;
+			v0 DOUBLE PRECISION;
+			b_mean DOUBLE PRECISION;
+			b_sd DOUBLE PRECISION;
+			b_n INTEGER;
+		BEGIN
+		NEW.anomaly = '';
+		SELECT * INTO a FROM field.metric_anomaly WHERE devicePK = NEW.devicePK AND typePK = NEW.typePK;
+		IF NOT FOUND THEN
+			RETURN NEW;
+		END IF;
+		IF a.rate > 0 THEN
+			SELECT time, sum / count INTO t0, v0 FROM field.metric_five_minutes
+				WHERE devicePK = NEW.devicePK AND typePK = NEW.typePK
+				AND time <= NEW.time - interval '1 hour' AND time > NEW.time - interval '2 hours'
+				ORDER BY time DESC LIMIT 1;
+			IF FOUND AND abs(NEW.value - v0) * 3600 / extract(epoch FROM NEW.time - t0) > a.rate THEN
+				NEW.anomaly = 'rate';
+				RETURN NEW;
+			END IF;
+		END IF;
+		IF a.deviations > 0 THEN
+			SELECT avg(sum / count), stddev_samp(sum / count), count(*) INTO b_mean, b_sd, b_n FROM field.metric_hour
+				WHERE devicePK = NEW.devicePK AND typePK = NEW.typePK
+				AND time IN (SELECT date_trunc('hour', NEW.time) - d * interval '1 day' FROM generate_series(1, a.days) d);
+			IF b_n >= 3 AND b_sd > 0 AND abs(NEW.value - b_mean) > a.deviations * b_sd THEN
+				NEW.anomaly = 'baseline';
+			END IF;
+		END IF;
+		RETURN NEW; END;
+		$$
+		LANGUAGE plpgsql;
+
+		CREATE TRIGGER metric_summary_anomaly_trigger BEFORE INSERT OR UPDATE ON field.metric_summary
+		FOR EACH ROW EXECUTE PROCEDURE field.metric_summary_anomaly();
+		CREATE FUNCTION data.latency_summary_anomaly()
+		RETURNS TRIGGER AS
+		$$
+		DECLARE
+			a data.latency_anomaly%ROWTYPE;
+			t0 TIMESTAMP WITH TIME ZONE;
+			v0 DOUBLE PRECISION;
+			b_mean DOUBLE PRECISION;
+			b_sd DOUBLE PRECISION;
+			b_n INTEGER;
+		BEGIN
+		NEW.anomaly = '';
+		SELECT * INTO a FROM data.latency_anomaly WHERE sitePK = NEW.sitePK AND typePK = NEW.typePK;
+		IF NOT FOUND THEN
+			RETURN NEW;
+		END IF;
+		IF a.rate > 0 THEN
+			SELECT time, mean_sum / count INTO t0, v0 FROM data.latency_five_minutes
+				WHERE sitePK = NEW.sitePK AND typePK = NEW.typePK
+				AND time <= NEW.time - interval '1 hour' AND time > NEW.time - interval '2 hours'
+				ORDER BY time DESC LIMIT 1;
+			IF FOUND AND abs(NEW.mean - v0) * 3600 / extract(epoch FROM NEW.time - t0) > a.rate THEN
+				NEW.anomaly = 'rate';
+				RETURN NEW;
+			END IF;
+		END IF;
+		IF a.deviations > 0 THEN
+			SELECT avg(mean_sum / count), stddev_samp(mean_sum / count), count(*) INTO b_mean, b_sd, b_n FROM data.latency_hour
+				WHERE sitePK = NEW.sitePK AND typePK = NEW.typePK
+				AND time IN (SELECT date_trunc('hour', NEW.time) - d * interval '1 day' FROM generate_series(1, a.days) d);
+			IF b_n >= 3 AND b_sd > 0 AND abs(NEW.mean - b_mean) > a.deviations * b_sd THEN
+				NEW.anomaly = 'baseline';
+			END IF;
+		END IF;
+		RETURN NEW; END;
+		$$
+		LANGUAGE plpgsql;
+
+		CREATE TRIGGER latency_summary_anomaly_trigger BEFORE INSERT OR UPDATE ON data.latency_summary
+		FOR EACH ROW EXECUTE PROCEDURE data.latency_summary_anomaly();`,
+		down: `DROP TRIGGER metric_summary_anomaly_trigger ON field.metric_summary;
+		DROP FUNCTION field.metric_summary_anomaly();
+		DROP TRIGGER latency_summary_anomaly_trigger ON data.latency_summary;
+		DROP FUNCTION data.latency_summary_anomaly();
+		ALTER TABLE field.metric_summary DROP COLUMN anomaly;
+		ALTER TABLE data.latency_summary DROP COLUMN anomaly;
+		DROP TABLE field.metric_anomaly;
+		DROP TABLE data.latency_anomaly`,
+	},
+	{
+		version:     18,
+		description: "prometheus counters",
+		up: `CREATE TABLE app.prometheus_counter (
+			series TEXT PRIMARY KEY,
+			value DOUBLE PRECISION NOT NULL,
+			seen TIMESTAMP(0) WITH TIME ZONE NOT NULL
+		);
+		GRANT ALL ON app.prometheus_counter TO mtr_w;
+		GRANT SELECT ON app.prometheus_counter TO mtr_r;`,
+		down: `DROP TABLE app.prometheus_counter`,
+	},
+}
+
+// latestVersion returns the version of the schema after all of m have been applied.
+func latestVersion(m []migration) int {
+	if len(m) == 0 {
+		return schemaBaseline
+	}
+
+	return m[len(m)-1].version
+}
+
+// checkMigrations returns an error if the versions in m don't follow on from schemaBaseline or a migration is empty.
+func checkMigrations(m []migration) error {
+	for i, v := range m {
+		if v.version != schemaBaseline+i+1 {
+			return fmt.Errorf("migration %d (%s) expected version %d", v.version, v.description, schemaBaseline+i+1)
+		}
+
+		if v.description == "" || v.up == "" || v.down == "" {
+			return fmt.Errorf("migration %d needs a description, up, and down", v.version)
+		}
+	}
+
+	return nil
+}
+
+// schemaVersion returns the version of the schema in the DB.
+func schemaVersion(d *sql.DB) (int, error) {
+	var version sql.NullInt64
+
+	if err := d.QueryRow(`SELECT max(version) FROM mtr.schema_version`).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	if !version.Valid {
+		return 0, fmt.Errorf("no rows in mtr.schema_version")
+	}
+
+	return int(version.Int64), nil
+}
+
+// checkSchema returns an error if the schema in the DB is behind the migrations in this binary.
+func checkSchema(d *sql.DB) error {
+	version, err := schemaVersion(d)
+	if err != nil {
+		return err
+	}
+
+	if latest := latestVersion(migrations); version < latest {
+		return fmt.Errorf("schema version %d is behind %d, run mtr-api migrate up", version, latest)
+	}
+
+	return nil
+}
+
+/*
+migrateUp applies the migrations in m that haven't been applied to the DB.  Each migration is applied
+in a transaction with its row in mtr.schema_version.  Returns the migrations that were applied.
+*/
+func migrateUp(d *sql.DB, m []migration) ([]migration, error) {
+	if err := checkMigrations(m); err != nil {
+		return nil, err
+	}
+
+	var applied []migration
+
+	for _, v := range m {
+		ok, err := migrateTx(d, func(txn *sql.Tx, version int) (bool, error) {
+			if version >= v.version {
+				return false, nil
+			}
+
+			if version != v.version-1 {
+				return false, fmt.Errorf("schema version %d can't be migrated to %d", version, v.version)
+			}
+
+			if _, err := txn.Exec(v.up); err != nil {
+				return false, fmt.Errorf("migration %d (%s): %s", v.version, v.description, err)
+			}
+
+			_, err := txn.Exec(`INSERT INTO mtr.schema_version(version, description) VALUES($1, $2)`, v.version, v.description)
+			return true, err
+		})
+		if err != nil {
+			return applied, err
+		}
+
+		if ok {
+			applied = append(applied, v)
+		}
+	}
+
+	return applied, nil
+}
+
+// migrateDown reverts the latest migration that has been applied to the DB.
+func migrateDown(d *sql.DB, m []migration) (migration, error) {
+	if err := checkMigrations(m); err != nil {
+		return migration{}, err
+	}
+
+	var reverted migration
+
+	_, err := migrateTx(d, func(txn *sql.Tx, version int) (bool, error) {
+		if version <= schemaBaseline {
+			return false, fmt.Errorf("schema version %d can't be migrated down", version)
+		}
+
+		if version > latestVersion(m) {
+			return false, fmt.Errorf("schema version %d is newer than this binary", version)
+		}
+
+		reverted = m[version-schemaBaseline-1]
+
+		if _, err := txn.Exec(reverted.down); err != nil {
+			return false, fmt.Errorf("migration %d (%s): %s", reverted.version, reverted.description, err)
+		}
+
+		_, err := txn.Exec(`DELETE FROM mtr.schema_version WHERE version = $1`, reverted.version)
+		return true, err
+	})
+
+	return reverted, err
+}
+
+// migrateTx runs f in a transaction holding migrateLock with the current schema version.
+// The transaction is committed if f returns true.
+func migrateTx(d *sql.DB, f func(txn *sql.Tx, version int) (bool, error)) (bool, error) {
+	txn, err := d.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer txn.Rollback()
+
+	if _, err = txn.Exec(`SELECT pg_advisory_xact_lock($1)`, migrateLock); err != nil {
+		return false, err
+	}
+
+	// databases created from the original schema before migrations were added are at the baseline.
+	var exists bool
+
+	if err = txn.QueryRow(`SELECT to_regclass('mtr.schema_version') IS NOT NULL`).Scan(&exists); err != nil {
+		return false, err
+	}
+
+	if !exists {
+		if _, err = txn.Exec(`CREATE TABLE mtr.schema_version (
+				version INTEGER PRIMARY KEY,
+				description TEXT NOT NULL,
+				applied TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now())`); err != nil {
+			return false, err
+		}
+
+		if _, err = txn.Exec(`INSERT INTO mtr.schema_version(version, description) VALUES($1, 'baseline')`, schemaBaseline); err != nil {
+			return false, err
+		}
+	}
+
+	var version int
+
+	if err = txn.QueryRow(`SELECT max(version) FROM mtr.schema_version`).Scan(&version); err != nil {
+		return false, err
+	}
+
+	ok, err := f(txn, version)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return true, txn.Commit()
+}
+
+/*
+migrate runs the migrate subcommand e.g., mtr-api migrate status
+
+	up      applies all migrations that haven't been applied.
+	down    reverts the latest migration.
+	status  prints the schema version and any migrations that haven't been applied.
+*/
+func migrate(d *sql.DB, args []string, w io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: mtr-api migrate up|down|status")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrateUp(d, migrations)
+		for _, v := range applied {
+			fmt.Fprintf(w, "applied %d %s\n", v.version, v.description)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintf(w, "schema is up to date at version %d\n", latestVersion(migrations))
+		}
+	case "down":
+		reverted, err := migrateDown(d, migrations)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "reverted %d %s\n", reverted.version, reverted.description)
+	case "status":
+		var version int
+
+		if _, err := migrateTx(d, func(txn *sql.Tx, v int) (bool, error) {
+			version = v
+			return false, nil
+		}); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "schema version %d, latest version %d\n", version, latestVersion(migrations))
+
+		for _, v := range migrations {
+			if v.version > version {
+				fmt.Fprintf(w, "pending %d %s\n", v.version, v.description)
+			}
+		}
+	default:
+		return fmt.Errorf("usage: mtr-api migrate up|down|status")
+	}
+
+	return nil
+}
+
+/*
+migrateMain runs the migrate subcommand and exits.  Migrations change the schema so they use the
+DB credentials in DB_MIGRATE_USER and DB_MIGRATE_PASSWORD (usually the DB owner), or DB_USER and
+DB_PASSWORD if they aren't set.
+*/
+func migrateMain(args []string) {
+	user, password := os.Getenv("DB_MIGRATE_USER"), os.Getenv("DB_MIGRATE_PASSWORD")
+	if user == "" {
+		user, password = os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD")
+	}
+
+	d, err := sql.Open("postgres",
+		fmt.Sprintf("host=%s connect_timeout=30 user=%s password=%s dbname=mtr sslmode=disable", os.Getenv("DB_HOST"), user, password))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	err = migrate(d, args, os.Stdout)
+	d.Close()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
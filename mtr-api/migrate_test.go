@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	wt "github.com/GeoNet/weft/wefttest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckMigrations(t *testing.T) {
+	if err := checkMigrations(migrations); err != nil {
+		t.Error(err)
+	}
+
+	next := latestVersion(migrations) + 1
+
+	in := []struct {
+		id string
+		m  migration
+		ok bool
+	}{
+		{id: wt.L(), m: migration{version: next, description: "test", up: "SELECT 1", down: "SELECT 1"}, ok: true},
+		{id: wt.L(), m: migration{version: next + 1, description: "test", up: "SELECT 1", down: "SELECT 1"}},
+		{id: wt.L(), m: migration{version: next, description: "test", up: "SELECT 1"}},
+		{id: wt.L(), m: migration{version: next, up: "SELECT 1", down: "SELECT 1"}},
+	}
+
+	for _, v := range in {
+		err := checkMigrations(append(append([]migration{}, migrations...), v.m))
+		if v.ok && err != nil {
+			t.Errorf("%s unexpected error %s", v.id, err)
+		}
+		if !v.ok && err == nil {
+			t.Errorf("%s expected error", v.id)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	// new databases are at the latest version.
+	if err := checkSchema(db); err != nil {
+		t.Fatal(err)
+	}
+
+	latest := latestVersion(migrations)
+
+	m := append(append([]migration{}, migrations...), migration{
+		version:     latest + 1,
+		description: "test migration",
+		up:          `INSERT INTO mtr.tag(tag) VALUES('MIGRATE_TEST')`,
+		down:        `DELETE FROM mtr.tag WHERE tag = 'MIGRATE_TEST'`,
+	})
+
+	applied, err := migrateUp(db, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 1 || applied[0].version != latest+1 {
+		t.Errorf("expected the test migration to be applied got %v", applied)
+	}
+
+	var version int
+	if version, err = schemaVersion(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if version != latest+1 {
+		t.Errorf("expected version %d got %d", latest+1, version)
+	}
+
+	var found bool
+	if err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM mtr.tag WHERE tag = 'MIGRATE_TEST')`).Scan(&found); err != nil {
+		t.Fatal(err)
+	}
+
+	if !found {
+		t.Error("expected the test migration to insert the tag")
+	}
+
+	// applying again is a noop.
+	if applied, err = migrateUp(db, m); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("expected no migrations to be applied got %d", len(applied))
+	}
+
+	// this binary doesn't have the test migration so can't revert it.
+	if _, err = migrateDown(db, migrations); err == nil {
+		t.Error("expected error reverting a migration newer than the binary")
+	}
+
+	var reverted migration
+	if reverted, err = migrateDown(db, m); err != nil {
+		t.Fatal(err)
+	}
+
+	if reverted.version != latest+1 {
+		t.Errorf("expected to revert %d got %d", latest+1, reverted.version)
+	}
+
+	if err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM mtr.tag WHERE tag = 'MIGRATE_TEST')`).Scan(&found); err != nil {
+		t.Fatal(err)
+	}
+
+	if found {
+		t.Error("expected the test migration to be reverted")
+	}
+
+	var b bytes.Buffer
+
+	if err = migrate(db, []string{"status"}, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(b.String(), "schema version") {
+		t.Errorf("unexpected status %s", b.String())
+	}
+
+	if err = migrate(db, []string{"sideways"}, &b); err == nil {
+		t.Error("expected error for unknown migrate command")
+	}
+}
+
+/*
+TestMigrateBaseline migrates the original schema in the mtr_baseline DB (see database/scripts/initdb-baseline.sh)
+to the latest version, checks it matches the schema from database/ddl, then reverts all the migrations
+and applies them again.
+*/
+func TestMigrateBaseline(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	d, err := sql.Open("postgres",
+		os.ExpandEnv("host=${DB_HOST} connect_timeout=30 user=${DB_MIGRATE_USER} password=${DB_MIGRATE_PASSWORD} dbname=mtr_baseline sslmode=disable"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if _, err = migrateUp(d, migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBaselineSchema(t, d)
+
+	for range migrations {
+		if _, err = migrateDown(d, migrations); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var version int
+	if version, err = schemaVersion(d); err != nil {
+		t.Fatal(err)
+	}
+
+	if version != schemaBaseline {
+		t.Errorf("expected version %d after reverting all migrations got %d", schemaBaseline, version)
+	}
+
+	if _, err = migrateUp(d, migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBaselineSchema(t, d)
+}
+
+// checkBaselineSchema checks the columns and functions in the migrated DB d match the test DB.
+func checkBaselineSchema(t *testing.T, d *sql.DB) {
+	version, err := schemaVersion(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if latest := latestVersion(migrations); version != latest {
+		t.Errorf("expected version %d got %d", latest, version)
+	}
+
+	expected, err := schemaObjects(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := schemaObjects(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range expected {
+		if migrated[k] != v {
+			t.Errorf("%s expected %s got %s", k, v, migrated[k])
+		}
+	}
+
+	for k, v := range migrated {
+		if _, ok := expected[k]; !ok {
+			t.Errorf("%s %s is not in database/ddl", k, v)
+		}
+	}
+}
+
+// schemaObjects returns the type of the columns (not including partitions) and the functions in the mtr schemas.
+func schemaObjects(d *sql.DB) (map[string]string, error) {
+	rows, err := d.Query(`SELECT n.nspname || '.' || c.relname || '.' || a.attname, format_type(a.atttypid, a.atttypmod)
+				FROM pg_attribute a
+				JOIN pg_class c ON c.oid = a.attrelid
+				JOIN pg_namespace n ON n.oid = c.relnamespace
+				WHERE n.nspname IN ('mtr', 'field', 'data', 'app')
+				AND c.relkind IN ('r', 'v')
+				AND c.relname !~ '_[0-9]{8}$'
+				AND a.attnum > 0
+				AND NOT a.attisdropped
+				UNION ALL
+				SELECT n.nspname || '.' || p.proname || '()', 'function'
+				FROM pg_proc p
+				JOIN pg_namespace n ON n.oid = p.pronamespace
+				WHERE n.nspname IN ('mtr', 'field', 'data', 'app')`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	o := make(map[string]string)
+
+	for rows.Next() {
+		var k, v string
+		if err = rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		o[k] = v
+	}
+
+	return o, rows.Err()
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/GeoNet/mtr/mtrapp"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/weft"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// notifyMaxAttempts is the number of times delivery is tried before a notification has failed.
+const notifyMaxAttempts = 10
+
+// notifyMaxBackoff is the longest wait between delivery attempts.
+const notifyMaxBackoff = time.Hour
+
+// notifyBatch is the most notifications delivered each time deliverNotifications runs.
+const notifyBatch = 100
+
+// notifyTimeout is the longest a webhook or email delivery can take.
+var notifyTimeout = time.Second * 10
+
+// notifyLease is how long notifications are claimed for while they are delivered.  It is longer than it takes
+// to deliver notifyBatch notifications.  Claimed notifications that weren't delivered (e.g., mtr-api stopped)
+// are tried again after it.
+const notifyLease = time.Hour
+
+var notifyClient = &http.Client{Timeout: notifyTimeout}
+
+/*
+notifyConfig routes alert notifications (see alert.go) to webhooks and email.  It is read from the JSON file
+in the env var MTR_NOTIFY_CONFIG e.g.,
+
+	{"smtp": {"addr": "smtp.example.com:25", "from": "mtr@example.com"},
+	 "targets": [
+		{"name": "ops", "webhook": "https://example.com/hooks/mtr", "typeIDs": ["latency.strong"]},
+		{"name": "taupo", "email": ["taupo@example.com"], "tags": ["TAUP"]}
+	]}
+
+A notification is sent to each target that matches when an alert starts (firing) or is resolved.
+A target with tags matches alerts for metrics with any of the tags and a target with typeIDs matches
+alerts for those types.  If both are set an alert must match both.  A target with neither matches every alert.
+*/
+type notifyConfig struct {
+	SMTP    notifySMTP     `json:"smtp"`
+	Targets []notifyTarget `json:"targets"`
+}
+
+// notifySMTP is the server that email is sent through.  There is no authentication.
+type notifySMTP struct {
+	Addr string `json:"addr"`
+	From string `json:"from"`
+}
+
+// notifyTarget is a webhook URL (a JSON POST of the alert) or a list of email addresses.
+type notifyTarget struct {
+	Name    string   `json:"name"`
+	Webhook string   `json:"webhook"`
+	Email   []string `json:"email"`
+	Tags    []string `json:"tags"`
+	TypeIDs []string `json:"typeIDs"`
+}
+
+var notify = struct {
+	sync.Mutex
+	config notifyConfig
+}{}
+
+/*
+notifyAlert is the body of a notification.  Event is firing or resolved and State is the
+state of the alert (bad or late).  Value, Lower, and Upper are the latest value and thresholds
+for the metric when the event happened.
+*/
+type notifyAlert struct {
+	Event    string    `json:"event"`
+	Schema   string    `json:"schema"`
+	DeviceID string    `json:"deviceID,omitempty"`
+	SiteID   string    `json:"siteID,omitempty"`
+	TypeID   string    `json:"typeID"`
+	State    string    `json:"state"`
+	Value    float64   `json:"value"`
+	Lower    float64   `json:"lower"`
+	Upper    float64   `json:"upper"`
+	Tags     []string  `json:"tags"`
+	Time     time.Time `json:"time"`
+}
+
+// notification is a queued notification from mtr.notification.  target is the name of the notifyTarget.
+type notification struct {
+	pk       int64
+	target   string
+	method   string
+	address  string
+	body     string
+	attempts int
+}
+
+// loadNotifyConfig reads the notification targets from the JSON file.
+// An empty file name is no targets (no notifications are sent).
+func loadNotifyConfig(file string) error {
+	if file == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	return setNotifyConfig(b)
+}
+
+// setNotifyConfig parses and validates the config in b and makes it the current config.
+func setNotifyConfig(b []byte) error {
+	var c notifyConfig
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+
+	for i, t := range c.Targets {
+		if t.Name == "" {
+			return fmt.Errorf("target %d: empty name", i)
+		}
+
+		if names[t.Name] {
+			return fmt.Errorf("target %d: duplicate name %s", i, t.Name)
+		}
+		names[t.Name] = true
+
+		switch {
+		case t.Webhook != "" && len(t.Email) > 0:
+			return fmt.Errorf("target %s: only one of webhook or email can be set", t.Name)
+		case t.Webhook != "":
+			u, err := url.Parse(t.Webhook)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("target %s: invalid webhook URL %s", t.Name, t.Webhook)
+			}
+		case len(t.Email) > 0:
+			if c.SMTP.Addr == "" || c.SMTP.From == "" {
+				return fmt.Errorf("target %s: email needs the smtp addr and from", t.Name)
+			}
+
+			for _, e := range t.Email {
+				if _, err := mail.ParseAddress(e); err != nil || strings.Contains(e, ",") {
+					return fmt.Errorf("target %s: invalid email address %s", t.Name, e)
+				}
+			}
+		default:
+			return fmt.Errorf("target %s: one of webhook or email is needed", t.Name)
+		}
+	}
+
+	notify.Lock()
+	notify.config = c
+	notify.Unlock()
+
+	return nil
+}
+
+// matches returns true if the alert should be sent to the target.
+func (t notifyTarget) matches(a notifyAlert) bool {
+	if len(t.TypeIDs) > 0 && !contains(t.TypeIDs, a.TypeID) {
+		return false
+	}
+
+	if len(t.Tags) == 0 {
+		return true
+	}
+
+	for _, tag := range a.Tags {
+		if contains(t.Tags, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// method returns how notifications are sent to t and the address to send them to.
+func (t notifyTarget) method() (string, string) {
+	if t.Webhook != "" {
+		return "webhook", t.Webhook
+	}
+
+	return "email", strings.Join(t.Email, ",")
+}
+
+func contains(s []string, v string) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newNotifyAlert returns the notification for event on the alert for k with state.  m is the current value for the metric.
+func newNotifyAlert(event string, k alertKey, state string, m alertMetric, t time.Time) notifyAlert {
+	a := notifyAlert{
+		Event:  event,
+		Schema: k.schema,
+		TypeID: k.typeID,
+		State:  state,
+		Value:  m.value,
+		Lower:  m.lower,
+		Upper:  m.upper,
+		Tags:   []string{},
+		Time:   t,
+	}
+
+	switch k.schema {
+	case "field":
+		a.DeviceID = k.id
+	case "data":
+		a.SiteID = k.id
+	}
+
+	return a
+}
+
+// queueNotifications adds the tags for the metric to each alert and returns a notification for each target
+// that the alert matches.  They are saved with the alert changes and sent by deliverNotifications.
+func queueNotifications(alerts []notifyAlert) ([]notification, error) {
+	notify.Lock()
+	targets := notify.config.Targets
+	notify.Unlock()
+
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	var res []notification
+
+	for _, a := range alerts {
+		var err error
+
+		if a.Tags, err = alertTags(a); err != nil {
+			return nil, err
+		}
+
+		var b []byte
+		if b, err = json.Marshal(a); err != nil {
+			return nil, err
+		}
+
+		for _, t := range targets {
+			if !t.matches(a) {
+				continue
+			}
+
+			method, address := t.method()
+
+			res = append(res, notification{target: t.Name, method: method, address: address, body: string(b)})
+		}
+	}
+
+	return res, nil
+}
+
+// alertTags returns the tags for the metric for a.
+func alertTags(a notifyAlert) ([]string, error) {
+	tags := []string{}
+
+	switch a.Schema {
+	case "field":
+		t, err := storage.fieldMetricTags(a.DeviceID, a.TypeID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range t {
+			tags = append(tags, v.Tag)
+		}
+	case "data":
+		t, err := storage.dataLatencyTags(a.SiteID, a.TypeID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range t {
+			tags = append(tags, v.Tag)
+		}
+	default:
+		return nil, fmt.Errorf("invalid schema for alert %s", a.Schema)
+	}
+
+	sort.Strings(tags)
+
+	return tags, nil
+}
+
+// notifyBackoff returns how long to wait before trying to deliver a notification again after attempts.
+// It doubles from one minute up to notifyMaxBackoff.
+func notifyBackoff(attempts int) time.Duration {
+	if attempts < 1 || attempts > 7 {
+		return notifyMaxBackoff
+	}
+
+	d := time.Minute << uint(attempts-1)
+	if d > notifyMaxBackoff {
+		return notifyMaxBackoff
+	}
+
+	return d
+}
+
+/*
+sendNotifications delivers notifications (see deliverNotifications) once a minute.  It runs separately from
+evaluateAlerts so that slow webhooks or email don't hold up the alerts.  The time taken is tracked as a timer.
+*/
+func sendNotifications() {
+	ticker := time.NewTicker(time.Minute).C
+	for {
+		select {
+		case <-ticker:
+			t := mtrapp.Start()
+
+			if err := deliverNotifications(time.Now().UTC()); err != nil {
+				log.Println(err)
+			}
+
+			t.Track("deliverNotifications")
+		}
+	}
+}
+
+/*
+deliverNotifications sends the pending notifications that are due.  They are claimed (see claimNotifications)
+and then sent without holding a transaction open, with the result of each saved as soon as it is sent.  A failed
+delivery is retried after notifyBackoff until notifyMaxAttempts and the error is kept in mtr.notification.
+*/
+func deliverNotifications(now time.Time) error {
+	pending, err := claimNotifications(now)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range pending {
+		if e := n.deliver(now); e != nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+/*
+claimNotifications returns up to notifyBatch notifications that are due.  The attempt is counted and they
+aren't due again until after notifyLease so more than one mtr-api can deliver at the same time.
+*/
+func claimNotifications(now time.Time) ([]notification, error) {
+	return storage.notificationsClaim(now, notifyBatch, notifyLease)
+}
+
+// deliver sends n and saves the result.
+func (n notification) deliver(now time.Time) error {
+	sendErr := n.send()
+	if sendErr == nil {
+		return storage.notificationSent(n.pk, now)
+	}
+
+	status := "pending"
+	if n.attempts >= notifyMaxAttempts {
+		status = "failed"
+	}
+
+	return storage.notificationRetry(n.pk, status, sendErr.Error(), now.Add(notifyBackoff(n.attempts)))
+}
+
+func (n notification) send() error {
+	switch n.method {
+	case "webhook":
+		return sendWebhook(n.address, []byte(n.body))
+	case "email":
+		var a notifyAlert
+
+		if err := json.Unmarshal([]byte(n.body), &a); err != nil {
+			return err
+		}
+
+		return sendEmail(strings.Split(n.address, ","), a)
+	default:
+		return fmt.Errorf("invalid notification method %s", n.method)
+	}
+}
+
+// sendWebhook POSTs the JSON body to u.  Any status other than 2xx is an error.
+func sendWebhook(u string, body []byte) error {
+	res, err := notifyClient.Post(u, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", res.Status)
+	}
+
+	return nil
+}
+
+/*
+sendEmail sends a to the email addresses using the SMTP server in the notification config.  STARTTLS is used
+if the server has it.  The whole exchange with the server must finish within notifyTimeout.
+*/
+func sendEmail(to []string, a notifyAlert) error {
+	notify.Lock()
+	s := notify.config.SMTP
+	notify.Unlock()
+
+	if s.Addr == "" || s.From == "" {
+		return fmt.Errorf("no SMTP server in the notification config")
+	}
+
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", s.Addr, notifyTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(notifyTimeout)); err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(s.From); err != nil {
+		return err
+	}
+
+	for _, addr := range to {
+		if err = c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(emailMessage(s.From, to, a)); err != nil {
+		return err
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// emailMessage formats a as a plain text email.  IDs can be from auto registration so the subject is
+// Q encoded if needed (e.g., it has CR or LF) so that it can't add headers.
+func emailMessage(from string, to []string, a notifyAlert) []byte {
+	id := a.DeviceID
+	if id == "" {
+		id = a.SiteID
+	}
+
+	var b bytes.Buffer
+
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", fmt.Sprintf("mtr alert %s: %s %s is %s", a.Event, id, a.TypeID, a.State)) + "\r\n")
+	b.WriteString("Date: " + a.Time.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+
+	switch a.Event {
+	case alertResolved:
+		b.WriteString(fmt.Sprintf("%s %s is no longer %s.\r\n\r\n", id, a.TypeID, a.State))
+	default:
+		b.WriteString(fmt.Sprintf("%s %s is %s.\r\n\r\n", id, a.TypeID, a.State))
+	}
+
+	b.WriteString(fmt.Sprintf("value: %g\r\n", a.Value))
+	b.WriteString(fmt.Sprintf("thresholds: %g to %g\r\n", a.Lower, a.Upper))
+	b.WriteString("tags: " + strings.Join(a.Tags, ", ") + "\r\n")
+	b.WriteString("time: " + a.Time.Format(time.RFC3339) + "\r\n")
+
+	return b.Bytes()
+}
+
+// notificationProto is the delivery log.  It returns the notifications queued after startDate (default the last 24 hours),
+// most recent first.
+func notificationProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	t, res := alertStart(r)
+	if !res.Ok {
+		return res
+	}
+
+	var nr mtrpb.NotificationResult
+	var err error
+
+	if nr.Result, err = storage.notifications(t); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	var by []byte
+	if by, err = proto.Marshal(&nr); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
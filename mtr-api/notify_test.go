@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	wt "github.com/GeoNet/weft/wefttest"
+	"github.com/golang/protobuf/proto"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetNotifyConfig(t *testing.T) {
+	defer setNotifyConfig([]byte(`{}`))
+
+	in := []struct {
+		id     string
+		config string
+		ok     bool
+	}{
+		{id: wt.L(), config: `{}`, ok: true},
+		{id: wt.L(), config: `{"targets": [{"name": "ops", "webhook": "https://example.com/hook", "tags": ["TAUP"]}]}`, ok: true},
+		{id: wt.L(), config: `{"smtp": {"addr": "localhost:25", "from": "mtr@example.com"},
+			"targets": [{"name": "ops", "email": ["ops@example.com", "Ops <ops2@example.com>"]}]}`, ok: true},
+		{id: wt.L(), config: `{"targets": [{"webhook": "https://example.com/hook"}]}`},
+		{id: wt.L(), config: `{"targets": [{"name": "ops"}]}`},
+		{id: wt.L(), config: `{"targets": [{"name": "ops", "webhook": "ftp://example.com/hook"}]}`},
+		{id: wt.L(), config: `{"targets": [{"name": "ops", "webhook": "https://example.com/hook"}, {"name": "ops", "webhook": "https://example.com/hook"}]}`},
+		{id: wt.L(), config: `{"targets": [{"name": "ops", "email": ["ops@example.com"]}]}`},
+		{id: wt.L(), config: `{"smtp": {"addr": "localhost:25", "from": "mtr@example.com"}, "targets": [{"name": "ops", "email": ["not an address"]}]}`},
+		{id: wt.L(), config: `{"smtp": {"addr": "localhost:25", "from": "mtr@example.com"},
+			"targets": [{"name": "ops", "webhook": "https://example.com/hook", "email": ["ops@example.com"]}]}`},
+		{id: wt.L(), config: `{"targets": [`},
+	}
+
+	for _, v := range in {
+		err := setNotifyConfig([]byte(v.config))
+		if v.ok && err != nil {
+			t.Errorf("%s unexpected error %s", v.id, err)
+		}
+		if !v.ok && err == nil {
+			t.Errorf("%s expected error", v.id)
+		}
+	}
+}
+
+func TestNotifyTargetMatches(t *testing.T) {
+	a := notifyAlert{TypeID: "voltage", Tags: []string{"LINZ", "TAUP"}}
+
+	in := []struct {
+		id      string
+		target  notifyTarget
+		matches bool
+	}{
+		{id: wt.L(), target: notifyTarget{}, matches: true},
+		{id: wt.L(), target: notifyTarget{Tags: []string{"TAUP"}}, matches: true},
+		{id: wt.L(), target: notifyTarget{Tags: []string{"WGTN", "LINZ"}}, matches: true},
+		{id: wt.L(), target: notifyTarget{Tags: []string{"WGTN"}}},
+		{id: wt.L(), target: notifyTarget{TypeIDs: []string{"voltage"}}, matches: true},
+		{id: wt.L(), target: notifyTarget{TypeIDs: []string{"latency.strong"}}},
+		{id: wt.L(), target: notifyTarget{TypeIDs: []string{"voltage"}, Tags: []string{"TAUP"}}, matches: true},
+		{id: wt.L(), target: notifyTarget{TypeIDs: []string{"voltage"}, Tags: []string{"WGTN"}}},
+		{id: wt.L(), target: notifyTarget{TypeIDs: []string{"conn"}, Tags: []string{"TAUP"}}},
+	}
+
+	for _, v := range in {
+		if v.target.matches(a) != v.matches {
+			t.Errorf("%s expected matches %t", v.id, v.matches)
+		}
+	}
+}
+
+func TestNotifyBackoff(t *testing.T) {
+	expected := []time.Duration{time.Minute, time.Minute * 2, time.Minute * 4, time.Minute * 8, time.Minute * 16,
+		time.Minute * 32, time.Hour, time.Hour, time.Hour}
+
+	for i, d := range expected {
+		if b := notifyBackoff(i + 1); b != d {
+			t.Errorf("attempt %d expected backoff %s got %s", i+1, d, b)
+		}
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	bodies := make(chan string, 1)
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		bodies <- string(b)
+	}))
+	defer hook.Close()
+
+	if err := sendWebhook(hook.URL, []byte(`{"event": "firing"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if b := <-bodies; b != `{"event": "firing"}` {
+		t.Errorf("unexpected webhook body %s", b)
+	}
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	if err := sendWebhook(broken.URL, []byte(`{}`)); err == nil {
+		t.Error("expected error for 500 response")
+	}
+}
+
+func TestSendEmail(t *testing.T) {
+	addr, msgs, stop := smtpStandIn(t)
+	defer stop()
+
+	if err := setNotifyConfig([]byte(`{"smtp": {"addr": "` + addr + `", "from": "mtr@example.com"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	defer setNotifyConfig([]byte(`{}`))
+
+	a := notifyAlert{
+		Event:    alertFiring,
+		Schema:   "field",
+		DeviceID: "gps-taupoairport",
+		TypeID:   "voltage",
+		State:    metricBad,
+		Value:    11000,
+		Lower:    12000,
+		Upper:    15000,
+		Tags:     []string{"TAUP"},
+		Time:     time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	if err := sendEmail([]string{"ops@example.com"}, a); err != nil {
+		t.Fatal(err)
+	}
+
+	m := <-msgs
+
+	for _, s := range []string{
+		"To: ops@example.com\r\n",
+		"Subject: mtr alert firing: gps-taupoairport voltage is bad\r\n",
+		"value: 11000\r\n",
+		"thresholds: 12000 to 15000\r\n",
+		"tags: TAUP\r\n",
+	} {
+		if !strings.Contains(m, s) {
+			t.Errorf("expected %q in email %s", s, m)
+		}
+	}
+}
+
+// TestEmailMessageHeaders checks IDs can't add headers to an email.
+func TestEmailMessageHeaders(t *testing.T) {
+	a := notifyAlert{
+		Event:    alertFiring,
+		DeviceID: "gps-taupoairport\r\nBcc: someone@example.com",
+		TypeID:   "voltage\nX-Injected: true",
+		State:    metricBad,
+	}
+
+	m := string(emailMessage("mtr@example.com", []string{"ops@example.com"}, a))
+
+	headers := m[:strings.Index(m, "\r\n\r\n")]
+
+	for _, h := range strings.Split(headers, "\r\n") {
+		if !(strings.HasPrefix(h, "From: ") || strings.HasPrefix(h, "To: ") || strings.HasPrefix(h, "Subject: ") ||
+			strings.HasPrefix(h, "Date: ") || strings.HasPrefix(h, "Content-Type: ")) {
+			t.Errorf("unexpected header %q", h)
+		}
+	}
+
+	// the five headers and no other line breaks.
+	if n := strings.Count(headers, "\n"); n != 4 {
+		t.Errorf("expected 5 header lines got %q", headers)
+	}
+
+	if !strings.Contains(headers, "Subject: =?utf-8?q?") {
+		t.Errorf("expected the subject to be Q encoded got %q", headers)
+	}
+}
+
+// TestSendEmailTimeout checks an SMTP server that doesn't respond doesn't block delivery.
+func TestSendEmailTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// accepts connections but never sends the greeting.
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	if err = setNotifyConfig([]byte(`{"smtp": {"addr": "` + l.Addr().String() + `", "from": "mtr@example.com"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	defer setNotifyConfig([]byte(`{}`))
+
+	timeout := notifyTimeout
+	notifyTimeout = time.Millisecond * 200
+	defer func() { notifyTimeout = timeout }()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- sendEmail([]string{"ops@example.com"}, notifyAlert{Event: alertFiring, TypeID: "voltage"})
+	}()
+
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Error("expected timeout error")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("sendEmail didn't time out")
+	}
+}
+
+// TestNotifications checks notifications are queued for alerts and delivered to the matching targets.
+func TestNotifications(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	bodies := make(chan []byte, 10)
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- b
+	}))
+	defer hook.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	addr, msgs, stop := smtpStandIn(t)
+	defer stop()
+
+	if err := setNotifyConfig([]byte(`{"smtp": {"addr": "` + addr + `", "from": "mtr@example.com"}, "targets": [
+		{"name": "hook", "webhook": "` + hook.URL + `", "typeIDs": ["voltage"], "tags": ["TEST_NOTIFY"]},
+		{"name": "broken", "webhook": "` + broken.URL + `", "tags": ["TEST_NOTIFY"]},
+		{"name": "email", "email": ["ops@example.com"], "tags": ["TEST_NOTIFY"]},
+		{"name": "other", "webhook": "` + hook.URL + `", "tags": ["NOT_THIS_TAG"]}
+		]}`)); err != nil {
+		t.Fatal(err)
+	}
+	defer setNotifyConfig([]byte(`{}`))
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	if _, err := db.Exec(`DELETE FROM mtr.alert WHERE schema = 'field' AND id = 'test-notify'`); err != nil {
+		t.Fatal(err)
+	}
+
+	in := wt.Requests{
+		{ID: wt.L(), URL: "/field/model?modelID=Trimble+NetR9", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/device?deviceID=test-notify&modelID=Trimble+NetR9&latitude=-38.74270&longitude=176.08100", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric?deviceID=test-notify&typeID=voltage", Method: "DELETE"},
+		{ID: wt.L(), URL: "/field/metric?deviceID=test-notify&typeID=voltage&value=14000&time=" + now.Add(time.Minute*-1).Format(time.RFC3339), Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric/threshold?deviceID=test-notify&typeID=voltage&lower=12000&upper=13000", Method: "PUT"},
+		{ID: wt.L(), URL: "/tag/TEST_NOTIFY", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric/tag?deviceID=test-notify&typeID=voltage&tag=TEST_NOTIFY", Method: "PUT"},
+	}
+
+	for _, v := range in {
+		if err := doStatus(testServer.URL, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer doStatus(testServer.URL, wt.Request{ID: wt.L(), URL: "/field/device?deviceID=test-notify", Method: "DELETE"})
+
+	if err := updateAlerts(now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deliverNotifications(now); err != nil {
+		t.Fatal(err)
+	}
+
+	var a notifyAlert
+
+	select {
+	case b := <-bodies:
+		if err := json.Unmarshal(b, &a); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no webhook received")
+	}
+
+	if a.Event != alertFiring || a.DeviceID != "test-notify" || a.State != metricBad || a.Value != 14000 ||
+		a.Lower != 12000 || a.Upper != 13000 || len(a.Tags) != 1 || a.Tags[0] != "TEST_NOTIFY" {
+		t.Errorf("unexpected webhook alert %+v", a)
+	}
+
+	select {
+	case m := <-msgs:
+		if !strings.Contains(m, "Subject: mtr alert firing: test-notify voltage is bad") {
+			t.Errorf("unexpected email %s", m)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no email received")
+	}
+
+	select {
+	case b := <-bodies:
+		t.Errorf("unexpected webhook %s", b)
+	default:
+	}
+
+	n := testNotifications(t)
+
+	if len(n) != 3 {
+		t.Fatalf("expected 3 notifications got %d", len(n))
+	}
+
+	for _, v := range []string{"hook", "email"} {
+		if n[v].Status != "sent" || n[v].Attempts != 1 || n[v].SentSeconds != now.Unix() {
+			t.Errorf("expected %s sent got %+v", v, n[v])
+		}
+	}
+
+	if n["broken"].Status != "pending" || n["broken"].Attempts != 1 || !strings.Contains(n["broken"].Error, "500") {
+		t.Errorf("expected broken pending got %+v", n["broken"])
+	}
+
+	// the broken webhook isn't retried until after the backoff.
+	if err := deliverNotifications(now.Add(time.Second * 30)); err != nil {
+		t.Fatal(err)
+	}
+
+	if b := testNotifications(t)["broken"]; b.Attempts != 1 {
+		t.Errorf("expected 1 attempt got %d", b.Attempts)
+	}
+
+	if err := deliverNotifications(now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if b := testNotifications(t)["broken"]; b.Attempts != 2 || b.Status != "pending" {
+		t.Errorf("expected 2 attempts got %+v", b)
+	}
+
+	// a claimed notification isn't claimed again until after the lease.
+	if n := testClaims(t, now.Add(time.Minute*3)); n != 1 {
+		t.Errorf("expected to claim 1 notification got %d", n)
+	}
+
+	if n := testClaims(t, now.Add(time.Minute*3)); n != 0 {
+		t.Errorf("expected to claim 0 notifications got %d", n)
+	}
+
+	if n := testClaims(t, now.Add(time.Minute*3+notifyLease)); n != 1 {
+		t.Errorf("expected to claim 1 notification after the lease got %d", n)
+	}
+}
+
+// testClaims returns the number of notifications for test-notify claimed at now.
+func testClaims(t *testing.T, now time.Time) int {
+	claimed, err := claimNotifications(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+
+	for _, v := range claimed {
+		if strings.Contains(v.body, `"deviceID":"test-notify"`) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// testNotifications returns the notifications for test-notify by target.
+func testNotifications(t *testing.T) map[string]*mtrpb.Notification {
+	r := wt.Request{ID: wt.L(), URL: "/notification", Accept: "application/x-protobuf", User: userW, Password: keyW}
+
+	b, err := r.Do(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nr mtrpb.NotificationResult
+
+	if err = proto.Unmarshal(b, &nr); err != nil {
+		t.Fatal(err)
+	}
+
+	n := make(map[string]*mtrpb.Notification)
+
+	for _, v := range nr.Result {
+		if strings.Contains(v.Body, `"deviceID":"test-notify"`) {
+			n[v.Target] = v
+		}
+	}
+
+	return n
+}
+
+// smtpStandIn runs a minimal SMTP server for testing.  It returns the address to send to and the messages that it receives.
+func smtpStandIn(t *testing.T) (string, <-chan string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := make(chan string, 10)
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go smtpSession(c, msgs)
+		}
+	}()
+
+	return l.Addr().String(), msgs, func() { l.Close() }
+}
+
+func smtpSession(c net.Conn, msgs chan<- string) {
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+
+	fmt.Fprint(c, "220 localhost\r\n")
+
+	var data bool
+	var msg bytes.Buffer
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		if data {
+			if line == ".\r\n" {
+				data = false
+				msgs <- msg.String()
+				msg.Reset()
+				fmt.Fprint(c, "250 ok\r\n")
+				continue
+			}
+
+			msg.WriteString(line)
+			continue
+		}
+
+		switch f := strings.Fields(strings.ToUpper(line)); {
+		case len(f) == 0:
+			fmt.Fprint(c, "500 empty command\r\n")
+		case f[0] == "EHLO" || f[0] == "HELO":
+			fmt.Fprint(c, "250 localhost\r\n")
+		case f[0] == "DATA":
+			data = true
+			fmt.Fprint(c, "354 end with .\r\n")
+		case f[0] == "QUIT":
+			fmt.Fprint(c, "221 bye\r\n")
+			return
+		default:
+			fmt.Fprint(c, "250 ok\r\n")
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+/*
+partitionTables are partitioned by day (UTC).  Each table is a view over <table>_parent which is
+inherited by a table for each day e.g., field.metric_20160101.  Inserts to the view are saved in the
+partition for the day (see mtr.partition_insert in the DDL) so reads and inserts don't change.
+Old partitions are dropped instead of deleting their rows.
+*/
+var partitionTables = []string{"field.metric", "data.latency", "data.completeness", "app.metric", "app.counter", "app.timer"}
+
+// partitionAhead is the number of days of partitions that are created before they are needed.
+const partitionAhead = 3
+
+type partition struct {
+	name string
+	day  time.Time
+}
+
+// partitionName returns the name of the partition of table for the day of t.
+func partitionName(table string, t time.Time) string {
+	return table + "_" + t.UTC().Format("20060102")
+}
+
+// createPartition creates the partition of table for the day of t if it doesn't exist.
+func createPartition(e execer, table string, t time.Time) error {
+	_, err := e.Exec(`SELECT mtr.create_partition($1, $2::date)`, table, t.UTC().Format("2006-01-02"))
+	return err
+}
+
+// partitions returns the partitions of table.
+func partitions(table string) ([]partition, error) {
+	rows, err := db.Query(`SELECT c.relname FROM pg_inherits i
+				JOIN pg_class c ON c.oid = i.inhrelid
+				WHERE i.inhparent = $1::regclass
+				ORDER BY c.relname ASC`, table+"_parent")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schema := table[:strings.Index(table, ".")]
+
+	var p []partition
+
+	for rows.Next() {
+		var name string
+
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		if len(name) < 8 {
+			continue
+		}
+
+		day, err := time.Parse("20060102", name[len(name)-8:])
+		if err != nil {
+			continue
+		}
+
+		p = append(p, partition{name: schema + "." + name, day: day})
+	}
+
+	return p, rows.Err()
+}
+
+/*
+managePartitions creates the partitions for today and the next partitionAhead days and drops partitions
+for days that are completely older than the longest retention for the schema (see mtr.retention).
+Partitions are archived before they are dropped (see archivePartition).  Returns the estimated number of rows dropped.
+*/
+func managePartitions() (int64, error) {
+	now := time.Now().UTC()
+	var dropped int64
+
+	for _, table := range partitionTables {
+		for i := 0; i <= partitionAhead; i++ {
+			if err := createPartition(db, table, now.Add(time.Hour*24*time.Duration(i))); err != nil {
+				return dropped, err
+			}
+		}
+
+		var days sql.NullInt64
+
+		if err := db.QueryRow(`SELECT max(days) FROM mtr.retention WHERE schema = $1`,
+			table[:strings.Index(table, ".")]).Scan(&days); err != nil {
+			return dropped, err
+		}
+
+		if !days.Valid {
+			continue
+		}
+
+		before := now.Add(time.Hour * -24 * time.Duration(days.Int64)).Truncate(time.Hour * 24)
+
+		p, err := partitions(table)
+		if err != nil {
+			return dropped, err
+		}
+
+		for _, v := range p {
+			if !v.day.Before(before) {
+				continue
+			}
+
+			if err = archivePartition(table, v); err != nil {
+				return dropped, err
+			}
+		}
+
+		var n int64
+
+		if err := db.QueryRow(`SELECT mtr.drop_partitions($1, $2::date)`, table, before.Format("2006-01-02")).Scan(&n); err != nil {
+			return dropped, err
+		}
+
+		dropped += n
+	}
+
+	return dropped, nil
+}
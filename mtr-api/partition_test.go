@@ -0,0 +1,80 @@
+package main
+
+import (
+	wt "github.com/GeoNet/weft/wefttest"
+	"testing"
+	"time"
+)
+
+func TestPartitionName(t *testing.T) {
+	tm := time.Date(2016, 1, 2, 23, 59, 59, 0, time.FixedZone("NZDT", 13*3600))
+
+	if n := partitionName("field.metric", tm); n != "field.metric_20160102" {
+		t.Errorf("expected field.metric_20160102 got %s", n)
+	}
+}
+
+func TestPartitions(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	old := now.Add(time.Hour * -24 * 50)
+
+	// values are saved in the partition for their day, which is created if needed.
+	for _, tm := range []time.Time{now, old} {
+		r := wt.Request{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&value=14000&time=" + tm.Format(time.RFC3339), Method: "PUT"}
+		if _, err := r.Do(testServer.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var c int
+
+	if err := db.QueryRow(`SELECT count(*) FROM `+partitionName("field.metric", old)+` WHERE time = $1`, old).Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c != 1 {
+		t.Errorf("expected 1 value in the partition got %d", c)
+	}
+
+	if _, err := managePartitions(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := partitions("field.metric")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := make(map[string]bool)
+	for _, v := range p {
+		found[v.name] = true
+	}
+
+	for i := 0; i <= partitionAhead; i++ {
+		n := partitionName("field.metric", now.Add(time.Hour*24*time.Duration(i)))
+		if !found[n] {
+			t.Errorf("expected partition %s", n)
+		}
+	}
+
+	// the partition for 50 days ago is older than the retention for field (40 days).
+	if found[partitionName("field.metric", old)] {
+		t.Errorf("expected partition %s to be dropped", partitionName("field.metric", old))
+	}
+
+	if err = db.QueryRow(`SELECT count(*) FROM field.metric WHERE time = $1`, old).Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c != 0 {
+		t.Errorf("expected old values to be dropped got %d", c)
+	}
+}
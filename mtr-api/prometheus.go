@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/mtr/prompb"
+	"github.com/GeoNet/weft"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+promConfig maps Prometheus series into mtr.  It is read from the JSON file
+in the env var MTR_PROMETHEUS_CONFIG e.g.,
+
+	{"rules": [
+		{"match": {"__name__": "node_voltage"}, "table": "field.metric", "typeID": "voltage", "scale": 1000},
+		{"match": {"__name__": "http_requests_total", "code": "200"}, "table": "app.counter", "typeID": "200"}
+	]}
+
+Rules are tried in order and the first rule where all the match labels are equal is used.
+*/
+type promConfig struct {
+	Rules []promRule `json:"rules"`
+}
+
+/*
+promRule maps matching series into a table.
+
+For "field.metric" the deviceID is the value of DeviceLabel (default device) and the typeID
+is TypeID or the value of TypeLabel (default type).
+
+For "app.metric" and "app.counter" the applicationID and instanceID are the values of
+ApplicationLabel (default job) and InstanceLabel (default instance).  TypeID is the numeric
+app.type e.g., 200.  Prometheus counters are cumulative, the increase between samples is
+saved to app.counter.
+
+Values are multiplied by Scale (default 1).  App metrics and counters are rounded.
+*/
+type promRule struct {
+	Match            map[string]string `json:"match"`
+	Table            string            `json:"table"`
+	TypeID           string            `json:"typeID"`
+	TypeLabel        string            `json:"typeLabel"`
+	DeviceLabel      string            `json:"deviceLabel"`
+	ApplicationLabel string            `json:"applicationLabel"`
+	InstanceLabel    string            `json:"instanceLabel"`
+	Scale            float64           `json:"scale"`
+	appTypePK        int
+}
+
+// promCounterTTL is how long a counter series is kept in app.prometheus_counter without samples
+// before it is forgotten.  The next sample after that is a new starting value.
+const promCounterTTL = time.Hour
+
+type promUnmatched struct {
+	count int64
+	last  time.Time
+}
+
+var prom = struct {
+	sync.Mutex
+	rules     []promRule
+	unmatched map[string]promUnmatched // by metric name
+	expired   time.Time                // when app.prometheus_counter was last checked for stale series
+}{
+	unmatched: make(map[string]promUnmatched),
+}
+
+func init() {
+	mux.HandleFunc("/prometheus/write", makeHandlerBatch("prometheusWrite", prometheusWrite))
+}
+
+// loadPromConfig reads the Prometheus mapping rules from the JSON file.
+// An empty file name is no rules (all series are unmatched).
+func loadPromConfig(file string) error {
+	if file == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	return setPromConfig(b)
+}
+
+// setPromConfig parses and validates the rules in b and makes them the current rules.
+func setPromConfig(b []byte) error {
+	var c promConfig
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return err
+	}
+
+	for i := range c.Rules {
+		r := &c.Rules[i]
+
+		if len(r.Match) == 0 {
+			return fmt.Errorf("rule %d: empty match", i)
+		}
+
+		if r.Scale == 0 {
+			r.Scale = 1
+		}
+
+		switch r.Table {
+		case "field.metric":
+			if r.DeviceLabel == "" {
+				r.DeviceLabel = "device"
+			}
+			if r.TypeLabel == "" {
+				r.TypeLabel = "type"
+			}
+		case "app.metric", "app.counter":
+			if r.ApplicationLabel == "" {
+				r.ApplicationLabel = "job"
+			}
+			if r.InstanceLabel == "" {
+				r.InstanceLabel = "instance"
+			}
+
+			var err error
+			if r.appTypePK, err = strconv.Atoi(r.TypeID); err != nil {
+				return fmt.Errorf("rule %d: invalid typeID for %s: %s", i, r.Table, r.TypeID)
+			}
+		default:
+			return fmt.Errorf("rule %d: invalid table: %s", i, r.Table)
+		}
+	}
+
+	prom.Lock()
+	prom.rules = c.Rules
+	prom.Unlock()
+
+	return nil
+}
+
+// match returns true if the labels in l have all the values in r.Match.
+func (r promRule) match(l map[string]string) bool {
+	for k, v := range r.Match {
+		if l[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+prometheusWrite receives the Prometheus remote write protocol (snappy compressed prompb.WriteRequest).
+Series are saved using the first matching rule.  Series that match no rule are counted, see
+prometheusUnmatchedProto.  Values that can't be saved (e.g., unknown devices or already data for the interval)
+are logged but don't fail the request so that Prometheus doesn't resend them.  The request only fails if
+no values could be saved because of a server error.
+*/
+func prometheusWrite(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	if res := weft.CheckQuery(r, []string{}, []string{}); !res.Ok {
+		return res
+	}
+
+	c, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxBatchBytes))
+	if err != nil {
+		return weft.BadRequest("error reading request body")
+	}
+
+	d, err := snappy.Decode(nil, c)
+	if err != nil {
+		return weft.BadRequest("invalid snappy in request body")
+	}
+
+	var req prompb.WriteRequest
+
+	if err = proto.Unmarshal(d, &req); err != nil {
+		return weft.BadRequest("invalid protobuf in request body")
+	}
+
+	prom.Lock()
+	rules := prom.rules
+	prom.Unlock()
+
+	var unmatched, saved, failed int
+	var last *weft.Result
+
+	for _, ts := range req.Timeseries {
+		l := make(map[string]string, len(ts.Labels))
+		for _, v := range ts.Labels {
+			l[v.Name] = v.Value
+		}
+
+		var rule *promRule
+		for i := range rules {
+			if rules[i].match(l) {
+				rule = &rules[i]
+				break
+			}
+		}
+
+		if rule == nil {
+			unmatched++
+			promCountUnmatched(l["__name__"])
+			continue
+		}
+
+		for _, s := range ts.Samples {
+			// NaN is used for stale markers.
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+
+			res := rule.save(l, s)
+			switch {
+			case res.Ok:
+				saved++
+			case res.Code == http.StatusInternalServerError:
+				failed++
+				last = res
+			default:
+				failed++
+			}
+		}
+	}
+
+	if unmatched > 0 || failed > 0 {
+		log.Printf("prometheus write: %d series unmatched, %d samples not saved", unmatched, failed)
+	}
+
+	// If nothing could be saved because of a server error (e.g., the DB is down) then
+	// return the error so that Prometheus will retry.
+	if saved == 0 && last != nil {
+		return last
+	}
+
+	promExpireCounters(time.Now().UTC())
+
+	return &weft.StatusOK
+}
+
+// save saves the sample s from the series with labels l.
+func (r promRule) save(l map[string]string, s *prompb.Sample) *weft.Result {
+	t := time.Unix(s.Timestamp/1000, (s.Timestamp%1000)*int64(time.Millisecond)).UTC()
+	v := s.Value * r.Scale
+	// app metrics and counters are integers.
+	n := math.Floor(v + 0.5)
+
+	switch r.Table {
+	case "field.metric":
+		typeID := r.TypeID
+		if typeID == "" {
+			typeID = l[r.TypeLabel]
+		}
+
+		f := fieldMetric{}
+		return f.save(l[r.DeviceLabel], typeID, t, v)
+	case "app.metric":
+		return applicationMetricSave(l[r.ApplicationLabel], l[r.InstanceLabel], r.appTypePK, t, int64(n))
+	case "app.counter":
+		return r.saveCounter(l, t, n)
+	}
+
+	return weft.InternalServerError(fmt.Errorf("invalid table: %s", r.Table))
+}
+
+/*
+saveCounter saves the increase in the counter series with labels l since its last value to app.counter.
+The last value is kept by the store (see promCounterSave) and the series is locked while the increase is saved so that
+concurrent writes for the series can't count the same increase twice.  The last value is only updated if the
+increase is saved so that it is included in the next increase if the save fails.  The first sample from a counter
+is the starting value.
+*/
+func (r promRule) saveCounter(l map[string]string, t time.Time, n float64) *weft.Result {
+	res := &weft.StatusOK
+
+	err := storage.promCounterSave(seriesKey(l), n, time.Now().UTC(), func(last float64) error {
+		inc := n - last
+		// counter reset
+		if inc < 0 {
+			inc = n
+		}
+
+		if inc > 0 {
+			if res = applicationCounterSave(l[r.ApplicationLabel], l[r.InstanceLabel], r.appTypePK, t, int(inc)); !res.Ok {
+				return errors.New(res.Msg)
+			}
+		}
+
+		return nil
+	})
+
+	switch {
+	case !res.Ok:
+		return res
+	case err != nil:
+		return weft.InternalServerError(err)
+	}
+
+	return res
+}
+
+// seriesKey returns a string that uniquely identifies a series from its labels.
+func seriesKey(l map[string]string) string {
+	var k []string
+	for n, v := range l {
+		k = append(k, n+"="+v)
+	}
+
+	sort.Strings(k)
+
+	return strings.Join(k, ",")
+}
+
+// promExpireCounters forgets counter series that have had no samples for promCounterTTL before now.
+// The counters are checked at most once a minute.
+func promExpireCounters(now time.Time) {
+	prom.Lock()
+	if now.Sub(prom.expired) < time.Minute {
+		prom.Unlock()
+		return
+	}
+	prom.expired = now
+	prom.Unlock()
+
+	if err := storage.promCountersExpire(now.Add(-promCounterTTL)); err != nil {
+		log.Printf("prometheus write: error expiring counters: %s", err.Error())
+	}
+}
+
+func promCountUnmatched(name string) {
+	prom.Lock()
+	u := prom.unmatched[name]
+	u.count++
+	u.last = time.Now().UTC()
+	prom.unmatched[name] = u
+	prom.Unlock()
+}
+
+// prometheusUnmatchedProto returns the count of series that did not match a mapping rule by metric name
+// since the server started.
+func prometheusUnmatchedProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var pr mtrpb.PrometheusUnmatchedResult
+
+	prom.Lock()
+	for k, v := range prom.unmatched {
+		pr.Result = append(pr.Result, &mtrpb.PrometheusUnmatched{Name: k, Count: v.count, Seconds: v.last.Unix()})
+	}
+	prom.Unlock()
+
+	sort.Sort(byName(pr.Result))
+
+	var by []byte
+	var err error
+
+	if by, err = proto.Marshal(&pr); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
+
+type byName []*mtrpb.PrometheusUnmatched
+
+func (a byName) Len() int           { return len(a) }
+func (a byName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byName) Less(i, j int) bool { return a[i].Name < a[j].Name }
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/mtr/prompb"
+	wt "github.com/GeoNet/weft/wefttest"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPrometheusWrite(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	if err := setPromConfig([]byte(`{"rules": [
+		{"match": {"__name__": "field_voltage"}, "table": "field.metric", "typeID": "voltage", "scale": 1000},
+		{"match": {"__name__": "http_requests_total", "code": "200"}, "table": "app.counter", "typeID": "200"}
+	]}`)); err != nil {
+		t.Fatal(err)
+	}
+	defer setPromConfig([]byte(`{}`))
+
+	if err := setPromConfig([]byte(`{"rules": [{"match": {"a": "b"}, "table": "not.a.table"}]}`)); err == nil {
+		t.Error("expected error for invalid table.")
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	ms := func(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) }
+
+	w := prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{
+			{
+				Labels: []*prompb.Label{
+					{Name: "__name__", Value: "field_voltage"},
+					{Name: "device", Value: "gps-taupoairport"},
+				},
+				Samples: []*prompb.Sample{{Value: 13.5, Timestamp: ms(now.Add(time.Minute * -1))}},
+			},
+			{
+				Labels: []*prompb.Label{
+					{Name: "__name__", Value: "http_requests_total"},
+					{Name: "code", Value: "200"},
+					{Name: "job", Value: "test-app"},
+					{Name: "instance", Value: "test-instance"},
+				},
+				Samples: []*prompb.Sample{
+					{Value: 100, Timestamp: ms(now.Add(time.Minute * -2))},
+					{Value: 150, Timestamp: ms(now.Add(time.Minute * -1))},
+				},
+			},
+			{
+				Labels:  []*prompb.Label{{Name: "__name__", Value: "go_goroutines"}},
+				Samples: []*prompb.Sample{{Value: 10, Timestamp: ms(now)}},
+			},
+		},
+	}
+
+	by, err := proto.Marshal(&w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", testServer.URL+"/prometheus/write", bytes.NewReader(snappy.Encode(nil, by)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth(userW, keyW)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+
+	res, err := wt.Client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 got %d", res.StatusCode)
+	}
+
+	var v float64
+
+	if err = db.QueryRow(`SELECT value FROM field.metric_summary
+				JOIN field.device USING (devicepk)
+				JOIN field.type USING (typepk)
+				WHERE deviceID = 'gps-taupoairport' AND typeID = 'voltage'`).Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v != 13500 {
+		t.Errorf("expected 13500 got %g", v)
+	}
+
+	// the counter is saved as the increase between samples.
+	var c int
+
+	if err = db.QueryRow(`SELECT sum(count) FROM app.counter
+				JOIN app.application USING (applicationpk)
+				WHERE applicationID = 'test-app' AND typePK = 200 AND time >= $1`, now.Add(time.Minute*-2)).Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c != 50 {
+		t.Errorf("expected count 50 got %d", c)
+	}
+
+	r := wt.Request{ID: wt.L(), URL: "/prometheus/unmatched", Accept: "application/x-protobuf"}
+
+	var b []byte
+
+	if b, err = r.Do(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	var u mtrpb.PrometheusUnmatchedResult
+
+	if err = proto.Unmarshal(b, &u); err != nil {
+		t.Error(err)
+	}
+
+	var found bool
+	for _, p := range u.Result {
+		if p.Name == "go_goroutines" && p.Count > 0 {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Error("expected go_goroutines to be unmatched")
+	}
+
+	// Not snappy
+	req, err = http.NewRequest("POST", testServer.URL+"/prometheus/write", bytes.NewReader(by))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth(userW, keyW)
+
+	if res, err = wt.Client.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 got %d", res.StatusCode)
+	}
+}
+
+func TestPromExpireCounters(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	now := time.Now().UTC()
+
+	if _, err := db.Exec(`INSERT INTO app.prometheus_counter(series, value, seen) VALUES
+				('test-expire-a', 1, $1), ('test-expire-b', 2, $2)
+				ON CONFLICT (series) DO UPDATE SET seen = EXCLUDED.seen`,
+		now.Add(time.Minute*-10), now.Add(-promCounterTTL-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	prom.Lock()
+	prom.expired = time.Time{}
+	prom.Unlock()
+
+	promExpireCounters(now)
+
+	for k, expected := range map[string]bool{"test-expire-a": true, "test-expire-b": false} {
+		var found bool
+
+		if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM app.prometheus_counter WHERE series = $1)`, k).Scan(&found); err != nil {
+			t.Fatal(err)
+		}
+
+		if found != expected {
+			t.Errorf("%s expected kept %t got %t", k, expected, found)
+		}
+	}
+}
+
+// TestPromCounterConcurrent checks concurrent samples for a counter only count the increase once.
+func TestPromCounterConcurrent(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	r := promRule{Table: "app.counter", ApplicationLabel: "job", InstanceLabel: "instance", appTypePK: 200}
+	l := map[string]string{"__name__": "test_requests_total", "job": "test-prom-concurrent", "instance": "test-instance"}
+
+	if _, err := db.Exec(`DELETE FROM app.prometheus_counter WHERE series = $1`, seriesKey(l)); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	ms := func(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) }
+
+	// the starting value.
+	if res := r.save(l, &prompb.Sample{Value: 100, Timestamp: ms(now.Add(time.Minute * -10))}); !res.Ok {
+		t.Fatal(res.Msg)
+	}
+
+	// the same sample is sent at different times so the increase could be saved more than once.
+	const n = 5
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			if res := r.save(l, &prompb.Sample{Value: 150, Timestamp: ms(now.Add(time.Minute * time.Duration(-i)))}); !res.Ok {
+				t.Error(res.Msg)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	var c int
+
+	if err := db.QueryRow(`SELECT sum(count) FROM app.counter
+				JOIN app.application USING (applicationpk)
+				WHERE applicationID = 'test-prom-concurrent' AND typePK = 200`).Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c != 50 {
+		t.Errorf("expected count 50 got %d", c)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"github.com/GeoNet/mtr/internal"
+	"github.com/GeoNet/mtr/mtrapp"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/weft"
+	"github.com/golang/protobuf/proto"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retentionChunk is the most rows deleted by one statement so that
+// deleting old values doesn't hold locks on the tables for long.
+const retentionChunk = 10000
+
+// retentionTable is a table with raw values that are deleted when they are older
+// than the retention for their schema and type (in mtr.retention).
+type retentionTable struct {
+	table       string
+	schema      string
+	typeTable   string // the table has typePK from typeTable.  Empty if the table doesn't have types.
+	partitioned bool   // see partitionTables.
+}
+
+var retentionTables = []retentionTable{
+	{table: "field.metric", schema: "field", typeTable: "field.type", partitioned: true},
+	{table: "field.metric_summary", schema: "field", typeTable: "field.type"},
+	{table: "data.latency", schema: "data", typeTable: "data.type", partitioned: true},
+	{table: "data.latency_summary", schema: "data", typeTable: "data.type"},
+	{table: "data.completeness", schema: "data", typeTable: "data.completeness_type", partitioned: true},
+	{table: "app.metric", schema: "app", typeTable: "app.type", partitioned: true},
+	{table: "app.counter", schema: "app", typeTable: "app.type", partitioned: true},
+	{table: "app.timer", schema: "app", partitioned: true},
+}
+
+// retentionTypeTables are the tables for the typeIDs in each schema.
+var retentionTypeTables = map[string][]string{
+	"field": {"field.type"},
+	"data":  {"data.type", "data.completeness_type"},
+	"app":   {"app.type"},
+}
+
+func retentionPut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	schema := v.Get("schema")
+	typeID := v.Get("typeID")
+
+	if res := retentionSchema(schema); !res.Ok {
+		return res
+	}
+
+	days, err := strconv.Atoi(v.Get("days"))
+	if err != nil || days <= 0 {
+		return weft.BadRequest("invalid days")
+	}
+
+	switch err = storage.retentionSave(schema, typeID, days); err {
+	case nil:
+		return &weft.StatusOK
+	case errNotFound:
+		return weft.BadRequest("unknown typeID for schema " + schema)
+	default:
+		return weft.InternalServerError(err)
+	}
+}
+
+// retentionDelete deletes the retention for a type.  The type then uses the default
+// for the schema, which can't be deleted.
+func retentionDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	schema := v.Get("schema")
+	typeID := v.Get("typeID")
+
+	if res := retentionSchema(schema); !res.Ok {
+		return res
+	}
+
+	if typeID == "" {
+		return weft.BadRequest("the default retention for a schema can't be deleted")
+	}
+
+	if err := storage.retentionDelete(schema, typeID); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	return &weft.StatusOK
+}
+
+func retentionProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	var err error
+	var rr mtrpb.RetentionResult
+
+	if rr.Result, err = storage.retentions(); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	var by []byte
+	if by, err = proto.Marshal(&rr); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
+
+func retentionSchema(schema string) *weft.Result {
+	if _, ok := retentionTypeTables[schema]; !ok {
+		return weft.BadRequest("invalid schema")
+	}
+
+	return &weft.StatusOK
+}
+
+/*
+typeRetention returns how long raw values are kept for typePK from typeTable in schema.  This is the
+retention for the type if there is one, otherwise the default for the schema.  typeTable is needed because
+a schema can have more than one type table e.g., data.type and data.completeness_type.
+*/
+func typeRetention(schema, typeTable string, typePK int) (time.Duration, error) {
+	var days int
+
+	if err := dbR.QueryRow(`SELECT days FROM mtr.retention
+				WHERE schema = $1
+				AND typeID IN ('', (SELECT typeID FROM `+typeTable+` WHERE typePK = $2))
+				ORDER BY typeID DESC LIMIT 1`, schema, typePK).Scan(&days); err != nil {
+		return 0, err
+	}
+
+	return time.Hour * 24 * time.Duration(days), nil
+}
+
+// shortestRetention returns the shortest time raw values are kept for any type in schema.
+func shortestRetention(schema string) (time.Duration, error) {
+	var days int
+
+	if err := dbR.QueryRow(`SELECT min(days) FROM mtr.retention WHERE schema = $1`, schema).Scan(&days); err != nil {
+		return 0, err
+	}
+
+	return time.Hour * 24 * time.Duration(days), nil
+}
+
+// deletedApplicationID is the app.application the rows deleted from each table are counted for.
+const deletedApplicationID = "mtr-retention"
+
+// deleteMetrics deletes old metrics (see store.deleteOld) once a minute.
+func deleteMetrics() {
+	ticker := time.NewTicker(time.Minute).C
+	for {
+		select {
+		case <-ticker:
+			if err := storage.deleteOld(time.Now().UTC()); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+/*
+countDeleted counts n rows deleted from table.  The total is counted with mtrapp.Deleted and the count for the
+table is saved to app.counter for deletedApplicationID with the table as the instance so that it's clear which
+tables are being trimmed.  Partitions dropped by managePartitions are counted as "partitions" and restored values
+that expired as "restored".
+*/
+func countDeleted(table string, n int64) {
+	if n <= 0 {
+		return
+	}
+
+	mtrapp.Deleted.Add(uint64(n))
+
+	if res := applicationCounterSave(deletedApplicationID, table, int(internal.Deleted), time.Now().UTC(), int(n)); !res.Ok {
+		log.Printf("error counting rows deleted from %s: %s", table, res.Msg)
+	}
+}
+
+/*
+deleteOld deletes values from r.table that are older than the retention for their type.
+For partitioned tables only partitions for days that are completely older than the retention
+are deleted from so retention is rounded up to whole days.  Partitions are archived before the
+first values are deleted from them.
+*/
+func (r retentionTable) deleteOld() (int64, error) {
+	rows, err := db.Query(`SELECT typeID, days FROM mtr.retention WHERE schema = $1`, r.schema)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	days := make(map[string]int)
+
+	for rows.Next() {
+		var typeID string
+		var d int
+
+		if err = rows.Scan(&typeID, &d); err != nil {
+			return 0, err
+		}
+
+		days[typeID] = d
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// don't delete anything if the default has been removed from the DB.
+	if _, ok := days[""]; !ok {
+		return 0, nil
+	}
+
+	targets := []partition{{name: r.table}}
+
+	if r.partitioned {
+		if targets, err = partitions(r.table); err != nil {
+			return 0, err
+		}
+	}
+
+	now := time.Now().UTC()
+	var deleted int64
+
+	for typeID, d := range days {
+		cutoff := now.Add(time.Hour * -24 * time.Duration(d))
+
+		var where string
+		var args []interface{}
+
+		switch {
+		case r.typeTable == "" && typeID == "":
+			where = `time < $1`
+		case r.typeTable == "":
+			continue
+		case typeID == "":
+			// types that don't have their own retention.
+			where = `time < $1 AND typePK NOT IN (SELECT typePK FROM ` + r.typeTable + `
+					JOIN mtr.retention USING (typeID) WHERE schema = $3)`
+			args = append(args, r.schema)
+		default:
+			where = `time < $1 AND typePK = (SELECT typePK FROM ` + r.typeTable + ` WHERE typeID = $3)`
+			args = append(args, typeID)
+		}
+
+		for _, p := range targets {
+			if r.partitioned && p.day.Add(time.Hour*24).After(cutoff) {
+				continue
+			}
+
+			if r.partitioned {
+				if err = archivePartition(r.table, p); err != nil {
+					return deleted, err
+				}
+			}
+
+			n, err := deleteChunks(p.name, where, cutoff, args...)
+			deleted += n
+			if err != nil {
+				return deleted, err
+			}
+		}
+	}
+
+	return deleted, nil
+}
+
+/*
+deleteChunks deletes rows from table that match where until it deletes fewer than retentionChunk rows.
+where must use $1 for the time and may use $3 for arg.
+*/
+func deleteChunks(table, where string, t time.Time, arg ...interface{}) (int64, error) {
+	args := append([]interface{}{t, retentionChunk}, arg...)
+
+	var deleted int64
+
+	for {
+		result, err := db.Exec(`DELETE FROM `+table+` WHERE ctid = ANY(ARRAY(
+			SELECT ctid FROM `+table+` WHERE `+where+` LIMIT $2))`, args...)
+		if err != nil {
+			return deleted, err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted += n
+
+		if n < retentionChunk {
+			return deleted, nil
+		}
+	}
+}
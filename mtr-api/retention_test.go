@@ -0,0 +1,140 @@
+package main
+
+import (
+	"github.com/GeoNet/mtr/mtrpb"
+	wt "github.com/GeoNet/weft/wefttest"
+	"github.com/golang/protobuf/proto"
+	"testing"
+	"time"
+)
+
+func TestRetention(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	r := wt.Request{ID: wt.L(), URL: "/retention", Accept: "application/x-protobuf"}
+
+	b, err := r.Do(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rr mtrpb.RetentionResult
+
+	if err = proto.Unmarshal(b, &rr); err != nil {
+		t.Fatal(err)
+	}
+
+	days := make(map[string]int32)
+
+	for _, v := range rr.Result {
+		days[v.Schema+"."+v.TypeID] = v.Days
+	}
+
+	for k, v := range map[string]int32{"app.": 28, "data.": 40, "data.latency.strong": 365, "field.": 40, "field.conn": 7} {
+		if days[k] != v {
+			t.Errorf("%s expected %d days got %d", k, v, days[k])
+		}
+	}
+
+	if _, ok := days["field.voltage"]; ok {
+		t.Error("expected retention for voltage to be deleted")
+	}
+
+	// voltage uses the default for field, conn has its own retention.
+	var d time.Duration
+
+	if d, err = typeRetention("field", "field.type", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if d != time.Hour*24*40 {
+		t.Errorf("expected voltage retention 40 days got %s", d)
+	}
+
+	if d, err = typeRetention("field", "field.type", 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if d != time.Hour*24*7 {
+		t.Errorf("expected conn retention 7 days got %s", d)
+	}
+
+	if d, err = shortestRetention("field"); err != nil {
+		t.Fatal(err)
+	}
+
+	if d != time.Hour*24*7 {
+		t.Errorf("expected shortest field retention 7 days got %s", d)
+	}
+
+	// completeness types are in data.completeness_type not data.type.
+	r = wt.Request{ID: wt.L(), URL: "/retention?schema=data&typeID=completeness.gnss.1hz&days=90", Method: "PUT", User: userW, Password: keyW}
+	if _, err = r.Do(testServer.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	if d, err = typeRetention("data", "data.completeness_type", 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if d != time.Hour*24*90 {
+		t.Errorf("expected completeness retention 90 days got %s", d)
+	}
+
+	r = wt.Request{ID: wt.L(), URL: "/retention?schema=data&typeID=completeness.gnss.1hz", Method: "DELETE", User: userW, Password: keyW}
+	if _, err = r.Do(testServer.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// values 10 days old are deleted for conn but not for voltage.
+	old := time.Now().UTC().Add(time.Hour * -24 * 10).Truncate(time.Minute).Format(time.RFC3339)
+
+	for _, u := range []string{
+		"/field/metric?deviceID=gps-taupoairport&typeID=voltage&value=14000&time=" + old,
+		"/field/metric?deviceID=gps-taupoairport&typeID=conn&value=1000&time=" + old,
+	} {
+		r = wt.Request{ID: wt.L(), URL: u, Method: "PUT", User: userW, Password: keyW}
+		if _, err = r.Do(testServer.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = (retentionTable{table: "field.metric", schema: "field", typeTable: "field.type", partitioned: true}).deleteOld(); err != nil {
+		t.Fatal(err)
+	}
+
+	var c int
+
+	for typeID, expected := range map[string]int{"voltage": 1, "conn": 0} {
+		if err = db.QueryRow(`SELECT count(*) FROM field.metric
+				JOIN field.device USING (devicepk)
+				JOIN field.type USING (typepk)
+				WHERE deviceID = 'gps-taupoairport' AND typeID = $1 AND time = $2`, typeID, old).Scan(&c); err != nil {
+			t.Fatal(err)
+		}
+
+		if c != expected {
+			t.Errorf("%s expected %d old values got %d", typeID, expected, c)
+		}
+	}
+
+	// deleted rows are counted with the table as the instance.
+	countDeleted("field.metric", 5)
+
+	if err = db.QueryRow(`SELECT sum(count) FROM app.counter
+				JOIN app.application USING (applicationpk)
+				JOIN app.instance USING (instancepk)
+				WHERE applicationID = $1 AND instanceID = 'field.metric' AND typePK = 1300`, deletedApplicationID).Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c != 5 {
+		t.Errorf("expected 5 rows deleted from field.metric got %d", c)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// rollupSlack allows for default time ranges that are the same as a retention period
+// e.g., resolution full over 40 days.
+const rollupSlack = time.Hour
+
+/*
+rollup is a level of pre-aggregated values.  There is a rollup table for each of
+rollupTables and level e.g., field.metric_hour.  They are updated by triggers
+on the tables in the DB so all the ways of saving values are included.
+*/
+type rollup struct {
+	resolution string        // same as the resolution query parameter.
+	retention  time.Duration // how long the rollup is kept for.
+}
+
+// rollups from finest to coarsest.
+var rollups = []rollup{
+	{resolution: "five_minutes", retention: time.Hour * 24 * 90},
+	{resolution: "hour", retention: time.Hour * 24 * 365 * 2},
+	{resolution: "day", retention: time.Hour * 24 * 365 * 10},
+}
+
+// rollupTables are the tables that have rollups.
+var rollupTables = []string{"field.metric", "data.latency", "data.completeness", "app.metric"}
+
+/*
+rollupResolution returns the resolution to query for resolution over a time range starting at t0.
+"minute" and "full" are read from the raw table which is kept for raw (see typeRetention).  It is the requested resolution or the
+finest coarser resolution that is still kept at t0 e.g., resolution minute starting 6 months ago is read
+from the hour rollup.  If no resolution is kept at t0 the coarsest rollup is used.
+*/
+func rollupResolution(resolution string, t0 time.Time, raw time.Duration) (string, error) {
+	levels := []rollup{{resolution: "full", retention: raw}, {resolution: "minute", retention: raw}}
+	levels = append(levels, rollups...)
+
+	i := -1
+	for j := range levels {
+		if levels[j].resolution == resolution {
+			i = j
+			break
+		}
+	}
+
+	if i == -1 {
+		return "", fmt.Errorf("invalid resolution: %s", resolution)
+	}
+
+	now := time.Now().UTC()
+
+	for _, l := range levels[i:] {
+		if !t0.Before(now.Add(-l.retention - rollupSlack)) {
+			return l.resolution, nil
+		}
+	}
+
+	return levels[len(levels)-1].resolution, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/GeoNet/mtr/mtrpb"
+	wt "github.com/GeoNet/weft/wefttest"
+	"github.com/golang/protobuf/proto"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRollupResolution(t *testing.T) {
+	now := time.Now().UTC()
+
+	in := []struct {
+		id         string
+		resolution string
+		t0         time.Time
+		expected   string
+	}{
+		{id: wt.L(), resolution: "minute", t0: now.Add(time.Hour * -12), expected: "minute"},
+		{id: wt.L(), resolution: "full", t0: now.Add(time.Hour * -24 * 40), expected: "full"},
+		{id: wt.L(), resolution: "five_minutes", t0: now.Add(time.Hour * -24 * 2), expected: "five_minutes"},
+		{id: wt.L(), resolution: "minute", t0: now.Add(time.Hour * -24 * 60), expected: "five_minutes"},
+		{id: wt.L(), resolution: "minute", t0: now.Add(time.Hour * -24 * 180), expected: "hour"},
+		{id: wt.L(), resolution: "five_minutes", t0: now.Add(time.Hour * -24 * 365 * 5), expected: "day"},
+		{id: wt.L(), resolution: "hour", t0: now.Add(time.Hour * -24 * 365 * 20), expected: "day"},
+	}
+
+	for _, v := range in {
+		r, err := rollupResolution(v.resolution, v.t0, time.Hour*24*40)
+		if err != nil {
+			t.Errorf("%s: %s", v.id, err)
+			continue
+		}
+
+		if r != v.expected {
+			t.Errorf("%s: expected %s got %s", v.id, v.expected, r)
+		}
+	}
+
+	if _, err := rollupResolution("week", now, time.Hour*24*40); err == nil {
+		t.Error("expected error for invalid resolution")
+	}
+}
+
+func TestFieldMetricRollup(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	// Load test data.
+	if err := routes.DoAllStatusOk(testServer.URL); err != nil {
+		t.Error(err)
+	}
+
+	hour := time.Now().UTC().Truncate(time.Hour).Add(time.Hour * -2)
+
+	r := wt.Request{ID: wt.L(), Method: "PUT"}
+
+	for i, v := range []int{12000, 13000, 14000} {
+		r.URL = "/field/metric?deviceID=gps-taupoairport&typeID=voltage&time=" +
+			hour.Add(time.Minute*time.Duration(i*10)).Format(time.RFC3339) + "&value=" + strconv.Itoa(v)
+
+		if _, err := r.Do(testServer.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var count, min, max int
+	var sum int64
+
+	if err := db.QueryRow(`SELECT count, sum, min, max FROM field.metric_hour
+				JOIN field.device USING (devicepk)
+				JOIN field.type USING (typepk)
+				WHERE deviceID = 'gps-taupoairport' AND typeID = 'voltage' AND time = $1`, hour).Scan(&count, &sum, &min, &max); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 3 || sum != 39000 || min != 12000 || max != 14000 {
+		t.Errorf("unexpected hour rollup count %d sum %d min %d max %d", count, sum, min, max)
+	}
+
+	// values in the same five minutes are in one row.
+	if err := db.QueryRow(`SELECT count(*) FROM field.metric_five_minutes
+				JOIN field.device USING (devicepk)
+				JOIN field.type USING (typepk)
+				WHERE deviceID = 'gps-taupoairport' AND typeID = 'voltage'
+				AND time >= $1 AND time < $2`, hour, hour.Add(time.Hour)).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 3 {
+		t.Errorf("expected 3 five minute rollups got %d", count)
+	}
+
+	r = wt.Request{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=hour", Accept: "application/x-protobuf"}
+
+	b, err := r.Do(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var f mtrpb.FieldMetricResult
+
+	if err = proto.Unmarshal(b, &f); err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+
+	for _, v := range f.Result {
+		if v.Seconds == hour.Unix() {
+			found = true
+			if v.Value != 13000 {
+				t.Errorf("expected hour mean 13000 got %f", v.Value)
+			}
+		}
+	}
+
+	if !found {
+		t.Errorf("no value for hour %s", hour)
+	}
+}
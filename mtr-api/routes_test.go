@@ -6,6 +6,7 @@ import (
 	wt "github.com/GeoNet/weft/wefttest"
 	"github.com/golang/protobuf/proto"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
@@ -18,6 +19,11 @@ func init() {
 			if routes[i].Surrogate == "" {
 				routes[i].Surrogate = "max-age=10"
 			}
+
+			if private[strings.Split(routes[i].URL, "?")[0]] {
+				routes[i].User = userW
+				routes[i].Password = keyW
+			}
 		default:
 			// Any non GET requests need authentication
 			routes[i].User = userW
@@ -49,6 +55,10 @@ var routes = wt.Requests{
 
 	// a list of all application IDs
 	{ID: wt.L(), URL: "/app", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/app/type", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/app/type?typeID=TestQueue&description=queue%20length&unit=n", Method: "PUT"},
+	{ID: wt.L(), URL: "/app/type?typeID=TestQueue", Method: "DELETE"},
+	{ID: wt.L(), URL: "/app/type?typeID=1234&description=queue%20length&unit=n", Method: "PUT", Status: http.StatusBadRequest},
 
 	// SVG plots
 	{ID: wt.L(), URL: "/app/metric?applicationID=test-app&group=timers"},
@@ -81,6 +91,11 @@ var routes = wt.Requests{
 	// Should get a rate limit error for sends in the same minute
 	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&time=2015-05-14T21:40:30Z&value=15100", Method: "PUT", Status: http.StatusTooManyRequests},
 
+	// disk.hd1 has a min_interval of 10 minutes.
+	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=disk.hd1&time=2015-05-14T21:40:30Z&value=50", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=disk.hd1&time=2015-05-14T21:45:30Z&value=51", Method: "PUT", Status: http.StatusTooManyRequests},
+	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=disk.hd1", Method: "DELETE"},
+
 	// Field states
 
 	// update the field state to true (bool: on->true, off->false)
@@ -94,6 +109,14 @@ var routes = wt.Requests{
 	{ID: wt.L(), URL: "/field/state?deviceID=gps-taupoairport&typeID=mains", Method: "DELETE"},
 	{ID: wt.L(), URL: "/field/state?deviceID=gps-taupoairport&typeID=mains&time=2015-05-14T21:40:30Z&value=true", Method: "PUT"},
 
+	// changes of state and a timeline plot (see TestFieldStateHistory).
+	{ID: wt.L(), URL: "/field/state/history?deviceID=gps-taupoairport&typeID=mains&startDate=2015-05-14T00:00:00Z&endDate=2015-05-15T00:00:00Z", Content: "image/svg+xml"},
+	{ID: wt.L(), URL: "/field/state/history?deviceID=gps-taupoairport&typeID=mains", Content: "image/svg+xml"},
+	{ID: wt.L(), URL: "/field/state/history?deviceID=gps-taupoairport&typeID=mains&startDate=2015-05-14T00:00:00Z&endDate=2015-05-15T00:00:00Z", Accept: "text/csv"},
+	{ID: wt.L(), URL: "/field/state/history?deviceID=gps-taupoairport&typeID=mains&startDate=2015-05-14T00:00:00Z&endDate=2015-05-15T00:00:00Z", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/field/state/history?deviceID=NOT_THERE&typeID=mains", Status: http.StatusNotFound},
+	{ID: wt.L(), URL: "/field/state/history?deviceID=gps-taupoairport&typeID=mains&startDate=2015-05-15T00:00:00Z&endDate=2015-05-14T00:00:00Z", Status: http.StatusBadRequest},
+
 	// Tags
 	{ID: wt.L(), URL: "/tag/LINZ", Method: "DELETE"},
 
@@ -144,10 +167,30 @@ var routes = wt.Requests{
 	// Update a threshold on a metric
 	{ID: wt.L(), URL: "/field/metric/threshold?deviceID=gps-taupoairport&typeID=voltage&lower=13000&upper=15000", Method: "PUT"},
 
+	// A threshold with a for duration (seconds) and a recovery band.
+	{ID: wt.L(), URL: "/field/metric/threshold?deviceID=gps-taupoairport&typeID=voltage&lower=12000&upper=15000&for=600&hysteresis=500", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/metric/threshold?deviceID=gps-taupoairport&typeID=voltage&lower=12000&upper=15000&for=-600", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/field/metric/threshold?deviceID=gps-taupoairport&typeID=voltage&lower=12000&upper=15000&hysteresis=2000", Method: "PUT", Status: http.StatusBadRequest},
+
 	// Delete a threshold on a metric then create it again
 	{ID: wt.L(), URL: "/field/metric/threshold?deviceID=gps-taupoairport&typeID=voltage", Method: "DELETE"},
 	{ID: wt.L(), URL: "/field/metric/threshold?deviceID=gps-taupoairport&typeID=voltage&lower=12000&upper=45000", Method: "PUT"},
 
+	// Set, update, and delete the late window for a metric.
+	{ID: wt.L(), URL: "/field/metric/late?deviceID=gps-taupoairport&typeID=voltage&late=3600", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/metric/late?deviceID=gps-taupoairport&typeID=voltage&late=7200", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/metric/late?deviceID=gps-taupoairport&typeID=voltage&late=0", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/field/metric/late?deviceID=gps-taupoairport&typeID=voltage", Method: "DELETE"},
+	{ID: wt.L(), URL: "/field/metric/late?deviceID=gps-taupoairport&typeID=voltage&late=7200", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/metric/late", Accept: "application/x-protobuf"},
+
+	// Set, update, and delete rate of change and baseline thresholds for a metric.
+	{ID: wt.L(), URL: "/field/metric/anomaly?deviceID=gps-taupoairport&typeID=voltage&rate=500", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/metric/anomaly?deviceID=gps-taupoairport&typeID=voltage&rate=500&deviations=3&baselineDays=14", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/metric/anomaly?deviceID=gps-taupoairport&typeID=voltage", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/field/metric/anomaly", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/field/metric/anomaly?deviceID=gps-taupoairport&typeID=voltage", Method: "DELETE"},
+
 	// GET requests
 	// Non specific Accept headers return svg.
 	// Model
@@ -157,6 +200,7 @@ var routes = wt.Requests{
 	// Device
 	// protobuf version
 	{ID: wt.L(), URL: "/field/device", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/field/device/pending", Accept: "application/x-protobuf"},
 
 	// Metrics.  Resolution is optional on plots.  Resolution is fixed for sparks.
 	// Options for the plot parameter:
@@ -168,13 +212,15 @@ var routes = wt.Requests{
 	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=hour", Content: "image/svg+xml"},
 	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=minute", Content: "image/svg+xml"},
 	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=hour", Content: "image/svg+xml"},
-	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=day", Status: http.StatusBadRequest, Surrogate: "max-age=86400"},
+	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=day", Content: "image/svg+xml"},
+	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=week", Status: http.StatusBadRequest, Surrogate: "max-age=86400"},
 	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&plot=spark", Content: "image/svg+xml"},
 	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=minute&plot=scatter", Content: "image/svg+xml"},
 	// field metric history data
 	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=minute", Accept: "application/x-protobuf"},
 	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=five_minutes", Accept: "application/x-protobuf"},
 	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=hour", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=day", Accept: "application/x-protobuf"},
 
 	// Latest metrics as SVG map
 	//  These only pass with the map180 data in the DB.
@@ -201,9 +247,48 @@ var routes = wt.Requests{
 	// All field metric thresholds as protobuf
 	{ID: wt.L(), URL: "/field/metric/threshold", Accept: "application/x-protobuf"},
 
+	// Default thresholds for a model.  Devices without their own threshold use them.
+	{ID: wt.L(), URL: "/field/model/threshold?modelID=Trimble+NetR9&typeID=voltage&lower=12000&upper=15000.5", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/model/threshold?modelID=Trimble+NetR9&typeID=voltage&lower=12000&upper=16000", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/model/threshold?modelID=Trimble+NetR9&typeID=voltage&lower=low&upper=15000", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/field/model/threshold", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/field/model/threshold?modelID=Trimble+NetR9&typeID=voltage", Method: "DELETE"},
+
 	// Metric types
 	{ID: wt.L(), URL: "/field/type", Accept: "application/x-protobuf"},
 
+	// Add, update, and delete a metric type.  The server assigns the typePK.
+	{ID: wt.L(), URL: "/field/type?typeID=test.current&description=current&unit=mA&scale=0.001&display=A", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/type?typeID=test.current&description=current%20draw&unit=mA&scale=0.001&display=A&minInterval=300", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/type?typeID=test.current&description=current%20draw&unit=mA&scale=0.001&display=A&late=120", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/type?typeID=test.current&description=current%20draw&unit=mA&scale=0.001&display=A&late=-1", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/field/type?typeID=test.current", Method: "DELETE"},
+	{ID: wt.L(), URL: "/field/type?typeID=test.current&description=current&unit=mA&scale=0&display=A", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/field/type?typeID=test.current&description=current&unit=m%20A&scale=0.001&display=A", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/field/type?typeID=test.current&description=current&unit=mA&scale=0.001&display=A&minInterval=7", Method: "PUT", Status: http.StatusBadRequest},
+	// voltage has metrics so changing its unit or deleting it needs force.
+	{ID: wt.L(), URL: "/field/type?typeID=voltage&description=voltage&unit=V&scale=1&display=V", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/field/type?typeID=voltage&description=voltage&unit=mV&scale=0.001&display=V", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/type?typeID=voltage", Method: "DELETE", Status: http.StatusBadRequest},
+
+	{ID: wt.L(), URL: "/field/state/type?typeID=test.door", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/state/type", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/field/state/type?typeID=test.door", Method: "DELETE"},
+
+	// enumerated states (see TestFieldStateValue).
+	{ID: wt.L(), URL: "/field/state/type?typeID=test.generator", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/state/value?typeID=test.generator&value=running&severity=0", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/state/value?typeID=test.generator&value=standby&severity=1", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/state/value?typeID=test.generator&value=fault&severity=3", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/field/state/value?typeID=NOT_THERE&value=fault&severity=2", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/field/state/value", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/field/state?deviceID=gps-taupoairport&typeID=test.generator&time=2015-05-14T21:40:30Z&value=running", Method: "PUT"},
+	{ID: wt.L(), URL: "/field/state?deviceID=gps-taupoairport&typeID=test.generator&time=2015-05-14T21:40:30Z&value=true", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/field/state/value?typeID=test.generator&value=running", Method: "DELETE", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/field/state/value?typeID=test.generator&value=standby", Method: "DELETE"},
+	{ID: wt.L(), URL: "/field/state/type?typeID=test.generator&force=true", Method: "DELETE"},
+	{ID: wt.L(), URL: "/field/state?deviceID=gps-taupoairport&typeID=mains&time=2015-05-14T21:40:30Z&value=running", Method: "PUT", Status: http.StatusBadRequest},
+
 	// Data latency
 
 	// Delete site - cascades to latency values
@@ -230,13 +315,29 @@ var routes = wt.Requests{
 
 	// All data sites as protobuf
 	{ID: wt.L(), URL: "/data/site", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/data/site/pending", Accept: "application/x-protobuf"},
+
+	// Prometheus remote write series that don't match a mapping rule.
+	{ID: wt.L(), URL: "/prometheus/unmatched", Accept: "application/x-protobuf"},
 	{ID: wt.L(), URL: "/data/type", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/data/type?typeID=test.latency&description=test%20latency&unit=ms&scale=1.0&display=ms", Method: "PUT"},
+	{ID: wt.L(), URL: "/data/type?typeID=test.latency&description=test%20latency&unit=ms&scale=1.0&display=ms&late=600", Method: "PUT"},
+	{ID: wt.L(), URL: "/data/type?typeID=test.latency", Method: "DELETE"},
+	{ID: wt.L(), URL: "/data/completeness/type?typeID=test.completeness&expected=8640&minInterval=600", Method: "PUT"},
+	{ID: wt.L(), URL: "/data/completeness/type?typeID=test.completeness&expected=0", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/data/completeness/type?typeID=test.completeness", Method: "DELETE"},
 
 	// min, max, fifty, ninety are optional latency values
 	{ID: wt.L(), URL: "/data/latency?siteID=WGTN&typeID=latency.strong&time=2015-05-14T23:40:30Z&mean=10000&min=10&max=100000&fifty=9000&ninety=12000", Method: "PUT"},
 
 	{ID: wt.L(), URL: "/data/latency?siteID=WGTN&typeID=latency.strong", Method: "DELETE"},
 
+	// latency.gnss.1hz has a min_interval of 10s.  Should get a rate limit error for sends in the same 10s.
+	{ID: wt.L(), URL: "/data/latency?siteID=WGTN&typeID=latency.gnss.1hz&time=2015-05-14T23:40:30Z&mean=10000", Method: "PUT"},
+	{ID: wt.L(), URL: "/data/latency?siteID=WGTN&typeID=latency.gnss.1hz&time=2015-05-14T23:40:40Z&mean=10000", Method: "PUT"},
+	{ID: wt.L(), URL: "/data/latency?siteID=WGTN&typeID=latency.gnss.1hz&time=2015-05-14T23:40:49Z&mean=10000", Status: http.StatusTooManyRequests, Method: "PUT"},
+	{ID: wt.L(), URL: "/data/latency?siteID=WGTN&typeID=latency.gnss.1hz", Method: "DELETE"},
+
 	// Create a threshold for latency.
 	// I assume a single threshold would be for mean, fifty, and ninety?
 	{ID: wt.L(), URL: "/data/latency/threshold?siteID=TAUP&typeID=latency.strong", Method: "DELETE"},
@@ -244,6 +345,8 @@ var routes = wt.Requests{
 
 	// Update a threshold
 	{ID: wt.L(), URL: "/data/latency/threshold?siteID=TAUP&typeID=latency.strong&lower=13000&upper=15000", Method: "PUT"},
+	{ID: wt.L(), URL: "/data/latency/threshold?siteID=TAUP&typeID=latency.strong&lower=13000&upper=15000&for=300&hysteresis=100", Method: "PUT"},
+	{ID: wt.L(), URL: "/data/latency/threshold?siteID=TAUP&typeID=latency.strong&lower=13000&upper=15000&hysteresis=-1", Method: "PUT", Status: http.StatusBadRequest},
 
 	// Delete a threshold then create it again
 	{ID: wt.L(), URL: "/data/latency/threshold?siteID=TAUP&typeID=latency.strong", Method: "DELETE"},
@@ -253,6 +356,16 @@ var routes = wt.Requests{
 	{ID: wt.L(), URL: "/data/latency/threshold", Accept: "application/x-protobuf"},
 	{ID: wt.L(), URL: "/data/latency/threshold?typeID=latency.strong&siteID=TAUP", Accept: "application/x-protobuf"},
 	{ID: wt.L(), URL: "/data/latency/threshold?typeID=latency.strong&typeID=latency.strong", Accept: "application/x-protobuf"},
+
+	// Set and delete the late window for a latency.
+	{ID: wt.L(), URL: "/data/latency/late?siteID=TAUP&typeID=latency.strong&late=600", Method: "PUT"},
+	{ID: wt.L(), URL: "/data/latency/late?siteID=TAUP&typeID=latency.strong&late=x", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/data/latency/late", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/data/latency/late?siteID=TAUP&typeID=latency.strong", Method: "DELETE"},
+	{ID: wt.L(), URL: "/data/latency/anomaly?siteID=TAUP&typeID=latency.strong&deviations=3", Method: "PUT"},
+	{ID: wt.L(), URL: "/data/latency/anomaly?siteID=TAUP&typeID=latency.strong&deviations=3&baselineDays=1", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/data/latency/anomaly", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/data/latency/anomaly?siteID=TAUP&typeID=latency.strong", Method: "DELETE"},
 	{ID: wt.L(), URL: "/data/latency/threshold?typeID=latency.strong&siteID=TAUP&typeID=latency.strong", Accept: "application/x-protobuf"},
 
 	// Delete data.completeness
@@ -295,6 +408,7 @@ var routes = wt.Requests{
 	{ID: wt.L(), URL: "/data/latency?siteID=TAUP&typeID=latency.strong&resolution=hour"},
 	{ID: wt.L(), URL: "/data/latency?siteID=TAUP&typeID=latency.strong&resolution=minute"},
 	{ID: wt.L(), URL: "/data/latency?siteID=TAUP&typeID=latency.strong&resolution=hour"},
+	{ID: wt.L(), URL: "/data/latency?siteID=TAUP&typeID=latency.strong&resolution=day"},
 	{ID: wt.L(), URL: "/data/latency?siteID=TAUP&typeID=latency.strong&plot=spark"},
 	{ID: wt.L(), URL: "/data/latency?siteID=TAUP&typeID=latency.strong&resolution=minute&plot=scatter"},
 
@@ -302,11 +416,13 @@ var routes = wt.Requests{
 	{ID: wt.L(), URL: "/data/latency?siteID=TAUP&typeID=latency.strong&resolution=minute", Accept: "application/x-protobuf"},
 	{ID: wt.L(), URL: "/data/latency?siteID=TAUP&typeID=latency.strong&resolution=five_minutes", Accept: "application/x-protobuf"},
 	{ID: wt.L(), URL: "/data/latency?siteID=TAUP&typeID=latency.strong&resolution=hour", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/data/latency?siteID=TAUP&typeID=latency.strong&resolution=day", Accept: "application/x-protobuf"},
 
 	// Completeness plots.
 	{ID: wt.L(), URL: "/data/completeness?siteID=TAUP&typeID=completeness.gnss.1hz&resolution=five_minutes"},
 	{ID: wt.L(), URL: "/data/completeness?siteID=TAUP&typeID=completeness.gnss.1hz&resolution=hour"},
 	{ID: wt.L(), URL: "/data/completeness?siteID=TAUP&typeID=completeness.gnss.1hz&resolution=twelve_hours"},
+	{ID: wt.L(), URL: "/data/completeness?siteID=TAUP&typeID=completeness.gnss.1hz&resolution=day"},
 	{ID: wt.L(), URL: "/data/completeness?siteID=TAUP&typeID=completeness.gnss.1hz&plot=spark"},
 	{ID: wt.L(), URL: "/data/completeness?siteID=TAUP&typeID=completeness.gnss.1hz&resolution=five_minutes&plot=scatter"},
 
@@ -326,6 +442,42 @@ var routes = wt.Requests{
 	// Delete a tag on a metric
 	{ID: wt.L(), URL: "/field/metric/tag?deviceID=gps-taupoairport&typeID=voltage&tag=LINZ", Method: "DELETE"},
 
+	// Retention for raw metrics.  Types without their own retention use the default for the schema.
+	{ID: wt.L(), URL: "/retention?schema=field&typeID=voltage&days=7", Method: "PUT"},
+	{ID: wt.L(), URL: "/retention?schema=field&typeID=voltage&days=14", Method: "PUT"},
+	{ID: wt.L(), URL: "/retention?schema=field&typeID=voltage", Method: "DELETE"},
+	{ID: wt.L(), URL: "/retention?schema=field&typeID=conn&days=7", Method: "PUT"},
+	{ID: wt.L(), URL: "/retention?schema=data&typeID=latency.strong&days=365", Method: "PUT"},
+	{ID: wt.L(), URL: "/retention?schema=field&days=40", Method: "PUT"},
+	{ID: wt.L(), URL: "/retention?schema=field&typeID=NOT_THERE&days=7", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/retention?schema=nope&days=7", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/retention?schema=field&typeID=conn&days=0", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/retention", Accept: "application/x-protobuf"},
+
+	// Archives of raw metrics.  Archiving isn't enabled for the tests (see TestArchive).
+	{ID: wt.L(), URL: "/archive", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/archive?file=field/metric_20160102.csv.gz", Method: "PUT", Status: http.StatusBadRequest},
+
+	// Alerts for bad and late metrics (see TestAlerts).
+	{ID: wt.L(), URL: "/alert", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/alert", Accept: "application/json"},
+	{ID: wt.L(), URL: "/alert?startDate=2016-01-01T00:00:00Z", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/alert?startDate=yesterday", Accept: "application/x-protobuf", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/notification", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/notification?startDate=2016-01-01T00:00:00Z", Accept: "application/x-protobuf"},
+
+	// Silences (see TestSilences).  These have already ended so they don't change other tests.
+	{ID: wt.L(), URL: "/silence?deviceID=gps-taupoairport&startDate=2016-01-01T00:00:00Z&endDate=2016-01-02T00:00:00Z&reason=site+visit", Method: "PUT"},
+	{ID: wt.L(), URL: "/silence?siteID=TAUP&typeID=latency.strong&startDate=2016-01-01T00:00:00Z&endDate=2016-01-02T00:00:00Z&reason=upgrade", Method: "PUT"},
+	{ID: wt.L(), URL: "/silence?startDate=2016-01-01T00:00:00Z&endDate=2016-01-02T00:00:00Z&reason=site+visit", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/silence?deviceID=gps-taupoairport&siteID=TAUP&startDate=2016-01-01T00:00:00Z&endDate=2016-01-02T00:00:00Z&reason=site+visit", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/silence?deviceID=gps-taupoairport&startDate=2016-01-02T00:00:00Z&endDate=2016-01-01T00:00:00Z&reason=site+visit", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/silence?deviceID=gps-taupoairport&startDate=today&endDate=2016-01-01T00:00:00Z&reason=site+visit", Method: "PUT", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/silence?silenceID=0&deviceID=gps-taupoairport&startDate=2016-01-01T00:00:00Z&endDate=2016-01-02T00:00:00Z&reason=site+visit", Method: "PUT", Status: http.StatusNotFound},
+	{ID: wt.L(), URL: "/silence", Accept: "application/x-protobuf"},
+	{ID: wt.L(), URL: "/silence?silenceID=0", Method: "DELETE"},
+	{ID: wt.L(), URL: "/silence?silenceID=x", Method: "DELETE", Status: http.StatusBadRequest},
+
 	// soh routes
 	{ID: wt.L(), URL: "/soh"},
 	{ID: wt.L(), URL: "/soh/up"},
@@ -349,7 +501,7 @@ func TestRoutes(t *testing.T) {
 	}
 }
 
-// Any routes that are not GET should http.StatusUnauthorized without authorisation.
+// Any routes that are not GET, or are private, should http.StatusUnauthorized without authorisation.
 func TestRoutesNoAuth(t *testing.T) {
 	setup(t)
 	defer teardown()
@@ -357,6 +509,16 @@ func TestRoutesNoAuth(t *testing.T) {
 	for _, r := range routes {
 		switch r.Method {
 		case "", "GET":
+			if private[strings.Split(r.URL, "?")[0]] {
+				r.User = ""
+				r.Password = ""
+				r.Status = http.StatusUnauthorized
+				r.Surrogate = ""
+
+				if _, err := r.Do(testServer.URL); err != nil {
+					t.Error(err)
+				}
+			}
 		default:
 			r.User = ""
 			r.Password = ""
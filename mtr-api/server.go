@@ -10,7 +10,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"time"
 )
 
 // the handler wiring and majority of mux routing is generated from weft.toml
@@ -28,6 +27,9 @@ var wm *map180.Map180
 var userW = os.Getenv("MTR_USER")
 var keyW = os.Getenv("MTR_KEY")
 
+// autoRegister creates unknown devices and sites as pending when metrics are sent for them.
+var autoRegister = os.Getenv("MTR_AUTO_REGISTER") == "true"
+
 func init() {
 	mux.HandleFunc("/", weft.MakeHandlerAPI(home))
 	mux.HandleFunc("/health", health)
@@ -39,13 +41,75 @@ func init() {
 
 func main() {
 	var err error
+
+	// mtr-api migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrateMain(os.Args[2:])
+	}
+
+	if err = loadPromConfig(os.Getenv("MTR_PROMETHEUS_CONFIG")); err != nil {
+		log.Println("Problem with Prometheus config.")
+		log.Fatal(err)
+	}
+
+	if err = loadInfluxConfig(os.Getenv("MTR_INFLUX_CONFIG")); err != nil {
+		log.Println("Problem with InfluxDB config.")
+		log.Fatal(err)
+	}
+
+	if err = loadNotifyConfig(os.Getenv("MTR_NOTIFY_CONFIG")); err != nil {
+		log.Println("Problem with notification config.")
+		log.Fatal(err)
+	}
+
+	// MTR_STORE=memory runs without a database for small deployments.  Everything is lost on restart.
+	switch os.Getenv("MTR_STORE") {
+	case "", "postgres":
+		openDB()
+	case "memory":
+		if archiveDir != "" {
+			log.Fatal("MTR_ARCHIVE_DIR needs the database, it can't be used with MTR_STORE=memory")
+		}
+
+		storage = newMemStore()
+		log.Println("using the in-memory store, metrics are lost on restart and there are no maps")
+	default:
+		log.Fatalf("unknown MTR_STORE %q, expected postgres or memory", os.Getenv("MTR_STORE"))
+	}
+
+	go deleteMetrics()
+	go evaluateAlerts()
+	go sendNotifications()
+
+	// StatsD UDP listener for non Go applications e.g., MTR_STATSD_ADDR=:8125
+	if addr := os.Getenv("MTR_STATSD_ADDR"); addr != "" {
+		s, err := newStatsd(os.Getenv("MTR_STATSD_NAMING"))
+		if err != nil {
+			log.Println("Problem with StatsD config.")
+			log.Fatal(err)
+		}
+
+		if err = s.listen(addr); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("listening for StatsD on %s", addr)
+	}
+
+	log.Println("starting server")
+	log.Fatal(http.ListenAndServe(":8080", inbound(mux)))
+}
+
+// openDB opens the mtr database for pgStore and the maps.
+func openDB() {
+	var err error
+
 	db, err = sql.Open("postgres",
 		os.ExpandEnv("host=${DB_HOST} connect_timeout=30 user=${DB_USER} password=${DB_PASSWORD} dbname=mtr sslmode=disable"))
 	if err != nil {
 		log.Println("Problem with DB config.")
 		log.Fatal(err)
 	}
-	defer db.Close()
 
 	db.SetMaxIdleConns(30)
 	db.SetMaxOpenConns(30)
@@ -54,13 +118,20 @@ func main() {
 		log.Println("ERROR: problem pinging DB - is it up and contactable? 500s will be served")
 	}
 
+	// Refuse to serve if the schema is behind this binary (see migrate.go).
+	if os.Getenv("MTR_SCHEMA_CHECK") == "true" {
+		if err = checkSchema(db); err != nil {
+			log.Println("Problem with DB schema.")
+			log.Fatal(err)
+		}
+	}
+
 	dbR, err = sql.Open("postgres",
 		os.ExpandEnv("host=${DB_HOST} connect_timeout=30 user=${DB_USER_R} password=${DB_PASSWORD_R} dbname=mtr sslmode=disable"))
 	if err != nil {
 		log.Println("Problem with DB config.")
 		log.Fatal(err)
 	}
-	defer dbR.Close()
 
 	dbR.SetMaxIdleConns(30)
 	dbR.SetMaxOpenConns(30)
@@ -74,11 +145,6 @@ func main() {
 	if err != nil {
 		log.Printf("ERROR: problem with map180 config: %s", err.Error())
 	}
-
-	go deleteMetrics()
-
-	log.Println("starting server")
-	log.Fatal(http.ListenAndServe(":8080", inbound(mux)))
 }
 
 func home(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
@@ -89,12 +155,17 @@ func home(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
 	return &weft.NotFound
 }
 
+// private are the GET paths that need authentication.  The notification log has webhook URLs and email addresses.
+var private = map[string]bool{
+	"/notification": true,
+}
+
 // inbound wraps the mux and adds basic auth.
 func inbound(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "PUT", "DELETE", "POST":
-			if user, password, ok := r.BasicAuth(); ok && userW == user && keyW == password {
+			if authorized(r) {
 				h.ServeHTTP(w, r)
 			} else {
 				http.Error(w, "Access denied", http.StatusUnauthorized)
@@ -102,6 +173,11 @@ func inbound(h http.Handler) http.Handler {
 				return
 			}
 		case "GET":
+			if private[r.URL.Path] && !authorized(r) {
+				http.Error(w, "Access denied", http.StatusUnauthorized)
+				mtrapp.StatusUnauthorized.Inc()
+				return
+			}
 			h.ServeHTTP(w, r)
 		default:
 			weft.Write(w, r, &weft.MethodNotAllowed)
@@ -111,6 +187,12 @@ func inbound(h http.Handler) http.Handler {
 	})
 }
 
+// authorized returns true if r has the credentials for changing metrics.
+func authorized(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	return ok && userW == user && keyW == password
+}
+
 /*
 health does not require auth - for use with AWS EB load balancer checks.
 */
@@ -120,46 +202,6 @@ func health(w http.ResponseWriter, r *http.Request) {
 
 // TODO delete app instance and time source that have no metrics?
 
-/*
-deleteMetrics deletes old metrics.
-*/
-func deleteMetrics() {
-	ticker := time.NewTicker(time.Minute).C
-	var err error
-	for {
-		select {
-		case <-ticker:
-			if _, err = db.Exec(`DELETE FROM field.metric WHERE time < now() - interval '40 days'`); err != nil {
-				log.Println(err)
-			}
-
-			if _, err = db.Exec(`DELETE FROM field.metric_summary WHERE time < now() - interval '40 days'`); err != nil {
-				log.Println(err)
-			}
-
-			if _, err = db.Exec(`DELETE FROM data.latency WHERE time < now() - interval '40 days'`); err != nil {
-				log.Println(err)
-			}
-
-			if _, err = db.Exec(`DELETE FROM data.latency_summary WHERE time < now() - interval '40 days'`); err != nil {
-				log.Println(err)
-			}
-
-			if _, err = db.Exec(`DELETE FROM app.metric WHERE time < now() - interval '28 days'`); err != nil {
-				log.Println(err)
-			}
-
-			if _, err = db.Exec(`DELETE FROM app.counter WHERE time < now() - interval '28 days'`); err != nil {
-				log.Println(err)
-			}
-
-			if _, err = db.Exec(`DELETE FROM app.timer WHERE time < now() - interval '28 days'`); err != nil {
-				log.Println(err)
-			}
-		}
-	}
-}
-
 // up is for testing that the app has started e.g., for with load balancers.
 // It indicates the app is started.  It may still be serving errors.
 // Not useful for inclusion in app metrics so weft not used.
@@ -189,9 +231,7 @@ func soh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var c int
-
-	if err := db.QueryRow("SELECT 1").Scan(&c); err != nil {
+	if err := storage.ping(); err != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		w.Write([]byte("<html><head></head><body>service error</body></html>"))
 		log.Printf("ERROR: soh service error %s", err)
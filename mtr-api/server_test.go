@@ -13,7 +13,31 @@ import (
 
 var testServer *httptest.Server
 
+// testStorage is the store the test server was started with.  teardown restores it.
+var testStorage store
+
+// testMem is kept between tests, the same as the database, so tests can use the data added by TestRoutes.
+var testMem = newMemStore()
+
+/*
+setup starts the test server with testMem so that the routes can be tested without a database.
+The test applications are deleted.  Tests that check the database directly use setupDB.
+*/
 func setup(t *testing.T) {
+	testStorage = storage
+	storage = testMem
+
+	startTestServer()
+
+	testMem.mu.Lock()
+	for _, a := range []string{"test-app", "mtr-api", "mtr-ui"} {
+		delete(testMem.apps, a)
+	}
+	testMem.mu.Unlock()
+}
+
+// setupDB starts the test server with pgStore and the mtr database.  The test applications are deleted.
+func setupDB(t *testing.T) {
 	var err error
 	if db, err = sql.Open("postgres",
 		os.ExpandEnv("host=${DB_HOST} connect_timeout=30 user=${DB_USER} password=${DB_PASSWORD} dbname=mtr sslmode=disable")); err != nil {
@@ -40,13 +64,10 @@ func setup(t *testing.T) {
 	//	t.Fatalf("ERROR: problem with map180 config: %s", err)
 	//}
 
-	testServer = httptest.NewServer(inbound(mux))
+	testStorage = storage
+	storage = pgStore{}
 
-	// Silence the logging unless running with
-	// go test -v
-	if !testing.Verbose() {
-		log.SetOutput(ioutil.Discard)
-	}
+	startTestServer()
 
 	if r := delApplication("test-app"); !r.Ok {
 		t.Error(r.Msg)
@@ -61,6 +82,16 @@ func setup(t *testing.T) {
 	}
 }
 
+func startTestServer() {
+	testServer = httptest.NewServer(inbound(mux))
+
+	// Silence the logging unless running with
+	// go test -v
+	if !testing.Verbose() {
+		log.SetOutput(ioutil.Discard)
+	}
+}
+
 func delApplication(applicationID string) *weft.Result {
 	if applicationID == "" {
 		return weft.BadRequest("empty applicationID")
@@ -97,6 +128,15 @@ func setupBench(t *testing.B) {
 
 func teardown() {
 	testServer.Close()
-	db.Close()
-	defer dbR.Close()
+	storage = testStorage
+
+	if db != nil {
+		db.Close()
+		db = nil
+	}
+
+	if dbR != nil {
+		dbR.Close()
+		dbR = nil
+	}
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/weft"
+	"github.com/golang/protobuf/proto"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+fieldSilenced and dataSilenced are the SQL for whether a field metric or data latency matches an active silence.
+Empty targets in mtr.silence match everything so a silence matches a metric when all of its targets do.  Queries
+using them must join field.device and field.type, or data.site and data.type.
+*/
+const (
+	fieldSilenced = `EXISTS(SELECT 1 FROM mtr.silence s
+		WHERE s.start <= now() AND s."end" > now()
+		AND s.siteID = ''
+		AND (s.deviceID = '' OR s.deviceID = field.device.deviceID)
+		AND (s.typeID = '' OR s.typeID = field.type.typeID)
+		AND (s.tag = '' OR s.tag IN (SELECT g.tag FROM field.metric_tag mt JOIN mtr.tag g USING (tagPK)
+			WHERE mt.devicePK = field.device.devicePK AND mt.typePK = field.type.typePK)))`
+	dataSilenced = `EXISTS(SELECT 1 FROM mtr.silence s
+		WHERE s.start <= now() AND s."end" > now()
+		AND s.deviceID = ''
+		AND (s.siteID = '' OR s.siteID = data.site.siteID)
+		AND (s.typeID = '' OR s.typeID = data.type.typeID)
+		AND (s.tag = '' OR s.tag IN (SELECT g.tag FROM data.latency_tag lt JOIN mtr.tag g USING (tagPK)
+			WHERE lt.sitePK = data.site.sitePK AND lt.typePK = data.type.typePK)))`
+)
+
+// maintenanceState returns metricMaintenance instead of a bad or late state if the metric is silenced.
+func maintenanceState(state string, silenced bool) string {
+	if silenced && (state == metricBad || state == metricLate) {
+		return metricMaintenance
+	}
+
+	return state
+}
+
+/*
+silenceMatches returns true if s is active at now and matches the field metric for deviceID (siteID is empty) or the
+data latency for siteID (deviceID is empty) with typeID and tags.  It is the same as fieldSilenced and dataSilenced.
+*/
+func silenceMatches(s silence, now time.Time, deviceID, siteID, typeID string, tags []string) bool {
+	switch {
+	case s.start.After(now) || !s.end.After(now):
+		return false
+	case deviceID != "" && s.siteID != "", siteID != "" && s.deviceID != "":
+		return false
+	case s.deviceID != "" && s.deviceID != deviceID:
+		return false
+	case s.siteID != "" && s.siteID != siteID:
+		return false
+	case s.typeID != "" && s.typeID != typeID:
+		return false
+	case s.tag != "" && !contains(tags, s.tag):
+		return false
+	}
+
+	return true
+}
+
+/*
+silencePut adds a silence or, if silenceID is set, updates one.  There must be at least one of deviceID, siteID,
+tag, or typeID.  deviceID only matches field metrics and siteID only matches data latencies so a silence can't have both.
+*/
+func silencePut(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	v := r.URL.Query()
+
+	s := silence{
+		deviceID: v.Get("deviceID"),
+		siteID:   v.Get("siteID"),
+		tag:      v.Get("tag"),
+		typeID:   v.Get("typeID"),
+		reason:   v.Get("reason"),
+	}
+
+	switch {
+	case s.deviceID == "" && s.siteID == "" && s.tag == "" && s.typeID == "":
+		return weft.BadRequest("a silence needs a deviceID, siteID, tag, or typeID")
+	case s.deviceID != "" && s.siteID != "":
+		return weft.BadRequest("a silence can't have a deviceID and a siteID")
+	}
+
+	var err error
+
+	if s.start, err = time.Parse(time.RFC3339, v.Get("startDate")); err != nil {
+		return weft.BadRequest("invalid startDate")
+	}
+
+	if s.end, err = time.Parse(time.RFC3339, v.Get("endDate")); err != nil {
+		return weft.BadRequest("invalid endDate")
+	}
+
+	if !s.end.After(s.start) {
+		return weft.BadRequest("endDate must be after startDate")
+	}
+
+	if v.Get("silenceID") != "" {
+		if s.id, err = strconv.Atoi(v.Get("silenceID")); err != nil {
+			return weft.BadRequest("invalid silenceID")
+		}
+
+		// silence IDs start at 1 and an id of 0 would add a new silence.
+		if s.id < 1 {
+			return &weft.NotFound
+		}
+	}
+
+	switch err = storage.silenceSave(s); err {
+	case nil:
+		return &weft.StatusOK
+	case errNotFound:
+		return &weft.NotFound
+	default:
+		return weft.InternalServerError(err)
+	}
+}
+
+/*
+silenceDelete ends an active silence now.  It is kept as history.  A silence that hasn't started yet is deleted
+and one that has already ended is not changed.
+*/
+func silenceDelete(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	id, err := strconv.Atoi(r.URL.Query().Get("silenceID"))
+	if err != nil {
+		return weft.BadRequest("invalid silenceID")
+	}
+
+	if err = storage.silenceEnd(id, time.Now().UTC().Truncate(time.Second)); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	return &weft.StatusOK
+}
+
+// silenceProto returns all silences, most recent first.
+func silenceProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
+	silences, err := storage.silences()
+	if err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	var sr mtrpb.SilenceResult
+
+	for _, s := range silences {
+		sr.Result = append(sr.Result, &mtrpb.Silence{
+			SilenceID:    int64(s.id),
+			DeviceID:     s.deviceID,
+			SiteID:       s.siteID,
+			Tag:          s.tag,
+			TypeID:       s.typeID,
+			StartSeconds: s.start.Unix(),
+			EndSeconds:   s.end.Unix(),
+			Reason:       s.reason,
+		})
+	}
+
+	var by []byte
+	if by, err = proto.Marshal(&sr); err != nil {
+		return weft.InternalServerError(err)
+	}
+
+	b.Write(by)
+
+	return &weft.StatusOK
+}
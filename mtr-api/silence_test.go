@@ -0,0 +1,184 @@
+package main
+
+import (
+	"github.com/GeoNet/mtr/mtrpb"
+	wt "github.com/GeoNet/weft/wefttest"
+	"github.com/golang/protobuf/proto"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceState(t *testing.T) {
+	in := []struct {
+		id       string
+		state    string
+		silenced bool
+		expected string
+	}{
+		{id: wt.L(), state: metricBad, silenced: true, expected: metricMaintenance},
+		{id: wt.L(), state: metricLate, silenced: true, expected: metricMaintenance},
+		{id: wt.L(), state: metricOK, silenced: true, expected: metricOK},
+		{id: wt.L(), state: metricUnknown, silenced: true, expected: metricUnknown},
+		{id: wt.L(), state: metricBad, silenced: false, expected: metricBad},
+		{id: wt.L(), state: metricLate, silenced: false, expected: metricLate},
+	}
+
+	for _, v := range in {
+		if s := maintenanceState(v.state, v.silenced); s != v.expected {
+			t.Errorf("%s expected %s got %s", v.id, v.expected, s)
+		}
+	}
+}
+
+// TestSilences checks a silence for a tag puts a bad metric in maintenance and resolves its alert.
+func TestSilences(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for _, q := range []string{`DELETE FROM mtr.alert WHERE schema = 'field' AND id = 'test-silence'`,
+		`DELETE FROM mtr.silence WHERE tag = 'test-silence'`} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setupReq := wt.Requests{
+		{ID: wt.L(), URL: "/field/model?modelID=Trimble+NetR9", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/device?deviceID=test-silence&modelID=Trimble+NetR9&latitude=-38.74270&longitude=176.08100", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric?deviceID=test-silence&typeID=voltage", Method: "DELETE"},
+		{ID: wt.L(), URL: "/field/metric/threshold?deviceID=test-silence&typeID=voltage&lower=12000&upper=13000", Method: "PUT"},
+		{ID: wt.L(), URL: "/tag/test-silence", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric/tag?deviceID=test-silence&typeID=voltage&tag=test-silence", Method: "PUT"},
+		// bad
+		{ID: wt.L(), URL: "/field/metric?deviceID=test-silence&typeID=voltage&value=14000&time=" + now.Add(time.Minute*-1).Format(time.RFC3339), Method: "PUT"},
+	}
+
+	for _, v := range setupReq {
+		if err := doStatus(testServer.URL, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer doStatus(testServer.URL, wt.Request{ID: wt.L(), URL: "/field/device?deviceID=test-silence", Method: "DELETE"})
+
+	if err := updateAlerts(now); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testSilenceFiring(t); n != 1 {
+		t.Errorf("expected 1 firing alert got %d", n)
+	}
+
+	if m := testFieldSummary(t, "test-silence"); m.Maintenance {
+		t.Error("expected metric not in maintenance before the silence")
+	}
+
+	v := url.Values{}
+	v.Set("tag", "test-silence")
+	v.Set("startDate", now.Add(time.Hour*-1).Format(time.RFC3339))
+	v.Set("endDate", now.Add(time.Hour).Format(time.RFC3339))
+	v.Set("reason", "site visit")
+
+	if err := doStatus(testServer.URL, wt.Request{ID: wt.L(), URL: "/silence?" + v.Encode(), Method: "PUT"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if m := testFieldSummary(t, "test-silence"); !m.Maintenance {
+		t.Errorf("expected metric in maintenance got %+v", m)
+	}
+
+	if err := updateAlerts(now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testSilenceFiring(t); n != 0 {
+		t.Errorf("expected no firing alerts for a silenced metric got %d", n)
+	}
+
+	s := testSilence(t)
+
+	if s.Reason != "site visit" || s.StartSeconds != now.Add(time.Hour*-1).Unix() || s.EndSeconds != now.Add(time.Hour).Unix() {
+		t.Errorf("unexpected silence %+v", s)
+	}
+
+	r := wt.Request{ID: wt.L(), URL: "/silence?silenceID=" + strconv.FormatInt(s.SilenceID, 10), Method: "DELETE"}
+	if err := doStatus(testServer.URL, r); err != nil {
+		t.Fatal(err)
+	}
+
+	// the silence has ended and is kept.
+	if s = testSilence(t); s.EndSeconds > time.Now().Unix() {
+		t.Errorf("expected ended silence got %+v", s)
+	}
+
+	if m := testFieldSummary(t, "test-silence"); m.Maintenance {
+		t.Error("expected metric not in maintenance after the silence")
+	}
+}
+
+// testSilenceFiring returns the number of firing alerts for test-silence.
+func testSilenceFiring(t *testing.T) int {
+	var n int
+
+	if err := db.QueryRow(`SELECT COUNT(*) FROM mtr.alert WHERE schema = 'field' AND id = 'test-silence' AND "end" IS NULL`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+// testFieldSummary returns the voltage summary for deviceID.
+func testFieldSummary(t *testing.T, deviceID string) *mtrpb.FieldMetricSummary {
+	r := wt.Request{ID: wt.L(), URL: "/field/metric/summary?typeID=voltage", Accept: "application/x-protobuf"}
+
+	b, err := r.Do(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fr mtrpb.FieldMetricSummaryResult
+
+	if err = proto.Unmarshal(b, &fr); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range fr.Result {
+		if v.DeviceID == deviceID {
+			return v
+		}
+	}
+
+	t.Fatal("no summary for " + deviceID)
+
+	return nil
+}
+
+// testSilence returns the silence for the test-silence tag.
+func testSilence(t *testing.T) *mtrpb.Silence {
+	r := wt.Request{ID: wt.L(), URL: "/silence", Accept: "application/x-protobuf"}
+
+	b, err := r.Do(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sr mtrpb.SilenceResult
+
+	if err = proto.Unmarshal(b, &sr); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range sr.Result {
+		if v.Tag == "test-silence" {
+			return v
+		}
+	}
+
+	t.Fatal("no silence for test-silence")
+
+	return nil
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"github.com/GeoNet/mtr/internal"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultStatsdNaming is used when MTR_STATSD_NAMING is not set.
+const defaultStatsdNaming = "application.instance.source"
+
+/*
+statsdNaming maps StatsD metric names to applicationID, instanceID, and sourceID.  It is
+a dot separated pattern using the parts application, instance, source, and _ (ignored) e.g.,
+
+	application.instance.source  myapp.host1.StatusOK
+	_.application.source         prod.myapp.db_query
+
+The last part in the pattern takes the rest of the metric name.  If the pattern has no instance
+then the instanceID is the address of the sender.  For timers the source is the app.source.
+For counters and gauges the source is the app.type typeID (e.g., StatusOK) or typePK (e.g., 200).
+*/
+type statsdNaming []string
+
+// statsdGaugeTTL is how long a gauge is kept without being set before it is forgotten.
+const statsdGaugeTTL = time.Hour
+
+// statsdKey identifies an aggregated StatsD metric.
+type statsdKey struct {
+	applicationID, instanceID, sourceID string
+}
+
+/*
+statsd aggregates StatsD counters (c), timers (ms), and gauges (g) and saves them once per minute
+the same way as mtrapp.  Counters are summed and saved to app.counter.  Timers are saved to app.timer with
+the count, average, fiftieth, and ninetieth percentiles.  The last value of each gauge that was set in the minute
+is saved to app.metric.  All values for a minute are saved at the same minute boundary.  Gauges that haven't
+been set for statsdGaugeTTL are forgotten.
+*/
+type statsd struct {
+	sync.Mutex
+	naming   statsdNaming
+	counters map[statsdKey]float64
+	gauges   map[statsdKey]statsdGauge
+	updated  map[statsdKey]bool // gauges set since the last flush
+	timers   map[statsdKey][]int
+	types    map[string]int // app.type typeID to typePK
+}
+
+// statsdGauge is the value of a gauge and when it was last set.
+type statsdGauge struct {
+	value float64
+	set   time.Time
+}
+
+func newStatsd(naming string) (*statsd, error) {
+	n, err := parseStatsdNaming(naming)
+	if err != nil {
+		return nil, err
+	}
+
+	return &statsd{
+		naming:   n,
+		counters: make(map[statsdKey]float64),
+		gauges:   make(map[statsdKey]statsdGauge),
+		updated:  make(map[statsdKey]bool),
+		timers:   make(map[statsdKey][]int),
+		types:    make(map[string]int),
+	}, nil
+}
+
+func parseStatsdNaming(s string) (statsdNaming, error) {
+	if s == "" {
+		s = defaultStatsdNaming
+	}
+
+	n := statsdNaming(strings.Split(s, "."))
+
+	var application, source bool
+
+	for _, p := range n {
+		switch p {
+		case "application":
+			application = true
+		case "source":
+			source = true
+		case "instance", "_":
+		default:
+			return nil, fmt.Errorf("invalid part in StatsD naming: %s", p)
+		}
+	}
+
+	if !application || !source {
+		return nil, fmt.Errorf("StatsD naming must have application and source: %s", s)
+	}
+
+	return n, nil
+}
+
+// key returns the statsdKey for the metric name from host.
+func (n statsdNaming) key(name, host string) (statsdKey, error) {
+	k := statsdKey{instanceID: host}
+
+	parts := strings.SplitN(name, ".", len(n))
+	if len(parts) != len(n) {
+		return k, fmt.Errorf("name doesn't match naming: %s", name)
+	}
+
+	for i, p := range n {
+		switch p {
+		case "application":
+			k.applicationID = parts[i]
+		case "instance":
+			k.instanceID = parts[i]
+		case "source":
+			k.sourceID = parts[i]
+		}
+	}
+
+	if k.applicationID == "" || k.instanceID == "" || k.sourceID == "" {
+		return k, fmt.Errorf("empty application, instance, or source: %s", name)
+	}
+
+	return k, nil
+}
+
+// listen receives StatsD packets on the UDP addr and saves the aggregated values each minute.
+func (s *statsd) listen(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute).C
+
+		for {
+			<-ticker
+			s.flush(time.Now().UTC())
+		}
+	}()
+
+	go func() {
+		buf := make([]byte, 65535)
+
+		for {
+			n, a, err := conn.ReadFrom(buf)
+			if err != nil {
+				log.Printf("statsd: %s", err.Error())
+				continue
+			}
+
+			host := a.String()
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+
+			if err = s.parse(string(buf[:n]), host); err != nil {
+				log.Printf("statsd: %s", err.Error())
+			}
+		}
+	}()
+
+	return nil
+}
+
+// parse parses and aggregates the lines in packet e.g.,
+//
+//	myapp.host1.StatusOK:1|c|@0.5
+//	myapp.host1.db_query:12.5|ms
+//	myapp.host1.Routines:+2|g
+//
+// Lines that can't be parsed are skipped.  Returns the first error.
+func (s *statsd) parse(packet, host string) error {
+	var first error
+
+	for _, l := range strings.Split(packet, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+
+		if err := s.parseLine(l, host); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+func (s *statsd) parseLine(l, host string) error {
+	i := strings.LastIndex(l, ":")
+	if i == -1 {
+		return fmt.Errorf("invalid line: %s", l)
+	}
+
+	k, err := s.naming.key(l[:i], host)
+	if err != nil {
+		return err
+	}
+
+	f := strings.Split(l[i+1:], "|")
+	if len(f) < 2 {
+		return fmt.Errorf("invalid line: %s", l)
+	}
+
+	v, err := strconv.ParseFloat(f[0], 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("invalid value: %s", l)
+	}
+
+	rate := 1.0
+
+	for _, o := range f[2:] {
+		if strings.HasPrefix(o, "@") {
+			if rate, err = strconv.ParseFloat(o[1:], 64); err != nil || rate <= 0 || rate > 1 {
+				return fmt.Errorf("invalid sample rate: %s", l)
+			}
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	switch f[1] {
+	case "c":
+		s.counters[k] += v / rate
+	case "ms":
+		s.timers[k] = append(s.timers[k], int(math.Floor(v+0.5)))
+	case "g":
+		// a signed value changes the gauge.
+		if strings.HasPrefix(f[0], "+") || strings.HasPrefix(f[0], "-") {
+			v += s.gauges[k].value
+		}
+		s.gauges[k] = statsdGauge{value: v, set: time.Now().UTC()}
+		s.updated[k] = true
+	default:
+		return fmt.Errorf("unsupported type: %s", l)
+	}
+
+	return nil
+}
+
+// flush saves the values aggregated for the minute before now and resets the counters and timers.
+// All the values are saved at the minute boundary now is in.  Gauges keep their value for relative
+// changes until they expire.
+func (s *statsd) flush(now time.Time) {
+	t := now.Truncate(time.Minute)
+
+	s.Lock()
+	counters := s.counters
+	timers := s.timers
+	gauges := make(map[statsdKey]float64, len(s.updated))
+	for k := range s.updated {
+		gauges[k] = s.gauges[k].value
+	}
+	s.counters = make(map[statsdKey]float64)
+	s.timers = make(map[statsdKey][]int)
+	s.updated = make(map[statsdKey]bool)
+	s.Unlock()
+
+	s.expireGauges(now)
+
+	for k, v := range counters {
+		c := int(math.Floor(v + 0.5))
+		if c == 0 {
+			continue
+		}
+
+		typePK, err := s.typePK(k.sourceID)
+		if err != nil {
+			log.Printf("statsd: %s", err.Error())
+			continue
+		}
+
+		if res := applicationCounterSave(k.applicationID, k.instanceID, typePK, t, c); !res.Ok {
+			log.Printf("statsd: error saving counter %s: %s", k.sourceID, res.Msg)
+			s.forgetType(k.sourceID)
+		}
+	}
+
+	for k, v := range timers {
+		var sum int
+		for _, t := range v {
+			sum += t
+		}
+
+		a := sum / len(v)
+		f := internal.Percentile(0.5, v)
+		n := internal.Percentile(0.9, v)
+
+		if res := applicationTimerSave(k.applicationID, k.instanceID, k.sourceID, t, len(v), a, f, n); !res.Ok {
+			log.Printf("statsd: error saving timer %s: %s", k.sourceID, res.Msg)
+		}
+	}
+
+	for k, v := range gauges {
+		typePK, err := s.typePK(k.sourceID)
+		if err != nil {
+			log.Printf("statsd: %s", err.Error())
+			continue
+		}
+
+		if res := applicationMetricSave(k.applicationID, k.instanceID, typePK, t, int64(math.Floor(v+0.5))); !res.Ok {
+			log.Printf("statsd: error saving gauge %s: %s", k.sourceID, res.Msg)
+			s.forgetType(k.sourceID)
+		}
+	}
+}
+
+// expireGauges forgets gauges that haven't been set for statsdGaugeTTL before now.
+func (s *statsd) expireGauges(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	for k, v := range s.gauges {
+		if now.Sub(v.set) > statsdGaugeTTL {
+			delete(s.gauges, k)
+		}
+	}
+}
+
+// typePK returns the app.type typePK for typeID.  typeID can be the typeID or typePK.
+func (s *statsd) typePK(typeID string) (int, error) {
+	if i, err := strconv.Atoi(typeID); err == nil {
+		return i, nil
+	}
+
+	s.Lock()
+	i, ok := s.types[typeID]
+	s.Unlock()
+
+	if ok {
+		return i, nil
+	}
+
+	i, err := storage.appTypePK(typeID)
+	if err != nil {
+		return 0, fmt.Errorf("unknown app type %s: %s", typeID, err.Error())
+	}
+
+	s.Lock()
+	s.types[typeID] = i
+	s.Unlock()
+
+	return i, nil
+}
+
+// forgetType removes typeID from the cache in case the app type has been deleted and added again with a new typePK.
+func (s *statsd) forgetType(typeID string) {
+	s.Lock()
+	delete(s.types, typeID)
+	s.Unlock()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsdParse(t *testing.T) {
+	if _, err := parseStatsdNaming("application.bad.source"); err == nil {
+		t.Error("expected error for invalid naming part.")
+	}
+
+	if _, err := parseStatsdNaming("application.instance"); err == nil {
+		t.Error("expected error for naming without source.")
+	}
+
+	s, err := newStatsd("_.application.source")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.parse("prod.myapp.StatusOK:1|c\nprod.myapp.StatusOK:1|c|@0.5\nprod.myapp.db.query:12.6|ms\nprod.myapp.db.query:20|ms\n"+
+		"prod.myapp.Routines:10|g\nprod.myapp.Routines:-3|g", "10.0.0.1"); err != nil {
+		t.Error(err)
+	}
+
+	k := statsdKey{applicationID: "myapp", instanceID: "10.0.0.1", sourceID: "StatusOK"}
+	if s.counters[k] != 3 {
+		t.Errorf("expected count 3 got %f", s.counters[k])
+	}
+
+	k.sourceID = "db.query"
+	if len(s.timers[k]) != 2 || s.timers[k][0] != 13 {
+		t.Errorf("unexpected timers %v", s.timers[k])
+	}
+
+	k.sourceID = "Routines"
+	if s.gauges[k].value != 7 {
+		t.Errorf("expected gauge 7 got %f", s.gauges[k].value)
+	}
+
+	for _, l := range []string{
+		"myapp.StatusOK",
+		"myapp.StatusOK:1",
+		"prod.myapp.StatusOK:a|c",
+		"prod.myapp.StatusOK:1|c|@2",
+		"prod.myapp.StatusOK:1|s",
+	} {
+		if err = s.parseLine(l, "10.0.0.1"); err == nil {
+			t.Errorf("expected error for %s", l)
+		}
+	}
+}
+
+func TestStatsdFlush(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	s, err := newStatsd("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.parse("statsd-app.host1.StatusOK:5|c\nstatsd-app.host1.query:10|ms\nstatsd-app.host1.query:30|ms\nstatsd-app.host1.1100:12|g", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	s.flush(now.Add(time.Second * 10))
+
+	var c int
+	var tm time.Time
+
+	if err = db.QueryRow(`SELECT time, count FROM app.counter
+				JOIN app.application USING (applicationpk)
+				JOIN app.instance USING (instancepk)
+				WHERE applicationID = 'statsd-app' AND instanceID = 'host1' AND typePK = 200`).Scan(&tm, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c != 5 {
+		t.Errorf("expected count 5 got %d", c)
+	}
+
+	// all values are saved at the same minute boundary.
+	if !tm.Equal(now) {
+		t.Errorf("expected counter time %s got %s", now, tm)
+	}
+
+	var average, fifty, ninety int
+
+	if err = db.QueryRow(`SELECT time, count, average, fifty, ninety FROM app.timer
+				JOIN app.application USING (applicationpk)
+				JOIN app.source USING (sourcepk)
+				WHERE applicationID = 'statsd-app' AND sourceID = 'query'`).Scan(&tm, &c, &average, &fifty, &ninety); err != nil {
+		t.Fatal(err)
+	}
+
+	if !tm.Equal(now) {
+		t.Errorf("expected timer time %s got %s", now, tm)
+	}
+
+	if c != 2 || average != 20 || fifty != 20 || ninety != 30 {
+		t.Errorf("unexpected timer count %d average %d fifty %d ninety %d", c, average, fifty, ninety)
+	}
+
+	var v int64
+
+	if err = db.QueryRow(`SELECT time, value FROM app.metric
+				JOIN app.application USING (applicationpk)
+				WHERE applicationID = 'statsd-app' AND typePK = 1100`).Scan(&tm, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if !tm.Equal(now) {
+		t.Errorf("expected gauge time %s got %s", now, tm)
+	}
+
+	if v != 12 {
+		t.Errorf("expected gauge 12 got %d", v)
+	}
+
+	// the counter and timer are reset and the gauge is only saved again if it is set.
+	if len(s.counters) != 0 || len(s.timers) != 0 || len(s.updated) != 0 {
+		t.Error("expected statsd to be reset after flush")
+	}
+}
+
+func TestStatsdExpireGauges(t *testing.T) {
+	s, err := newStatsd("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.parse("statsd-app.host1.1100:12|g\nstatsd-app.host1.1200:3|g", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+
+	// make one gauge stale.
+	k := statsdKey{applicationID: "statsd-app", instanceID: "host1", sourceID: "1200"}
+	g := s.gauges[k]
+	g.set = now.Add(-statsdGaugeTTL - time.Minute)
+	s.gauges[k] = g
+
+	s.expireGauges(now)
+
+	if len(s.gauges) != 1 {
+		t.Fatalf("expected 1 gauge got %d", len(s.gauges))
+	}
+
+	if _, ok := s.gauges[k]; ok {
+		t.Error("expected stale gauge to be expired")
+	}
+
+	// a relative change to an expired gauge starts from 0.
+	if err = s.parse("statsd-app.host1.1200:+2|g", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.gauges[k].value != 2 {
+		t.Errorf("expected gauge 2 got %g", s.gauges[k].value)
+	}
+}
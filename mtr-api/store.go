@@ -0,0 +1,398 @@
+package main
+
+import (
+	"errors"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/mtr/ts"
+	"math"
+	"time"
+)
+
+var (
+	// errNotFound is returned by a store when the device, type, or tag doesn't exist.
+	errNotFound = errors.New("not found")
+	// errRateLimit is returned by a store when there is already a value for the min_interval of the type.
+	errRateLimit = errors.New("already data for the interval")
+	// errHasMetrics is returned by a store when changing or deleting a type would change or delete its metrics.
+	errHasMetrics = errors.New("type has metrics")
+	// errInUse is returned by a store when deleting a field state value that devices are in.
+	errInUse = errors.New("in use")
+)
+
+/*
+store is the storage for the field, data, and app metrics, their types, thresholds, tags, and summaries,
+and the alerts, notifications, and retention.  pgStore uses the mtr database.  memStore keeps everything
+in memory and is lost on restart; it is for small deployments without a database (MTR_STORE=memory)
+and for the tests.
+
+Values are unscaled (see fieldType.scale).
+*/
+type store interface {
+	fieldModelSave(modelID string) error
+	// fieldModelDelete deletes the model and its devices.
+	fieldModelDelete(modelID string) error
+	fieldModels() ([]*mtrpb.FieldModel, error)
+	// fieldDeviceSave adds or updates a device.  Updating a pending device confirms it.
+	// It returns errNotFound if the model doesn't exist.
+	fieldDeviceSave(deviceID, modelID string, latitude, longitude float64) error
+	// fieldDeviceDelete deletes the device and its metrics.
+	fieldDeviceDelete(deviceID string) error
+	// fieldDevices returns the devices or, if pending is true, only the pending devices.
+	fieldDevices(pending bool) ([]*mtrpb.FieldDevice, error)
+
+	fieldTypeByID(typeID string) (fieldType, error)
+	fieldDeviceModel(deviceID string) (string, error)
+
+	// fieldMetricSave saves a value and updates the summary if the value is newer.
+	fieldMetricSave(deviceID, typeID string, t time.Time, value float64) error
+	// fieldMetricBatchSave saves the values from in and updates the summaries with the newest value
+	// for each device and type.  The status for each value is returned in the same order as in.
+	// Unknown devices or types get 400 and values that are rate limited get 429.  If backfill
+	// is true a value that is already saved with the same time and value gets 200.
+	fieldMetricBatchSave(in []*mtrpb.FieldMetricBatchValue, backfill bool) ([]*mtrpb.BatchStatus, error)
+	// fieldMetricDelete deletes all values, rollups, thresholds, and tags for the device and type.
+	fieldMetricDelete(deviceID, typeID string) error
+	// fieldMetrics returns values in timeRange, averaged for resolution ('full', 'minute', 'five_minutes', 'hour', or 'day').
+	fieldMetrics(deviceID, typeID, resolution string, timeRange []time.Time) ([]ts.Point, error)
+	fieldMetricLatest(deviceID, typeID string) (ts.Point, error)
+
+	// fieldThreshold returns the threshold for the device or, if there isn't one, the threshold for its model.
+	// source is thresholdDevice or thresholdModel.  It returns 0, 0, "" if there is no threshold.
+	fieldThreshold(deviceID, typeID string) (lower, upper float64, source string, err error)
+	fieldThresholdSave(deviceID, typeID string, th threshold) error
+	fieldThresholdDelete(deviceID, typeID string) error
+	fieldThresholds() ([]*mtrpb.FieldMetricThreshold, error)
+
+	fieldModelThresholdSave(modelID, typeID string, th threshold) error
+	fieldModelThresholdDelete(modelID, typeID string) error
+	fieldModelThresholds() ([]*mtrpb.FieldModelThreshold, error)
+
+	// fieldMetricLateSave sets the late window (seconds) for the device and type.  It returns errNotFound
+	// if the device or type doesn't exist.
+	fieldMetricLateSave(deviceID, typeID string, late int) error
+	fieldMetricLateDelete(deviceID, typeID string) error
+	fieldMetricLates() ([]*mtrpb.FieldMetricLate, error)
+
+	// fieldMetricAnomalySave returns errNotFound if the device or type doesn't exist.
+	fieldMetricAnomalySave(deviceID, typeID string, a anomalyThreshold) error
+	fieldMetricAnomalyDelete(deviceID, typeID string) error
+	fieldMetricAnomalies() ([]*mtrpb.FieldMetricAnomaly, error)
+
+	// fieldStateSave saves the state for the device and type, and the history if it is a change.  state is empty
+	// for on/off types.  It returns errNotFound if the device or state type doesn't exist.
+	fieldStateSave(deviceID, typeID string, t time.Time, value bool, state string) error
+	fieldStateDelete(deviceID, typeID string) error
+	fieldStates() ([]*mtrpb.FieldState, error)
+	// fieldStateHistory returns the changes of state for the device and type in timeRange.  If there is
+	// a change before timeRange the state at the start of timeRange is returned in initial.
+	// It returns errNotFound if the device or state type doesn't exist.
+	fieldStateHistory(deviceID, typeID string, timeRange []time.Time) (initial *fieldStateChange, changes []fieldStateChange, err error)
+	// fieldStateValueSave returns errNotFound if the state type doesn't exist.
+	fieldStateValueSave(typeID, value string, severity int) error
+	// fieldStateValueDelete returns errInUse if there are devices in the state.
+	fieldStateValueDelete(typeID, value string) error
+	// fieldStateValues returns the values for the state type, or for all types if typeID is empty.
+	fieldStateValues(typeID string) ([]*mtrpb.FieldStateValue, error)
+	fieldStateTagSave(deviceID, typeID, tag string) error
+	fieldStateTagDelete(deviceID, typeID, tag string) error
+	fieldStateTags() ([]*mtrpb.FieldStateTag, error)
+
+	tagSave(tag string) error
+	// tags returns the tags in ascending order.
+	tags() ([]string, error)
+	// tagDelete deletes the tag from everything it has been added to.
+	tagDelete(tag string) error
+	fieldMetricTagSave(deviceID, typeID, tag string) error
+	fieldMetricTagDelete(deviceID, typeID, tag string) error
+	// fieldMetricTags returns the tags for the device and type, or all tags if both are empty.
+	fieldMetricTags(deviceID, typeID string) ([]*mtrpb.FieldMetricTag, error)
+
+	// dataSiteSave adds or updates a site.  Updating a pending site confirms it.
+	dataSiteSave(siteID string, latitude, longitude float64) error
+	// dataSiteDelete deletes the site and its metrics.
+	dataSiteDelete(siteID string) error
+	// dataSites returns the sites or, if pending is true, only the pending sites.
+	dataSites(pending bool) ([]*mtrpb.DataSite, error)
+
+	// dataLatencyThresholdSave returns errNotFound if the site or type doesn't exist.
+	dataLatencyThresholdSave(siteID, typeID string, th threshold) error
+	dataLatencyThresholdDelete(siteID, typeID string) error
+	// dataLatencyThresholds returns the thresholds for siteID and typeID.  Either can be empty to match all.
+	dataLatencyThresholds(siteID, typeID string) ([]*mtrpb.DataLatencyThreshold, error)
+
+	// dataLatencyLateSave sets the late window (seconds) for the site and type.  It returns errNotFound
+	// if the site or type doesn't exist.
+	dataLatencyLateSave(siteID, typeID string, late int) error
+	dataLatencyLateDelete(siteID, typeID string) error
+	dataLatencyLates() ([]*mtrpb.DataLatencyLate, error)
+
+	// dataLatencyAnomalySave returns errNotFound if the site or type doesn't exist.
+	dataLatencyAnomalySave(siteID, typeID string, a anomalyThreshold) error
+	dataLatencyAnomalyDelete(siteID, typeID string) error
+	dataLatencyAnomalies() ([]*mtrpb.DataLatencyAnomaly, error)
+
+	dataTypeByID(typeID string) (dataType, error)
+	// dataLatencySave saves a latency and updates the summary if it is newer.  It returns errNotFound
+	// if the site or type doesn't exist and errRateLimit if there is already a value for the min_interval.
+	dataLatencySave(siteID, typeID string, t time.Time, mean, min, max, fifty, ninety float64) error
+	// dataLatencyBatchSave saves the values from in like fieldMetricBatchSave.  If backfill is true
+	// values that are not in time order for a site and type get 400.
+	dataLatencyBatchSave(in []dataBatchValue, backfill bool) ([]*mtrpb.BatchStatus, error)
+	// dataLatencyDelete deletes all latencies, rollups, thresholds, and tags for the site and type.
+	dataLatencyDelete(siteID, typeID string) error
+	// dataLatencies returns latencies in timeRange, aggregated for resolution (see fieldMetrics).
+	// It returns errNotFound if the site or type doesn't exist.
+	dataLatencies(siteID, typeID, resolution string, timeRange []time.Time) ([]dataLatency, error)
+	dataLatencyLatest(siteID, typeID string) (dataLatency, error)
+	dataLatencyTagSave(siteID, typeID, tag string) error
+	dataLatencyTagDelete(siteID, typeID, tag string) error
+	// dataLatencyTags returns the tags for the site and type, or all tags if both are empty.
+	dataLatencyTags(siteID, typeID string) ([]*mtrpb.DataLatencyTag, error)
+
+	dataCompletenessTypeByID(typeID string) (dataCompletenessType, error)
+	// dataCompletenessSave returns errNotFound and errRateLimit like dataLatencySave.
+	dataCompletenessSave(siteID, typeID string, t time.Time, count int) error
+	// dataCompletenessBatchSave is like dataLatencyBatchSave.
+	dataCompletenessBatchSave(in []dataBatchValue, backfill bool) ([]*mtrpb.BatchStatus, error)
+	dataCompletenessDelete(siteID, typeID string) error
+	// dataCompleteness returns the count summed for each resolution ('five_minutes', 'hour', 'twelve_hours', or 'day')
+	// after t0.  It returns errNotFound if the site or type doesn't exist.
+	dataCompleteness(siteID, typeID, resolution string, t0 time.Time) ([]ts.Point, error)
+	dataCompletenessLatest(siteID, typeID string) (ts.Point, error)
+	dataCompletenessTagSave(siteID, typeID, tag string) error
+	dataCompletenessTagDelete(siteID, typeID, tag string) error
+	// dataCompletenessTags returns the tags for the site and type, or all tags if both are empty.
+	dataCompletenessTags(siteID, typeID string) ([]*mtrpb.DataCompletenessTag, error)
+
+	// typeSave adds typeID to t or updates its columns.  It returns errHasMetrics if a protected column
+	// (see typeTable) would change for a type that has metrics, unless force is true.
+	typeSave(t typeTable, typeID string, cols []typeColumn, force bool) error
+	// typeDelete deletes typeID and all of its metrics.  It returns errHasMetrics if the type has metrics,
+	// unless force is true.
+	typeDelete(t typeTable, typeID string, force bool) error
+	fieldTypes() ([]*mtrpb.FieldType, error)
+	fieldStateTypes() ([]*mtrpb.FieldType, error)
+	dataTypes() ([]*mtrpb.DataType, error)
+	dataCompletenessTypes() ([]*mtrpb.DataType, error)
+	appTypes() ([]*mtrpb.AppType, error)
+
+	// appIDs returns the applicationIDs in ascending order.
+	appIDs() ([]string, error)
+	// appTypePK returns the typePK for the app.type typeID.  It returns errNotFound if there isn't one.
+	appTypePK(typeID string) (int, error)
+	// appMetricSave, appCounterSave, and appTimerSave save a value.  The application, instance, and source
+	// are added if needed e.g., the first time an application sends a value from an instance.
+	appMetricSave(applicationID, instanceID string, typePK int, t time.Time, value int64) error
+	appCounterSave(applicationID, instanceID string, typePK int, t time.Time, count int) error
+	appTimerSave(applicationID, instanceID, sourceID string, t time.Time, count, average, fifty, ninety int) error
+	// appMetrics returns the values for the application and types in timeRange, averaged for resolution
+	// (see fieldMetrics).  It returns errNotFound if the application or a type doesn't exist.
+	appMetrics(applicationID string, typePKs []int, resolution string, timeRange []time.Time) ([]appMetricValue, error)
+	// appCounters returns the counts for the application in timeRange, summed for resolution ('full', 'minute',
+	// 'five_minutes', or 'hour').
+	appCounters(applicationID, resolution string, timeRange []time.Time) ([]appCounter, error)
+	// appTimers returns the timers for the application in timeRange for resolution (see appCounters).  If
+	// sourceID is empty the timers for all sources are returned.
+	appTimers(applicationID, sourceID, resolution string, timeRange []time.Time) ([]appTimer, error)
+
+	/*
+		promCounterSave calls f with the last value of the Prometheus counter series and, if f returns nil, makes
+		n the last value.  The series is locked while f runs so concurrent writes can't count the same increase twice.
+		f isn't called for the first value of a series.  The error from f is returned.
+	*/
+	promCounterSave(series string, n float64, now time.Time, f func(last float64) error) error
+	// promCountersExpire forgets the counter series that have had no values since before.
+	promCountersExpire(before time.Time) error
+
+	// ping returns an error if the store can't be used.
+	ping() error
+
+	// retentionSave sets the days raw values are kept for typeID in schema, or the default for schema if typeID
+	// is empty.  It returns errNotFound if typeID isn't a type in schema (see retentionTypeTables).
+	retentionSave(schema, typeID string, days int) error
+	retentionDelete(schema, typeID string) error
+	retentions() ([]*mtrpb.Retention, error)
+	/*
+		deleteOld deletes values that are older than their retention (see mtr.retention), rollups older than
+		their retention, and resolved alerts and finished notifications older than alertRetention.  The rows
+		deleted are counted with countDeleted.
+	*/
+	deleteOld(now time.Time) error
+
+	// fieldSummaries returns the latest value of the field metrics for typeID, or for all types if typeID is empty.
+	fieldSummaries(typeID string) ([]fieldSummary, error)
+	// dataLatencySummaries returns the latest latency for typeID, or for all types if typeID is empty.
+	dataLatencySummaries(typeID string) ([]dataLatencySummary, error)
+	// dataCompletenessSummaries returns the latest count for typeID, or for all types if typeID is empty.
+	// It returns errNotFound if typeID doesn't exist.
+	dataCompletenessSummaries(typeID string) ([]dataCompletenessSummary, error)
+
+	// silenceSave adds s or, if s.id is set, updates it.  It returns errNotFound if there is no silence s.id.
+	silenceSave(s silence) error
+	// silenceEnd ends the silence at now.  A silence that hasn't started is deleted and one that has ended isn't changed.
+	silenceEnd(silenceID int, now time.Time) error
+	// silences returns all silences, most recent first.
+	silences() ([]silence, error)
+
+	/*
+		alertUpdate calls f with the firing alerts and saves the changes that it returns.  Only one mtr-api
+		updates the alerts at a time.  If another is already updating them this returns nil without calling f.
+	*/
+	alertUpdate(now time.Time, f func(open map[alertKey]string) (alertChange, error)) error
+	// alerts returns the firing alerts and the alerts that were resolved at or after since, most recent first.
+	alerts(since time.Time) ([]alert, error)
+
+	/*
+		notificationsClaim returns up to limit pending notifications that are due at now.  The attempt is
+		counted and they aren't due again until after lease so that more than one mtr-api can deliver at the same time.
+	*/
+	notificationsClaim(now time.Time, limit int, lease time.Duration) ([]notification, error)
+	notificationSent(pk int64, t time.Time) error
+	// notificationRetry saves a failed delivery.  status is pending, to try again at next, or failed.
+	notificationRetry(pk int64, status, errMsg string, next time.Time) error
+	// notifications returns the notifications queued at or after since, most recent first.
+	notifications(since time.Time) ([]*mtrpb.Notification, error)
+}
+
+// fieldType - table field.type
+type fieldType struct {
+	typeID      string
+	scale       float64
+	display     string
+	minInterval int // seconds
+}
+
+// dataType - table data.type
+type dataType struct {
+	typeID      string
+	scale       float64
+	display     string
+	minInterval int // seconds
+}
+
+// dataLatency is a latency value, or the aggregate for a resolution.
+type dataLatency struct {
+	t                   time.Time
+	mean, fifty, ninety float64
+}
+
+// dataCompletenessType - table data.completeness_type
+type dataCompletenessType struct {
+	typeID      string
+	expected    int // count per minInterval
+	minInterval int // seconds
+}
+
+// appMetricValue is a value, or the average for a resolution, from app.metric.
+type appMetricValue struct {
+	instanceID string
+	typePK     int
+	t          time.Time
+	value      float64
+}
+
+// appCounter is a count, or the sum for a resolution, from app.counter.
+type appCounter struct {
+	typePK int
+	t      time.Time
+	count  int
+}
+
+/*
+appTimer is a timer from app.timer.  For a resolution average is the mean, fifty and ninety are the max, and
+count is the sum for the period.
+*/
+type appTimer struct {
+	sourceID      string
+	t             time.Time
+	average       float64
+	fifty, ninety int
+	count         int
+}
+
+/*
+fieldSummary is the latest value for a field metric.  The threshold is the device or model threshold
+(see thresholdSource, which is empty if there isn't one).  late is the late window (seconds) and silenced
+is true if the metric matches an active silence.
+*/
+type fieldSummary struct {
+	deviceID, modelID, typeID string
+	latitude, longitude       float64
+	pending                   bool
+	scale                     float64
+	t                         time.Time
+	value                     float64
+	th                        threshold
+	thresholdSource           string
+	outSince                  time.Time
+	anomaly                   string
+	late                      int
+	silenced                  bool
+}
+
+// dataLatencySummary is the latest latency for a site and type.  hasThreshold is false if there is no threshold.
+type dataLatencySummary struct {
+	siteID, typeID                string
+	latitude, longitude           float64
+	pending                       bool
+	scale                         float64
+	t                             time.Time
+	mean, min, max, fifty, ninety float64
+	th                            threshold
+	hasThreshold                  bool
+	outSince                      time.Time
+	anomaly                       string
+	late                          int
+	silenced                      bool
+}
+
+// dataCompletenessSummary is the latest count for a site and type.
+type dataCompletenessSummary struct {
+	siteID, typeID      string
+	latitude, longitude float64
+	pending             bool
+	t                   time.Time
+	count, expected     int
+}
+
+// silence is from mtr.silence.  Empty targets match everything (see silenceMatches).
+type silence struct {
+	id                            int
+	deviceID, siteID, tag, typeID string
+	start, end                    time.Time
+	reason                        string
+}
+
+// alert is from mtr.alert.  end is zero for a firing alert.
+type alert struct {
+	alertKey
+	state      string
+	value      float64
+	start, end time.Time
+}
+
+// alertChange is the changes to the alerts from an evaluation.  Resolved alerts end and started alerts
+// start at the time of the evaluation, and the notifications are queued then.
+type alertChange struct {
+	resolved      []alertKey
+	started       []alert
+	notifications []notification
+}
+
+// storage is the store used by the handlers.  It is set at startup (see server.go) and by the tests.
+var storage store = pgStore{}
+
+// roundInt32 rounds v to the nearest int32 for the integer fields in mtrpb that are kept for older clients.
+func roundInt32(v float64) int32 {
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case v >= math.MaxInt32:
+		return math.MaxInt32
+	case v <= math.MinInt32:
+		return math.MinInt32
+	case v < 0:
+		return int32(math.Ceil(v - 0.5))
+	}
+	return int32(math.Floor(v + 0.5))
+}
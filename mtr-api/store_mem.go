@@ -0,0 +1,1460 @@
+package main
+
+import (
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/mtr/ts"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+memStore is a store that keeps everything in memory.  It is for small deployments that don't need a
+database (MTR_STORE=memory) and for the tests.  Nothing is kept over a restart.  newMemStore adds the same
+types and retention as the DDL for a new database.
+
+Raw values are kept for their retention (see deleteOld) and are aggregated for each resolution when they
+are read, there are no rollups.  The summaries are kept up to date with out_since and anomaly the same as the
+triggers in the database.
+*/
+type memStore struct {
+	mu sync.Mutex
+
+	models  map[string]bool
+	devices map[string]*memLocation        // deviceID
+	sites   map[string]*memLocation        // siteID
+	types   map[string]map[string]*memType // type table (e.g., field.type) to typeID
+	tagIDs  map[string]bool
+
+	field           memMetrics
+	modelThresholds map[memKey]threshold // modelID (as id) and typeID
+	states          memStates
+	latency         memMetrics
+	completeness    memMetrics
+
+	apps      map[string]*memApp
+	promMu    sync.Mutex // serialises promCounterSave while f is called.
+	prom      map[string]memCounter
+	retention map[memKey]int // schema (as id) and typeID to days
+
+	silenceList      []silence
+	lastSilenceID    int
+	alertList        []alert
+	alerting         bool // alertUpdate is running.
+	notificationList []*memNotification
+	lastNotification int64
+}
+
+// memKey is the key for a metric e.g., deviceID and typeID.
+type memKey struct {
+	id, typeID string
+}
+
+// memLocation is a device or site.
+type memLocation struct {
+	modelID             string // devices only.
+	latitude, longitude float64
+	pending             bool
+}
+
+// memType is a row from a type table.  cols has the columns that can be set with typeSave.
+type memType struct {
+	pk   int
+	cols map[string]interface{}
+}
+
+// memMetrics is the values, summaries, and settings for the metrics of a schema e.g., field metrics.
+type memMetrics struct {
+	values     map[memKey]memSeries
+	summaries  map[memKey]*memSummary
+	thresholds map[memKey]threshold
+	lates      map[memKey]int
+	anomalies  map[memKey]anomalyThreshold
+	tags       map[memKey]map[string]bool
+}
+
+// memStates is the field states.  history is in time order.  values are the severity for each value of a state type.
+type memStates struct {
+	current map[memKey]fieldStateChange
+	history map[memKey][]fieldStateChange
+	values  map[string]map[string]int
+	tags    map[memKey]map[string]bool
+}
+
+// memValue is the value at t.  v is the columns e.g., mean, min, max, fifty, ninety for a latency.
+type memValue struct {
+	t time.Time
+	v []float64
+}
+
+// memSeries is the values for a metric in time order.
+type memSeries []memValue
+
+// memBucket is the values in a period.  sum and max are for each column of the values.
+type memBucket struct {
+	t        time.Time
+	n        int
+	sum, max []float64
+}
+
+// memSummary is the latest value for a metric.
+type memSummary struct {
+	memValue
+	outSince time.Time
+	anomaly  string
+}
+
+// memResolution is the period values are aggregated over for each resolution.  Zero for full.
+var memResolution = map[string]time.Duration{
+	"full":         0,
+	"minute":       time.Minute,
+	"five_minutes": time.Minute * 5,
+	"hour":         time.Hour,
+	"day":          time.Hour * 24,
+}
+
+func newMemMetrics() memMetrics {
+	return memMetrics{
+		values:     make(map[memKey]memSeries),
+		summaries:  make(map[memKey]*memSummary),
+		thresholds: make(map[memKey]threshold),
+		lates:      make(map[memKey]int),
+		anomalies:  make(map[memKey]anomalyThreshold),
+		tags:       make(map[memKey]map[string]bool),
+	}
+}
+
+// newMemStore returns an empty memStore with the types and retention that are in a new database.
+func newMemStore() *memStore {
+	m := &memStore{
+		models:  make(map[string]bool),
+		devices: make(map[string]*memLocation),
+		sites:   make(map[string]*memLocation),
+		types:   make(map[string]map[string]*memType),
+		tagIDs:  make(map[string]bool),
+
+		field:           newMemMetrics(),
+		modelThresholds: make(map[memKey]threshold),
+		states: memStates{
+			current: make(map[memKey]fieldStateChange),
+			history: make(map[memKey][]fieldStateChange),
+			values:  make(map[string]map[string]int),
+			tags:    make(map[memKey]map[string]bool),
+		},
+		latency:      newMemMetrics(),
+		completeness: newMemMetrics(),
+
+		apps:      make(map[string]*memApp),
+		prom:      make(map[string]memCounter),
+		retention: make(map[memKey]int),
+	}
+
+	for _, t := range []typeTable{fieldTypeTable, fieldStateTypeTable, dataTypeTable, dataCompletenessTypeTable, appTypeTable} {
+		m.types[t.table] = make(map[string]*memType)
+	}
+
+	for _, t := range []struct {
+		pk                        int
+		typeID, description, unit string
+		scale                     float64
+		display                   string
+		minInterval               int
+	}{
+		{1, "voltage", "voltage", "mV", 0.001, "V", 60},
+		{2, "clock", "clock quality", "%", 1, "%", 60},
+		{3, "satellites", "number of satellites tracked", "n", 1, "n", 60},
+		{4, "conn", "end to end connectivity", "us", 0.001, "ms", 60},
+		{5, "ping", "ping", "us", 0.001, "ms", 60},
+		{6, "disk.hd1", "disk hd1", "%", 1, "%", 600},
+		{7, "disk.hd2", "disk hd2", "%", 1, "%", 600},
+		{8, "disk.hd3", "disk hd3", "%", 1, "%", 600},
+		{9, "disk.hd4", "disk hd4", "%", 1, "%", 600},
+		{10, "centre", "centre", "mV", 1, "mV", 60},
+		{11, "rf.signal", "rf signal", "dB", 1, "db", 60},
+		{12, "rf.noise", "rf signal", "dB", 1, "db", 60},
+	} {
+		m.types["field.type"][t.typeID] = &memType{pk: t.pk, cols: map[string]interface{}{
+			"description": t.description, "unit": t.unit, "scale": t.scale, "display": t.display,
+			"min_interval": t.minInterval, "late": lateDefault,
+		}}
+	}
+
+	m.types["field.state_type"]["mains"] = &memType{pk: 1000, cols: map[string]interface{}{}}
+
+	for _, t := range []struct {
+		pk                  int
+		typeID, description string
+		minInterval         int
+	}{
+		{1, "latency.strong", "latency strong motion data", 60},
+		{2, "latency.weak", "latency weak motion data", 60},
+		{3, "latency.gnss.1hz", "latency GNSS 1Hz data", 10},
+		{4, "latency.tsunami", "latency tsunami data", 60},
+		{5, "latency.files.gnss", "latency files data", 60},
+	} {
+		m.types["data.type"][t.typeID] = &memType{pk: t.pk, cols: map[string]interface{}{
+			"description": t.description, "unit": "ms", "scale": 1.0, "display": "ms",
+			"min_interval": t.minInterval, "late": lateDefault,
+		}}
+	}
+
+	m.types["data.completeness_type"]["completeness.gnss.1hz"] = &memType{pk: 100, cols: map[string]interface{}{
+		"expected": 86400, "min_interval": 60,
+	}}
+
+	for _, t := range []struct {
+		pk                        int
+		typeID, description, unit string
+	}{
+		{1, "Requests", "Requests", "n"},
+		{200, "StatusOK", "OK", "n"},
+		{400, "StatusBadRequest", "Bad Request", "n"},
+		{401, "StatusUnauthorized", "Unauthorized", "n"},
+		{404, "StatusNotFound", "Not Found", "n"},
+		{500, "StatusInternalServerError", "Internal Server Error", "n"},
+		{503, "StatusServiceUnavailable", "Service Unavailable", "n"},
+		{1000, "MemSys", "bytes obtained from system", "bytes"},
+		{1001, "MemHeapAlloc", "bytes allocated and not yet freed", "bytes"},
+		{1002, "MemHeapSys", "bytes obtained from system", "bytes"},
+		{1003, "MemHeapObjects", "total number of allocated objects", "n"},
+		{1100, "Routines", "number of routines that currently exist", "n"},
+		{1201, "MsgRx", "messages received", "n"},
+		{1202, "MsgTx", "messages transmitted", "n"},
+		{1203, "MsgProc", "messages processed", "n"},
+		{1204, "MsgErr", "messages error", "n"},
+		{1300, "Deleted", "rows deleted", "n"},
+	} {
+		m.types["app.type"][t.typeID] = &memType{pk: t.pk, cols: map[string]interface{}{
+			"description": t.description, "unit": t.unit,
+		}}
+	}
+
+	m.retention[memKey{id: "field"}] = 40
+	m.retention[memKey{id: "data"}] = 40
+	m.retention[memKey{id: "app"}] = 28
+
+	return m
+}
+
+func (t *memType) stringCol(name string) string {
+	s, _ := t.cols[name].(string)
+	return s
+}
+
+func (t *memType) floatCol(name string) float64 {
+	switch v := t.cols[name].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	}
+	return 0
+}
+
+func (t *memType) intCol(name string) int {
+	switch v := t.cols[name].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// typeByID returns typeID from the type table.  m.mu must be held.
+func (m *memStore) typeByID(table, typeID string) (*memType, bool) {
+	t, ok := m.types[table][typeID]
+	return t, ok
+}
+
+// fieldExists returns true if the device and field type exist.  m.mu must be held.
+func (m *memStore) fieldExists(deviceID, typeID string) bool {
+	_, okT := m.typeByID("field.type", typeID)
+	_, okD := m.devices[deviceID]
+	return okT && okD
+}
+
+// registerDevice is the same as registerDevice for the DB.  m.mu must be held.
+func (m *memStore) registerDevice(deviceID, typeID string) {
+	if _, ok := m.devices[deviceID]; ok || deviceID == "" {
+		return
+	}
+
+	if _, ok := m.typeByID("field.type", typeID); !ok {
+		return
+	}
+
+	m.models[unknownModel] = true
+	m.devices[deviceID] = &memLocation{modelID: unknownModel, pending: true}
+}
+
+/*
+add adds v at t unless there is already a value in the same min_interval (see rate_limit in the DB), or at t if
+interval is 0.  If it isn't added the value that is already saved is returned with false.
+*/
+func (s memSeries) add(t time.Time, interval int, v []float64) (memSeries, memValue, bool) {
+	i := sort.Search(len(s), func(i int) bool { return !s[i].t.Before(t) })
+
+	// values in the same interval are next to each other.
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(s) {
+			continue
+		}
+
+		if (interval == 0 && s[j].t.Equal(t)) || (interval > 0 && s[j].t.Unix()/int64(interval) == t.Unix()/int64(interval)) {
+			return s, s[j], false
+		}
+	}
+
+	s = append(s, memValue{})
+	copy(s[i+1:], s[i:])
+	s[i] = memValue{t: t, v: v}
+
+	return s, memValue{}, true
+}
+
+// since returns the values at or after t.
+func (s memSeries) since(t time.Time) memSeries {
+	return s[sort.Search(len(s), func(i int) bool { return !s[i].t.Before(t) }):]
+}
+
+// between returns the values from t0 to t1 inclusive.
+func (s memSeries) between(t0, t1 time.Time) memSeries {
+	s = s.since(t0)
+	return s[:sort.Search(len(s), func(i int) bool { return s[i].t.After(t1) })]
+}
+
+// buckets groups the values by the period that they are in.  Each value is a bucket if period is 0.
+func (s memSeries) buckets(period time.Duration) []memBucket {
+	var res []memBucket
+
+	for _, v := range s {
+		t := v.t
+		if period > 0 {
+			t = t.Truncate(period)
+		}
+
+		if period == 0 || len(res) == 0 || !res[len(res)-1].t.Equal(t) {
+			b := memBucket{t: t, n: 1, sum: make([]float64, len(v.v)), max: make([]float64, len(v.v))}
+			copy(b.sum, v.v)
+			copy(b.max, v.v)
+			res = append(res, b)
+			continue
+		}
+
+		b := &res[len(res)-1]
+		b.n++
+		for i, f := range v.v {
+			b.sum[i] += f
+			b.max[i] = math.Max(b.max[i], f)
+		}
+	}
+
+	return res
+}
+
+/*
+aggregate returns the values in timeRange in buckets for resolution.  The same as the rollups in the DB, periods
+longer than a minute are whole and start from the period containing timeRange[0].
+*/
+func (s memSeries) aggregate(resolution string, timeRange []time.Time) ([]memBucket, error) {
+	period, ok := memResolution[resolution]
+	if !ok {
+		return nil, fmt.Errorf("invalid resolution %s", resolution)
+	}
+
+	t0, t1 := timeRange[0], timeRange[1]
+	if period > time.Minute {
+		t0 = t0.Truncate(period)
+		t1 = t1.Truncate(period).Add(period - time.Nanosecond)
+	}
+
+	return s.between(t0, t1).buckets(period), nil
+}
+
+func (b memBucket) mean(i int) float64 {
+	return b.sum[i] / float64(b.n)
+}
+
+// anomaly returns rate or baseline if v at t is an anomaly for a.  It is the same as the summary triggers in the DB.
+func (s memSeries) anomaly(a anomalyThreshold, t time.Time, v float64) string {
+	if a.rate > 0 {
+		// the latest five minute period that starts in the hour before the hour before t.
+		from, to := t.Add(-2*time.Hour), t.Add(-time.Hour)
+		b := s.between(from.Truncate(5*time.Minute), to.Truncate(5*time.Minute).Add(5*time.Minute-time.Nanosecond)).buckets(5 * time.Minute)
+
+		for i := len(b) - 1; i >= 0; i-- {
+			if b[i].t.After(to) || !b[i].t.After(from) {
+				continue
+			}
+
+			if math.Abs(v-b[i].mean(0))*3600/t.Sub(b[i].t).Seconds() > a.rate {
+				return "rate"
+			}
+			break
+		}
+	}
+
+	if a.deviations > 0 {
+		// the mean for the same hour on each of the days before t.
+		var means []float64
+		h := t.Truncate(time.Hour)
+
+		for d := 1; d <= a.days; d++ {
+			t0 := h.Add(time.Duration(-d) * time.Hour * 24)
+			if b := s.between(t0, t0.Add(time.Hour-time.Nanosecond)).buckets(time.Hour); len(b) == 1 {
+				means = append(means, b[0].mean(0))
+			}
+		}
+
+		if len(means) >= 3 {
+			var mean, sd float64
+			for _, f := range means {
+				mean += f
+			}
+			mean = mean / float64(len(means))
+
+			for _, f := range means {
+				sd += (f - mean) * (f - mean)
+			}
+			sd = math.Sqrt(sd / float64(len(means)-1))
+
+			if sd > 0 && math.Abs(v-mean) > a.deviations*sd {
+				return "baseline"
+			}
+		}
+	}
+
+	return ""
+}
+
+/*
+summarise updates the summary for k if t is newer.  out_since is set when the first column of v goes outside
+th and cleared when it is back inside th by the hysteresis, or if th is nil.  The anomaly is checked if there is
+an anomaly threshold for k.  The same as the summary triggers in the DB.
+*/
+func (mm memMetrics) summarise(k memKey, t time.Time, v []float64, th *threshold) {
+	old, ok := mm.summaries[k]
+	if ok && !old.t.Before(t) {
+		return
+	}
+
+	s := &memSummary{memValue: memValue{t: t, v: v}}
+	if ok {
+		s.outSince = old.outSince
+	}
+
+	switch {
+	case th == nil || (v[0] >= th.lower+th.hysteresis && v[0] <= th.upper-th.hysteresis):
+		s.outSince = time.Time{}
+	case v[0] < th.lower || v[0] > th.upper:
+		if s.outSince.IsZero() {
+			s.outSince = t
+		}
+	}
+
+	if a, ok := mm.anomalies[k]; ok {
+		s.anomaly = mm.values[k].anomaly(a, t, v[0])
+	}
+
+	mm.summaries[k] = s
+}
+
+// deleteIf deletes the values, summaries, settings, and tags for the keys that f returns true for.
+func (mm memMetrics) deleteIf(f func(k memKey) bool) {
+	for k := range mm.values {
+		if f(k) {
+			delete(mm.values, k)
+		}
+	}
+	for k := range mm.summaries {
+		if f(k) {
+			delete(mm.summaries, k)
+		}
+	}
+	for k := range mm.thresholds {
+		if f(k) {
+			delete(mm.thresholds, k)
+		}
+	}
+	for k := range mm.lates {
+		if f(k) {
+			delete(mm.lates, k)
+		}
+	}
+	for k := range mm.anomalies {
+		if f(k) {
+			delete(mm.anomalies, k)
+		}
+	}
+	for k := range mm.tags {
+		if f(k) {
+			delete(mm.tags, k)
+		}
+	}
+}
+
+// hasType returns true if there are values or summaries for typeID.
+func (mm memMetrics) hasType(typeID string) bool {
+	for k := range mm.values {
+		if k.typeID == typeID {
+			return true
+		}
+	}
+	for k := range mm.summaries {
+		if k.typeID == typeID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s memStates) deleteIf(f func(k memKey) bool) {
+	for k := range s.current {
+		if f(k) {
+			delete(s.current, k)
+		}
+	}
+	for k := range s.history {
+		if f(k) {
+			delete(s.history, k)
+		}
+	}
+	for k := range s.tags {
+		if f(k) {
+			delete(s.tags, k)
+		}
+	}
+}
+
+// memTagAdd adds tag to k in tags.
+func memTagAdd(tags map[memKey]map[string]bool, k memKey, tag string) {
+	if tags[k] == nil {
+		tags[k] = make(map[string]bool)
+	}
+
+	tags[k][tag] = true
+}
+
+// memTag is a tag on a metric.
+type memTag struct {
+	memKey
+	tag string
+}
+
+// memTagList returns the tags on k, or on all metrics if k is empty, sorted by tag then id then typeID.
+func memTagList(tags map[memKey]map[string]bool, k memKey) []memTag {
+	var res memTagsByTag
+
+	for key, v := range tags {
+		if k != (memKey{}) && key != k {
+			continue
+		}
+
+		for tag := range v {
+			res = append(res, memTag{memKey: key, tag: tag})
+		}
+	}
+
+	sort.Sort(res)
+
+	return res
+}
+
+// memTagNames returns the tags on k in tags.
+func memTagNames(tags map[memKey]map[string]bool, k memKey) []string {
+	var res []string
+
+	for tag := range tags[k] {
+		res = append(res, tag)
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+// silenced returns true if an active silence at now matches (see silenceMatches).  m.mu must be held.
+func (m *memStore) silenced(now time.Time, deviceID, siteID, typeID string, tags []string) bool {
+	for _, s := range m.silenceList {
+		if silenceMatches(s, now, deviceID, siteID, typeID, tags) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *memStore) fieldModelSave(modelID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.models[modelID] = true
+
+	return nil
+}
+
+func (m *memStore) fieldModelDelete(modelID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for deviceID, d := range m.devices {
+		if d.modelID == modelID {
+			m.deleteDevice(deviceID)
+		}
+	}
+
+	for k := range m.modelThresholds {
+		if k.id == modelID {
+			delete(m.modelThresholds, k)
+		}
+	}
+
+	delete(m.models, modelID)
+
+	return nil
+}
+
+func (m *memStore) fieldModels() ([]*mtrpb.FieldModel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []string
+	for k := range m.models {
+		ids = append(ids, k)
+	}
+
+	sort.Strings(ids)
+
+	var res []*mtrpb.FieldModel
+
+	for _, id := range ids {
+		res = append(res, &mtrpb.FieldModel{ModelID: id})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) fieldDeviceSave(deviceID, modelID string, latitude, longitude float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.models[modelID] {
+		return errNotFound
+	}
+
+	m.devices[deviceID] = &memLocation{modelID: modelID, latitude: latitude, longitude: longitude}
+
+	return nil
+}
+
+func (m *memStore) fieldDeviceDelete(deviceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteDevice(deviceID)
+
+	return nil
+}
+
+// deleteDevice deletes the device and everything for it.  m.mu must be held.
+func (m *memStore) deleteDevice(deviceID string) {
+	f := func(k memKey) bool { return k.id == deviceID }
+
+	m.field.deleteIf(f)
+	m.states.deleteIf(f)
+
+	delete(m.devices, deviceID)
+}
+
+func (m *memStore) fieldDevices(pending bool) ([]*mtrpb.FieldDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []string
+	for k, d := range m.devices {
+		if !pending || d.pending {
+			ids = append(ids, k)
+		}
+	}
+
+	sort.Strings(ids)
+
+	var res []*mtrpb.FieldDevice
+
+	for _, id := range ids {
+		d := m.devices[id]
+		res = append(res, &mtrpb.FieldDevice{
+			DeviceID:  id,
+			ModelID:   d.modelID,
+			Latitude:  float32(d.latitude),
+			Longitude: float32(d.longitude),
+			Pending:   d.pending,
+		})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) fieldTypeByID(typeID string) (fieldType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.typeByID("field.type", typeID)
+	if !ok {
+		return fieldType{typeID: typeID}, errNotFound
+	}
+
+	return fieldType{
+		typeID:      typeID,
+		scale:       t.floatCol("scale"),
+		display:     t.stringCol("display"),
+		minInterval: t.intCol("min_interval"),
+	}, nil
+}
+
+func (m *memStore) fieldDeviceModel(deviceID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.devices[deviceID]
+	if !ok {
+		return "", errNotFound
+	}
+
+	return d.modelID, nil
+}
+
+func (m *memStore) fieldMetricSave(deviceID, typeID string, t time.Time, value float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if autoRegister {
+		m.registerDevice(deviceID, typeID)
+	}
+
+	if _, err := m.fieldMetricAdd(deviceID, typeID, t.UTC(), value); err != nil {
+		return err
+	}
+
+	m.fieldSummarise(memKey{id: deviceID, typeID: typeID}, t.UTC(), value)
+
+	return nil
+}
+
+/*
+fieldMetricAdd adds a value.  It returns errNotFound if the device or type don't exist and errRateLimit, with the
+value that is already saved, if there is already a value for the min_interval.  m.mu must be held.
+*/
+func (m *memStore) fieldMetricAdd(deviceID, typeID string, t time.Time, value float64) (memValue, error) {
+	if !m.fieldExists(deviceID, typeID) {
+		return memValue{}, errNotFound
+	}
+
+	k := memKey{id: deviceID, typeID: typeID}
+
+	s, old, ok := m.field.values[k].add(t, m.types["field.type"][typeID].intCol("min_interval"), []float64{value})
+	if !ok {
+		return old, errRateLimit
+	}
+
+	m.field.values[k] = s
+
+	return memValue{}, nil
+}
+
+// fieldSummarise updates the summary for k with the device or model threshold.  m.mu must be held.
+func (m *memStore) fieldSummarise(k memKey, t time.Time, value float64) {
+	var th *threshold
+	if f, _, ok := m.fieldTh(k.id, k.typeID); ok {
+		th = &f
+	}
+
+	m.field.summarise(k, t, []float64{value}, th)
+}
+
+func (m *memStore) fieldMetricBatchSave(in []*mtrpb.FieldMetricBatchValue, backfill bool) ([]*mtrpb.BatchStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := make([]*mtrpb.BatchStatus, len(in))
+	latest := make(map[memKey]int) // index in in of the newest value.
+
+	for i, v := range in {
+		if autoRegister {
+			m.registerDevice(v.DeviceID, v.TypeID)
+		}
+
+		t := time.Unix(v.Seconds, 0).UTC()
+		value := batchValue(v)
+
+		old, err := m.fieldMetricAdd(v.DeviceID, v.TypeID, t, value)
+		switch {
+		case err == errNotFound:
+			status[i] = &mtrpb.BatchStatus{Code: http.StatusBadRequest, Msg: "Didn't create row, check your query parameters exist"}
+			continue
+		case err == errRateLimit && !(backfill && old.t.Equal(t) && old.v[0] == value):
+			status[i] = &mtrpb.BatchStatus{Code: int32(statusTooManyRequests.Code), Msg: statusTooManyRequests.Msg}
+			continue
+		}
+
+		status[i] = &mtrpb.BatchStatus{Code: http.StatusOK}
+
+		k := memKey{id: v.DeviceID, typeID: v.TypeID}
+		if l, ok := latest[k]; !ok || v.Seconds > in[l].Seconds {
+			latest[k] = i
+		}
+	}
+
+	for k, i := range latest {
+		m.fieldSummarise(k, time.Unix(in[i].Seconds, 0).UTC(), batchValue(in[i]))
+	}
+
+	return status, nil
+}
+
+func (m *memStore) fieldMetricDelete(deviceID, typeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := memKey{id: deviceID, typeID: typeID}
+	m.field.deleteIf(func(key memKey) bool { return key == k })
+
+	return nil
+}
+
+func (m *memStore) fieldMetrics(deviceID, typeID, resolution string, timeRange []time.Time) ([]ts.Point, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.fieldExists(deviceID, typeID) {
+		return nil, errNotFound
+	}
+
+	b, err := m.field.values[memKey{id: deviceID, typeID: typeID}].aggregate(resolution, timeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var pts []ts.Point
+
+	for _, v := range b {
+		pts = append(pts, ts.Point{DateTime: v.t, Value: v.mean(0)})
+	}
+
+	return pts, nil
+}
+
+func (m *memStore) fieldMetricLatest(deviceID, typeID string) (ts.Point, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.field.values[memKey{id: deviceID, typeID: typeID}]
+	if len(s) == 0 {
+		return ts.Point{}, errNotFound
+	}
+
+	return ts.Point{DateTime: s[len(s)-1].t, Value: s[len(s)-1].v[0]}, nil
+}
+
+// fieldTh returns the threshold for the device or its model, and the source.  m.mu must be held.
+func (m *memStore) fieldTh(deviceID, typeID string) (threshold, string, bool) {
+	if th, ok := m.field.thresholds[memKey{id: deviceID, typeID: typeID}]; ok {
+		return th, thresholdDevice, true
+	}
+
+	if d, ok := m.devices[deviceID]; ok {
+		if th, ok := m.modelThresholds[memKey{id: d.modelID, typeID: typeID}]; ok {
+			return th, thresholdModel, true
+		}
+	}
+
+	return threshold{}, "", false
+}
+
+func (m *memStore) fieldThreshold(deviceID, typeID string) (float64, float64, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	th, source, _ := m.fieldTh(deviceID, typeID)
+
+	return th.lower, th.upper, source, nil
+}
+
+func (m *memStore) fieldThresholdSave(deviceID, typeID string, th threshold) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.fieldExists(deviceID, typeID) {
+		return errNotFound
+	}
+
+	m.field.thresholds[memKey{id: deviceID, typeID: typeID}] = th
+
+	return nil
+}
+
+func (m *memStore) fieldThresholdDelete(deviceID, typeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.field.thresholds, memKey{id: deviceID, typeID: typeID})
+
+	return nil
+}
+
+func (m *memStore) fieldThresholds() ([]*mtrpb.FieldMetricThreshold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.FieldMetricThreshold
+
+	for _, k := range memSortedKeys(m.field.thresholds) {
+		v := m.field.thresholds[k]
+		res = append(res, &mtrpb.FieldMetricThreshold{
+			DeviceID:    k.id,
+			TypeID:      k.typeID,
+			Lower:       roundInt32(v.lower),
+			Upper:       roundInt32(v.upper),
+			Scale:       m.types["field.type"][k.typeID].floatCol("scale"),
+			LowerDouble: v.lower,
+			UpperDouble: v.upper,
+			ForSeconds:  int32(v.forSeconds),
+			Hysteresis:  v.hysteresis,
+		})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) fieldModelThresholdSave(modelID, typeID string, th threshold) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.typeByID("field.type", typeID); !ok || !m.models[modelID] {
+		return errNotFound
+	}
+
+	m.modelThresholds[memKey{id: modelID, typeID: typeID}] = th
+
+	return nil
+}
+
+func (m *memStore) fieldModelThresholdDelete(modelID, typeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.modelThresholds, memKey{id: modelID, typeID: typeID})
+
+	return nil
+}
+
+func (m *memStore) fieldModelThresholds() ([]*mtrpb.FieldModelThreshold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.FieldModelThreshold
+
+	for _, k := range memSortedKeys(m.modelThresholds) {
+		v := m.modelThresholds[k]
+		res = append(res, &mtrpb.FieldModelThreshold{
+			ModelID:    k.id,
+			TypeID:     k.typeID,
+			Lower:      v.lower,
+			Upper:      v.upper,
+			Scale:      m.types["field.type"][k.typeID].floatCol("scale"),
+			ForSeconds: int32(v.forSeconds),
+			Hysteresis: v.hysteresis,
+		})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) fieldMetricLateSave(deviceID, typeID string, late int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.fieldExists(deviceID, typeID) {
+		return errNotFound
+	}
+
+	m.field.lates[memKey{id: deviceID, typeID: typeID}] = late
+
+	return nil
+}
+
+func (m *memStore) fieldMetricLateDelete(deviceID, typeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.field.lates, memKey{id: deviceID, typeID: typeID})
+
+	return nil
+}
+
+func (m *memStore) fieldMetricLates() ([]*mtrpb.FieldMetricLate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.FieldMetricLate
+
+	for _, k := range memSortedKeys(m.field.lates) {
+		res = append(res, &mtrpb.FieldMetricLate{DeviceID: k.id, TypeID: k.typeID, Late: int32(m.field.lates[k])})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) fieldMetricAnomalySave(deviceID, typeID string, a anomalyThreshold) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.fieldExists(deviceID, typeID) {
+		return errNotFound
+	}
+
+	m.field.anomalies[memKey{id: deviceID, typeID: typeID}] = a
+
+	return nil
+}
+
+func (m *memStore) fieldMetricAnomalyDelete(deviceID, typeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.field.anomalies, memKey{id: deviceID, typeID: typeID})
+
+	return nil
+}
+
+func (m *memStore) fieldMetricAnomalies() ([]*mtrpb.FieldMetricAnomaly, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.FieldMetricAnomaly
+
+	for _, k := range memSortedKeys(m.field.anomalies) {
+		a := m.field.anomalies[k]
+		res = append(res, &mtrpb.FieldMetricAnomaly{
+			DeviceID:   k.id,
+			TypeID:     k.typeID,
+			Rate:       a.rate,
+			Deviations: a.deviations,
+			Days:       int32(a.days),
+		})
+	}
+
+	return res, nil
+}
+
+// stateExists returns true if the device and state type exist.  m.mu must be held.
+func (m *memStore) stateExists(deviceID, typeID string) bool {
+	_, okT := m.typeByID("field.state_type", typeID)
+	_, okD := m.devices[deviceID]
+	return okT && okD
+}
+
+// severity is the same as fieldStateSeverity.  m.mu must be held.
+func (m *memStore) severity(typeID string, c fieldStateChange) int32 {
+	if s, ok := m.states.values[typeID][c.state]; ok && c.state != "" {
+		return int32(s)
+	}
+
+	if c.value {
+		return 0
+	}
+
+	return 2
+}
+
+func (m *memStore) fieldStateSave(deviceID, typeID string, t time.Time, value bool, state string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.stateExists(deviceID, typeID) {
+		return errNotFound
+	}
+
+	k := memKey{id: deviceID, typeID: typeID}
+	c := fieldStateChange{t: t.UTC(), value: value, state: state}
+
+	m.states.current[k] = c
+	m.states.history[k] = memStateHistoryAdd(m.states.history[k], c)
+
+	return nil
+}
+
+/*
+memStateHistoryAdd adds c to h if it is a change from the state at c.t then removes the rows at and after c.t
+that are no longer a change from the row before them.  The same as fieldStateHistorySave.
+*/
+func memStateHistoryAdd(h []fieldStateChange, c fieldStateChange) []fieldStateChange {
+	same := func(a, b fieldStateChange) bool { return a.value == b.value && a.state == b.state }
+
+	// h[i-1] is the state at c.t
+	i := sort.Search(len(h), func(i int) bool { return h[i].t.After(c.t) })
+
+	switch {
+	case i > 0 && same(h[i-1], c):
+		return h
+	case i > 0 && h[i-1].t.Equal(c.t):
+		i--
+		h[i] = c
+	default:
+		h = append(h, fieldStateChange{})
+		copy(h[i+1:], h[i:])
+		h[i] = c
+	}
+
+	// the row after c.
+	j := i + 1
+
+	if i > 0 && same(h[i-1], h[i]) {
+		h = append(h[:i], h[i+1:]...)
+		j = i
+	}
+
+	if j > 0 && j < len(h) && same(h[j-1], h[j]) {
+		h = append(h[:j], h[j+1:]...)
+	}
+
+	return h
+}
+
+func (m *memStore) fieldStateDelete(deviceID, typeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := memKey{id: deviceID, typeID: typeID}
+
+	delete(m.states.current, k)
+	delete(m.states.history, k)
+
+	return nil
+}
+
+func (m *memStore) fieldStates() ([]*mtrpb.FieldState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.FieldState
+
+	for _, k := range memSortedKeys(m.states.current) {
+		c := m.states.current[k]
+		res = append(res, &mtrpb.FieldState{
+			DeviceID: k.id,
+			TypeID:   k.typeID,
+			Seconds:  c.t.Unix(),
+			Value:    c.value,
+			State:    c.state,
+			Severity: m.severity(k.typeID, c),
+		})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) fieldStateHistory(deviceID, typeID string, timeRange []time.Time) (*fieldStateChange, []fieldStateChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.stateExists(deviceID, typeID) {
+		return nil, nil, errNotFound
+	}
+
+	var initial *fieldStateChange
+	var changes []fieldStateChange
+
+	for _, c := range m.states.history[memKey{id: deviceID, typeID: typeID}] {
+		c.severity = m.severity(typeID, c)
+
+		switch {
+		case c.t.Before(timeRange[0]):
+			i := c
+			i.t = timeRange[0]
+			initial = &i
+		case !c.t.After(timeRange[1]):
+			changes = append(changes, c)
+		}
+	}
+
+	return initial, changes, nil
+}
+
+func (m *memStore) fieldStateValueSave(typeID, value string, severity int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.typeByID("field.state_type", typeID); !ok {
+		return errNotFound
+	}
+
+	if m.states.values[typeID] == nil {
+		m.states.values[typeID] = make(map[string]int)
+	}
+
+	m.states.values[typeID][value] = severity
+
+	return nil
+}
+
+func (m *memStore) fieldStateValueDelete(typeID, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, c := range m.states.current {
+		if k.typeID == typeID && c.state == value {
+			return errInUse
+		}
+	}
+
+	delete(m.states.values[typeID], value)
+
+	return nil
+}
+
+func (m *memStore) fieldStateValues(typeID string) ([]*mtrpb.FieldStateValue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys memKeys
+
+	for t, v := range m.states.values {
+		if typeID != "" && t != typeID {
+			continue
+		}
+
+		for value := range v {
+			keys = append(keys, memKey{id: t, typeID: value})
+		}
+	}
+
+	sort.Sort(keys)
+
+	var res []*mtrpb.FieldStateValue
+
+	for _, k := range keys {
+		res = append(res, &mtrpb.FieldStateValue{TypeID: k.id, Value: k.typeID, Severity: int32(m.states.values[k.id][k.typeID])})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) fieldStateTagSave(deviceID, typeID, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.stateExists(deviceID, typeID) || !m.tagIDs[tag] {
+		return errNotFound
+	}
+
+	memTagAdd(m.states.tags, memKey{id: deviceID, typeID: typeID}, tag)
+
+	return nil
+}
+
+func (m *memStore) fieldStateTagDelete(deviceID, typeID, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.states.tags[memKey{id: deviceID, typeID: typeID}], tag)
+
+	return nil
+}
+
+func (m *memStore) fieldStateTags() ([]*mtrpb.FieldStateTag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.FieldStateTag
+
+	for _, t := range memTagList(m.states.tags, memKey{}) {
+		res = append(res, &mtrpb.FieldStateTag{DeviceID: t.id, TypeID: t.typeID, Tag: t.tag})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) tagSave(tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tagIDs[tag] = true
+
+	return nil
+}
+
+func (m *memStore) tags() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []string
+
+	for tag := range m.tagIDs {
+		res = append(res, tag)
+	}
+
+	sort.Strings(res)
+
+	return res, nil
+}
+
+func (m *memStore) tagDelete(tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.tagIDs, tag)
+
+	for _, tags := range []map[memKey]map[string]bool{m.field.tags, m.states.tags, m.latency.tags, m.completeness.tags} {
+		for _, v := range tags {
+			delete(v, tag)
+		}
+	}
+
+	return nil
+}
+
+func (m *memStore) fieldMetricTagSave(deviceID, typeID, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.fieldExists(deviceID, typeID) || !m.tagIDs[tag] {
+		return errNotFound
+	}
+
+	memTagAdd(m.field.tags, memKey{id: deviceID, typeID: typeID}, tag)
+
+	return nil
+}
+
+func (m *memStore) fieldMetricTagDelete(deviceID, typeID, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.field.tags[memKey{id: deviceID, typeID: typeID}], tag)
+
+	return nil
+}
+
+func (m *memStore) fieldMetricTags(deviceID, typeID string) ([]*mtrpb.FieldMetricTag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.FieldMetricTag
+
+	for _, t := range memTagList(m.field.tags, memKey{id: deviceID, typeID: typeID}) {
+		res = append(res, &mtrpb.FieldMetricTag{DeviceID: t.id, TypeID: t.typeID, Tag: t.tag})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) fieldSummaries(typeID string) ([]fieldSummary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	var res []fieldSummary
+
+	for _, k := range memSortedKeys(m.field.summaries) {
+		if typeID != "" && k.typeID != typeID {
+			continue
+		}
+
+		s := m.field.summaries[k]
+		d := m.devices[k.id]
+		t := m.types["field.type"][k.typeID]
+
+		f := fieldSummary{
+			deviceID:  k.id,
+			modelID:   d.modelID,
+			typeID:    k.typeID,
+			latitude:  d.latitude,
+			longitude: d.longitude,
+			pending:   d.pending,
+			scale:     t.floatCol("scale"),
+			t:         s.t,
+			value:     s.v[0],
+			outSince:  s.outSince,
+			anomaly:   s.anomaly,
+			late:      t.intCol("late"),
+			silenced:  m.silenced(now, k.id, "", k.typeID, memTagNames(m.field.tags, k)),
+		}
+
+		f.th, f.thresholdSource, _ = m.fieldTh(k.id, k.typeID)
+
+		if l, ok := m.field.lates[k]; ok {
+			f.late = l
+		}
+
+		res = append(res, f)
+	}
+
+	return res, nil
+}
+
+// memKeys sorts by id then typeID.
+type memKeys []memKey
+
+func (k memKeys) Len() int      { return len(k) }
+func (k memKeys) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k memKeys) Less(i, j int) bool {
+	if k[i].id != k[j].id {
+		return k[i].id < k[j].id
+	}
+	return k[i].typeID < k[j].typeID
+}
+
+/*
+memSortedKeys returns the keys of m, which must be a map with memKey keys, sorted by id then typeID.
+The maps in memStore iterate in a random order and the results from the store should not.
+*/
+func memSortedKeys(m interface{}) []memKey {
+	var keys memKeys
+
+	switch v := m.(type) {
+	case map[memKey]threshold:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[memKey]int:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[memKey]anomalyThreshold:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[memKey]*memSummary:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[memKey]fieldStateChange:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	default:
+		panic(fmt.Sprintf("memSortedKeys: unsupported map %T", m))
+	}
+
+	sort.Sort(keys)
+
+	return keys
+}
+
+// memTagsByTag sorts by tag then id then typeID.
+type memTagsByTag []memTag
+
+func (t memTagsByTag) Len() int      { return len(t) }
+func (t memTagsByTag) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t memTagsByTag) Less(i, j int) bool {
+	if t[i].tag != t[j].tag {
+		return t[i].tag < t[j].tag
+	}
+	return memKeys{t[i].memKey, t[j].memKey}.Less(0, 1)
+}
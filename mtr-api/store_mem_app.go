@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// memApp is the values for an application.
+type memApp struct {
+	metrics  map[memAppKey]memSeries // value
+	counters map[memAppKey]memSeries // count
+	timers   map[memAppKey]memSeries // average, fifty, ninety, count
+}
+
+// memAppKey is the key for app values.  sourceID is only used for timers and typePK for metrics and counters.
+type memAppKey struct {
+	instanceID, sourceID string
+	typePK               int
+}
+
+// memCounter is the last value of a Prometheus counter series.
+type memCounter struct {
+	value float64
+	seen  time.Time
+}
+
+// errDuplicate is returned when saving an app value that is already saved for the time.
+var errDuplicate = errors.New("duplicate value for the time")
+
+func (m *memStore) appIDs() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []string
+
+	for k := range m.apps {
+		res = append(res, k)
+	}
+
+	sort.Strings(res)
+
+	return res, nil
+}
+
+// appTypeByPK returns true if there is an app.type with typePK.  m.mu must be held.
+func (m *memStore) appTypeByPK(typePK int) bool {
+	for _, t := range m.types["app.type"] {
+		if t.pk == typePK {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *memStore) appTypePK(typeID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.typeByID("app.type", typeID)
+	if !ok {
+		return 0, errNotFound
+	}
+
+	return t.pk, nil
+}
+
+// app returns the application, adding it if needed.  m.mu must be held.
+func (m *memStore) app(applicationID string) *memApp {
+	a, ok := m.apps[applicationID]
+	if !ok {
+		a = &memApp{
+			metrics:  make(map[memAppKey]memSeries),
+			counters: make(map[memAppKey]memSeries),
+			timers:   make(map[memAppKey]memSeries),
+		}
+		m.apps[applicationID] = a
+	}
+
+	return a
+}
+
+// appAdd adds v at t to values.  It returns errDuplicate if there is already a value at t.  m.mu must be held.
+func appAdd(values map[memAppKey]memSeries, k memAppKey, t time.Time, v []float64) error {
+	s, _, ok := values[k].add(t.UTC(), 0, v)
+	if !ok {
+		return errDuplicate
+	}
+
+	values[k] = s
+
+	return nil
+}
+
+func (m *memStore) appMetricSave(applicationID, instanceID string, typePK int, t time.Time, value int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a := m.app(applicationID)
+
+	if !m.appTypeByPK(typePK) {
+		return fmt.Errorf("unknown typePK %d", typePK)
+	}
+
+	return appAdd(a.metrics, memAppKey{instanceID: instanceID, typePK: typePK}, t, []float64{float64(value)})
+}
+
+func (m *memStore) appCounterSave(applicationID, instanceID string, typePK int, t time.Time, count int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a := m.app(applicationID)
+
+	if !m.appTypeByPK(typePK) {
+		return fmt.Errorf("unknown typePK %d", typePK)
+	}
+
+	return appAdd(a.counters, memAppKey{instanceID: instanceID, typePK: typePK}, t, []float64{float64(count)})
+}
+
+func (m *memStore) appTimerSave(applicationID, instanceID, sourceID string, t time.Time, count, average, fifty, ninety int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return appAdd(m.app(applicationID).timers, memAppKey{instanceID: instanceID, sourceID: sourceID}, t,
+		[]float64{float64(average), float64(fifty), float64(ninety), float64(count)})
+}
+
+func (m *memStore) appMetrics(applicationID string, typePKs []int, resolution string, timeRange []time.Time) ([]appMetricValue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.apps[applicationID]
+	if !ok {
+		return nil, errNotFound
+	}
+
+	pks := make(map[int]bool)
+
+	for _, pk := range typePKs {
+		if !m.appTypeByPK(pk) {
+			return nil, errNotFound
+		}
+		pks[pk] = true
+	}
+
+	var res memAppMetrics
+
+	for k, s := range a.metrics {
+		if !pks[k.typePK] {
+			continue
+		}
+
+		b, err := s.aggregate(resolution, timeRange)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range b {
+			res = append(res, appMetricValue{instanceID: k.instanceID, typePK: k.typePK, t: v.t, value: v.mean(0)})
+		}
+	}
+
+	sort.Sort(res)
+
+	return res, nil
+}
+
+func (m *memStore) appCounters(applicationID, resolution string, timeRange []time.Time) ([]appCounter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	period, ok := memResolution[resolution]
+	if !ok || resolution == "day" {
+		return nil, fmt.Errorf("invalid resolution: %s", resolution)
+	}
+
+	var a memApp
+	if v, ok := m.apps[applicationID]; ok {
+		a = *v
+	}
+
+	// the counts for all instances are summed for each type.
+	type key struct {
+		typePK int
+		t      int64
+	}
+
+	sums := make(map[key]int)
+	var res memAppCounters
+
+	for k, s := range a.counters {
+		for _, v := range s.between(timeRange[0], timeRange[1]).buckets(period) {
+			if period == 0 {
+				res = append(res, appCounter{typePK: k.typePK, t: v.t, count: int(v.sum[0])})
+				continue
+			}
+			sums[key{typePK: k.typePK, t: v.t.UnixNano()}] += int(v.sum[0])
+		}
+	}
+
+	for k, v := range sums {
+		res = append(res, appCounter{typePK: k.typePK, t: time.Unix(0, k.t).UTC(), count: v})
+	}
+
+	sort.Sort(res)
+
+	return res, nil
+}
+
+func (m *memStore) appTimers(applicationID, sourceID, resolution string, timeRange []time.Time) ([]appTimer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	period, ok := memResolution[resolution]
+	if !ok || resolution == "day" {
+		return nil, fmt.Errorf("invalid resolution: %s", resolution)
+	}
+
+	var a memApp
+	if v, ok := m.apps[applicationID]; ok {
+		a = *v
+	}
+
+	// the timers for all instances are combined for each source.
+	bySource := make(map[string]memSeries)
+
+	for k, s := range a.timers {
+		if sourceID != "" && k.sourceID != sourceID {
+			continue
+		}
+
+		for _, v := range s.between(timeRange[0], timeRange[1]) {
+			bySource[k.sourceID] = append(bySource[k.sourceID], v)
+		}
+	}
+
+	var res memAppTimers
+
+	for id, s := range bySource {
+		sort.Sort(memByTime(s))
+
+		for _, v := range s.buckets(period) {
+			res = append(res, appTimer{
+				sourceID: id,
+				t:        v.t,
+				average:  v.mean(0),
+				fifty:    int(v.max[1]),
+				ninety:   int(v.max[2]),
+				count:    int(v.sum[3]),
+			})
+		}
+	}
+
+	sort.Sort(res)
+
+	return res, nil
+}
+
+func (m *memStore) promCounterSave(series string, n float64, now time.Time, f func(last float64) error) error {
+	m.promMu.Lock()
+	defer m.promMu.Unlock()
+
+	m.mu.Lock()
+	c, ok := m.prom[series]
+	if !ok {
+		m.prom[series] = memCounter{value: n, seen: now}
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	// f saves the increase through the store so m.mu can't be held.
+	err := f(c.value)
+	if err != nil {
+		n = c.value
+	}
+
+	m.mu.Lock()
+	m.prom[series] = memCounter{value: n, seen: now}
+	m.mu.Unlock()
+
+	return err
+}
+
+func (m *memStore) promCountersExpire(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, v := range m.prom {
+		if v.seen.Before(before) {
+			delete(m.prom, k)
+		}
+	}
+
+	return nil
+}
+
+func (m *memStore) ping() error {
+	return nil
+}
+
+// memByTime sorts values by time.
+type memByTime memSeries
+
+func (s memByTime) Len() int           { return len(s) }
+func (s memByTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s memByTime) Less(i, j int) bool { return s[i].t.Before(s[j].t) }
+
+// memAppMetrics sorts by time then instanceID then typePK.
+type memAppMetrics []appMetricValue
+
+func (a memAppMetrics) Len() int      { return len(a) }
+func (a memAppMetrics) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a memAppMetrics) Less(i, j int) bool {
+	switch {
+	case !a[i].t.Equal(a[j].t):
+		return a[i].t.Before(a[j].t)
+	case a[i].instanceID != a[j].instanceID:
+		return a[i].instanceID < a[j].instanceID
+	}
+	return a[i].typePK < a[j].typePK
+}
+
+// memAppCounters sorts by time then typePK.
+type memAppCounters []appCounter
+
+func (a memAppCounters) Len() int      { return len(a) }
+func (a memAppCounters) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a memAppCounters) Less(i, j int) bool {
+	if !a[i].t.Equal(a[j].t) {
+		return a[i].t.Before(a[j].t)
+	}
+	return a[i].typePK < a[j].typePK
+}
+
+// memAppTimers sorts by time then sourceID.
+type memAppTimers []appTimer
+
+func (a memAppTimers) Len() int      { return len(a) }
+func (a memAppTimers) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a memAppTimers) Less(i, j int) bool {
+	if !a[i].t.Equal(a[j].t) {
+		return a[i].t.Before(a[j].t)
+	}
+	return a[i].sourceID < a[j].sourceID
+}
@@ -0,0 +1,663 @@
+package main
+
+import (
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/mtr/ts"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// registerSite is the same as registerSite for the DB.  m.mu must be held.
+func (m *memStore) registerSite(siteID, typeTable, typeID string) {
+	if _, ok := m.sites[siteID]; ok || siteID == "" {
+		return
+	}
+
+	if _, ok := m.typeByID(typeTable, typeID); !ok {
+		return
+	}
+
+	m.sites[siteID] = &memLocation{pending: true}
+}
+
+// dataExists returns true if the site and typeID in typeTable exist.  m.mu must be held.
+func (m *memStore) dataExists(siteID, typeTable, typeID string) bool {
+	_, okT := m.typeByID(typeTable, typeID)
+	_, okS := m.sites[siteID]
+	return okT && okS
+}
+
+func (m *memStore) dataSiteSave(siteID string, latitude, longitude float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sites[siteID] = &memLocation{latitude: latitude, longitude: longitude}
+
+	return nil
+}
+
+func (m *memStore) dataSiteDelete(siteID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := func(k memKey) bool { return k.id == siteID }
+
+	m.latency.deleteIf(f)
+	m.completeness.deleteIf(f)
+
+	delete(m.sites, siteID)
+
+	return nil
+}
+
+func (m *memStore) dataSites(pending bool) ([]*mtrpb.DataSite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []string
+	for k, s := range m.sites {
+		if !pending || s.pending {
+			ids = append(ids, k)
+		}
+	}
+
+	sort.Strings(ids)
+
+	var res []*mtrpb.DataSite
+
+	for _, id := range ids {
+		s := m.sites[id]
+		res = append(res, &mtrpb.DataSite{SiteID: id, Latitude: s.latitude, Longitude: s.longitude, Pending: s.pending})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) dataLatencyThresholdSave(siteID, typeID string, th threshold) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dataExists(siteID, "data.type", typeID) {
+		return errNotFound
+	}
+
+	m.latency.thresholds[memKey{id: siteID, typeID: typeID}] = th
+
+	return nil
+}
+
+func (m *memStore) dataLatencyThresholdDelete(siteID, typeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.latency.thresholds, memKey{id: siteID, typeID: typeID})
+
+	return nil
+}
+
+func (m *memStore) dataLatencyThresholds(siteID, typeID string) ([]*mtrpb.DataLatencyThreshold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.DataLatencyThreshold
+
+	for _, k := range memSortedKeys(m.latency.thresholds) {
+		if (siteID != "" && k.id != siteID) || (typeID != "" && k.typeID != typeID) {
+			continue
+		}
+
+		th := m.latency.thresholds[k]
+		res = append(res, &mtrpb.DataLatencyThreshold{
+			SiteID:      k.id,
+			TypeID:      k.typeID,
+			Lower:       roundInt32(th.lower),
+			Upper:       roundInt32(th.upper),
+			Scale:       m.types["data.type"][k.typeID].floatCol("scale"),
+			LowerDouble: th.lower,
+			UpperDouble: th.upper,
+			ForSeconds:  int32(th.forSeconds),
+			Hysteresis:  th.hysteresis,
+		})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) dataLatencyLateSave(siteID, typeID string, late int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dataExists(siteID, "data.type", typeID) {
+		return errNotFound
+	}
+
+	m.latency.lates[memKey{id: siteID, typeID: typeID}] = late
+
+	return nil
+}
+
+func (m *memStore) dataLatencyLateDelete(siteID, typeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.latency.lates, memKey{id: siteID, typeID: typeID})
+
+	return nil
+}
+
+func (m *memStore) dataLatencyLates() ([]*mtrpb.DataLatencyLate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.DataLatencyLate
+
+	for _, k := range memSortedKeys(m.latency.lates) {
+		res = append(res, &mtrpb.DataLatencyLate{SiteID: k.id, TypeID: k.typeID, Late: int32(m.latency.lates[k])})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) dataLatencyAnomalySave(siteID, typeID string, a anomalyThreshold) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dataExists(siteID, "data.type", typeID) {
+		return errNotFound
+	}
+
+	m.latency.anomalies[memKey{id: siteID, typeID: typeID}] = a
+
+	return nil
+}
+
+func (m *memStore) dataLatencyAnomalyDelete(siteID, typeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.latency.anomalies, memKey{id: siteID, typeID: typeID})
+
+	return nil
+}
+
+func (m *memStore) dataLatencyAnomalies() ([]*mtrpb.DataLatencyAnomaly, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.DataLatencyAnomaly
+
+	for _, k := range memSortedKeys(m.latency.anomalies) {
+		a := m.latency.anomalies[k]
+		res = append(res, &mtrpb.DataLatencyAnomaly{
+			SiteID:     k.id,
+			TypeID:     k.typeID,
+			Rate:       a.rate,
+			Deviations: a.deviations,
+			Days:       int32(a.days),
+		})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) dataTypeByID(typeID string) (dataType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.typeByID("data.type", typeID)
+	if !ok {
+		return dataType{typeID: typeID}, errNotFound
+	}
+
+	return dataType{
+		typeID:      typeID,
+		scale:       t.floatCol("scale"),
+		display:     t.stringCol("display"),
+		minInterval: t.intCol("min_interval"),
+	}, nil
+}
+
+func (m *memStore) dataLatencySave(siteID, typeID string, t time.Time, mean, min, max, fifty, ninety float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if autoRegister {
+		m.registerSite(siteID, "data.type", typeID)
+	}
+
+	return m.dataAdd(&m.latency, "data.type", memKey{id: siteID, typeID: typeID}, t.UTC(), []float64{mean, min, max, fifty, ninety})
+}
+
+func (m *memStore) dataCompletenessSave(siteID, typeID string, t time.Time, count int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if autoRegister {
+		m.registerSite(siteID, "data.completeness_type", typeID)
+	}
+
+	return m.dataAdd(&m.completeness, "data.completeness_type", memKey{id: siteID, typeID: typeID}, t.UTC(), []float64{float64(count)})
+}
+
+/*
+dataAdd adds v to mm and updates the summary.  It returns errNotFound if the site or type in typeTable don't exist
+and errRateLimit if there is already a value for the min_interval.  m.mu must be held.
+*/
+func (m *memStore) dataAdd(mm *memMetrics, typeTable string, k memKey, t time.Time, v []float64) error {
+	if !m.dataExists(k.id, typeTable, k.typeID) {
+		return errNotFound
+	}
+
+	s, _, ok := mm.values[k].add(t, m.types[typeTable][k.typeID].intCol("min_interval"), v)
+	if !ok {
+		return errRateLimit
+	}
+
+	mm.values[k] = s
+	m.dataSummarise(mm, k, t, v)
+
+	return nil
+}
+
+// dataSummarise updates the summary for k.  Latencies are checked against their threshold.  m.mu must be held.
+func (m *memStore) dataSummarise(mm *memMetrics, k memKey, t time.Time, v []float64) {
+	var th *threshold
+	if f, ok := mm.thresholds[k]; ok {
+		th = &f
+	}
+
+	mm.summarise(k, t, v, th)
+}
+
+func (m *memStore) dataLatencyBatchSave(in []dataBatchValue, backfill bool) ([]*mtrpb.BatchStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.dataBatchSave(&m.latency, "data.type", in, backfill), nil
+}
+
+func (m *memStore) dataCompletenessBatchSave(in []dataBatchValue, backfill bool) ([]*mtrpb.BatchStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.dataBatchSave(&m.completeness, "data.completeness_type", in, backfill), nil
+}
+
+// dataBatchSave saves in to mm with the same statuses as dataBatchTable.save.  m.mu must be held.
+func (m *memStore) dataBatchSave(mm *memMetrics, typeTable string, in []dataBatchValue, backfill bool) []*mtrpb.BatchStatus {
+	type slot struct {
+		memKey
+		rateLimit int64
+	}
+
+	result := make([]*mtrpb.BatchStatus, len(in))
+	seen := make(map[slot]int) // index of the first value for the slot.
+	last := make(map[memKey]int64)
+	latest := make(map[memKey]int)
+
+	for i, v := range in {
+		if autoRegister {
+			m.registerSite(v.siteID, typeTable, v.typeID)
+		}
+
+		if !m.dataExists(v.siteID, typeTable, v.typeID) {
+			result[i] = &mtrpb.BatchStatus{Code: http.StatusBadRequest, Msg: "Didn't create row, check your query parameters exist"}
+			continue
+		}
+
+		k := memKey{id: v.siteID, typeID: v.typeID}
+
+		if backfill {
+			if l, ok := last[k]; ok && v.seconds < l {
+				result[i] = &mtrpb.BatchStatus{Code: int32(statusNotInOrder.Code), Msg: statusNotInOrder.Msg}
+				continue
+			}
+			last[k] = v.seconds
+		}
+
+		interval := m.types[typeTable][v.typeID].intCol("min_interval")
+		sl := slot{memKey: k, rateLimit: v.seconds / int64(interval)}
+
+		if j, ok := seen[sl]; ok {
+			if backfill && v.seconds == in[j].seconds && sameValues(v.values, in[j].values) {
+				result[i] = result[j]
+				continue
+			}
+			result[i] = &mtrpb.BatchStatus{Code: int32(statusTooManyRequests.Code), Msg: statusTooManyRequests.Msg}
+			continue
+		}
+
+		seen[sl] = i
+
+		t := time.Unix(v.seconds, 0).UTC()
+		values := memFloats(v.values)
+
+		s, old, ok := mm.values[k].add(t, interval, values)
+		if !ok {
+			if backfill && old.t.Equal(t) && memSameFloats(old.v, values) {
+				result[i] = &mtrpb.BatchStatus{Code: http.StatusOK}
+				continue
+			}
+			result[i] = &mtrpb.BatchStatus{Code: int32(statusTooManyRequests.Code), Msg: statusTooManyRequests.Msg}
+			continue
+		}
+
+		mm.values[k] = s
+		result[i] = &mtrpb.BatchStatus{Code: http.StatusOK}
+
+		if l, ok := latest[k]; !ok || v.seconds > in[l].seconds {
+			latest[k] = i
+		}
+	}
+
+	for k, i := range latest {
+		m.dataSummarise(mm, k, time.Unix(in[i].seconds, 0).UTC(), memFloats(in[i].values))
+	}
+
+	return result
+}
+
+// memFloats converts the values from a dataBatchValue.
+func memFloats(values []interface{}) []float64 {
+	f := make([]float64, len(values))
+
+	for i, v := range values {
+		switch n := v.(type) {
+		case float64:
+			f[i] = n
+		case int32:
+			f[i] = float64(n)
+		case int:
+			f[i] = float64(n)
+		}
+	}
+
+	return f
+}
+
+func memSameFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *memStore) dataLatencyDelete(siteID, typeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := memKey{id: siteID, typeID: typeID}
+	m.latency.deleteIf(func(key memKey) bool { return key == k })
+
+	return nil
+}
+
+func (m *memStore) dataLatencies(siteID, typeID, resolution string, timeRange []time.Time) ([]dataLatency, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dataExists(siteID, "data.type", typeID) {
+		return nil, errNotFound
+	}
+
+	b, err := m.latency.values[memKey{id: siteID, typeID: typeID}].aggregate(resolution, timeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []dataLatency
+
+	for _, v := range b {
+		res = append(res, dataLatency{t: v.t, mean: v.mean(0), fifty: v.max[3], ninety: v.max[4]})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) dataLatencyLatest(siteID, typeID string) (dataLatency, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.latency.values[memKey{id: siteID, typeID: typeID}]
+	if len(s) == 0 {
+		return dataLatency{}, errNotFound
+	}
+
+	v := s[len(s)-1]
+
+	return dataLatency{t: v.t, mean: v.v[0], fifty: v.v[3], ninety: v.v[4]}, nil
+}
+
+func (m *memStore) dataLatencyTagSave(siteID, typeID, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dataExists(siteID, "data.type", typeID) || !m.tagIDs[tag] {
+		return errNotFound
+	}
+
+	memTagAdd(m.latency.tags, memKey{id: siteID, typeID: typeID}, tag)
+
+	return nil
+}
+
+func (m *memStore) dataLatencyTagDelete(siteID, typeID, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.latency.tags[memKey{id: siteID, typeID: typeID}], tag)
+
+	return nil
+}
+
+func (m *memStore) dataLatencyTags(siteID, typeID string) ([]*mtrpb.DataLatencyTag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.DataLatencyTag
+
+	for _, t := range memTagList(m.latency.tags, memKey{id: siteID, typeID: typeID}) {
+		res = append(res, &mtrpb.DataLatencyTag{SiteID: t.id, TypeID: t.typeID, Tag: t.tag})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) dataCompletenessTypeByID(typeID string) (dataCompletenessType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.typeByID("data.completeness_type", typeID)
+	if !ok {
+		return dataCompletenessType{typeID: typeID}, errNotFound
+	}
+
+	return dataCompletenessType{
+		typeID:      typeID,
+		expected:    t.intCol("expected"),
+		minInterval: t.intCol("min_interval"),
+	}, nil
+}
+
+func (m *memStore) dataCompletenessDelete(siteID, typeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := memKey{id: siteID, typeID: typeID}
+	m.completeness.deleteIf(func(key memKey) bool { return key == k })
+
+	return nil
+}
+
+func (m *memStore) dataCompleteness(siteID, typeID, resolution string, t0 time.Time) ([]ts.Point, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dataExists(siteID, "data.completeness_type", typeID) {
+		return nil, errNotFound
+	}
+
+	s := m.completeness.values[memKey{id: siteID, typeID: typeID}]
+
+	var b []memBucket
+
+	switch resolution {
+	case "five_minutes", "hour", "day":
+		// the periods that start after t0, the same as the rollups.
+		period := memResolution[resolution]
+		from := t0.Truncate(period)
+		if !from.After(t0) {
+			from = from.Add(period)
+		}
+		b = s.since(from).buckets(period)
+	case "twelve_hours":
+		b = s.since(t0.Add(time.Nanosecond)).buckets(time.Hour * 12)
+	default:
+		return nil, fmt.Errorf("invalid resolution: %s", resolution)
+	}
+
+	var pts []ts.Point
+
+	for _, v := range b {
+		pts = append(pts, ts.Point{DateTime: v.t, Value: v.sum[0]})
+	}
+
+	return pts, nil
+}
+
+func (m *memStore) dataCompletenessLatest(siteID, typeID string) (ts.Point, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.completeness.values[memKey{id: siteID, typeID: typeID}]
+	if len(s) == 0 {
+		return ts.Point{}, errNotFound
+	}
+
+	return ts.Point{DateTime: s[len(s)-1].t, Value: s[len(s)-1].v[0]}, nil
+}
+
+func (m *memStore) dataCompletenessTagSave(siteID, typeID, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dataExists(siteID, "data.completeness_type", typeID) || !m.tagIDs[tag] {
+		return errNotFound
+	}
+
+	memTagAdd(m.completeness.tags, memKey{id: siteID, typeID: typeID}, tag)
+
+	return nil
+}
+
+func (m *memStore) dataCompletenessTagDelete(siteID, typeID, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.completeness.tags[memKey{id: siteID, typeID: typeID}], tag)
+
+	return nil
+}
+
+func (m *memStore) dataCompletenessTags(siteID, typeID string) ([]*mtrpb.DataCompletenessTag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.DataCompletenessTag
+
+	for _, t := range memTagList(m.completeness.tags, memKey{id: siteID, typeID: typeID}) {
+		res = append(res, &mtrpb.DataCompletenessTag{SiteID: t.id, TypeID: t.typeID, Tag: t.tag})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) dataLatencySummaries(typeID string) ([]dataLatencySummary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	var res []dataLatencySummary
+
+	for _, k := range memSortedKeys(m.latency.summaries) {
+		if typeID != "" && k.typeID != typeID {
+			continue
+		}
+
+		s := m.latency.summaries[k]
+		site := m.sites[k.id]
+		t := m.types["data.type"][k.typeID]
+
+		d := dataLatencySummary{
+			siteID:    k.id,
+			typeID:    k.typeID,
+			latitude:  site.latitude,
+			longitude: site.longitude,
+			pending:   site.pending,
+			scale:     t.floatCol("scale"),
+			t:         s.t,
+			mean:      s.v[0],
+			min:       s.v[1],
+			max:       s.v[2],
+			fifty:     s.v[3],
+			ninety:    s.v[4],
+			outSince:  s.outSince,
+			anomaly:   s.anomaly,
+			late:      t.intCol("late"),
+			silenced:  m.silenced(now, "", k.id, k.typeID, memTagNames(m.latency.tags, k)),
+		}
+
+		d.th, d.hasThreshold = m.latency.thresholds[k]
+
+		if l, ok := m.latency.lates[k]; ok {
+			d.late = l
+		}
+
+		res = append(res, d)
+	}
+
+	return res, nil
+}
+
+func (m *memStore) dataCompletenessSummaries(typeID string) ([]dataCompletenessSummary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.typeByID("data.completeness_type", typeID); typeID != "" && !ok {
+		return nil, errNotFound
+	}
+
+	var res []dataCompletenessSummary
+
+	for _, k := range memSortedKeys(m.completeness.summaries) {
+		if typeID != "" && k.typeID != typeID {
+			continue
+		}
+
+		s := m.completeness.summaries[k]
+		site := m.sites[k.id]
+
+		res = append(res, dataCompletenessSummary{
+			siteID:    k.id,
+			typeID:    k.typeID,
+			latitude:  site.latitude,
+			longitude: site.longitude,
+			pending:   site.pending,
+			t:         s.t,
+			count:     int(s.v[0]),
+			expected:  m.types["data.completeness_type"][k.typeID].intCol("expected"),
+		})
+	}
+
+	return res, nil
+}
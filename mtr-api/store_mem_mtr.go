@@ -0,0 +1,690 @@
+package main
+
+import (
+	"github.com/GeoNet/mtr/mtrpb"
+	"sort"
+	"time"
+)
+
+// memNotification is a notification and its delivery.
+type memNotification struct {
+	notification
+	status, err         string
+	created, next, sent time.Time
+}
+
+func (m *memStore) typeSave(t typeTable, typeID string, cols []typeColumn, force bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	types := m.types[t.table]
+	typ, ok := types[typeID]
+
+	if ok && !force && m.typeHasMetrics(t, typeID) {
+		for _, c := range cols {
+			for _, p := range t.protect {
+				if c.name == p && typ.cols[c.name] != c.value {
+					return errHasMetrics
+				}
+			}
+		}
+	}
+
+	if !ok {
+		typ = &memType{pk: t.firstPK, cols: make(map[string]interface{})}
+
+		for _, v := range types {
+			if v.pk >= typ.pk {
+				typ.pk = v.pk + 1
+			}
+		}
+
+		// the column defaults in the DB.
+		switch t.table {
+		case "field.type", "data.type":
+			typ.cols["late"] = lateDefault
+			fallthrough
+		case "data.completeness_type":
+			typ.cols["min_interval"] = 60
+		}
+
+		types[typeID] = typ
+	}
+
+	for _, c := range cols {
+		typ.cols[c.name] = c.value
+	}
+
+	return nil
+}
+
+// typeHasMetrics returns true if there are values for typeID from t.  m.mu must be held.
+func (m *memStore) typeHasMetrics(t typeTable, typeID string) bool {
+	switch t.table {
+	case "field.type":
+		return m.field.hasType(typeID)
+	case "field.state_type":
+		for k := range m.states.current {
+			if k.typeID == typeID {
+				return true
+			}
+		}
+		for k := range m.states.history {
+			if k.typeID == typeID {
+				return true
+			}
+		}
+	case "data.type":
+		return m.latency.hasType(typeID)
+	case "data.completeness_type":
+		return m.completeness.hasType(typeID)
+	case "app.type":
+		typ, ok := m.types[t.table][typeID]
+		if !ok {
+			return false
+		}
+
+		for _, a := range m.apps {
+			for _, values := range []map[memAppKey]memSeries{a.metrics, a.counters} {
+				for k := range values {
+					if k.typePK == typ.pk {
+						return true
+					}
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func (m *memStore) typeDelete(t typeTable, typeID string, force bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	typ, ok := m.types[t.table][typeID]
+	if !ok {
+		return nil
+	}
+
+	if !force && m.typeHasMetrics(t, typeID) {
+		return errHasMetrics
+	}
+
+	delete(m.types[t.table], typeID)
+
+	f := func(k memKey) bool { return k.typeID == typeID }
+
+	switch t.table {
+	case "field.type":
+		m.field.deleteIf(f)
+
+		for k := range m.modelThresholds {
+			if f(k) {
+				delete(m.modelThresholds, k)
+			}
+		}
+	case "field.state_type":
+		m.states.deleteIf(f)
+		delete(m.states.values, typeID)
+	case "data.type":
+		m.latency.deleteIf(f)
+	case "data.completeness_type":
+		m.completeness.deleteIf(f)
+	case "app.type":
+		for _, a := range m.apps {
+			for _, values := range []map[memAppKey]memSeries{a.metrics, a.counters} {
+				for k := range values {
+					if k.typePK == typ.pk {
+						delete(values, k)
+					}
+				}
+			}
+		}
+	}
+
+	// the retention for the type is only deleted if no other type in the schema has the same typeID.
+	for _, tt := range retentionTypeTables[t.schema] {
+		if _, ok := m.types[tt][typeID]; ok {
+			return nil
+		}
+	}
+
+	delete(m.retention, memKey{id: t.schema, typeID: typeID})
+
+	return nil
+}
+
+// typeIDs returns the typeIDs in table in ascending order.  m.mu must be held.
+func (m *memStore) typeIDs(table string) []string {
+	var ids []string
+
+	for k := range m.types[table] {
+		ids = append(ids, k)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+func (m *memStore) fieldTypes() ([]*mtrpb.FieldType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.FieldType
+
+	for _, id := range m.typeIDs("field.type") {
+		t := m.types["field.type"][id]
+		res = append(res, &mtrpb.FieldType{
+			TypeID:      id,
+			Display:     t.stringCol("display"),
+			MinInterval: int32(t.intCol("min_interval")),
+			Description: t.stringCol("description"),
+			Unit:        t.stringCol("unit"),
+			Scale:       t.floatCol("scale"),
+			Late:        int32(t.intCol("late")),
+		})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) fieldStateTypes() ([]*mtrpb.FieldType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.FieldType
+
+	for _, id := range m.typeIDs("field.state_type") {
+		res = append(res, &mtrpb.FieldType{TypeID: id})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) dataTypes() ([]*mtrpb.DataType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.DataType
+
+	for _, id := range m.typeIDs("data.type") {
+		t := m.types["data.type"][id]
+		res = append(res, &mtrpb.DataType{
+			TypeID:      id,
+			Display:     t.stringCol("display"),
+			MinInterval: int32(t.intCol("min_interval")),
+			Description: t.stringCol("description"),
+			Unit:        t.stringCol("unit"),
+			Scale:       t.floatCol("scale"),
+			Late:        int32(t.intCol("late")),
+		})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) dataCompletenessTypes() ([]*mtrpb.DataType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.DataType
+
+	for _, id := range m.typeIDs("data.completeness_type") {
+		t := m.types["data.completeness_type"][id]
+		res = append(res, &mtrpb.DataType{
+			TypeID:      id,
+			Expected:    int32(t.intCol("expected")),
+			MinInterval: int32(t.intCol("min_interval")),
+		})
+	}
+
+	return res, nil
+}
+
+func (m *memStore) appTypes() ([]*mtrpb.AppType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res memAppTypes
+
+	for id, t := range m.types["app.type"] {
+		res = append(res, &mtrpb.AppType{
+			TypePK:      int32(t.pk),
+			TypeID:      id,
+			Description: t.stringCol("description"),
+			Unit:        t.stringCol("unit"),
+		})
+	}
+
+	sort.Sort(res)
+
+	return res, nil
+}
+
+func (m *memStore) silenceSave(s silence) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s.id == 0 {
+		m.lastSilenceID++
+		s.id = m.lastSilenceID
+		m.silenceList = append(m.silenceList, s)
+		return nil
+	}
+
+	for i := range m.silenceList {
+		if m.silenceList[i].id == s.id {
+			m.silenceList[i] = s
+			return nil
+		}
+	}
+
+	return errNotFound
+}
+
+func (m *memStore) silenceEnd(silenceID int, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.silenceList {
+		if s.id != silenceID {
+			continue
+		}
+
+		switch {
+		case !s.start.Before(now):
+			m.silenceList = append(m.silenceList[:i], m.silenceList[i+1:]...)
+		case s.end.After(now):
+			m.silenceList[i].end = now
+		}
+
+		break
+	}
+
+	return nil
+}
+
+func (m *memStore) silences() ([]silence, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make(memSilences, len(m.silenceList))
+	copy(res, m.silenceList)
+
+	sort.Sort(res)
+
+	return res, nil
+}
+
+func (m *memStore) alertUpdate(now time.Time, f func(open map[alertKey]string) (alertChange, error)) error {
+	m.mu.Lock()
+
+	if m.alerting {
+		m.mu.Unlock()
+		return nil
+	}
+
+	m.alerting = true
+
+	open := make(map[alertKey]string)
+
+	for _, a := range m.alertList {
+		if a.end.IsZero() {
+			open[a.alertKey] = a.state
+		}
+	}
+
+	m.mu.Unlock()
+
+	// f reads the summaries through the store so m.mu can't be held.
+	c, err := f(open)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.alerting = false
+
+	if err != nil {
+		return err
+	}
+
+	resolved := make(map[alertKey]bool)
+	for _, k := range c.resolved {
+		resolved[k] = true
+	}
+
+	for i, a := range m.alertList {
+		if a.end.IsZero() && resolved[a.alertKey] {
+			m.alertList[i].end = now
+		}
+	}
+
+	for _, a := range c.started {
+		a.start, a.end = now, time.Time{}
+		m.alertList = append(m.alertList, a)
+	}
+
+	for _, n := range c.notifications {
+		m.lastNotification++
+		n.pk, n.attempts = m.lastNotification, 0
+		m.notificationList = append(m.notificationList, &memNotification{notification: n, status: "pending", created: now, next: now})
+	}
+
+	return nil
+}
+
+func (m *memStore) alerts(since time.Time) ([]alert, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res memAlerts
+
+	for _, a := range m.alertList {
+		if a.end.IsZero() || !a.end.Before(since) {
+			res = append(res, a)
+		}
+	}
+
+	sort.Sort(res)
+
+	return res, nil
+}
+
+func (m *memStore) notificationsClaim(now time.Time, limit int, lease time.Duration) ([]notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []notification
+
+	// notificationList is in notificationPK order.
+	for _, n := range m.notificationList {
+		if len(res) == limit {
+			break
+		}
+
+		if n.status != "pending" || n.next.After(now) {
+			continue
+		}
+
+		n.attempts++
+		n.next = now.Add(lease)
+		res = append(res, n.notification)
+	}
+
+	return res, nil
+}
+
+// notification returns the notification for pk.  m.mu must be held.
+func (m *memStore) notification(pk int64) *memNotification {
+	for _, n := range m.notificationList {
+		if n.pk == pk {
+			return n
+		}
+	}
+
+	return nil
+}
+
+func (m *memStore) notificationSent(pk int64, t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n := m.notification(pk); n != nil {
+		n.status, n.err, n.sent = "sent", "", t
+	}
+
+	return nil
+}
+
+func (m *memStore) notificationRetry(pk int64, status, errMsg string, next time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n := m.notification(pk); n != nil {
+		n.status, n.err, n.next = status, errMsg, next
+	}
+
+	return nil
+}
+
+func (m *memStore) notifications(since time.Time) ([]*mtrpb.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.Notification
+
+	// newest first, the same as created DESC, notificationPK DESC.
+	for i := len(m.notificationList) - 1; i >= 0; i-- {
+		n := m.notificationList[i]
+
+		if n.created.Before(since) {
+			continue
+		}
+
+		p := &mtrpb.Notification{
+			Target:         n.target,
+			Method:         n.method,
+			Address:        n.address,
+			Body:           n.body,
+			Status:         n.status,
+			Attempts:       int32(n.attempts),
+			Error:          n.err,
+			CreatedSeconds: n.created.Unix(),
+		}
+
+		if !n.sent.IsZero() {
+			p.SentSeconds = n.sent.Unix()
+		}
+
+		res = append(res, p)
+	}
+
+	return res, nil
+}
+
+func (m *memStore) retentionSave(schema, typeID string, days int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if typeID != "" {
+		var found bool
+
+		for _, t := range retentionTypeTables[schema] {
+			if _, ok := m.types[t][typeID]; ok {
+				found = true
+			}
+		}
+
+		if !found {
+			return errNotFound
+		}
+	}
+
+	m.retention[memKey{id: schema, typeID: typeID}] = days
+
+	return nil
+}
+
+func (m *memStore) retentionDelete(schema, typeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.retention, memKey{id: schema, typeID: typeID})
+
+	return nil
+}
+
+func (m *memStore) retentions() ([]*mtrpb.Retention, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*mtrpb.Retention
+
+	for _, k := range memSortedKeys(m.retention) {
+		res = append(res, &mtrpb.Retention{Schema: k.id, TypeID: k.typeID, Days: int32(m.retention[k])})
+	}
+
+	return res, nil
+}
+
+/*
+deleteOld deletes values and summaries older than their retention the same as retentionTable.deleteOld, and
+resolved alerts and finished notifications older than alertRetention.  There are no rollups or partitions.
+*/
+func (m *memStore) deleteOld(now time.Time) error {
+	m.mu.Lock()
+
+	// before returns the time values for typeID in schema are kept from.  false if the default for
+	// the schema has been removed, then nothing is deleted.
+	before := func(schema, typeID string) (time.Time, bool) {
+		d, ok := m.retention[memKey{id: schema}]
+		if !ok {
+			return time.Time{}, false
+		}
+
+		if days, ok := m.retention[memKey{id: schema, typeID: typeID}]; ok {
+			d = days
+		}
+
+		return now.Add(time.Hour * time.Duration(-24*d)), true
+	}
+
+	trim := func(s memSeries, schema, typeID string) (memSeries, int64) {
+		t, ok := before(schema, typeID)
+		if !ok {
+			return s, 0
+		}
+
+		keep := s.since(t)
+
+		return append(memSeries(nil), keep...), int64(len(s) - len(keep))
+	}
+
+	deleted := make(map[string]int64)
+
+	for _, d := range []struct {
+		table, schema string
+		mm            memMetrics
+	}{
+		{"field.metric", "field", m.field},
+		{"data.latency", "data", m.latency},
+		{"data.completeness", "data", m.completeness},
+	} {
+		for k, s := range d.mm.values {
+			var n int64
+			d.mm.values[k], n = trim(s, d.schema, k.typeID)
+			deleted[d.table] += n
+		}
+	}
+
+	for _, d := range []struct {
+		table, schema string
+		mm            memMetrics
+	}{
+		{"field.metric_summary", "field", m.field},
+		{"data.latency_summary", "data", m.latency},
+	} {
+		for k, s := range d.mm.summaries {
+			if t, ok := before(d.schema, k.typeID); ok && s.t.Before(t) {
+				delete(d.mm.summaries, k)
+				deleted[d.table]++
+			}
+		}
+	}
+
+	typeIDs := make(map[int]string)
+	for id, t := range m.types["app.type"] {
+		typeIDs[t.pk] = id
+	}
+
+	for _, a := range m.apps {
+		for _, d := range []struct {
+			table  string
+			values map[memAppKey]memSeries
+		}{
+			{"app.metric", a.metrics},
+			{"app.counter", a.counters},
+			{"app.timer", a.timers},
+		} {
+			for k, s := range d.values {
+				var n int64
+				d.values[k], n = trim(s, "app", typeIDs[k.typePK])
+				deleted[d.table] += n
+			}
+		}
+	}
+
+	var alerts []alert
+	for _, a := range m.alertList {
+		if !a.end.IsZero() && a.end.Before(now.Add(-alertRetention)) {
+			deleted["mtr.alert"]++
+			continue
+		}
+		alerts = append(alerts, a)
+	}
+	m.alertList = alerts
+
+	var notifications []*memNotification
+	for _, n := range m.notificationList {
+		if n.status != "pending" && n.created.Before(now.Add(-alertRetention)) {
+			deleted["mtr.notification"]++
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	m.notificationList = notifications
+
+	m.mu.Unlock()
+
+	// countDeleted saves to the store.
+	var tables []string
+	for k := range deleted {
+		tables = append(tables, k)
+	}
+
+	sort.Strings(tables)
+
+	for _, t := range tables {
+		countDeleted(t, deleted[t])
+	}
+
+	return nil
+}
+
+// memSilences sorts by start descending then id descending.
+type memSilences []silence
+
+func (s memSilences) Len() int      { return len(s) }
+func (s memSilences) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s memSilences) Less(i, j int) bool {
+	if !s[i].start.Equal(s[j].start) {
+		return s[i].start.After(s[j].start)
+	}
+	return s[i].id > s[j].id
+}
+
+// memAlerts sorts by start descending then schema, id, and typeID.
+type memAlerts []alert
+
+func (a memAlerts) Len() int      { return len(a) }
+func (a memAlerts) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a memAlerts) Less(i, j int) bool {
+	switch {
+	case !a[i].start.Equal(a[j].start):
+		return a[i].start.After(a[j].start)
+	case a[i].schema != a[j].schema:
+		return a[i].schema < a[j].schema
+	case a[i].id != a[j].id:
+		return a[i].id < a[j].id
+	}
+	return a[i].typeID < a[j].typeID
+}
+
+// memAppTypes sorts by typePK.
+type memAppTypes []*mtrpb.AppType
+
+func (a memAppTypes) Len() int           { return len(a) }
+func (a memAppTypes) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a memAppTypes) Less(i, j int) bool { return a[i].TypePK < a[j].TypePK }
@@ -0,0 +1,1120 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/mtr/ts"
+	"github.com/lib/pq"
+	"net/http"
+	"time"
+)
+
+// pgStore is a store in the mtr database.  It uses db for writes and dbR for reads.
+type pgStore struct{}
+
+func (p pgStore) fieldTypeByID(typeID string) (fieldType, error) {
+	t := fieldType{typeID: typeID}
+
+	err := dbR.QueryRow(`SELECT scale, display, min_interval FROM field.type WHERE typeID = $1`,
+		typeID).Scan(&t.scale, &t.display, &t.minInterval)
+	if err == sql.ErrNoRows {
+		return t, errNotFound
+	}
+
+	return t, err
+}
+
+func (p pgStore) fieldDeviceModel(deviceID string) (string, error) {
+	var mod string
+
+	err := dbR.QueryRow(`SELECT modelid FROM field.device JOIN field.model using (modelpk)
+		WHERE deviceID = $1`,
+		deviceID).Scan(&mod)
+	if err == sql.ErrNoRows {
+		return "", errNotFound
+	}
+
+	return mod, err
+}
+
+func (p pgStore) fieldModelSave(modelID string) error {
+	if _, err := db.Exec(`INSERT INTO field.model(modelID) VALUES($1)`, modelID); err != nil && !isUniqueViolation(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (p pgStore) fieldModelDelete(modelID string) error {
+	_, err := db.Exec(`DELETE FROM field.model where modelID = $1`, modelID)
+
+	return err
+}
+
+func (p pgStore) fieldModels() ([]*mtrpb.FieldModel, error) {
+	rows, err := dbR.Query(`SELECT modelID
+		FROM
+		field.model`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.FieldModel
+
+	for rows.Next() {
+		var t mtrpb.FieldModel
+
+		if err = rows.Scan(&t.ModelID); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) fieldDeviceSave(deviceID, modelID string, latitude, longitude float64) error {
+	var err error
+	var result sql.Result
+	var i int64
+
+	// return if insert succeeds
+	if result, err = db.Exec(`INSERT INTO field.device(deviceID, modelPK, latitude, longitude)
+				SELECT $1, modelPK, $3, $4
+				FROM field.model
+				WHERE modelID = $2`,
+		deviceID, modelID, latitude, longitude); err == nil {
+		if i, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		if i == 1 {
+			return nil
+		}
+		return errNotFound
+	}
+
+	if !isUniqueViolation(err) {
+		return err
+	}
+
+	// update the device.  This also confirms an auto registered (pending) device.
+	if result, err = db.Exec(`UPDATE field.device
+				SET latitude = $2, longitude = $3, modelPK = field.model.modelPK, pending = false
+				FROM field.model
+				WHERE deviceID = $1
+				AND modelID = $4`,
+		deviceID, latitude, longitude, modelID); err != nil {
+		return err
+	}
+
+	if i, err = result.RowsAffected(); err != nil {
+		return err
+	}
+	if i != 1 {
+		return errNotFound
+	}
+
+	return nil
+}
+
+func (p pgStore) fieldDeviceDelete(deviceID string) error {
+	_, err := db.Exec(`DELETE FROM field.device where deviceID = $1`, deviceID)
+
+	return err
+}
+
+func (p pgStore) fieldDevices(pending bool) ([]*mtrpb.FieldDevice, error) {
+	var rows *sql.Rows
+	var err error
+
+	if pending {
+		rows, err = dbR.Query(`SELECT deviceid, modelid, latitude, longitude, pending
+			FROM
+			field.device JOIN field.model USING(modelpk)
+			WHERE pending
+			ORDER BY deviceid ASC`)
+	} else {
+		rows, err = dbR.Query(`SELECT deviceid, modelid, latitude, longitude, pending
+			FROM
+			field.device JOIN field.model USING(modelpk)`)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.FieldDevice
+
+	for rows.Next() {
+		var d mtrpb.FieldDevice
+
+		if err = rows.Scan(&d.DeviceID, &d.ModelID, &d.Latitude, &d.Longitude, &d.Pending); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &d)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) fieldMetricSave(deviceID, typeID string, t time.Time, value float64) error {
+	var err error
+
+	if autoRegister {
+		if err = registerDevice(db, deviceID, typeID); err != nil && !isUniqueViolation(err) {
+			return err
+		}
+	}
+
+	var result sql.Result
+
+	if result, err = db.Exec(`INSERT INTO field.metric(devicePK, typePK, rate_limit, time, value)
+				SELECT devicePK, typePK, $3::bigint / min_interval * min_interval, $4, $5
+				FROM field.device, field.type
+				WHERE deviceID = $1
+				AND typeID = $2`,
+		deviceID, typeID, t.Unix(), t, value); err != nil {
+		if isUniqueViolation(err) {
+			return errRateLimit
+		}
+		return err
+	}
+
+	var i int64
+	if i, err = result.RowsAffected(); err != nil {
+		return err
+	}
+	if i != 1 {
+		return errNotFound
+	}
+
+	// Update the summary value if the incoming value is newer.
+	if result, err = db.Exec(`UPDATE field.metric_summary SET time = $3, value = $4
+				WHERE time < $3
+				AND devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
+				AND typePK = (SELECT typePK FROM field.type WHERE typeID = $2)`,
+		deviceID, typeID, t, value); err != nil {
+		return err
+	}
+
+	// If no rows change either the value is old or it's the first time we've seen this metric.
+	if i, err = result.RowsAffected(); err != nil {
+		return err
+	}
+	if i != 1 {
+		if _, err = db.Exec(`INSERT INTO field.metric_summary(devicePK, typePK, time, value)
+				SELECT devicePK, typePK, $3, $4
+				FROM field.device, field.type
+				WHERE deviceID = $1
+				AND typeID = $2`,
+			deviceID, typeID, t, value); err != nil && !isUniqueViolation(err) {
+			// a unique violation means the incoming value was old.
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p pgStore) fieldMetricBatchSave(in []*mtrpb.FieldMetricBatchValue, backfill bool) ([]*mtrpb.BatchStatus, error) {
+	txn, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	var status []*mtrpb.BatchStatus
+	latest := make(map[deviceType]*mtrpb.FieldMetricBatchValue)
+
+	for _, v := range in {
+		res := fieldMetricBatchInsert(txn, v, backfill)
+		if res.Code == http.StatusInternalServerError {
+			txn.Rollback()
+			return nil, errors.New(res.Msg)
+		}
+
+		status = append(status, &mtrpb.BatchStatus{Code: int32(res.Code), Msg: res.Msg})
+
+		if res.Ok {
+			k := deviceType{deviceID: v.DeviceID, typeID: v.TypeID}
+			if l, ok := latest[k]; !ok || v.Seconds > l.Seconds {
+				latest[k] = v
+			}
+		}
+	}
+
+	for _, v := range latest {
+		if res := fieldMetricSummary(txn, v.DeviceID, v.TypeID, time.Unix(v.Seconds, 0).UTC(), batchValue(v)); !res.Ok {
+			txn.Rollback()
+			return nil, errors.New(res.Msg)
+		}
+	}
+
+	return status, txn.Commit()
+}
+
+func (p pgStore) fieldMetricDelete(deviceID, typeID string) error {
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"field.metric", "field.metric_five_minutes", "field.metric_hour", "field.metric_day",
+		"field.metric_summary", "field.metric_tag", "field.threshold", "field.metric_late",
+		"field.metric_anomaly"} {
+		if _, err = txn.Exec(`DELETE FROM `+table+` WHERE
+				devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
+				 AND typePK = (SELECT typePK from field.type WHERE typeID = $2)`,
+			deviceID, typeID); err != nil {
+			txn.Rollback()
+			return err
+		}
+	}
+
+	return txn.Commit()
+}
+
+func (p pgStore) fieldMetrics(deviceID, typeID, resolution string, timeRange []time.Time) ([]ts.Point, error) {
+	devicePK, typePK, err := p.fieldMetricPK(deviceID, typeID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := queryMetricRows(devicePK, typePK, resolution, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pts []ts.Point
+
+	for rows.Next() {
+		var pt ts.Point
+		if err = rows.Scan(&pt.DateTime, &pt.Value); err != nil {
+			return nil, err
+		}
+		pts = append(pts, pt)
+	}
+
+	return pts, rows.Err()
+}
+
+func (p pgStore) fieldMetricLatest(deviceID, typeID string) (ts.Point, error) {
+	var pt ts.Point
+
+	err := dbR.QueryRow(`SELECT time, value FROM field.metric WHERE
+			devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
+			AND typePK = (SELECT typePK FROM field.type WHERE typeID = $2)
+			ORDER BY time DESC
+			LIMIT 1`,
+		deviceID, typeID).Scan(&pt.DateTime, &pt.Value)
+	if err == sql.ErrNoRows {
+		return pt, errNotFound
+	}
+
+	return pt, err
+}
+
+// fieldMetricPK returns the primary keys for deviceID and typeID.
+func (p pgStore) fieldMetricPK(deviceID, typeID string) (devicePK, typePK int, err error) {
+	if err = dbR.QueryRow(`SELECT devicePK FROM field.device WHERE deviceID = $1`,
+		deviceID).Scan(&devicePK); err != nil {
+		if err == sql.ErrNoRows {
+			err = errNotFound
+		}
+		return
+	}
+
+	if err = dbR.QueryRow(`SELECT typePK FROM field.type WHERE typeID = $1`,
+		typeID).Scan(&typePK); err != nil {
+		if err == sql.ErrNoRows {
+			err = errNotFound
+		}
+	}
+
+	return
+}
+
+func (p pgStore) fieldThreshold(deviceID, typeID string) (lower, upper float64, source string, err error) {
+	if err = dbR.QueryRow(`SELECT `+fieldLower+`, `+fieldUpper+`, `+fieldThresholdSource+`
+		FROM field.device CROSS JOIN field.type
+		`+fieldThresholdJoin+`
+		WHERE deviceID = $1
+		AND typeID = $2`,
+		deviceID, typeID).Scan(&lower, &upper, &source); err == sql.ErrNoRows {
+		err = nil
+	}
+
+	return
+}
+
+func (p pgStore) fieldThresholdSave(deviceID, typeID string, th threshold) error {
+	result, err := db.Exec(`INSERT INTO field.threshold(devicePK, typePK, lower, upper, for_seconds, hysteresis)
+		SELECT devicePK, typePK, $3, $4, $5, $6
+				FROM field.device, field.type
+				WHERE deviceID = $1
+				AND typeID = $2
+		ON CONFLICT (devicePK, typePK) DO UPDATE SET lower = EXCLUDED.lower, upper = EXCLUDED.upper,
+		for_seconds = EXCLUDED.for_seconds, hysteresis = EXCLUDED.hysteresis`,
+		deviceID, typeID, th.lower, th.upper, th.forSeconds, th.hysteresis)
+	if err != nil {
+		return err
+	}
+
+	var i int64
+	if i, err = result.RowsAffected(); err != nil {
+		return err
+	}
+	if i != 1 {
+		return errNotFound
+	}
+
+	return nil
+}
+
+func (p pgStore) fieldThresholdDelete(deviceID, typeID string) error {
+	_, err := db.Exec(`DELETE FROM field.threshold
+		WHERE devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
+		AND typePK = (SELECT typePK FROM field.type WHERE typeID = $2)`,
+		deviceID, typeID)
+
+	return err
+}
+
+func (p pgStore) fieldThresholds() ([]*mtrpb.FieldMetricThreshold, error) {
+	rows, err := dbR.Query(`SELECT deviceID, typeID, lower, upper, for_seconds, hysteresis, scale
+		FROM
+		field.threshold JOIN field.device USING (devicepk)
+		JOIN field.type USING (typepk)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.FieldMetricThreshold
+
+	for rows.Next() {
+		var t mtrpb.FieldMetricThreshold
+
+		if err = rows.Scan(&t.DeviceID, &t.TypeID, &t.LowerDouble, &t.UpperDouble, &t.ForSeconds, &t.Hysteresis, &t.Scale); err != nil {
+			return nil, err
+		}
+
+		t.Lower, t.Upper = roundInt32(t.LowerDouble), roundInt32(t.UpperDouble)
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) fieldModelThresholdSave(modelID, typeID string, th threshold) error {
+	result, err := db.Exec(`INSERT INTO field.model_threshold(modelPK, typePK, lower, upper, for_seconds, hysteresis)
+		SELECT modelPK, typePK, $3, $4, $5, $6
+				FROM field.model, field.type
+				WHERE modelID = $1
+				AND typeID = $2
+		ON CONFLICT (modelPK, typePK) DO UPDATE SET lower = EXCLUDED.lower, upper = EXCLUDED.upper,
+		for_seconds = EXCLUDED.for_seconds, hysteresis = EXCLUDED.hysteresis`,
+		modelID, typeID, th.lower, th.upper, th.forSeconds, th.hysteresis)
+	if err != nil {
+		return err
+	}
+
+	var i int64
+	if i, err = result.RowsAffected(); err != nil {
+		return err
+	}
+	if i != 1 {
+		return errNotFound
+	}
+
+	return nil
+}
+
+func (p pgStore) fieldModelThresholdDelete(modelID, typeID string) error {
+	_, err := db.Exec(`DELETE FROM field.model_threshold
+		WHERE modelPK = (SELECT modelPK FROM field.model WHERE modelID = $1)
+		AND typePK = (SELECT typePK FROM field.type WHERE typeID = $2)`,
+		modelID, typeID)
+
+	return err
+}
+
+func (p pgStore) fieldModelThresholds() ([]*mtrpb.FieldModelThreshold, error) {
+	rows, err := dbR.Query(`SELECT modelID, typeID, lower, upper, for_seconds, hysteresis, scale
+		FROM field.model_threshold
+		JOIN field.model USING (modelPK)
+		JOIN field.type USING (typePK)
+		ORDER BY modelID ASC, typeID ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.FieldModelThreshold
+
+	for rows.Next() {
+		var t mtrpb.FieldModelThreshold
+
+		if err = rows.Scan(&t.ModelID, &t.TypeID, &t.Lower, &t.Upper, &t.ForSeconds, &t.Hysteresis, &t.Scale); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) fieldMetricLateSave(deviceID, typeID string, late int) error {
+	result, err := db.Exec(`INSERT INTO field.metric_late(devicePK, typePK, late)
+				SELECT devicePK, typePK, $3
+				FROM field.device, field.type
+				WHERE deviceID = $1
+				AND typeID = $2
+				ON CONFLICT (devicePK, typePK) DO UPDATE SET late = EXCLUDED.late`,
+		deviceID, typeID, late)
+	if err != nil {
+		return err
+	}
+
+	return oneRow(result)
+}
+
+func (p pgStore) fieldMetricLateDelete(deviceID, typeID string) error {
+	_, err := db.Exec(`DELETE FROM field.metric_late
+				WHERE devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
+				AND typePK = (SELECT typePK FROM field.type WHERE typeID = $2)`,
+		deviceID, typeID)
+
+	return err
+}
+
+func (p pgStore) fieldMetricLates() ([]*mtrpb.FieldMetricLate, error) {
+	rows, err := dbR.Query(`SELECT deviceID, typeID, late
+				FROM field.metric_late
+				JOIN field.device USING (devicePK)
+				JOIN field.type USING (typePK)
+				ORDER BY deviceID ASC, typeID ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.FieldMetricLate
+
+	for rows.Next() {
+		var l mtrpb.FieldMetricLate
+
+		if err = rows.Scan(&l.DeviceID, &l.TypeID, &l.Late); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &l)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) fieldMetricAnomalySave(deviceID, typeID string, a anomalyThreshold) error {
+	result, err := db.Exec(`INSERT INTO field.metric_anomaly(devicePK, typePK, rate, deviations, days)
+				SELECT devicePK, typePK, $3, $4, $5
+				FROM field.device, field.type
+				WHERE deviceID = $1
+				AND typeID = $2
+				ON CONFLICT (devicePK, typePK) DO UPDATE SET rate = EXCLUDED.rate,
+				deviations = EXCLUDED.deviations, days = EXCLUDED.days`,
+		deviceID, typeID, a.rate, a.deviations, a.days)
+	if err != nil {
+		return err
+	}
+
+	return oneRow(result)
+}
+
+func (p pgStore) fieldMetricAnomalyDelete(deviceID, typeID string) error {
+	_, err := db.Exec(`DELETE FROM field.metric_anomaly
+				WHERE devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
+				AND typePK = (SELECT typePK FROM field.type WHERE typeID = $2)`,
+		deviceID, typeID)
+
+	return err
+}
+
+func (p pgStore) fieldMetricAnomalies() ([]*mtrpb.FieldMetricAnomaly, error) {
+	rows, err := dbR.Query(`SELECT deviceID, typeID, rate, deviations, days
+				FROM field.metric_anomaly
+				JOIN field.device USING (devicePK)
+				JOIN field.type USING (typePK)
+				ORDER BY deviceID ASC, typeID ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.FieldMetricAnomaly
+
+	for rows.Next() {
+		var a mtrpb.FieldMetricAnomaly
+
+		if err = rows.Scan(&a.DeviceID, &a.TypeID, &a.Rate, &a.Deviations, &a.Days); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &a)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) fieldStateSave(deviceID, typeID string, t time.Time, value bool, state string) error {
+	s := sql.NullString{String: state, Valid: state != ""}
+
+	result, err := db.Exec(`UPDATE field.state SET
+				time = $3, value = $4, state = $5
+				WHERE devicePK = (SELECT devicePK from field.device WHERE deviceID = $1)
+				AND typePK = (SELECT typePK from field.state_type WHERE typeID = $2)`,
+		deviceID, typeID, t, value, s)
+	if err != nil {
+		return err
+	}
+
+	// If no rows change it's the first time we've seen this state.
+	if err = oneRow(result); err == errNotFound {
+		if result, err = db.Exec(`INSERT INTO field.state(devicePK, typePK, time, value, state)
+					SELECT devicePK, typePK, $3, $4, $5
+					FROM field.device, field.state_type
+					WHERE deviceID = $1
+					AND typeID = $2`,
+			deviceID, typeID, t, value, s); err != nil {
+			return err
+		}
+
+		err = oneRow(result)
+	}
+	if err != nil {
+		return err
+	}
+
+	return p.fieldStateHistorySave(deviceID, typeID, t, value, s)
+}
+
+// fieldStateHistoryRepeat is SQL to delete the row in field.state_history for the device ($1) and type ($2)
+// at the time from the format verb if it has the same value and state as the row before it.
+const fieldStateHistoryRepeat = `DELETE FROM field.state_history h
+				USING field.device d, field.state_type s
+				WHERE d.deviceID = $1
+				AND s.typeID = $2
+				AND h.devicePK = d.devicePK
+				AND h.typePK = s.typePK
+				AND h.time = %s
+				AND EXISTS (SELECT 1 FROM (SELECT p.value, p.state FROM field.state_history p
+					WHERE p.devicePK = h.devicePK
+					AND p.typePK = h.typePK
+					AND p.time < h.time
+					ORDER BY p.time DESC LIMIT 1) l
+					WHERE l.value = h.value AND l.state IS NOT DISTINCT FROM h.state)`
+
+/*
+fieldStateHistorySave adds a row to field.state_history if value and state are a change from the state at t.
+Resending a state, or sending the same state again, doesn't add a row.  States can arrive out of order so
+the rows at and after t are deleted if they are no longer a change from the state before them.
+*/
+func (p pgStore) fieldStateHistorySave(deviceID, typeID string, t time.Time, value bool, state sql.NullString) error {
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// serialise changes to the history for the device and type.
+	if _, err = txn.Exec(`SELECT 1 FROM field.state
+				WHERE devicePK = (SELECT devicePK from field.device WHERE deviceID = $1)
+				AND typePK = (SELECT typePK from field.state_type WHERE typeID = $2)
+				FOR UPDATE`, deviceID, typeID); err != nil {
+		txn.Rollback()
+		return err
+	}
+
+	if _, err = txn.Exec(`INSERT INTO field.state_history(devicePK, typePK, time, value, state)
+				SELECT d.devicePK, s.typePK, $3::timestamptz, $4::boolean, $5::text
+				FROM field.device d, field.state_type s
+				WHERE d.deviceID = $1
+				AND s.typeID = $2
+				AND NOT EXISTS (SELECT 1 FROM (SELECT h.value, h.state FROM field.state_history h
+					WHERE h.devicePK = d.devicePK
+					AND h.typePK = s.typePK
+					AND h.time <= $3::timestamptz
+					ORDER BY h.time DESC LIMIT 1) l
+					WHERE l.value = $4::boolean AND l.state IS NOT DISTINCT FROM $5::text)
+				ON CONFLICT (devicePK, typePK, time) DO UPDATE SET value = EXCLUDED.value, state = EXCLUDED.state`,
+		deviceID, typeID, t, value, state); err != nil {
+		txn.Rollback()
+		return err
+	}
+
+	// a changed row at t can be the same as the row before it.
+	if _, err = txn.Exec(fmt.Sprintf(fieldStateHistoryRepeat, `$3::timestamptz`), deviceID, typeID, t); err != nil {
+		txn.Rollback()
+		return err
+	}
+
+	// the row after t can be the same as the state at t.
+	if _, err = txn.Exec(fmt.Sprintf(fieldStateHistoryRepeat, `(SELECT min(n.time) FROM field.state_history n
+					WHERE n.devicePK = d.devicePK
+					AND n.typePK = s.typePK
+					AND n.time > $3::timestamptz)`), deviceID, typeID, t); err != nil {
+		txn.Rollback()
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (p pgStore) fieldStateDelete(deviceID, typeID string) error {
+	for _, table := range []string{"field.state", "field.state_history"} {
+		if _, err := db.Exec(`DELETE FROM `+table+`
+				WHERE devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
+				AND typePK = (SELECT typePK from field.state_type WHERE typeID = $2)`,
+			deviceID, typeID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p pgStore) fieldStates() ([]*mtrpb.FieldState, error) {
+	rows, err := dbR.Query(`SELECT deviceID, typeID, time, s.value, COALESCE(state, ''), ` + fieldStateSeverity + `
+				FROM field.state s
+				JOIN field.device USING (devicePK)
+				JOIN field.state_type USING (typePK)
+				LEFT JOIN field.state_value v ON v.typePK = s.typePK AND v.value = s.state`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.FieldState
+	var t time.Time
+
+	for rows.Next() {
+		var s mtrpb.FieldState
+
+		if err = rows.Scan(&s.DeviceID, &s.TypeID, &t, &s.Value, &s.State, &s.Severity); err != nil {
+			return nil, err
+		}
+
+		// Convert from Go's time.Time to unix seconds since epoch discarding nanosecs
+		s.Seconds = t.Unix()
+
+		res = append(res, &s)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) fieldStateHistory(deviceID, typeID string, timeRange []time.Time) (initial *fieldStateChange, changes []fieldStateChange, err error) {
+	var devicePK, typePK int
+
+	err = dbR.QueryRow(`SELECT devicePK, typePK FROM field.device, field.state_type WHERE deviceID = $1 AND typeID = $2`,
+		deviceID, typeID).Scan(&devicePK, &typePK)
+	if err == sql.ErrNoRows {
+		return nil, nil, errNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var c fieldStateChange
+
+	err = dbR.QueryRow(`SELECT s.value, COALESCE(state, ''), `+fieldStateSeverity+`
+			FROM field.state_history s
+			LEFT JOIN field.state_value v ON v.typePK = s.typePK AND v.value = s.state
+			WHERE devicePK = $1 AND s.typePK = $2 AND time < $3
+			ORDER BY time DESC LIMIT 1`, devicePK, typePK, timeRange[0]).Scan(&c.value, &c.state, &c.severity)
+	switch err {
+	case nil:
+		c.t = timeRange[0]
+		initial = &c
+	case sql.ErrNoRows:
+	default:
+		return nil, nil, err
+	}
+
+	var rows *sql.Rows
+
+	if rows, err = dbR.Query(`SELECT time, s.value, COALESCE(state, ''), `+fieldStateSeverity+`
+			FROM field.state_history s
+			LEFT JOIN field.state_value v ON v.typePK = s.typePK AND v.value = s.state
+			WHERE devicePK = $1 AND s.typePK = $2 AND time >= $3 AND time <= $4
+			ORDER BY time ASC`, devicePK, typePK, timeRange[0], timeRange[1]); err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v fieldStateChange
+
+		if err = rows.Scan(&v.t, &v.value, &v.state, &v.severity); err != nil {
+			return nil, nil, err
+		}
+
+		changes = append(changes, v)
+	}
+
+	return initial, changes, rows.Err()
+}
+
+func (p pgStore) fieldStateValueSave(typeID, value string, severity int) error {
+	result, err := db.Exec(`INSERT INTO field.state_value(typePK, value, severity)
+				SELECT typePK, $2, $3 FROM field.state_type WHERE typeID = $1
+				ON CONFLICT (typePK, value) DO UPDATE SET severity = EXCLUDED.severity`,
+		typeID, value, severity)
+	if err != nil {
+		return err
+	}
+
+	return oneRow(result)
+}
+
+func (p pgStore) fieldStateValueDelete(typeID, value string) error {
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	var typePK int
+
+	err = txn.QueryRow(`SELECT typePK FROM field.state_type WHERE typeID = $1`, typeID).Scan(&typePK)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		return err
+	}
+
+	var found bool
+	if err = txn.QueryRow(`SELECT EXISTS(SELECT 1 FROM field.state WHERE typePK = $1 AND state = $2)`, typePK, value).Scan(&found); err != nil {
+		return err
+	}
+
+	if found {
+		return errInUse
+	}
+
+	if _, err = txn.Exec(`DELETE FROM field.state_value WHERE typePK = $1 AND value = $2`, typePK, value); err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (p pgStore) fieldStateValues(typeID string) ([]*mtrpb.FieldStateValue, error) {
+	var rows *sql.Rows
+	var err error
+
+	if typeID == "" {
+		rows, err = dbR.Query(`SELECT typeID, value, severity FROM field.state_value
+				JOIN field.state_type USING (typePK)
+				ORDER BY typeID ASC, value ASC`)
+	} else {
+		rows, err = db.Query(`SELECT typeID, value, severity FROM field.state_value
+				JOIN field.state_type USING (typePK)
+				WHERE typeID = $1
+				ORDER BY value ASC`, typeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.FieldStateValue
+
+	for rows.Next() {
+		var v mtrpb.FieldStateValue
+
+		if err = rows.Scan(&v.TypeID, &v.Value, &v.Severity); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &v)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) fieldStateTagSave(deviceID, typeID, tag string) error {
+	result, err := db.Exec(`INSERT INTO field.state_tag(devicePK, typePK, tagPK)
+				SELECT devicePK, typePK, tagPK
+				FROM field.device, field.state_type, mtr.tag
+				WHERE deviceID = $1
+				AND typeID = $2
+				AND tag = $3`,
+		deviceID, typeID, tag)
+	if err != nil {
+		if isUniqueViolation(err) {
+			// the tag is already on the state.
+			return nil
+		}
+		return err
+	}
+
+	return oneRow(result)
+}
+
+func (p pgStore) fieldStateTagDelete(deviceID, typeID, tag string) error {
+	_, err := db.Exec(`DELETE FROM field.state_tag
+			WHERE devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
+			AND typePK = (SELECT typePK FROM field.state_type WHERE typeID = $2)
+			AND tagPK = (SELECT tagPK FROM mtr.tag WHERE tag = $3)`,
+		deviceID, typeID, tag)
+
+	return err
+}
+
+func (p pgStore) fieldStateTags() ([]*mtrpb.FieldStateTag, error) {
+	rows, err := dbR.Query(`SELECT deviceID, tag, typeID from field.state_tag
+				JOIN mtr.tag USING (tagpk)
+				JOIN field.device USING (devicepk)
+				JOIN field.state_type USING (typepk)
+				ORDER BY tag ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.FieldStateTag
+
+	for rows.Next() {
+		var t mtrpb.FieldStateTag
+
+		if err = rows.Scan(&t.DeviceID, &t.Tag, &t.TypeID); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) tagSave(tag string) error {
+	if _, err := db.Exec(`INSERT INTO mtr.tag(tag) VALUES($1)`, tag); err != nil && !isUniqueViolation(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (p pgStore) tags() ([]string, error) {
+	rows, err := dbR.Query(`SELECT tag FROM mtr.tag ORDER BY tag ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []string
+
+	for rows.Next() {
+		var t string
+
+		if err = rows.Scan(&t); err != nil {
+			return nil, err
+		}
+
+		res = append(res, t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) tagDelete(tag string) error {
+	_, err := db.Exec(`DELETE FROM mtr.tag WHERE tag=$1`, tag)
+
+	return err
+}
+
+func (p pgStore) fieldMetricTagSave(deviceID, typeID, tag string) error {
+	result, err := db.Exec(`INSERT INTO field.metric_tag(devicePK, typePK, tagPK)
+				SELECT devicePK, typePK, tagPK
+				FROM field.device, field.type, mtr.tag
+				WHERE deviceID = $1
+				AND typeID = $2
+				AND tag = $3`,
+		deviceID, typeID, tag)
+	if err != nil {
+		if isUniqueViolation(err) {
+			// the tag is already on the metric.
+			return nil
+		}
+		return err
+	}
+
+	var i int64
+	if i, err = result.RowsAffected(); err != nil {
+		return err
+	}
+	if i != 1 {
+		return errNotFound
+	}
+
+	return nil
+}
+
+func (p pgStore) fieldMetricTagDelete(deviceID, typeID, tag string) error {
+	_, err := db.Exec(`DELETE FROM field.metric_tag
+			WHERE devicePK = (SELECT devicePK FROM field.device WHERE deviceID = $1)
+			AND typePK = (SELECT typePK FROM field.type WHERE typeID = $2)
+			AND tagPK = (SELECT tagPK FROM mtr.tag WHERE tag = $3)`,
+		deviceID, typeID, tag)
+
+	return err
+}
+
+func (p pgStore) fieldMetricTags(deviceID, typeID string) ([]*mtrpb.FieldMetricTag, error) {
+	var rows *sql.Rows
+	var err error
+
+	if deviceID == "" && typeID == "" {
+		rows, err = dbR.Query(`SELECT deviceID, tag, typeID from field.metric_tag
+				JOIN mtr.tag USING (tagpk)
+				JOIN field.device USING (devicepk)
+				JOIN field.type USING (typepk)
+				ORDER BY tag ASC`)
+	} else {
+		rows, err = dbR.Query(`SELECT deviceID, tag, typeID from field.metric_tag
+				JOIN mtr.tag USING (tagpk)
+				JOIN field.device USING (devicepk)
+				JOIN field.type USING (typepk)
+				WHERE deviceID=$1 AND typeID=$2
+				ORDER BY tag ASC`, deviceID, typeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.FieldMetricTag
+
+	for rows.Next() {
+		var t mtrpb.FieldMetricTag
+
+		if err = rows.Scan(&t.DeviceID, &t.Tag, &t.TypeID); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+// Types can have more than one value a minute (see min_interval) so
+// all resolutions apart from full aggregate the values in each period.
+// Resolutions coarser than minute, and ranges older than the raw values, are read
+// from the rollups (see rollupResolution).
+func queryMetricRows(devicePK, typePK int, resolution string, timeRange []time.Time) (*sql.Rows, error) {
+	var err error
+	var rows *sql.Rows
+
+	var raw time.Duration
+	if raw, err = typeRetention("field", "field.type", typePK); err != nil {
+		return nil, err
+	}
+
+	if resolution, err = rollupResolution(resolution, timeRange[0], raw); err != nil {
+		return nil, err
+	}
+
+	switch resolution {
+	case "minute":
+		rows, err = dbR.Query(`SELECT date_trunc('`+resolution+`',time) as t, avg(value) FROM field.metric WHERE
+		devicePK = $1 AND typePK = $2
+		AND time >= $3 AND time <= $4
+		GROUP BY date_trunc('`+resolution+`',time)
+		ORDER BY t ASC`,
+			devicePK, typePK, timeRange[0], timeRange[1])
+	case "full":
+		rows, err = dbR.Query(`SELECT time, value
+		FROM field.metric
+		WHERE devicePK = $1
+		AND typePK = $2
+		AND time >= $3 AND time <= $4
+		ORDER BY time ASC`,
+			devicePK, typePK, timeRange[0], timeRange[1])
+	default:
+		rows, err = dbR.Query(`SELECT time, sum::float8 / count FROM field.metric_`+resolution+` WHERE
+		devicePK = $1 AND typePK = $2
+		AND time >= mtr.rollup_time($3, $5) AND time <= $4
+		ORDER BY time ASC`,
+			devicePK, typePK, timeRange[0], timeRange[1], resolution)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// oneRow returns errNotFound if result didn't change exactly one row e.g., an insert from a select
+// that didn't match anything.
+func oneRow(result sql.Result) error {
+	i, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if i != 1 {
+		return errNotFound
+	}
+
+	return nil
+}
+
+func (p pgStore) fieldSummaries(typeID string) ([]fieldSummary, error) {
+	q := `SELECT deviceID, modelID, typeID, latitude, longitude, pending, scale, time, value,
+		` + fieldLower + `, ` + fieldUpper + `, ` + fieldFor + `, ` + fieldHysteresis + `, ` + fieldThresholdSource + `,
+		out_since, anomaly, ` + fieldLate + `, ` + fieldSilenced + `
+		FROM field.metric_summary
+		JOIN field.device USING (devicePK)
+		JOIN field.model USING (modelPK)
+		JOIN field.type USING (typePK)
+		LEFT JOIN field.metric_late USING (devicePK, typePK)
+		` + fieldThresholdJoin
+
+	var rows *sql.Rows
+	var err error
+
+	switch typeID {
+	case "":
+		rows, err = dbR.Query(q)
+	default:
+		rows, err = dbR.Query(q+` WHERE typeID = $1`, typeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []fieldSummary
+
+	for rows.Next() {
+		var s fieldSummary
+		var outSince pq.NullTime
+
+		if err = rows.Scan(&s.deviceID, &s.modelID, &s.typeID, &s.latitude, &s.longitude, &s.pending, &s.scale, &s.t, &s.value,
+			&s.th.lower, &s.th.upper, &s.th.forSeconds, &s.th.hysteresis, &s.thresholdSource,
+			&outSince, &s.anomaly, &s.late, &s.silenced); err != nil {
+			return nil, err
+		}
+
+		s.outSince = outSince.Time
+		res = append(res, s)
+	}
+
+	return res, rows.Err()
+}
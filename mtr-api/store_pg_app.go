@@ -0,0 +1,339 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (p pgStore) appIDs() ([]string, error) {
+	rows, err := dbR.Query(`SELECT applicationid FROM app.application ORDER BY applicationid ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []string
+
+	for rows.Next() {
+		var a string
+
+		if err = rows.Scan(&a); err != nil {
+			return nil, err
+		}
+
+		res = append(res, a)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) appTypePK(typeID string) (int, error) {
+	var i int
+
+	err := db.QueryRow(`SELECT typePK FROM app.type WHERE typeID = $1`, typeID).Scan(&i)
+	if err == sql.ErrNoRows {
+		return 0, errNotFound
+	}
+
+	return i, err
+}
+
+func (p pgStore) appMetricSave(applicationID, instanceID string, typePK int, t time.Time, value int64) error {
+	return appSave(`INSERT INTO app.metric (applicationPK, instancePK, typePK, time, value)
+				SELECT applicationPK, instancePK, $3, $4, $5
+				FROM app.application, app.instance
+				WHERE applicationID = $1
+				AND instanceID = $2`, applicationID, instanceID, "",
+		applicationID, instanceID, typePK, t, value)
+}
+
+func (p pgStore) appCounterSave(applicationID, instanceID string, typePK int, t time.Time, count int) error {
+	return appSave(`INSERT INTO app.counter(applicationPK, instancePK, typePK, time, count)
+				SELECT applicationPK, instancePK, $3, $4, $5
+				FROM app.application, app.instance
+				WHERE applicationID = $1
+				AND instanceID = $2`, applicationID, instanceID, "",
+		applicationID, instanceID, typePK, t, count)
+}
+
+func (p pgStore) appTimerSave(applicationID, instanceID, sourceID string, t time.Time, count, average, fifty, ninety int) error {
+	return appSave(`INSERT INTO app.timer(applicationPK, instancePK, sourcePK, time, average, count, fifty, ninety)
+	 			SELECT applicationPK, instancePK, sourcePK, $4, $5, $6, $7, $8
+	 			FROM app.application, app.instance, app.source
+				WHERE applicationID = $1
+				AND instanceID = $2
+				AND sourceID = $3`, applicationID, instanceID, sourceID,
+		applicationID, instanceID, sourceID, t, average, count, fifty, ninety)
+}
+
+/*
+appSave runs the insert query with args.  If it doesn't insert one row the application, instance, and
+source (if sourceID isn't empty) are added and it is tried again.
+*/
+func appSave(query, applicationID, instanceID, sourceID string, args ...interface{}) error {
+	var err error
+	var result sql.Result
+
+	// If we insert one row then return.
+	// This will be the most common outcome.
+	if result, err = db.Exec(query, args...); err == nil {
+		if err = oneRow(result); err != errNotFound {
+			return err
+		}
+	}
+
+	// Most likely causes of error are missing application or instance.  Add them.
+	// Ignore errors - this could race from other handlers.
+	db.Exec(`INSERT INTO app.application(applicationID) VALUES($1)`, applicationID)
+	db.Exec(`INSERT INTO app.instance(instanceID) VALUES($1)`, instanceID)
+	if sourceID != "" {
+		db.Exec(`INSERT INTO app.source(sourceID) VALUES($1)`, sourceID)
+	}
+
+	// Try to insert again - if we insert one row then return.
+	if result, err = db.Exec(query, args...); err != nil {
+		return err
+	}
+
+	return oneRow(result)
+}
+
+func (p pgStore) appMetrics(applicationID string, typePKs []int, resolution string, timeRange []time.Time) ([]appMetricValue, error) {
+	// missing applicationID or typePK should return a 404 while no data can be 200.  See GeoNet/mtr#214
+	var pks []string
+
+	for _, t := range typePKs {
+		var found bool
+
+		if err := dbR.QueryRow(`SELECT EXISTS(SELECT 1 FROM app.type, app.application
+				WHERE applicationID = $1
+				AND typePK = $2)`, applicationID, t).Scan(&found); err != nil {
+			return nil, err
+		}
+
+		if !found {
+			return nil, errNotFound
+		}
+
+		pks = append(pks, strconv.Itoa(t))
+	}
+
+	var raw time.Duration
+	var err error
+
+	if raw, err = shortestRetention("app"); err != nil {
+		return nil, err
+	}
+
+	if resolution, err = rollupResolution(resolution, timeRange[0], raw); err != nil {
+		return nil, err
+	}
+
+	var rows *sql.Rows
+
+	switch resolution {
+	case "minute":
+		rows, err = dbR.Query(`SELECT instanceID, typePK, date_trunc('`+resolution+`',time) as t, avg(value)
+		FROM app.metric
+		JOIN app.instance USING (instancePK)
+		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
+		AND typePK IN (`+strings.Join(pks, ",")+`)
+		AND time >= $2 AND time <= $3
+		GROUP BY date_trunc('`+resolution+`',time), typePK, instanceID
+		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1])
+	case "full":
+		rows, err = dbR.Query(`SELECT instanceID, typePK, time as t, value
+		FROM app.metric
+		JOIN app.instance USING (instancePK)
+		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
+		AND typePK IN (`+strings.Join(pks, ",")+`)
+		AND time >= $2 AND time <= $3
+		ORDER BY time ASC`, applicationID, timeRange[0], timeRange[1])
+	default:
+		rows, err = dbR.Query(`SELECT instanceID, typePK, time as t, sum::float8 / count
+		FROM app.metric_`+resolution+`
+		JOIN app.instance USING (instancePK)
+		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
+		AND typePK IN (`+strings.Join(pks, ",")+`)
+		AND time >= mtr.rollup_time($2, $4) AND time <= $3
+		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1], resolution)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []appMetricValue
+
+	for rows.Next() {
+		var v appMetricValue
+
+		if err = rows.Scan(&v.instanceID, &v.typePK, &v.t, &v.value); err != nil {
+			return nil, err
+		}
+
+		res = append(res, v)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) appCounters(applicationID, resolution string, timeRange []time.Time) ([]appCounter, error) {
+	var err error
+	var rows *sql.Rows
+
+	switch resolution {
+	case "minute", "hour":
+		rows, err = dbR.Query(`SELECT typePK, date_trunc('`+resolution+`',time) as t, sum(count)
+		FROM app.counter
+		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
+		AND time >= $2 AND time <= $3
+		GROUP BY date_trunc('`+resolution+`',time), typePK
+		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1])
+	case "five_minutes":
+		rows, err = dbR.Query(`SELECT typePK,
+		date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min' as t, sum(count)
+		FROM app.counter
+		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
+		AND time >= $2 AND time <= $3
+		GROUP BY date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min', typePK
+		ORDER BY t ASC`, applicationID, timeRange[0], timeRange[1])
+	case "full":
+		rows, err = dbR.Query(`SELECT typePK, time, count
+		FROM app.counter
+		JOIN app.type USING (typepk)
+		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
+		AND time >= $2 AND time <= $3
+		ORDER BY time ASC`, applicationID, timeRange[0], timeRange[1])
+	default:
+		return nil, fmt.Errorf("invalid resolution: %s", resolution)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []appCounter
+
+	for rows.Next() {
+		var c appCounter
+
+		if err = rows.Scan(&c.typePK, &c.t, &c.count); err != nil {
+			return nil, err
+		}
+
+		res = append(res, c)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) appTimers(applicationID, sourceID, resolution string, timeRange []time.Time) ([]appTimer, error) {
+	var err error
+	var rows *sql.Rows
+
+	// the sources to include, all if sourceID is empty.
+	source := `($2::text = '' OR sourceID = $2)`
+
+	switch resolution {
+	case "minute", "hour":
+		rows, err = dbR.Query(`SELECT sourceID, date_trunc('`+resolution+`',time) as t, avg(average), max(fifty), max(ninety), sum(count)
+		FROM app.timer
+		JOIN app.source USING (sourcePK)
+		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
+		AND `+source+`
+		AND time >= $3 AND time <= $4
+		GROUP BY date_trunc('`+resolution+`',time), sourceID
+		ORDER BY t ASC`, applicationID, sourceID, timeRange[0], timeRange[1])
+	case "five_minutes":
+		rows, err = dbR.Query(`SELECT sourceID,
+		date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min' as t,
+		avg(average), max(fifty), max(ninety), sum(count)
+		FROM app.timer
+		JOIN app.source USING (sourcePK)
+		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
+		AND `+source+`
+		AND time >= $3 AND time <= $4
+		GROUP BY date_trunc('hour', time) + extract(minute from time)::int / 5 * interval '5 min', sourceID
+		ORDER BY t ASC`, applicationID, sourceID, timeRange[0], timeRange[1])
+	case "full":
+		rows, err = dbR.Query(`SELECT sourceID, time, average, fifty, ninety, count
+		FROM app.timer
+		JOIN app.source USING (sourcePK)
+		WHERE applicationPK = (SELECT applicationPK from app.application WHERE applicationID = $1)
+		AND `+source+`
+		AND time >= $3 AND time <= $4
+		ORDER BY time ASC`, applicationID, sourceID, timeRange[0], timeRange[1])
+	default:
+		return nil, fmt.Errorf("invalid resolution: %s", resolution)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []appTimer
+
+	for rows.Next() {
+		var a appTimer
+
+		if err = rows.Scan(&a.sourceID, &a.t, &a.average, &a.fifty, &a.ninety, &a.count); err != nil {
+			return nil, err
+		}
+
+		res = append(res, a)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) promCounterSave(series string, n float64, now time.Time, f func(last float64) error) error {
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	var last float64
+
+	switch err = txn.QueryRow(`SELECT value FROM app.prometheus_counter WHERE series = $1 FOR UPDATE`, series).Scan(&last); err {
+	case nil:
+	case sql.ErrNoRows:
+		if _, err = txn.Exec(`INSERT INTO app.prometheus_counter(series, value, seen) VALUES($1, $2, $3)
+				ON CONFLICT (series) DO NOTHING`, series, n, now); err != nil {
+			return err
+		}
+
+		return txn.Commit()
+	default:
+		return err
+	}
+
+	fErr := f(last)
+	if fErr != nil {
+		n = last
+	}
+
+	if _, err = txn.Exec(`UPDATE app.prometheus_counter SET value = $2, seen = $3 WHERE series = $1`, series, n, now); err != nil {
+		return err
+	}
+
+	if err = txn.Commit(); err != nil {
+		return err
+	}
+
+	return fErr
+}
+
+func (p pgStore) promCountersExpire(before time.Time) error {
+	_, err := db.Exec(`DELETE FROM app.prometheus_counter WHERE seen < $1`, before)
+	return err
+}
+
+func (p pgStore) ping() error {
+	var c int
+	return db.QueryRow("SELECT 1").Scan(&c)
+}
@@ -0,0 +1,813 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/GeoNet/mtr/ts"
+	"github.com/lib/pq"
+	"time"
+)
+
+func (p pgStore) dataSiteSave(siteID string, latitude, longitude float64) error {
+	_, err := db.Exec(`INSERT INTO data.site(siteID, latitude, longitude) VALUES($1, $2, $3)`,
+		siteID, latitude, longitude)
+	if err == nil || !isUniqueViolation(err) {
+		return err
+	}
+
+	// update the site.  This also confirms an auto registered (pending) site.
+	result, err := db.Exec(`UPDATE data.site SET latitude=$2, longitude=$3, pending=false where siteID=$1`,
+		siteID, latitude, longitude)
+	if err != nil {
+		return err
+	}
+
+	return oneRow(result)
+}
+
+func (p pgStore) dataSiteDelete(siteID string) error {
+	_, err := db.Exec(`DELETE FROM data.site where siteID = $1`, siteID)
+
+	return err
+}
+
+func (p pgStore) dataSites(pending bool) ([]*mtrpb.DataSite, error) {
+	var rows *sql.Rows
+	var err error
+
+	if pending {
+		rows, err = dbR.Query(`SELECT siteID, latitude, longitude, pending FROM data.site WHERE pending ORDER BY siteID ASC`)
+	} else {
+		rows, err = dbR.Query(`SELECT siteID, latitude, longitude, pending FROM data.site`)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.DataSite
+
+	for rows.Next() {
+		var t mtrpb.DataSite
+
+		if err = rows.Scan(&t.SiteID, &t.Latitude, &t.Longitude, &t.Pending); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) dataLatencyThresholdSave(siteID, typeID string, th threshold) error {
+	result, err := db.Exec(`INSERT INTO data.latency_threshold(sitePK, typePK, lower, upper, for_seconds, hysteresis)
+				SELECT sitePK, typePK, $3, $4, $5, $6
+				FROM data.site, data.type
+				WHERE siteID = $1
+				AND typeID = $2`,
+		siteID, typeID, th.lower, th.upper, th.forSeconds, th.hysteresis)
+	if err == nil {
+		return oneRow(result)
+	}
+
+	if !isUniqueViolation(err) {
+		return err
+	}
+
+	if result, err = db.Exec(`UPDATE data.latency_threshold SET lower=$3, upper=$4, for_seconds=$5, hysteresis=$6
+				WHERE sitePK = (SELECT sitePK FROM data.site WHERE siteID = $1)
+				AND typePK = (SELECT typePK FROM data.type WHERE typeID = $2)`,
+		siteID, typeID, th.lower, th.upper, th.forSeconds, th.hysteresis); err != nil {
+		return err
+	}
+
+	return oneRow(result)
+}
+
+func (p pgStore) dataLatencyThresholdDelete(siteID, typeID string) error {
+	_, err := db.Exec(`DELETE FROM data.latency_threshold
+				WHERE sitePK = (SELECT sitePK FROM data.site WHERE siteID = $1)
+				AND typePK = (SELECT typePK FROM data.type WHERE typeID = $2)`,
+		siteID, typeID)
+
+	return err
+}
+
+func (p pgStore) dataLatencyThresholds(siteID, typeID string) ([]*mtrpb.DataLatencyThreshold, error) {
+	args := []interface{}{} // empty SQL query args
+	sqlQuery := `SELECT siteID, typeID, lower, upper, for_seconds, hysteresis, scale
+		FROM data.latency_threshold
+		JOIN data.site USING (sitepk)
+		JOIN data.type USING (typepk)`
+
+	// Append optional arguments to sql query string and query args
+	if siteID != "" && typeID != "" {
+		sqlQuery += " WHERE siteID = $1 AND typeID = $2"
+		args = append(args, siteID, typeID)
+	} else if siteID != "" {
+		sqlQuery += " WHERE siteID = $1"
+		args = append(args, siteID)
+	} else if typeID != "" {
+		sqlQuery += " WHERE typeID = $1"
+		args = append(args, typeID)
+	}
+
+	rows, err := dbR.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.DataLatencyThreshold
+
+	for rows.Next() {
+		var t mtrpb.DataLatencyThreshold
+
+		if err = rows.Scan(&t.SiteID, &t.TypeID, &t.LowerDouble, &t.UpperDouble, &t.ForSeconds, &t.Hysteresis, &t.Scale); err != nil {
+			return nil, err
+		}
+
+		t.Lower, t.Upper = roundInt32(t.LowerDouble), roundInt32(t.UpperDouble)
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) dataLatencyLateSave(siteID, typeID string, late int) error {
+	result, err := db.Exec(`INSERT INTO data.latency_late(sitePK, typePK, late)
+				SELECT sitePK, typePK, $3
+				FROM data.site, data.type
+				WHERE siteID = $1
+				AND typeID = $2
+				ON CONFLICT (sitePK, typePK) DO UPDATE SET late = EXCLUDED.late`,
+		siteID, typeID, late)
+	if err != nil {
+		return err
+	}
+
+	return oneRow(result)
+}
+
+func (p pgStore) dataLatencyLateDelete(siteID, typeID string) error {
+	_, err := db.Exec(`DELETE FROM data.latency_late
+				WHERE sitePK = (SELECT sitePK FROM data.site WHERE siteID = $1)
+				AND typePK = (SELECT typePK FROM data.type WHERE typeID = $2)`,
+		siteID, typeID)
+
+	return err
+}
+
+func (p pgStore) dataLatencyLates() ([]*mtrpb.DataLatencyLate, error) {
+	rows, err := dbR.Query(`SELECT siteID, typeID, late
+				FROM data.latency_late
+				JOIN data.site USING (sitePK)
+				JOIN data.type USING (typePK)
+				ORDER BY siteID ASC, typeID ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.DataLatencyLate
+
+	for rows.Next() {
+		var l mtrpb.DataLatencyLate
+
+		if err = rows.Scan(&l.SiteID, &l.TypeID, &l.Late); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &l)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) dataLatencyAnomalySave(siteID, typeID string, a anomalyThreshold) error {
+	result, err := db.Exec(`INSERT INTO data.latency_anomaly(sitePK, typePK, rate, deviations, days)
+				SELECT sitePK, typePK, $3, $4, $5
+				FROM data.site, data.type
+				WHERE siteID = $1
+				AND typeID = $2
+				ON CONFLICT (sitePK, typePK) DO UPDATE SET rate = EXCLUDED.rate,
+				deviations = EXCLUDED.deviations, days = EXCLUDED.days`,
+		siteID, typeID, a.rate, a.deviations, a.days)
+	if err != nil {
+		return err
+	}
+
+	return oneRow(result)
+}
+
+func (p pgStore) dataLatencyAnomalyDelete(siteID, typeID string) error {
+	_, err := db.Exec(`DELETE FROM data.latency_anomaly
+				WHERE sitePK = (SELECT sitePK FROM data.site WHERE siteID = $1)
+				AND typePK = (SELECT typePK FROM data.type WHERE typeID = $2)`,
+		siteID, typeID)
+
+	return err
+}
+
+func (p pgStore) dataLatencyAnomalies() ([]*mtrpb.DataLatencyAnomaly, error) {
+	rows, err := dbR.Query(`SELECT siteID, typeID, rate, deviations, days
+				FROM data.latency_anomaly
+				JOIN data.site USING (sitePK)
+				JOIN data.type USING (typePK)
+				ORDER BY siteID ASC, typeID ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.DataLatencyAnomaly
+
+	for rows.Next() {
+		var a mtrpb.DataLatencyAnomaly
+
+		if err = rows.Scan(&a.SiteID, &a.TypeID, &a.Rate, &a.Deviations, &a.Days); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &a)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) dataLatencyTagSave(siteID, typeID, tag string) error {
+	result, err := db.Exec(`INSERT INTO data.latency_tag(sitePK, typePK, tagPK)
+				SELECT sitePK, typePK, tagPK
+				FROM data.site, data.type, mtr.tag
+				WHERE siteID = $1
+				AND typeID = $2
+				AND tag = $3`,
+		siteID, typeID, tag)
+	if err != nil {
+		if isUniqueViolation(err) {
+			// the tag is already on the metric.
+			return nil
+		}
+		return err
+	}
+
+	return oneRow(result)
+}
+
+func (p pgStore) dataLatencyTagDelete(siteID, typeID, tag string) error {
+	_, err := db.Exec(`DELETE FROM data.latency_tag
+			WHERE sitePK = (SELECT sitePK FROM data.site WHERE siteID = $1)
+			AND typePK = (SELECT typePK FROM data.type WHERE typeID = $2)
+			AND tagPK = (SELECT tagPK FROM mtr.tag WHERE tag = $3)`,
+		siteID, typeID, tag)
+
+	return err
+}
+
+func (p pgStore) dataLatencyTags(siteID, typeID string) ([]*mtrpb.DataLatencyTag, error) {
+	var rows *sql.Rows
+	var err error
+
+	if siteID == "" && typeID == "" {
+		rows, err = dbR.Query(`SELECT siteID, tag, typeID from data.latency_tag
+				JOIN mtr.tag USING (tagpk)
+				JOIN data.site USING (sitepk)
+				JOIN data.type USING (typepk)
+				ORDER BY tag ASC`)
+	} else {
+		rows, err = dbR.Query(`SELECT siteID, tag, typeID from data.latency_tag
+				JOIN mtr.tag USING (tagpk)
+				JOIN data.site USING (sitepk)
+				JOIN data.type USING (typepk)
+				WHERE siteID=$1 AND typeID=$2
+				ORDER BY tag ASC`, siteID, typeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.DataLatencyTag
+
+	for rows.Next() {
+		var t mtrpb.DataLatencyTag
+
+		if err = rows.Scan(&t.SiteID, &t.Tag, &t.TypeID); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) dataCompletenessTagSave(siteID, typeID, tag string) error {
+	result, err := db.Exec(`INSERT INTO data.completeness_tag(sitePK, typePK, tagPK)
+				SELECT sitePK, typePK, tagPK
+				FROM data.site, data.completeness_type, mtr.tag
+				WHERE siteID = $1
+				AND typeID = $2
+				AND tag = $3`,
+		siteID, typeID, tag)
+	if err != nil {
+		if isUniqueViolation(err) {
+			// the tag is already on the metric.
+			return nil
+		}
+		return err
+	}
+
+	return oneRow(result)
+}
+
+func (p pgStore) dataCompletenessTagDelete(siteID, typeID, tag string) error {
+	_, err := db.Exec(`DELETE FROM data.completeness_tag
+			WHERE sitePK = (SELECT sitePK FROM data.site WHERE siteID = $1)
+			AND typePK = (SELECT typePK FROM data.completeness_type WHERE typeID = $2)
+			AND tagPK = (SELECT tagPK FROM mtr.tag WHERE tag = $3)`,
+		siteID, typeID, tag)
+
+	return err
+}
+
+func (p pgStore) dataCompletenessTags(siteID, typeID string) ([]*mtrpb.DataCompletenessTag, error) {
+	var rows *sql.Rows
+	var err error
+
+	if siteID == "" && typeID == "" {
+		rows, err = dbR.Query(`SELECT siteID, tag, typeID from data.completeness_tag
+				JOIN mtr.tag USING (tagpk)
+				JOIN data.site USING (sitepk)
+				JOIN data.completeness_type USING (typepk)
+				ORDER BY tag ASC`)
+	} else {
+		rows, err = dbR.Query(`SELECT siteID, tag, typeID from data.completeness_tag
+				JOIN mtr.tag USING (tagpk)
+				JOIN data.site USING (sitepk)
+				JOIN data.completeness_type USING (typepk)
+				WHERE siteID=$1 AND typeID=$2
+				ORDER BY tag ASC`, siteID, typeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.DataCompletenessTag
+
+	for rows.Next() {
+		var t mtrpb.DataCompletenessTag
+
+		if err = rows.Scan(&t.SiteID, &t.Tag, &t.TypeID); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) dataTypeByID(typeID string) (dataType, error) {
+	t := dataType{typeID: typeID}
+
+	err := dbR.QueryRow(`SELECT scale, display, min_interval FROM data.type WHERE typeID = $1`,
+		typeID).Scan(&t.scale, &t.display, &t.minInterval)
+	if err == sql.ErrNoRows {
+		return t, errNotFound
+	}
+
+	return t, err
+}
+
+func (p pgStore) dataLatencySave(siteID, typeID string, t time.Time, mean, min, max, fifty, ninety float64) error {
+	var err error
+
+	if autoRegister {
+		if err = registerSite(db, siteID, "data.type", typeID); err != nil && !isUniqueViolation(err) {
+			return err
+		}
+	}
+
+	var result sql.Result
+
+	if result, err = db.Exec(`INSERT INTO data.latency(sitePK, typePK, rate_limit, time, mean, min, max, fifty, ninety)
+				SELECT sitePK, typePK, $3::bigint / min_interval * min_interval, $4, $5, $6, $7, $8, $9
+				FROM data.site, data.type
+				WHERE siteID = $1
+				AND typeID = $2`,
+		siteID, typeID, t.Unix(),
+		t, mean, min, max, fifty, ninety); err != nil {
+		if isUniqueViolation(err) {
+			return errRateLimit
+		}
+		return err
+	}
+
+	if err = oneRow(result); err != nil {
+		return err
+	}
+
+	// Update the summary values if the incoming is newer.
+	if result, err = db.Exec(`UPDATE data.latency_summary SET
+				time = $3, mean = $4, min = $5, max = $6, fifty = $7, ninety = $8
+				WHERE time < $3
+				AND sitePK = (SELECT sitePK from data.site WHERE siteID = $1)
+				AND typePK = (SELECT typePK from data.type WHERE typeID = $2)`,
+		siteID, typeID, t, mean, min, max, fifty, ninety); err != nil {
+		return err
+	}
+
+	// If no rows change either the values are old or it's the first time we've seen this metric.
+	if err = oneRow(result); err == errNotFound {
+		if _, err = db.Exec(`INSERT INTO data.latency_summary(sitePK, typePK, time, mean, min, max, fifty, ninety)
+				SELECT sitePK, typePK, $3, $4, $5, $6, $7, $8
+				FROM data.site, data.type
+				WHERE siteID = $1
+				AND typeID = $2`,
+			siteID, typeID, t, mean, min, max, fifty, ninety); err != nil && isUniqueViolation(err) {
+			// incoming value was old
+			err = nil
+		}
+	}
+
+	return err
+}
+
+func (p pgStore) dataLatencyBatchSave(in []dataBatchValue, backfill bool) ([]*mtrpb.BatchStatus, error) {
+	return dataLatencyBatchTable.save(in, backfill)
+}
+
+func (p pgStore) dataLatencyDelete(siteID, typeID string) error {
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"data.latency", "data.latency_five_minutes", "data.latency_hour", "data.latency_day",
+		"data.latency_summary", "data.latency_threshold", "data.latency_tag", "data.latency_late",
+		"data.latency_anomaly"} {
+		if _, err = txn.Exec(`DELETE FROM `+table+` WHERE
+				sitePK = (SELECT sitePK FROM data.site WHERE siteID = $1)
+				AND typePK = (SELECT typePK FROM data.type WHERE typeID = $2)`,
+			siteID, typeID); err != nil {
+			txn.Rollback()
+			return err
+		}
+	}
+
+	return txn.Commit()
+}
+
+func (p pgStore) dataLatencies(siteID, typeID, resolution string, timeRange []time.Time) ([]dataLatency, error) {
+	sitePK, typePK, err := p.dataLatencyPK(siteID, typeID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := queryLatencyRows(sitePK, typePK, resolution, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []dataLatency
+
+	for rows.Next() {
+		var l dataLatency
+
+		if err = rows.Scan(&l.t, &l.mean, &l.fifty, &l.ninety); err != nil {
+			return nil, err
+		}
+
+		res = append(res, l)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) dataLatencyLatest(siteID, typeID string) (dataLatency, error) {
+	var l dataLatency
+
+	err := dbR.QueryRow(`SELECT time, mean, fifty, ninety FROM data.latency WHERE
+			sitePK = (SELECT sitePK FROM data.site WHERE siteID = $1)
+			AND typePK = (SELECT typePK FROM data.type WHERE typeID = $2)
+			ORDER BY time DESC
+			LIMIT 1`,
+		siteID, typeID).Scan(&l.t, &l.mean, &l.fifty, &l.ninety)
+	if err == sql.ErrNoRows {
+		return l, errNotFound
+	}
+
+	return l, err
+}
+
+// dataLatencyPK returns the primary keys for siteID and typeID.
+func (p pgStore) dataLatencyPK(siteID, typeID string) (sitePK, typePK int, err error) {
+	if err = dbR.QueryRow(`SELECT sitePK FROM data.site WHERE siteID = $1`,
+		siteID).Scan(&sitePK); err != nil {
+		if err == sql.ErrNoRows {
+			err = errNotFound
+		}
+		return
+	}
+
+	if err = dbR.QueryRow(`SELECT typePK FROM data.type WHERE typeID = $1`,
+		typeID).Scan(&typePK); err != nil {
+		if err == sql.ErrNoRows {
+			err = errNotFound
+		}
+	}
+
+	return
+}
+
+// Types can have more than one value a minute (see min_interval) so
+// all resolutions apart from full aggregate the latencies in each period.
+// Resolutions coarser than minute, and ranges older than the raw values, are read
+// from the rollups (see rollupResolution).
+func queryLatencyRows(sitePK, typePK int, resolution string, timeRange []time.Time) (*sql.Rows, error) {
+	var err error
+	var rows *sql.Rows
+
+	var raw time.Duration
+	if raw, err = typeRetention("data", "data.type", typePK); err != nil {
+		return nil, err
+	}
+
+	if resolution, err = rollupResolution(resolution, timeRange[0], raw); err != nil {
+		return nil, err
+	}
+
+	switch resolution {
+	case "minute":
+		rows, err = dbR.Query(`SELECT date_trunc('`+resolution+`',time) as t, avg(mean), max(fifty), max(ninety) FROM data.latency WHERE
+		sitePK = $1 AND typePK = $2
+		AND time >= $3 AND time <= $4
+		GROUP BY date_trunc('`+resolution+`',time)
+		ORDER BY t ASC`,
+			sitePK, typePK, timeRange[0], timeRange[1])
+	case "full":
+		rows, err = dbR.Query(`SELECT time, mean, fifty, ninety FROM data.latency WHERE
+		sitePK = $1 AND typePK = $2
+		AND time >= $3 AND time <= $4
+		ORDER BY time ASC`,
+			sitePK, typePK, timeRange[0], timeRange[1])
+	default:
+		rows, err = dbR.Query(`SELECT time, mean_sum::float8 / count, fifty, ninety FROM data.latency_`+resolution+` WHERE
+		sitePK = $1 AND typePK = $2
+		AND time >= mtr.rollup_time($3, $5) AND time <= $4
+		ORDER BY time ASC`,
+			sitePK, typePK, timeRange[0], timeRange[1], resolution)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func (p pgStore) dataCompletenessTypeByID(typeID string) (dataCompletenessType, error) {
+	t := dataCompletenessType{typeID: typeID}
+
+	err := dbR.QueryRow(`SELECT expected, min_interval FROM data.completeness_type WHERE typeID = $1`,
+		typeID).Scan(&t.expected, &t.minInterval)
+	if err == sql.ErrNoRows {
+		return t, errNotFound
+	}
+
+	return t, err
+}
+
+func (p pgStore) dataCompletenessSave(siteID, typeID string, t time.Time, count int) error {
+	var err error
+
+	if autoRegister {
+		if err = registerSite(db, siteID, "data.completeness_type", typeID); err != nil && !isUniqueViolation(err) {
+			return err
+		}
+	}
+
+	var result sql.Result
+
+	if result, err = db.Exec(`INSERT INTO data.completeness(sitePK, typePK, rate_limit, time, count)
+				SELECT sitePK, typePK, $3::bigint / min_interval * min_interval, $4, $5
+				FROM data.site, data.completeness_type
+				WHERE siteID = $1
+				AND typeID = $2`,
+		siteID, typeID, t.Unix(), t, int32(count)); err != nil {
+		if isUniqueViolation(err) {
+			return errRateLimit
+		}
+		return err
+	}
+
+	if err = oneRow(result); err != nil {
+		return err
+	}
+
+	// Update the summary values if the incoming is newer.
+	if result, err = db.Exec(`UPDATE data.completeness_summary SET
+				time = $3, count = $4
+				WHERE time < $3
+				AND sitePK = (SELECT sitePK from data.site WHERE siteID = $1)
+				AND typePK = (SELECT typePK from data.completeness_type WHERE typeID = $2)`,
+		siteID, typeID, t, int32(count)); err != nil {
+		return err
+	}
+
+	// If no rows change either the values are old or it's the first time we've seen this metric.
+	if err = oneRow(result); err == errNotFound {
+		if _, err = db.Exec(`INSERT INTO data.completeness_summary(sitePK, typePK, time, count)
+				SELECT sitePK, typePK, $3, $4
+				FROM data.site, data.completeness_type
+				WHERE siteID = $1
+				AND typeID = $2`,
+			siteID, typeID, t, int32(count)); err != nil && isUniqueViolation(err) {
+			// incoming value was old
+			err = nil
+		}
+	}
+
+	return err
+}
+
+func (p pgStore) dataCompletenessBatchSave(in []dataBatchValue, backfill bool) ([]*mtrpb.BatchStatus, error) {
+	return dataCompletenessBatchTable.save(in, backfill)
+}
+
+func (p pgStore) dataCompletenessDelete(siteID, typeID string) error {
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"data.completeness", "data.completeness_five_minutes", "data.completeness_hour", "data.completeness_day",
+		"data.completeness_summary", "data.completeness_tag"} {
+		if _, err = txn.Exec(`DELETE FROM `+table+` WHERE
+				sitePK = (SELECT sitePK FROM data.site WHERE siteID = $1)
+				AND typePK = (SELECT typePK FROM data.completeness_type WHERE typeID = $2)`,
+			siteID, typeID); err != nil {
+			txn.Rollback()
+			return err
+		}
+	}
+
+	return txn.Commit()
+}
+
+func (p pgStore) dataCompleteness(siteID, typeID, resolution string, t0 time.Time) ([]ts.Point, error) {
+	var sitePK, typePK int
+
+	err := dbR.QueryRow(`SELECT sitePK, typePK FROM data.site, data.completeness_type WHERE siteID = $1 AND typeID = $2`,
+		siteID, typeID).Scan(&sitePK, &typePK)
+	if err == sql.ErrNoRows {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rows *sql.Rows
+
+	switch resolution {
+	case "five_minutes", "hour", "day":
+		rows, err = dbR.Query(`SELECT time, sum FROM data.completeness_`+resolution+` WHERE
+		sitePK = $1 AND typePK = $2
+		AND time > $3
+		ORDER BY time ASC`,
+			sitePK, typePK, t0)
+	case "twelve_hours":
+		rows, err = dbR.Query(`SELECT date_trunc('hour', time) + extract(hour from time)::int / 12 * interval '12 hour' as t, sum(count) FROM data.completeness WHERE
+		sitePK = $1 AND typePK = $2
+		AND time > $3
+		GROUP BY date_trunc('hour', time) + extract(hour from time)::int / 12 * interval '12 hour'
+		ORDER BY t ASC`,
+			sitePK, typePK, t0)
+	default:
+		return nil, fmt.Errorf("invalid resolution: %s", resolution)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pts []ts.Point
+
+	for rows.Next() {
+		var pt ts.Point
+		var v int
+
+		if err = rows.Scan(&pt.DateTime, &v); err != nil {
+			return nil, err
+		}
+
+		pt.Value = float64(v)
+		pts = append(pts, pt)
+	}
+
+	return pts, rows.Err()
+}
+
+func (p pgStore) dataCompletenessLatest(siteID, typeID string) (ts.Point, error) {
+	var pt ts.Point
+
+	err := dbR.QueryRow(`SELECT time, count FROM data.completeness WHERE
+			sitePK = (SELECT sitePK FROM data.site WHERE siteID = $1)
+			AND typePK = (SELECT typePK FROM data.completeness_type WHERE typeID = $2)
+			ORDER BY time DESC
+			LIMIT 1`,
+		siteID, typeID).Scan(&pt.DateTime, &pt.Value)
+	if err == sql.ErrNoRows {
+		return pt, errNotFound
+	}
+
+	return pt, err
+}
+
+func (p pgStore) dataLatencySummaries(typeID string) ([]dataLatencySummary, error) {
+	q := `SELECT siteID, typeID, latitude, longitude, pending, scale, time, mean, min, max, fifty, ninety,
+		COALESCE(lower, 0), COALESCE(upper, 0), COALESCE(for_seconds, 0), COALESCE(hysteresis, 0),
+		data.latency_threshold.sitePK IS NOT NULL, out_since, anomaly, ` + dataLate + `, ` + dataSilenced + `
+		FROM data.latency_summary
+		JOIN data.site USING (sitePK)
+		JOIN data.type USING (typePK)
+		LEFT JOIN data.latency_threshold USING (sitePK, typePK)
+		LEFT JOIN data.latency_late USING (sitePK, typePK)`
+
+	var rows *sql.Rows
+	var err error
+
+	switch typeID {
+	case "":
+		rows, err = dbR.Query(q)
+	default:
+		rows, err = dbR.Query(q+` WHERE typeID = $1`, typeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []dataLatencySummary
+
+	for rows.Next() {
+		var s dataLatencySummary
+		var outSince pq.NullTime
+
+		if err = rows.Scan(&s.siteID, &s.typeID, &s.latitude, &s.longitude, &s.pending, &s.scale, &s.t,
+			&s.mean, &s.min, &s.max, &s.fifty, &s.ninety,
+			&s.th.lower, &s.th.upper, &s.th.forSeconds, &s.th.hysteresis,
+			&s.hasThreshold, &outSince, &s.anomaly, &s.late, &s.silenced); err != nil {
+			return nil, err
+		}
+
+		s.outSince = outSince.Time
+		res = append(res, s)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) dataCompletenessSummaries(typeID string) ([]dataCompletenessSummary, error) {
+	q := `SELECT siteID, typeID, latitude, longitude, pending, time, count, expected
+		FROM data.completeness_summary
+		JOIN data.site USING (sitePK)
+		JOIN data.completeness_type USING (typePK)`
+
+	var rows *sql.Rows
+	var err error
+
+	switch typeID {
+	case "":
+		rows, err = dbR.Query(q)
+	default:
+		if _, err = p.dataCompletenessTypeByID(typeID); err != nil {
+			return nil, err
+		}
+
+		rows, err = dbR.Query(q+` WHERE typeID = $1`, typeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []dataCompletenessSummary
+
+	for rows.Next() {
+		var s dataCompletenessSummary
+
+		if err = rows.Scan(&s.siteID, &s.typeID, &s.latitude, &s.longitude, &s.pending, &s.t, &s.count, &s.expected); err != nil {
+			return nil, err
+		}
+
+		res = append(res, s)
+	}
+
+	return res, rows.Err()
+}
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/GeoNet/mtr/mtrapp"
+	"github.com/GeoNet/mtr/mtrpb"
+	"github.com/lib/pq"
+	"log"
+	"strings"
+	"time"
+)
+
+func (p pgStore) typeSave(t typeTable, typeID string, cols []typeColumn, force bool) error {
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	// stops concurrent requests being assigned the same typePK.  Doesn't block metrics being saved.
+	if _, err = txn.Exec(`LOCK TABLE ` + t.table + ` IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+
+	if !force && len(t.protect) > 0 {
+		args := []interface{}{typeID}
+		var changed []string
+
+		for _, c := range cols {
+			for _, p := range t.protect {
+				if c.name == p {
+					args = append(args, c.value)
+					changed = append(changed, fmt.Sprintf("%s <> $%d", c.name, len(args)))
+				}
+			}
+		}
+
+		var typePK int
+		var change bool
+
+		err = txn.QueryRow(`SELECT typePK, `+strings.Join(changed, " OR ")+` FROM `+t.table+` WHERE typeID = $1`,
+			args...).Scan(&typePK, &change)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return err
+		case change:
+			var found bool
+			if found, err = typeHasMetrics(txn, t, typePK); err != nil {
+				return err
+			}
+			if found {
+				return errHasMetrics
+			}
+		}
+	}
+
+	names := []string{"typePK", "typeID"}
+	values := []string{fmt.Sprintf("(SELECT GREATEST(COALESCE(max(typePK) + 1, %d), %d) FROM %s)", t.firstPK, t.firstPK, t.table), "$1"}
+	args := []interface{}{typeID}
+	var set []string
+
+	for _, c := range cols {
+		args = append(args, c.value)
+		names = append(names, c.name)
+		values = append(values, fmt.Sprintf("$%d", len(args)))
+		set = append(set, c.name+" = EXCLUDED."+c.name)
+	}
+
+	conflict := "DO NOTHING"
+	if len(set) > 0 {
+		conflict = "DO UPDATE SET " + strings.Join(set, ", ")
+	}
+
+	if _, err = txn.Exec(`INSERT INTO `+t.table+`(`+strings.Join(names, ", ")+`)
+			VALUES(`+strings.Join(values, ", ")+`)
+			ON CONFLICT (typeID) `+conflict, args...); err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (p pgStore) typeDelete(t typeTable, typeID string, force bool) error {
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	var typePK int
+
+	err = txn.QueryRow(`SELECT typePK FROM `+t.table+` WHERE typeID = $1 FOR UPDATE`, typeID).Scan(&typePK)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if !force {
+		var found bool
+		if found, err = typeHasMetrics(txn, t, typePK); err != nil {
+			return err
+		}
+		if found {
+			return errHasMetrics
+		}
+	}
+
+	if _, err = txn.Exec(`DELETE FROM `+t.table+` WHERE typePK = $1`, typePK); err != nil {
+		return err
+	}
+
+	// the retention for the type is only deleted if no other type in the schema has the same typeID.
+	var other bool
+
+	for _, tt := range retentionTypeTables[t.schema] {
+		if tt == t.table {
+			continue
+		}
+
+		var found bool
+		if err = txn.QueryRow(`SELECT EXISTS(SELECT 1 FROM `+tt+` WHERE typeID = $1)`, typeID).Scan(&found); err != nil {
+			return err
+		}
+		other = other || found
+	}
+
+	if !other {
+		if _, err = txn.Exec(`DELETE FROM mtr.retention WHERE schema = $1 AND typeID = $2`, t.schema, typeID); err != nil {
+			return err
+		}
+	}
+
+	return txn.Commit()
+}
+
+// typeHasMetrics returns true if any of the metric tables for t have values for typePK.
+func typeHasMetrics(txn *sql.Tx, t typeTable, typePK int) (bool, error) {
+	for _, m := range t.metrics {
+		var found bool
+
+		if err := txn.QueryRow(`SELECT EXISTS(SELECT 1 FROM `+m+` WHERE typePK = $1)`, typePK).Scan(&found); err != nil {
+			return false, err
+		}
+
+		if found {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (p pgStore) fieldTypes() ([]*mtrpb.FieldType, error) {
+	rows, err := dbR.Query(`SELECT typeID, display, min_interval, description, unit, scale, late
+		FROM field.type ORDER BY typeID ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.FieldType
+
+	for rows.Next() {
+		var t mtrpb.FieldType
+
+		if err = rows.Scan(&t.TypeID, &t.Display, &t.MinInterval, &t.Description, &t.Unit, &t.Scale, &t.Late); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) fieldStateTypes() ([]*mtrpb.FieldType, error) {
+	rows, err := dbR.Query(`SELECT typeID FROM field.state_type ORDER BY typeID ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.FieldType
+
+	for rows.Next() {
+		var t mtrpb.FieldType
+
+		if err = rows.Scan(&t.TypeID); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) dataTypes() ([]*mtrpb.DataType, error) {
+	rows, err := dbR.Query(`SELECT typeID, display, min_interval, description, unit, scale, late
+		FROM data.type ORDER BY typeID ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.DataType
+
+	for rows.Next() {
+		var t mtrpb.DataType
+
+		if err = rows.Scan(&t.TypeID, &t.Display, &t.MinInterval, &t.Description, &t.Unit, &t.Scale, &t.Late); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) dataCompletenessTypes() ([]*mtrpb.DataType, error) {
+	rows, err := dbR.Query(`SELECT typeID, expected, min_interval FROM data.completeness_type ORDER BY typeID ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.DataType
+
+	for rows.Next() {
+		var t mtrpb.DataType
+
+		if err = rows.Scan(&t.TypeID, &t.Expected, &t.MinInterval); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) appTypes() ([]*mtrpb.AppType, error) {
+	rows, err := dbR.Query(`SELECT typePK, typeID, description, unit FROM app.type ORDER BY typePK ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.AppType
+
+	for rows.Next() {
+		var t mtrpb.AppType
+
+		if err = rows.Scan(&t.TypePK, &t.TypeID, &t.Description, &t.Unit); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &t)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) silenceSave(s silence) error {
+	if s.id == 0 {
+		_, err := db.Exec(`INSERT INTO mtr.silence(deviceID, siteID, tag, typeID, start, "end", reason)
+				VALUES($1, $2, $3, $4, $5, $6, $7)`,
+			s.deviceID, s.siteID, s.tag, s.typeID, s.start, s.end, s.reason)
+		return err
+	}
+
+	result, err := db.Exec(`UPDATE mtr.silence SET deviceID = $2, siteID = $3, tag = $4, typeID = $5,
+				start = $6, "end" = $7, reason = $8
+				WHERE silencePK = $1`,
+		s.id, s.deviceID, s.siteID, s.tag, s.typeID, s.start, s.end, s.reason)
+	if err != nil {
+		return err
+	}
+
+	return oneRow(result)
+}
+
+func (p pgStore) silenceEnd(silenceID int, now time.Time) error {
+	if _, err := db.Exec(`DELETE FROM mtr.silence WHERE silencePK = $1 AND start >= $2`, silenceID, now); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`UPDATE mtr.silence SET "end" = $2 WHERE silencePK = $1 AND "end" > $2`, silenceID, now)
+	return err
+}
+
+func (p pgStore) silences() ([]silence, error) {
+	rows, err := dbR.Query(`SELECT silencePK, deviceID, siteID, tag, typeID, start, "end", reason
+				FROM mtr.silence
+				ORDER BY start DESC, silencePK DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []silence
+
+	for rows.Next() {
+		var s silence
+
+		if err = rows.Scan(&s.id, &s.deviceID, &s.siteID, &s.tag, &s.typeID, &s.start, &s.end, &s.reason); err != nil {
+			return nil, err
+		}
+
+		res = append(res, s)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) alertUpdate(now time.Time, f func(open map[alertKey]string) (alertChange, error)) error {
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	var locked bool
+	if err = txn.QueryRow(`SELECT pg_try_advisory_xact_lock($1)`, alertLock).Scan(&locked); err != nil {
+		return err
+	}
+
+	if !locked {
+		return nil
+	}
+
+	rows, err := txn.Query(`SELECT schema, id, typeID, state FROM mtr.alert WHERE "end" IS NULL`)
+	if err != nil {
+		return err
+	}
+
+	open := make(map[alertKey]string)
+
+	for rows.Next() {
+		var k alertKey
+		var s string
+
+		if err = rows.Scan(&k.schema, &k.id, &k.typeID, &s); err != nil {
+			rows.Close()
+			return err
+		}
+
+		open[k] = s
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	c, err := f(open)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range c.resolved {
+		if _, err = txn.Exec(`UPDATE mtr.alert SET "end" = $4
+				WHERE schema = $1 AND id = $2 AND typeID = $3 AND "end" IS NULL`,
+			k.schema, k.id, k.typeID, now); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range c.started {
+		if _, err = txn.Exec(`INSERT INTO mtr.alert(schema, id, typeID, state, value, start) VALUES($1, $2, $3, $4, $5, $6)`,
+			a.schema, a.id, a.typeID, a.state, a.value, now); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range c.notifications {
+		if _, err = txn.Exec(`INSERT INTO mtr.notification(target, method, address, body, created, next_attempt)
+				VALUES($1, $2, $3, $4, $5, $5)`, n.target, n.method, n.address, n.body, now); err != nil {
+			return err
+		}
+	}
+
+	return txn.Commit()
+}
+
+func (p pgStore) alerts(since time.Time) ([]alert, error) {
+	rows, err := dbR.Query(`SELECT schema, id, typeID, state, value, start, "end" FROM mtr.alert
+				WHERE "end" IS NULL OR "end" >= $1
+				ORDER BY start DESC, schema ASC, id ASC, typeID ASC`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []alert
+
+	for rows.Next() {
+		var a alert
+		var end pq.NullTime
+
+		if err = rows.Scan(&a.schema, &a.id, &a.typeID, &a.state, &a.value, &a.start, &end); err != nil {
+			return nil, err
+		}
+
+		a.end = end.Time
+		res = append(res, a)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) notificationsClaim(now time.Time, limit int, lease time.Duration) ([]notification, error) {
+	rows, err := db.Query(`WITH claimed AS (
+					UPDATE mtr.notification SET attempts = attempts + 1, next_attempt = $3
+					WHERE notificationPK IN (SELECT notificationPK FROM mtr.notification
+						WHERE status = 'pending' AND next_attempt <= $1
+						ORDER BY notificationPK ASC
+						LIMIT $2
+						FOR UPDATE SKIP LOCKED)
+					RETURNING notificationPK, target, method, address, body, attempts)
+				SELECT notificationPK, target, method, address, body, attempts FROM claimed
+				ORDER BY notificationPK ASC`, now, limit, now.Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []notification
+
+	for rows.Next() {
+		var n notification
+
+		if err = rows.Scan(&n.pk, &n.target, &n.method, &n.address, &n.body, &n.attempts); err != nil {
+			return nil, err
+		}
+
+		res = append(res, n)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) notificationSent(pk int64, t time.Time) error {
+	_, err := db.Exec(`UPDATE mtr.notification SET status = 'sent', error = '', sent = $2
+				WHERE notificationPK = $1`, pk, t)
+	return err
+}
+
+func (p pgStore) notificationRetry(pk int64, status, errMsg string, next time.Time) error {
+	_, err := db.Exec(`UPDATE mtr.notification SET status = $2, error = $3, next_attempt = $4
+				WHERE notificationPK = $1`, pk, status, errMsg, next)
+	return err
+}
+
+func (p pgStore) notifications(since time.Time) ([]*mtrpb.Notification, error) {
+	rows, err := dbR.Query(`SELECT target, method, address, body, status, attempts, error, created, sent
+				FROM mtr.notification
+				WHERE created >= $1
+				ORDER BY created DESC, notificationPK DESC`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.Notification
+
+	for rows.Next() {
+		var n mtrpb.Notification
+		var created time.Time
+		var sent pq.NullTime
+
+		if err = rows.Scan(&n.Target, &n.Method, &n.Address, &n.Body, &n.Status, &n.Attempts, &n.Error, &created, &sent); err != nil {
+			return nil, err
+		}
+
+		n.CreatedSeconds = created.Unix()
+
+		if sent.Valid {
+			n.SentSeconds = sent.Time.Unix()
+		}
+
+		res = append(res, &n)
+	}
+
+	return res, rows.Err()
+}
+
+func (p pgStore) retentionSave(schema, typeID string, days int) error {
+	if typeID != "" {
+		var found bool
+
+		for _, t := range retentionTypeTables[schema] {
+			if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM `+t+` WHERE typeID = $1)`, typeID).Scan(&found); err != nil {
+				return err
+			}
+			if found {
+				break
+			}
+		}
+
+		if !found {
+			return errNotFound
+		}
+	}
+
+	_, err := db.Exec(`INSERT INTO mtr.retention(schema, typeID, days) VALUES($1, $2, $3)
+			ON CONFLICT (schema, typeID) DO UPDATE SET days = EXCLUDED.days`, schema, typeID, days)
+	return err
+}
+
+func (p pgStore) retentionDelete(schema, typeID string) error {
+	_, err := db.Exec(`DELETE FROM mtr.retention WHERE schema = $1 AND typeID = $2`, schema, typeID)
+	return err
+}
+
+func (p pgStore) retentions() ([]*mtrpb.Retention, error) {
+	rows, err := dbR.Query(`SELECT schema, typeID, days FROM mtr.retention ORDER BY schema ASC, typeID ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*mtrpb.Retention
+
+	for rows.Next() {
+		var rt mtrpb.Retention
+
+		if err = rows.Scan(&rt.Schema, &rt.TypeID, &rt.Days); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &rt)
+	}
+
+	return res, rows.Err()
+}
+
+/*
+deleteOld manages the partitions first (see managePartitions) then deletes raw values using the retention in
+mtr.retention (see retentionTable.deleteOld), rollups using their retention, and resolved alerts and finished
+notifications after alertRetention.  The time taken for each table is tracked as a timer.  Errors are logged
+so that one table doesn't stop the others being trimmed.
+*/
+func (p pgStore) deleteOld(now time.Time) error {
+	n, err := managePartitions()
+	if err != nil {
+		log.Println(err)
+	}
+
+	countDeleted("partitions", n)
+
+	for _, r := range retentionTables {
+		t := mtrapp.Start()
+
+		n, err = r.deleteOld()
+		if err != nil {
+			log.Println(err)
+		}
+
+		countDeleted(r.table, n)
+		t.Track("deleteMetrics." + r.table)
+	}
+
+	n, err = expireRestored()
+	if err != nil {
+		log.Println(err)
+	}
+
+	countDeleted("restored", n)
+
+	n, err = deleteChunks(`mtr.alert`, `"end" < $1`, now.Add(-alertRetention))
+	if err != nil {
+		log.Println(err)
+	}
+
+	countDeleted("mtr.alert", n)
+
+	n, err = deleteChunks(`mtr.notification`, `status <> 'pending' AND created < $1`, now.Add(-alertRetention))
+	if err != nil {
+		log.Println(err)
+	}
+
+	countDeleted("mtr.notification", n)
+
+	// each rollup level has its own retention.
+	for _, table := range rollupTables {
+		for _, l := range rollups {
+			t := mtrapp.Start()
+
+			n, err = deleteChunks(table+`_`+l.resolution, `time < $1`, now.Add(-l.retention))
+			if err != nil {
+				log.Println(err)
+			}
+
+			countDeleted(table+"_"+l.resolution, n)
+			t.Track("deleteMetrics." + table + "_" + l.resolution)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"github.com/GeoNet/mtr/mtrpb"
+	wt "github.com/GeoNet/weft/wefttest"
+	"github.com/golang/protobuf/proto"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestMemStore runs the field metric routes against memStore.
+func TestMemStore(t *testing.T) {
+	m := newMemStore()
+	memDevices(t, m, "Trimble NetR9", "gps-taupoairport")
+
+	s := storage
+	storage = m
+	defer func() { storage = s }()
+
+	if userW == "" {
+		userW, keyW = "test", "test"
+		defer func() { userW, keyW = "", "" }()
+	}
+
+	server := httptest.NewServer(inbound(mux))
+	defer server.Close()
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	t0 := now.Add(time.Minute * -10).Format(time.RFC3339)
+	t1 := now.Add(time.Minute * -10).Add(time.Second * 30).Format(time.RFC3339)
+	t2 := now.Add(time.Minute * -5).Format(time.RFC3339)
+
+	in := wt.Requests{
+		{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&value=14000&time=" + t0, Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&value=14500&time=" + t1, Method: "PUT", Status: http.StatusTooManyRequests},
+		{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&value=15000&time=" + t2, Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric?deviceID=NOT_THERE&typeID=voltage&value=15000&time=" + t2, Method: "PUT", Status: http.StatusBadRequest},
+		{ID: wt.L(), URL: "/field/metric/threshold?deviceID=gps-taupoairport&typeID=voltage&lower=12000.5&upper=15000", Method: "PUT"},
+		{ID: wt.L(), URL: "/tag/TAUP", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric/tag?deviceID=gps-taupoairport&typeID=voltage&tag=TAUP", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric/tag?deviceID=gps-taupoairport&typeID=voltage&tag=NOT_THERE", Method: "PUT", Status: http.StatusBadRequest},
+		{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage", Content: "image/svg+xml"},
+		{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&plot=spark", Content: "image/svg+xml"},
+		{ID: wt.L(), URL: "/field/metric?deviceID=NOT_THERE&typeID=voltage", Status: http.StatusNotFound},
+		{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage", Accept: "text/csv"},
+		{ID: wt.L(), URL: "/field/metric/threshold", Accept: "application/x-protobuf"},
+		{ID: wt.L(), URL: "/field/metric/tag", Accept: "application/x-protobuf"},
+	}
+
+	for _, r := range in {
+		if r.Method == "" {
+			if _, err := r.Do(server.URL); err != nil {
+				t.Error(err)
+			}
+			continue
+		}
+
+		if err := doStatus(server.URL, r); err != nil {
+			t.Error(err)
+		}
+	}
+
+	r := wt.Request{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage&resolution=full", Accept: "application/x-protobuf"}
+
+	b, err := r.Do(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fmr mtrpb.FieldMetricResult
+
+	if err = proto.Unmarshal(b, &fmr); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmr.LowerDouble != 12000.5 || fmr.UpperDouble != 15000 {
+		t.Errorf("expected threshold 12000.5, 15000 got %g, %g", fmr.LowerDouble, fmr.UpperDouble)
+	}
+
+	// the integer fields are rounded for older clients.
+	if fmr.Lower != 12001 || fmr.Upper != 15000 {
+		t.Errorf("expected threshold 12001, 15000 got %d, %d", fmr.Lower, fmr.Upper)
+	}
+
+	if fmr.ThresholdSource != thresholdDevice {
+		t.Errorf("expected threshold source %s got %s", thresholdDevice, fmr.ThresholdSource)
+	}
+
+	if len(fmr.Result) != 2 {
+		t.Fatalf("expected 2 values got %d", len(fmr.Result))
+	}
+
+	if fmr.Result[0].Value != 14000 || fmr.Result[1].Value != 15000 {
+		t.Errorf("expected values 14000, 15000 got %f, %f", fmr.Result[0].Value, fmr.Result[1].Value)
+	}
+
+	// deleting the metric deletes its threshold and tags.
+	r = wt.Request{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=voltage", Method: "DELETE"}
+	if err = doStatus(server.URL, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if th, _ := m.fieldThresholds(); len(th) != 0 {
+		t.Errorf("expected no thresholds got %d", len(th))
+	}
+
+	if tags, _ := m.fieldMetricTags("", ""); len(tags) != 0 {
+		t.Errorf("expected no tags got %d", len(tags))
+	}
+}
+
+// TestMemStoreModelThreshold checks devices use the threshold for their model unless they have their own.
+func TestMemStoreModelThreshold(t *testing.T) {
+	m := newMemStore()
+	memDevices(t, m, "Trimble NetR9", "gps-taupoairport", "gps-wellington")
+	memDevices(t, m, "Other", "gps-other")
+
+	s := storage
+	storage = m
+	defer func() { storage = s }()
+
+	if userW == "" {
+		userW, keyW = "test", "test"
+		defer func() { userW, keyW = "", "" }()
+	}
+
+	server := httptest.NewServer(inbound(mux))
+	defer server.Close()
+
+	in := wt.Requests{
+		{ID: wt.L(), URL: "/field/model/threshold?modelID=Trimble+NetR9&typeID=voltage&lower=12000&upper=15000&for=600&hysteresis=500", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/model/threshold?modelID=Trimble+NetR9&typeID=voltage&lower=12000&upper=15000&hysteresis=2000", Method: "PUT", Status: http.StatusBadRequest},
+		{ID: wt.L(), URL: "/field/model/threshold?modelID=Trimble+NetR9&typeID=voltage&lower=12000&upper=15000&for=-1", Method: "PUT", Status: http.StatusBadRequest},
+		{ID: wt.L(), URL: "/field/model/threshold?modelID=NOT_THERE&typeID=voltage&lower=12000&upper=15000", Method: "PUT", Status: http.StatusBadRequest},
+		{ID: wt.L(), URL: "/field/metric/threshold?deviceID=gps-wellington&typeID=voltage&lower=11000&upper=14000", Method: "PUT"},
+	}
+
+	for _, r := range in {
+		if err := doStatus(server.URL, r); err != nil {
+			t.Error(err)
+		}
+	}
+
+	expected := []struct {
+		id           string
+		deviceID     string
+		lower, upper float64
+		source       string
+	}{
+		{id: wt.L(), deviceID: "gps-taupoairport", lower: 12000, upper: 15000, source: thresholdModel},
+		{id: wt.L(), deviceID: "gps-wellington", lower: 11000, upper: 14000, source: thresholdDevice},
+		{id: wt.L(), deviceID: "gps-other"},
+	}
+
+	for _, v := range expected {
+		lower, upper, source, err := m.fieldThreshold(v.deviceID, "voltage")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if lower != v.lower || upper != v.upper || source != v.source {
+			t.Errorf("%s expected %g, %g, %q got %g, %g, %q", v.id, v.lower, v.upper, v.source, lower, upper, source)
+		}
+	}
+
+	r := wt.Request{ID: wt.L(), URL: "/field/model/threshold", Accept: "application/x-protobuf"}
+
+	b, err := r.Do(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mr mtrpb.FieldModelThresholdResult
+
+	if err = proto.Unmarshal(b, &mr); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mr.Result) != 1 || mr.Result[0].ModelID != "Trimble NetR9" || mr.Result[0].Lower != 12000 || mr.Result[0].Scale != 0.001 ||
+		mr.Result[0].ForSeconds != 600 || mr.Result[0].Hysteresis != 500 {
+		t.Errorf("unexpected model thresholds %v", mr.Result)
+	}
+
+	r = wt.Request{ID: wt.L(), URL: "/field/model/threshold?modelID=Trimble+NetR9&typeID=voltage", Method: "DELETE"}
+	if err = doStatus(server.URL, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, source, _ := m.fieldThreshold("gps-taupoairport", "voltage"); source != "" {
+		t.Errorf("expected no threshold after delete got source %q", source)
+	}
+}
+
+func TestMemStoreResolution(t *testing.T) {
+	m := newMemStore()
+	memDevices(t, m, "Trimble NetR9", "gps-taupoairport")
+
+	t0 := time.Date(2016, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	for i, v := range []float64{10, 20, 30, 40, 50, 60} {
+		if err := m.fieldMetricSave("gps-taupoairport", "voltage", t0.Add(time.Minute*time.Duration(i)), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	in := []struct {
+		id         string
+		resolution string
+		values     []float64
+	}{
+		{id: wt.L(), resolution: "full", values: []float64{10, 20, 30, 40, 50, 60}},
+		{id: wt.L(), resolution: "five_minutes", values: []float64{30, 60}},
+		{id: wt.L(), resolution: "hour", values: []float64{35}},
+	}
+
+	for _, v := range in {
+		pts, err := m.fieldMetrics("gps-taupoairport", "voltage", v.resolution, []time.Time{t0, t0.Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(pts) != len(v.values) {
+			t.Errorf("%s expected %d values got %d", v.id, len(v.values), len(pts))
+			continue
+		}
+
+		for i := range pts {
+			if pts[i].Value != v.values[i] {
+				t.Errorf("%s expected %f got %f", v.id, v.values[i], pts[i].Value)
+			}
+		}
+	}
+
+	if _, err := m.fieldMetrics("gps-taupoairport", "voltage", "week", []time.Time{t0, t0.Add(time.Hour)}); err == nil {
+		t.Error("expected error for invalid resolution")
+	}
+}
+
+// memDevices adds the model and devices to m.
+func memDevices(t *testing.T, m *memStore, modelID string, deviceIDs ...string) {
+	if err := m.fieldModelSave(modelID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range deviceIDs {
+		if err := m.fieldDeviceSave(d, modelID, -38.74, 176.08); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// doStatus makes the non GET request r with the write credentials and only checks the response status.
+func doStatus(server string, r wt.Request) error {
+	req, err := http.NewRequest(r.Method, server+r.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(userW, keyW)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if res.StatusCode != status {
+		return fmt.Errorf("%s %s %s got status %d expected %d", r.ID, r.URL, r.Method, res.StatusCode, status)
+	}
+
+	return nil
+}
+
+func TestMetricValue(t *testing.T) {
+	in := []struct {
+		id    string
+		value string
+		ok    bool
+		v     float64
+	}{
+		{id: wt.L(), value: "14000", ok: true, v: 14000},
+		{id: wt.L(), value: "13.25", ok: true, v: 13.25},
+		{id: wt.L(), value: "-0.5", ok: true, v: -0.5},
+		{id: wt.L(), value: "", ok: false},
+		{id: wt.L(), value: "NaN", ok: false},
+		{id: wt.L(), value: "+Inf", ok: false},
+		{id: wt.L(), value: "ten", ok: false},
+	}
+
+	for _, v := range in {
+		f, err := metricValue(v.value)
+		if v.ok != (err == nil) {
+			t.Errorf("%s expected ok %t got error %v", v.id, v.ok, err)
+			continue
+		}
+
+		if v.ok && f != v.v {
+			t.Errorf("%s expected %g got %g", v.id, v.v, f)
+		}
+	}
+
+	for f, i := range map[float64]int32{0.4: 0, 0.5: 1, -0.5: -1, 13.5: 14, 1e12: math.MaxInt32, -1e12: math.MinInt32} {
+		if r := roundInt32(f); r != i {
+			t.Errorf("roundInt32(%g) expected %d got %d", f, i, r)
+		}
+	}
+}
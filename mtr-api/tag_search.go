@@ -2,11 +2,11 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"github.com/GeoNet/mtr/mtrpb"
 	"github.com/GeoNet/weft"
 	"github.com/golang/protobuf/proto"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 )
@@ -20,26 +20,45 @@ type tagSearch struct {
 
 //search tags and place names from devices
 func tagsProto(r *http.Request, h http.Header, b *bytes.Buffer) *weft.Result {
-	var err error
-	var rows *sql.Rows
+	tags, err := storage.tags()
+	if err != nil {
+		return weft.InternalServerError(err)
+	}
 
-	if rows, err = dbR.Query(`SELECT DISTINCT tag from ((SELECT tag FROM mtr.tag )
-	                          union (SELECT CASE  WHEN strpos(deviceid, '-') = 0 THEN deviceid ELSE split_part(deviceid, '-', 2) END AS tag FROM field.device)
-	                          union (SELECT siteid from data.site as tag)) ts ORDER BY tag ASC`); err != nil {
+	devices, err := storage.fieldDevices(false)
+	if err != nil {
 		return weft.InternalServerError(err)
 	}
-	defer rows.Close()
 
-	var ts mtrpb.TagResult
+	sites, err := storage.dataSites(false)
+	if err != nil {
+		return weft.InternalServerError(err)
+	}
 
-	for rows.Next() {
-		var t mtrpb.Tag
+	for _, d := range devices {
+		// the place name part of the deviceID e.g., taupoairport from gps-taupoairport
+		switch p := strings.Split(d.DeviceID, "-"); len(p) {
+		case 1:
+			tags = append(tags, d.DeviceID)
+		default:
+			tags = append(tags, p[1])
+		}
+	}
+
+	for _, s := range sites {
+		tags = append(tags, s.SiteID)
+	}
+
+	sort.Strings(tags)
 
-		if err = rows.Scan(&t.Tag); err != nil {
-			return weft.InternalServerError(err)
+	var ts mtrpb.TagResult
+
+	for i, t := range tags {
+		if i > 0 && t == tags[i-1] {
+			continue
 		}
 
-		ts.Result = append(ts.Result, &t)
+		ts.Result = append(ts.Result, &mtrpb.Tag{Tag: t})
 	}
 
 	var by []byte
@@ -95,35 +114,53 @@ func (a *tagSearch) fieldMetric() <-chan *weft.Result {
 	out := make(chan *weft.Result)
 	go func() {
 		defer close(out)
-		var err error
-		var rows *sql.Rows
-
-		if rows, err = dbR.Query(`SELECT deviceID, modelID, typeid, time, value, lower, upper
-	 			  FROM field.metric_tag
-	 			  JOIN field.metric_summary USING (devicepk, typepk)
-	 			  JOIN field.device USING (devicePK)
-	 			  JOIN field.type USING (typePK)
-	 			  JOIN field.model USING (modelPK)
-	 			  JOIN field.threshold using (devicePK, typePK)
-			          WHERE tagPK = (SELECT tagPK FROM mtr.tag WHERE tag = $1)
-			          OR deviceID LIKE $2`, a.tag, "%"+a.tag); err != nil {
+
+		tags, err := storage.fieldMetricTags("", "")
+		if err != nil {
 			out <- weft.InternalServerError(err)
 			return
 		}
-		defer rows.Close()
 
-		var tm time.Time
+		// the tagged metrics, true if they have a.tag
+		tagged := make(map[alertKey]bool)
 
-		for rows.Next() {
-			var fmr mtrpb.FieldMetricSummary
+		for _, t := range tags {
+			k := alertKey{schema: "field", id: t.DeviceID, typeID: t.TypeID}
+			tagged[k] = tagged[k] || t.Tag == a.tag
+		}
 
-			if err = rows.Scan(&fmr.DeviceID, &fmr.ModelID, &fmr.TypeID, &tm, &fmr.Value,
-				&fmr.Lower, &fmr.Upper); err != nil {
-				out <- weft.InternalServerError(err)
-				return
+		summaries, err := storage.fieldSummaries("")
+		if err != nil {
+			out <- weft.InternalServerError(err)
+			return
+		}
+
+		now := time.Now().UTC()
+
+		for _, s := range summaries {
+			has, ok := tagged[alertKey{schema: "field", id: s.deviceID, typeID: s.typeID}]
+
+			if !ok || !(has || strings.HasSuffix(s.deviceID, a.tag)) || s.thresholdSource == "" {
+				continue
 			}
 
-			fmr.Seconds = tm.Unix()
+			state := metricState(now, s.t, s.late, s.value, s.th, s.outSince, s.anomaly)
+
+			fmr := mtrpb.FieldMetricSummary{
+				DeviceID:        s.deviceID,
+				ModelID:         s.modelID,
+				TypeID:          s.typeID,
+				Seconds:         s.t.Unix(),
+				ValueDouble:     s.value,
+				LowerDouble:     s.th.lower,
+				UpperDouble:     s.th.upper,
+				ThresholdSource: s.thresholdSource,
+				Anomaly:         s.anomaly,
+				Late:            isLate(now, s.t, s.late),
+				Bad:             state == metricBad,
+				Maintenance:     maintenanceState(state, s.silenced) == metricMaintenance,
+			}
+			fieldMetricSummaryRound(&fmr)
 
 			a.tagResult.FieldMetric = append(a.tagResult.FieldMetric, &fmr)
 		}
@@ -138,33 +175,31 @@ func (a *tagSearch) fieldState() <-chan *weft.Result {
 	out := make(chan *weft.Result)
 	go func() {
 		defer close(out)
-		var err error
-		var rows *sql.Rows
-
-		if rows, err = dbR.Query(`SELECT deviceID, typeID, time, value
-					FROM field.state_tag
-					JOIN field.state USING (devicePK, typePK)
-					JOIN field.device USING (devicePK)
-					JOIN field.state_type USING (typePK)
-					WHERE tagPK = (SELECT tagPK FROM mtr.tag WHERE tag = $1)`, a.tag); err != nil {
+
+		tags, err := storage.fieldStateTags()
+		if err != nil {
 			out <- weft.InternalServerError(err)
 			return
 		}
-		defer rows.Close()
 
-		var tm time.Time
+		tagged := make(map[alertKey]bool)
 
-		for rows.Next() {
-			var fs mtrpb.FieldState
-
-			if err = rows.Scan(&fs.DeviceID, &fs.TypeID, &tm, &fs.Value); err != nil {
-				out <- weft.InternalServerError(err)
-				return
+		for _, t := range tags {
+			if t.Tag == a.tag {
+				tagged[alertKey{schema: "field", id: t.DeviceID, typeID: t.TypeID}] = true
 			}
+		}
 
-			fs.Seconds = tm.Unix()
+		states, err := storage.fieldStates()
+		if err != nil {
+			out <- weft.InternalServerError(err)
+			return
+		}
 
-			a.tagResult.FieldState = append(a.tagResult.FieldState, &fs)
+		for _, fs := range states {
+			if tagged[alertKey{schema: "field", id: fs.DeviceID, typeID: fs.TypeID}] {
+				a.tagResult.FieldState = append(a.tagResult.FieldState, fs)
+			}
 		}
 
 		out <- &weft.StatusOK
@@ -177,35 +212,54 @@ func (a *tagSearch) dataLatency() <-chan *weft.Result {
 	out := make(chan *weft.Result)
 	go func() {
 		defer close(out)
-		var err error
-		var rows *sql.Rows
-
-		if rows, err = dbR.Query(`SELECT siteID, typeID, time, mean, fifty, ninety, lower, upper
-	 			  FROM data.latency_tag
-	 			  JOIN data.latency_summary USING (sitePK, typePK)
-	 			  JOIN data.latency_threshold USING (sitePK, typePK)
-	 			  JOIN data.site USING (sitePK)
-				  JOIN data.type USING (typePK)
-			          WHERE tagPK = (SELECT tagPK FROM mtr.tag WHERE tag = $1)
-			          OR siteID = $2`, a.tag, a.tag); err != nil {
+
+		tags, err := storage.dataLatencyTags("", "")
+		if err != nil {
 			out <- weft.InternalServerError(err)
 			return
 		}
-		defer rows.Close()
 
-		var tm time.Time
+		// the tagged latencies, true if they have a.tag
+		tagged := make(map[alertKey]bool)
+
+		for _, t := range tags {
+			k := alertKey{schema: "data", id: t.SiteID, typeID: t.TypeID}
+			tagged[k] = tagged[k] || t.Tag == a.tag
+		}
 
-		for rows.Next() {
+		summaries, err := storage.dataLatencySummaries("")
+		if err != nil {
+			out <- weft.InternalServerError(err)
+			return
+		}
 
-			var dls mtrpb.DataLatencySummary
+		now := time.Now().UTC()
 
-			if err = rows.Scan(&dls.SiteID, &dls.TypeID, &tm, &dls.Mean, &dls.Fifty, &dls.Ninety,
-				&dls.Lower, &dls.Upper); err != nil {
-				out <- weft.InternalServerError(err)
-				return
+		for _, s := range summaries {
+			has, ok := tagged[alertKey{schema: "data", id: s.siteID, typeID: s.typeID}]
+
+			if !ok || !(has || s.siteID == a.tag) || !s.hasThreshold {
+				continue
+			}
+
+			state := metricState(now, s.t, s.late, s.mean, s.th, s.outSince, s.anomaly)
+
+			dls := mtrpb.DataLatencySummary{
+				SiteID:       s.siteID,
+				TypeID:       s.typeID,
+				Seconds:      s.t.Unix(),
+				MeanDouble:   s.mean,
+				FiftyDouble:  s.fifty,
+				NinetyDouble: s.ninety,
+				LowerDouble:  s.th.lower,
+				UpperDouble:  s.th.upper,
+				Anomaly:      s.anomaly,
+				Late:         isLate(now, s.t, s.late),
+				Bad:          state == metricBad,
+				Maintenance:  maintenanceState(state, s.silenced) == metricMaintenance,
 			}
+			dataLatencySummaryRound(&dls)
 
-			dls.Seconds = tm.Unix()
 			a.tagResult.DataLatency = append(a.tagResult.DataLatency, &dls)
 		}
 
@@ -219,46 +273,38 @@ func (a *tagSearch) dataCompleteness() <-chan *weft.Result {
 	out := make(chan *weft.Result)
 	go func() {
 		defer close(out)
-		var err error
-		var rows *sql.Rows
-
-		// Returns the last 5 minutes count for all completeness with given tag.
-		// Could be empty if the siteid+typeid has no data in 5 minutes.
-		if rows, err = dbR.Query(
-			`SELECT siteID, typeID, time, count, expected
-	 			  FROM data.completeness_tag
-	 			  JOIN data.completeness_summary USING (sitePK, typePK)
-	 			  JOIN data.site USING (sitePK)
-				  JOIN data.completeness_type USING (typePK)
-			          WHERE tagPK = (SELECT tagPK FROM mtr.tag WHERE tag = $1)`, a.tag); err != nil {
+
+		tags, err := storage.dataCompletenessTags("", "")
+		if err != nil {
 			out <- weft.InternalServerError(err)
 			return
 		}
-		defer rows.Close()
-		for rows.Next() {
-
-			var dls mtrpb.DataCompletenessSummary
-			var expected int
 
-			// data could be null
-			var ts sql.NullString
-			var count sql.NullInt64
+		tagged := make(map[alertKey]bool)
 
-			if err = rows.Scan(&dls.SiteID, &dls.TypeID, &ts, &count, &expected); err != nil {
-				out <- weft.InternalServerError(err)
-				return
+		for _, t := range tags {
+			if t.Tag == a.tag {
+				tagged[alertKey{schema: "data", id: t.SiteID, typeID: t.TypeID}] = true
 			}
+		}
 
-			if ts.Valid {
-				if tm, err := time.Parse(ts.String, "2016-06-16 03:59:41+00"); err == nil {
-					dls.Seconds = tm.Unix()
-				}
-			}
+		// The latest count for all completeness with given tag.
+		summaries, err := storage.dataCompletenessSummaries("")
+		if err != nil {
+			out <- weft.InternalServerError(err)
+			return
+		}
 
-			if count.Valid {
-				dls.Completeness = float32(count.Int64) / (float32(expected) / 288)
+		for _, s := range summaries {
+			if !tagged[alertKey{schema: "data", id: s.siteID, typeID: s.typeID}] {
+				continue
 			}
-			a.tagResult.DataCompleteness = append(a.tagResult.DataCompleteness, &dls)
+
+			a.tagResult.DataCompleteness = append(a.tagResult.DataCompleteness, &mtrpb.DataCompletenessSummary{
+				SiteID:       s.siteID,
+				TypeID:       s.typeID,
+				Completeness: float32(s.count) / (float32(s.expected) / 288),
+			})
 		}
 
 		out <- &weft.StatusOK
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"github.com/GeoNet/weft"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// typeTable is a table of metric types that can be changed with the API.  The server assigns
+// the typePK for new types.
+type typeTable struct {
+	table   string
+	schema  string   // for mtr.retention.
+	firstPK int      // the lowest typePK assigned to a new type.
+	metrics []string // tables that have values for the type.
+	protect []string // columns that can't be changed once the type has values, without force.
+}
+
+var (
+	fieldTypeTable = typeTable{
+		table:   "field.type",
+		schema:  "field",
+		firstPK: 1,
+		metrics: []string{"field.metric", "field.metric_summary"},
+		protect: []string{"unit", "scale"},
+	}
+	fieldStateTypeTable = typeTable{
+		table:   "field.state_type",
+		schema:  "field",
+		firstPK: 1,
+		metrics: []string{"field.state", "field.state_history"},
+	}
+	dataTypeTable = typeTable{
+		table:   "data.type",
+		schema:  "data",
+		firstPK: 1,
+		metrics: []string{"data.latency", "data.latency_summary"},
+		protect: []string{"unit", "scale"},
+	}
+	dataCompletenessTypeTable = typeTable{
+		table:   "data.completeness_type",
+		schema:  "data",
+		firstPK: 1,
+		metrics: []string{"data.completeness", "data.completeness_summary"},
+		protect: []string{"expected"},
+	}
+	// typePKs below 10000 are kept for the mtr.internal.ID constants used by mtrapp.
+	appTypeTable = typeTable{
+		table:   "app.type",
+		schema:  "app",
+		firstPK: 10000,
+		metrics: []string{"app.metric", "app.counter"},
+		protect: []string{"unit"},
+	}
+)
+
+// typeColumn is a column value for a type.
+type typeColumn struct {
+	name  string
+	value interface{}
+}
+
+/*
+typeSave adds typeID to t or updates the columns for it if it already exists.  Changing the
+protected columns of a type that has metrics is a bad request unless force is true - it changes
+the meaning of the stored values.
+*/
+func typeSave(t typeTable, typeID string, cols []typeColumn, force bool) *weft.Result {
+	switch err := storage.typeSave(t, typeID, cols, force); err {
+	case nil:
+		return &weft.StatusOK
+	case errHasMetrics:
+		return weft.BadRequest(fmt.Sprintf("%s has metrics, changing %s needs force=true",
+			typeID, strings.Join(t.protect, " or ")))
+	default:
+		return weft.InternalServerError(err)
+	}
+}
+
+/*
+typeDelete deletes typeID from t.  Deleting a type deletes all of its metrics, thresholds, and tags
+so it is a bad request if the type has metrics unless force is true.
+*/
+func typeDelete(t typeTable, typeID string, force bool) *weft.Result {
+	switch err := storage.typeDelete(t, typeID, force); err {
+	case nil:
+		return &weft.StatusOK
+	case errHasMetrics:
+		return weft.BadRequest(typeID + " has metrics, deleting it needs force=true")
+	default:
+		return weft.InternalServerError(err)
+	}
+}
+
+// typeForce returns the value of the optional force query parameter.
+func typeForce(v url.Values) (bool, *weft.Result) {
+	if v.Get("force") == "" {
+		return false, &weft.StatusOK
+	}
+
+	force, err := strconv.ParseBool(v.Get("force"))
+	if err != nil {
+		return false, weft.BadRequest("invalid force")
+	}
+
+	return force, &weft.StatusOK
+}
+
+// typeScale returns the scale and unit query parameters with the display and description for field and data types.
+func typeScale(v url.Values) ([]typeColumn, *weft.Result) {
+	unit := v.Get("unit")
+	if res := typeUnit(unit); !res.Ok {
+		return nil, res
+	}
+
+	scale, err := strconv.ParseFloat(v.Get("scale"), 64)
+	if err != nil || scale <= 0 || math.IsInf(scale, 0) || math.IsNaN(scale) {
+		return nil, weft.BadRequest("scale must be a number greater than 0")
+	}
+
+	display := v.Get("display")
+	if strings.TrimSpace(display) == "" {
+		return nil, weft.BadRequest("empty display")
+	}
+
+	if strings.TrimSpace(v.Get("description")) == "" {
+		return nil, weft.BadRequest("empty description")
+	}
+
+	return []typeColumn{
+		{name: "description", value: v.Get("description")},
+		{name: "unit", value: unit},
+		{name: "scale", value: scale},
+		{name: "display", value: display},
+	}, &weft.StatusOK
+}
+
+// typeUnit returns a bad request unless unit is short and has no spaces e.g., mV
+func typeUnit(unit string) *weft.Result {
+	if unit == "" || len(unit) > 16 || strings.IndexFunc(unit, unicode.IsSpace) != -1 {
+		return weft.BadRequest("unit must be 1 to 16 characters with no spaces")
+	}
+
+	return &weft.StatusOK
+}
+
+/*
+typeMinInterval returns the min_interval column from the optional minInterval query parameter.  Values are rate
+limited and rolled up per min_interval so it must divide a day.  There is no column if minInterval isn't set so
+updating a type keeps its min_interval (new types get the default of 60 from the DB).
+*/
+func typeMinInterval(v url.Values) ([]typeColumn, *weft.Result) {
+	if v.Get("minInterval") == "" {
+		return nil, &weft.StatusOK
+	}
+
+	m, err := strconv.Atoi(v.Get("minInterval"))
+	if err != nil || m <= 0 || 86400%m != 0 {
+		return nil, weft.BadRequest("minInterval must be a number of seconds that divides a day")
+	}
+
+	return []typeColumn{{name: "min_interval", value: m}}, &weft.StatusOK
+}
+
+/*
+typeLate returns the late column from the optional late query parameter.  Metrics for the type are late when
+there hasn't been a value for late seconds.  It can be overridden for a device or site (see field_metric_late.go
+and data_latency_late.go).  There is no column if late isn't set so updating a type keeps its late window
+(new types get lateDefault from the DB).
+*/
+func typeLate(v url.Values) ([]typeColumn, *weft.Result) {
+	if v.Get("late") == "" {
+		return nil, &weft.StatusOK
+	}
+
+	l, err := strconv.Atoi(v.Get("late"))
+	if err != nil || l <= 0 {
+		return nil, weft.BadRequest("late must be a number of seconds greater than 0")
+	}
+
+	return []typeColumn{{name: "late", value: l}}, &weft.StatusOK
+}
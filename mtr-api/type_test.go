@@ -0,0 +1,186 @@
+package main
+
+import (
+	wt "github.com/GeoNet/weft/wefttest"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTypeValues(t *testing.T) {
+	in := []struct {
+		id    string
+		query string
+		ok    bool
+	}{
+		{id: wt.L(), query: "description=voltage&unit=mV&scale=0.001&display=V", ok: true},
+		{id: wt.L(), query: "description=voltage&unit=mV&scale=0.001&display=V&minInterval=300", ok: true},
+		{id: wt.L(), query: "description=voltage&unit=mV&scale=0.001&display=V&minInterval=86400", ok: true},
+		{id: wt.L(), query: "description=voltage&unit=mV&scale=0.001&display=V&minInterval=7"},
+		{id: wt.L(), query: "description=voltage&unit=mV&scale=0.001&display=V&minInterval=0"},
+		{id: wt.L(), query: "description=voltage&unit=mV&scale=0&display=V"},
+		{id: wt.L(), query: "description=voltage&unit=mV&scale=-1&display=V"},
+		{id: wt.L(), query: "description=voltage&unit=mV&scale=NaN&display=V"},
+		{id: wt.L(), query: "description=voltage&unit=mV&scale=Inf&display=V"},
+		{id: wt.L(), query: "description=voltage&unit=m%20V&scale=0.001&display=V"},
+		{id: wt.L(), query: "description=voltage&unit=&scale=0.001&display=V"},
+		{id: wt.L(), query: "description=voltage&unit=millivoltsmillivolts&scale=0.001&display=V"},
+		{id: wt.L(), query: "description=voltage&unit=mV&scale=0.001&display="},
+		{id: wt.L(), query: "description=&unit=mV&scale=0.001&display=V"},
+	}
+
+	for _, v := range in {
+		q, err := url.ParseQuery(v.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, res := typeScale(q)
+		if res.Ok {
+			_, res = typeMinInterval(q)
+		}
+
+		if v.ok && !res.Ok {
+			t.Errorf("%s unexpected bad request %s", v.id, res.Msg)
+		}
+
+		if !v.ok && res.Ok {
+			t.Errorf("%s expected bad request", v.id)
+		}
+	}
+}
+
+func TestType(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	var max, typePK, fieldTypePK int
+
+	if err := db.QueryRow(`SELECT max(typePK) FROM field.type`).Scan(&max); err != nil {
+		t.Fatal(err)
+	}
+
+	r := wt.Request{ID: wt.L(), URL: "/field/type?typeID=test.type&description=test&unit=mA&scale=0.001&display=A", Method: "PUT"}
+	if err := doStatus(testServer.URL, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.QueryRow(`SELECT typePK FROM field.type WHERE typeID = 'test.type'`).Scan(&fieldTypePK); err != nil {
+		t.Fatal(err)
+	}
+
+	if fieldTypePK != max+1 {
+		t.Errorf("expected typePK %d got %d", max+1, fieldTypePK)
+	}
+
+	// app types don't use the typePKs kept for mtr.internal.
+	r = wt.Request{ID: wt.L(), URL: "/app/type?typeID=TestType&description=test&unit=n", Method: "PUT"}
+	if err := doStatus(testServer.URL, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.QueryRow(`SELECT typePK FROM app.type WHERE typeID = 'TestType'`).Scan(&typePK); err != nil {
+		t.Fatal(err)
+	}
+
+	if typePK < 10000 {
+		t.Errorf("expected app typePK >= 10000 got %d", typePK)
+	}
+
+	in := wt.Requests{
+		{ID: wt.L(), URL: "/field/model?modelID=Trimble+NetR9", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/device?deviceID=gps-taupoairport&modelID=Trimble+NetR9&latitude=-38.74270&longitude=176.08100", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric?deviceID=gps-taupoairport&typeID=test.type&time=2015-05-14T21:40:30Z&value=100", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/metric/threshold?deviceID=gps-taupoairport&typeID=test.type&lower=0&upper=200", Method: "PUT"},
+		{ID: wt.L(), URL: "/retention?schema=field&typeID=test.type&days=7", Method: "PUT"},
+		// the type has metrics.
+		{ID: wt.L(), URL: "/field/type?typeID=test.type&description=test&unit=A&scale=1&display=A", Method: "PUT", Status: http.StatusBadRequest},
+		{ID: wt.L(), URL: "/field/type?typeID=test.type", Method: "DELETE", Status: http.StatusBadRequest},
+		{ID: wt.L(), URL: "/field/type?typeID=test.type&force=yes", Method: "DELETE", Status: http.StatusBadRequest},
+		// the description and display can be changed.
+		{ID: wt.L(), URL: "/field/type?typeID=test.type&description=test%20current&unit=mA&scale=0.001&display=mA", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/type?typeID=test.type&description=test&unit=A&scale=1&display=A&force=true", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/type?typeID=test.type&force=true", Method: "DELETE"},
+		{ID: wt.L(), URL: "/app/type?typeID=TestType", Method: "DELETE"},
+	}
+
+	for _, v := range in {
+		if err := doStatus(testServer.URL, v); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// deleting the type deletes its metrics, threshold, and retention.
+	for _, q := range []string{
+		`SELECT EXISTS(SELECT 1 FROM field.type WHERE typeID = 'test.type')`,
+		`SELECT EXISTS(SELECT 1 FROM field.metric WHERE typePK = $1)`,
+		`SELECT EXISTS(SELECT 1 FROM field.threshold WHERE typePK = $1)`,
+		`SELECT EXISTS(SELECT 1 FROM mtr.retention WHERE schema = 'field' AND typeID = 'test.type')`,
+		`SELECT EXISTS(SELECT 1 FROM app.type WHERE typeID = 'TestType')`,
+	} {
+		var found bool
+		var err error
+
+		if strings.Contains(q, "$1") {
+			err = db.QueryRow(q, fieldTypePK).Scan(&found)
+		} else {
+			err = db.QueryRow(q).Scan(&found)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found {
+			t.Errorf("expected no rows for %s", q)
+		}
+	}
+}
+
+// TestTypeKeepsColumns checks that updating a type without the optional columns doesn't change them.
+func TestTypeKeepsColumns(t *testing.T) {
+	setupDB(t)
+	defer teardown()
+
+	typeColumns := func(id string) (minInterval, late int) {
+		if err := db.QueryRow(`SELECT min_interval, late FROM field.type WHERE typeID = 'test.keep'`).Scan(&minInterval, &late); err != nil {
+			t.Fatalf("%s %s", id, err)
+		}
+		return
+	}
+
+	in := wt.Requests{
+		{ID: wt.L(), URL: "/field/type?typeID=test.keep&force=true", Method: "DELETE"},
+		{ID: wt.L(), URL: "/field/type?typeID=test.keep&description=test&unit=mA&scale=0.001&display=A", Method: "PUT"},
+	}
+
+	for _, v := range in {
+		if err := doStatus(testServer.URL, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// new types get the defaults.
+	if m, l := typeColumns(wt.L()); m != 60 || l != lateDefault {
+		t.Errorf("expected min_interval 60 and late %d got %d and %d", lateDefault, m, l)
+	}
+
+	in = wt.Requests{
+		{ID: wt.L(), URL: "/field/type?typeID=test.keep&description=test&unit=mA&scale=0.001&display=A&minInterval=300&late=600", Method: "PUT"},
+		{ID: wt.L(), URL: "/field/type?typeID=test.keep&description=test%20keep&unit=mA&scale=0.001&display=A", Method: "PUT"},
+	}
+
+	for _, v := range in {
+		if err := doStatus(testServer.URL, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if m, l := typeColumns(wt.L()); m != 300 || l != 600 {
+		t.Errorf("expected min_interval 300 and late 600 got %d and %d", m, l)
+	}
+
+	if err := doStatus(testServer.URL, wt.Request{ID: wt.L(), URL: "/field/type?typeID=test.keep&force=true", Method: "DELETE"}); err != nil {
+		t.Error(err)
+	}
+}
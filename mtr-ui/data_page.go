@@ -169,7 +169,7 @@ func dataPlotPageHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft.
 
 	if f.Result != nil && len(f.Result) >= 1 {
 		thresholds := f.Result[0]
-		p.Plt.Thresholds = []float64{float64(thresholds.Lower) * thresholds.Scale, float64(thresholds.Upper) * thresholds.Scale}
+		p.Plt.Thresholds = []float64{thresholds.LowerDouble * thresholds.Scale, thresholds.UpperDouble * thresholds.Scale}
 	} else {
 		p.Plt.Thresholds = []float64{0.0, 0.0}
 	}
@@ -537,26 +537,30 @@ func incDataCount(m map[string]idCount, r *mtrpb.DataLatencySummary) {
 
 func dataStatusString(r *mtrpb.DataLatencySummary) string {
 	switch {
-	case r.Upper == 0 && r.Lower == 0:
+	case r.Maintenance:
+		return "maintenance"
+	case r.Late:
+		return "late"
+	case r.UpperDouble == 0 && r.LowerDouble == 0:
 		return "unknown"
+	case r.Bad:
+		return "bad"
 	case allGood(r):
 		return "good"
-		// TBD: late
 	}
 	return "bad"
 }
 
+// allGood returns true if fifty and ninety are inside the thresholds.  The mean is classified by mtr-api (Bad),
+// which allows for the for duration and recovery band on the threshold.
 func allGood(r *mtrpb.DataLatencySummary) bool {
-	if r.Upper == 0 && r.Lower == 0 {
+	if r.UpperDouble == 0 && r.LowerDouble == 0 {
 		return false
 	}
-	if r.Mean < r.Lower || r.Mean > r.Upper {
+	if r.FiftyDouble != 0 && (r.FiftyDouble < r.LowerDouble || r.FiftyDouble > r.UpperDouble) {
 		return false
 	}
-	if r.Fifty != 0 && (r.Fifty < r.Lower || r.Fifty > r.Upper) {
-		return false
-	}
-	if r.Ninety != 0 && (r.Ninety < r.Lower || r.Ninety > r.Upper) {
+	if r.NinetyDouble != 0 && (r.NinetyDouble < r.LowerDouble || r.NinetyDouble > r.UpperDouble) {
 		return false
 	}
 	return true
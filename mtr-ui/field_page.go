@@ -6,6 +6,7 @@ import (
 	"github.com/GeoNet/weft"
 	"github.com/golang/protobuf/proto"
 	"net/http"
+	"net/url"
 	"sort"
 )
 
@@ -146,9 +147,11 @@ func fieldPlotPageHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft
 		return weft.InternalServerError(err)
 	}
 
-	// Set thresholds on plot by drawing a box in dygraph.  Protobuf contains all thresholds, so select ours
+	// Set thresholds on plot by drawing a box in dygraph.  The summary has the threshold for the device or its model
+	// for all devices with the type, so select ours.
 	u := *mtrApiUrl
-	u.Path = "/field/metric/threshold"
+	u.Path = "/field/metric/summary"
+	u.RawQuery = "typeID=" + url.QueryEscape(p.TypeID)
 
 	var err error
 	var protoData []byte
@@ -156,7 +159,7 @@ func fieldPlotPageHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft
 		return weft.InternalServerError(err)
 	}
 
-	var f mtrpb.FieldMetricThresholdResult
+	var f mtrpb.FieldMetricSummaryResult
 	if err = proto.Unmarshal(protoData, &f); err != nil {
 		return weft.InternalServerError(err)
 	}
@@ -164,7 +167,7 @@ func fieldPlotPageHandler(r *http.Request, h http.Header, b *bytes.Buffer) *weft
 	if f.Result != nil {
 		for _, row := range f.Result {
 			if row.DeviceID == p.DeviceID && row.TypeID == p.TypeID {
-				p.Plt.Thresholds = []float64{float64(row.Lower) * row.Scale, float64(row.Upper) * row.Scale}
+				p.Plt.Thresholds = []float64{row.LowerDouble * row.Scale, row.UpperDouble * row.Scale}
 			}
 		}
 	}
@@ -554,11 +557,36 @@ func incFieldCount(m map[string]idCount, r *mtrpb.FieldMetricSummary) {
 
 func fieldStatusString(r *mtrpb.FieldMetricSummary) string {
 	switch {
-	case r.Upper == 0 && r.Lower == 0:
+	case r.Maintenance:
+		return "maintenance"
+	case r.Late:
+		return "late"
+	case r.UpperDouble == 0 && r.LowerDouble == 0:
 		return "unknown"
-	case r.Value >= r.Lower && r.Value <= r.Upper:
+	case r.Bad:
+		return "bad"
+	}
+	return "good"
+}
+
+// fieldStateStatusString returns the status for the declared severity of a field state.
+func fieldStateStatusString(s *mtrpb.FieldState) string {
+	switch s.Severity {
+	case 0:
 		return "good"
-		// TBD: late
+	case 1:
+		return "warning"
 	}
 	return "bad"
 }
+
+// fieldStateString returns the enumerated state or on/off.
+func fieldStateString(s *mtrpb.FieldState) string {
+	switch {
+	case s.State != "":
+		return s.State
+	case s.Value:
+		return "on"
+	}
+	return "off"
+}
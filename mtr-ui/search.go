@@ -28,6 +28,7 @@ type metricInfo struct {
 	Tag              string
 	Status           string
 	CompletenessInfo string
+	State            string // for field states e.g., on or running
 }
 
 func newSearchPage(apiUrl *url.URL) (s *searchPage, err error) {
@@ -71,6 +72,18 @@ func getMatchingMetrics(urlString string) (parsedTags matchingMetrics, err error
 		}
 	}
 
+	if tr.FieldState != nil {
+		for _, v := range tr.FieldState {
+			m := metricInfo{
+				TypeID:   v.TypeID,
+				DeviceID: v.DeviceID,
+				Status:   fieldStateStatusString(v),
+				State:    fieldStateString(v),
+			}
+			parsedTags = append(parsedTags, m)
+		}
+	}
+
 	if tr.DataLatency != nil {
 		for _, v := range tr.DataLatency {
 			m := metricInfo{
@@ -24,26 +24,26 @@ var funcMap = template.FuncMap{
 	"rfc3339str": func(sec int64) string {
 		return time.Unix(sec, 0).Format(time.RFC3339)
 	},
-	"latencyColour": func(r *mtrpb.DataLatency, lower, upper int32) string {
+	"latencyColour": func(r *mtrpb.DataLatency, lower, upper float64) string {
 		if upper == 0 && lower == 0 {
 			return "red"
 		}
-		if r.Mean < float32(lower) || r.Mean > float32(upper) {
+		if r.MeanDouble < lower || r.MeanDouble > upper {
 			return "red"
 		}
-		if r.Fifty != 0 && (r.Fifty < lower || r.Fifty > upper) {
+		if r.FiftyDouble != 0 && (r.FiftyDouble < lower || r.FiftyDouble > upper) {
 			return "red"
 		}
-		if r.Ninety != 0 && (r.Ninety < lower || r.Ninety > upper) {
+		if r.NinetyDouble != 0 && (r.NinetyDouble < lower || r.NinetyDouble > upper) {
 			return "red"
 		}
 		return "black"
 	},
-	"fieldColour": func(r *mtrpb.FieldMetric, lower, upper int32) string {
+	"fieldColour": func(r *mtrpb.FieldMetric, lower, upper float64) string {
 		if upper == 0 && lower == 0 {
 			return "red"
 		}
-		if r.Value < float32(lower) || r.Value > float32(upper) {
+		if r.ValueDouble < lower || r.ValueDouble > upper {
 			return "red"
 		}
 		return "black"
@@ -18,6 +18,7 @@ var (
 	MsgTx                     = Counter{id: internal.MsgTx}                     // Message transmitted.
 	MsgProc                   = Counter{id: internal.MsgProc}                   // Message processed.
 	MsgErr                    = Counter{id: internal.MsgErr}                    // Message error.
+	Deleted                   = Counter{id: internal.Deleted}                   // Rows deleted.
 )
 
 var counters = [...]*Counter{
@@ -32,6 +33,7 @@ var counters = [...]*Counter{
 	&MsgTx,
 	&MsgProc,
 	&MsgErr,
+	&Deleted,
 }
 
 var lastVal [len(counters)]uint64
@@ -48,6 +50,11 @@ func (c *Counter) Inc() {
 	atomic.AddUint64(&c.i, 1)
 }
 
+// Add increments the counter by n.
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.i, n)
+}
+
 func (c *Counter) value() uint64 {
 	return atomic.LoadUint64(&c.i)
 }
@@ -13,11 +13,9 @@ package mtrapp
 import (
 	"github.com/GeoNet/mtr/internal"
 	"log"
-	"math"
 	"net/http"
 	"os"
 	"runtime"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -99,8 +97,8 @@ func init() {
 
 					for k, v := range count {
 						a := sum[k] / v
-						f := percentile(0.5, taken[k])
-						n := percentile(0.9, taken[k])
+						f := internal.Percentile(0.5, taken[k])
+						n := internal.Percentile(0.9, taken[k])
 
 						go sendTimer(k, last, v, a, f, n)
 
@@ -116,29 +114,6 @@ func init() {
 	}
 }
 
-// calculates the kth percentile of v
-func percentile(k float64, v []int) (value int) {
-	if !sort.IntsAreSorted(v) {
-		sort.Ints(v)
-	}
-
-	p := k * float64(len(v))
-
-	if p != math.Trunc(p) {
-		idx := int(math.Ceil(p))
-		if idx <= len(v) {
-			value = v[int(math.Ceil(p))-1]
-		}
-	} else {
-		idx := int(math.Trunc(p))
-		if idx < len(v) {
-			value = int((v[idx-1] + v[idx]) / 2)
-		}
-	}
-
-	return
-}
-
 func sendMetric(typeID internal.ID, t time.Time, value int64) {
 	var req *http.Request
 	var res *http.Response
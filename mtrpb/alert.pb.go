@@ -0,0 +1,181 @@
+// Code generated by protoc-gen-go.
+// source: alert.proto
+// DO NOT EDIT!
+
+package mtrpb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// Alert is a period when a field metric or data latency was bad or late.
+type Alert struct {
+	// The schema for the metric: field (field.metric) or data (data.latency).
+	Schema string `protobuf:"bytes,1,opt,name=schema" json:"schema,omitempty"`
+	// The deviceID for field metrics e.g., gps-taupoairport
+	DeviceID string `protobuf:"bytes,2,opt,name=device_iD,json=deviceID" json:"device_iD,omitempty"`
+	// The siteID for data latencies e.g., TAUP
+	SiteID string `protobuf:"bytes,3,opt,name=site_iD,json=siteID" json:"site_iD,omitempty"`
+	// The typeID for the metric e.g., voltage
+	TypeID string `protobuf:"bytes,4,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	// The state of the metric: bad (outside its thresholds) or late (no recent values).
+	State string `protobuf:"bytes,5,opt,name=state" json:"state,omitempty"`
+	// The latest value (mean for latency) when the alert started.
+	Value float64 `protobuf:"fixed64,6,opt,name=value" json:"value,omitempty"`
+	// Unix time in seconds when the alert started.
+	StartSeconds int64 `protobuf:"varint,7,opt,name=start_seconds,json=startSeconds" json:"start_seconds,omitempty"`
+	// Unix time in seconds when the alert was resolved.  0 if the alert is still firing.
+	EndSeconds int64 `protobuf:"varint,8,opt,name=end_seconds,json=endSeconds" json:"end_seconds,omitempty"`
+}
+
+func (m *Alert) Reset()                    { *m = Alert{} }
+func (m *Alert) String() string            { return proto.CompactTextString(m) }
+func (*Alert) ProtoMessage()               {}
+func (*Alert) Descriptor() ([]byte, []int) { return fileDescriptor5, []int{0} }
+
+type AlertResult struct {
+	Result []*Alert `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *AlertResult) Reset()                    { *m = AlertResult{} }
+func (m *AlertResult) String() string            { return proto.CompactTextString(m) }
+func (*AlertResult) ProtoMessage()               {}
+func (*AlertResult) Descriptor() ([]byte, []int) { return fileDescriptor5, []int{1} }
+
+func (m *AlertResult) GetResult() []*Alert {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+// Notification is the delivery of an alert to a notification target.
+type Notification struct {
+	// The name of the target in the notification config.
+	Target string `protobuf:"bytes,1,opt,name=target" json:"target,omitempty"`
+	// How the notification is sent: webhook or email.
+	Method string `protobuf:"bytes,2,opt,name=method" json:"method,omitempty"`
+	// The webhook URL or the email addresses (comma separated).
+	Address string `protobuf:"bytes,3,opt,name=address" json:"address,omitempty"`
+	// The alert as JSON.  This is the body of webhooks.
+	Body string `protobuf:"bytes,4,opt,name=body" json:"body,omitempty"`
+	// The delivery status: pending, sent, or failed.
+	Status string `protobuf:"bytes,5,opt,name=status" json:"status,omitempty"`
+	// The number of times delivery has been tried.
+	Attempts int32 `protobuf:"varint,6,opt,name=attempts" json:"attempts,omitempty"`
+	// The error from the last failed attempt.
+	Error string `protobuf:"bytes,7,opt,name=error" json:"error,omitempty"`
+	// Unix time in seconds when the notification was queued.
+	CreatedSeconds int64 `protobuf:"varint,8,opt,name=created_seconds,json=createdSeconds" json:"created_seconds,omitempty"`
+	// Unix time in seconds when the notification was sent.  0 if it hasn't been sent.
+	SentSeconds int64 `protobuf:"varint,9,opt,name=sent_seconds,json=sentSeconds" json:"sent_seconds,omitempty"`
+}
+
+func (m *Notification) Reset()                    { *m = Notification{} }
+func (m *Notification) String() string            { return proto.CompactTextString(m) }
+func (*Notification) ProtoMessage()               {}
+func (*Notification) Descriptor() ([]byte, []int) { return fileDescriptor5, []int{2} }
+
+type NotificationResult struct {
+	Result []*Notification `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *NotificationResult) Reset()                    { *m = NotificationResult{} }
+func (m *NotificationResult) String() string            { return proto.CompactTextString(m) }
+func (*NotificationResult) ProtoMessage()               {}
+func (*NotificationResult) Descriptor() ([]byte, []int) { return fileDescriptor5, []int{3} }
+
+func (m *NotificationResult) GetResult() []*Notification {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+// Silence is a maintenance window.  While it is active the matching field metrics and data latencies
+// that are bad or late are shown as maintenance and don't alert.  Empty targets match everything,
+// a silence matches a metric when all of its targets do.
+type Silence struct {
+	SilenceID int64 `protobuf:"varint,1,opt,name=silence_iD,json=silenceID" json:"silence_iD,omitempty"`
+	// The deviceID to silence field metrics for e.g., gps-taupoairport
+	DeviceID string `protobuf:"bytes,2,opt,name=device_iD,json=deviceID" json:"device_iD,omitempty"`
+	// The siteID to silence data latencies for e.g., TAUP
+	SiteID string `protobuf:"bytes,3,opt,name=site_iD,json=siteID" json:"site_iD,omitempty"`
+	// The tag to silence metrics for e.g., TAUP
+	Tag string `protobuf:"bytes,4,opt,name=tag" json:"tag,omitempty"`
+	// The typeID to silence e.g., voltage
+	TypeID string `protobuf:"bytes,5,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	// Unix time in seconds when the silence starts.
+	StartSeconds int64 `protobuf:"varint,6,opt,name=start_seconds,json=startSeconds" json:"start_seconds,omitempty"`
+	// Unix time in seconds when the silence ends.
+	EndSeconds int64 `protobuf:"varint,7,opt,name=end_seconds,json=endSeconds" json:"end_seconds,omitempty"`
+	// Why the metrics are silenced e.g., site visit.
+	Reason string `protobuf:"bytes,8,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *Silence) Reset()                    { *m = Silence{} }
+func (m *Silence) String() string            { return proto.CompactTextString(m) }
+func (*Silence) ProtoMessage()               {}
+func (*Silence) Descriptor() ([]byte, []int) { return fileDescriptor5, []int{4} }
+
+type SilenceResult struct {
+	Result []*Silence `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *SilenceResult) Reset()                    { *m = SilenceResult{} }
+func (m *SilenceResult) String() string            { return proto.CompactTextString(m) }
+func (*SilenceResult) ProtoMessage()               {}
+func (*SilenceResult) Descriptor() ([]byte, []int) { return fileDescriptor5, []int{5} }
+
+func (m *SilenceResult) GetResult() []*Silence {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Alert)(nil), "mtrpb.Alert")
+	proto.RegisterType((*AlertResult)(nil), "mtrpb.AlertResult")
+	proto.RegisterType((*Notification)(nil), "mtrpb.Notification")
+	proto.RegisterType((*NotificationResult)(nil), "mtrpb.NotificationResult")
+	proto.RegisterType((*Silence)(nil), "mtrpb.Silence")
+	proto.RegisterType((*SilenceResult)(nil), "mtrpb.SilenceResult")
+}
+
+var fileDescriptor5 = []byte{
+	// 444 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x93, 0xbf, 0x6f, 0xd3, 0x40,
+	0x14, 0xc7, 0x75, 0x4d, 0x6d, 0xc7, 0xcf, 0x69, 0x41, 0x07, 0x02, 0x0b, 0x84, 0x08, 0x01, 0x41,
+	0x24, 0xa4, 0x0c, 0x74, 0x60, 0x2e, 0xca, 0x92, 0x85, 0xc1, 0xdd, 0x58, 0xaa, 0x8b, 0xfd, 0x68,
+	0x4f, 0x4a, 0x7c, 0xd1, 0xdd, 0x4b, 0xa5, 0xae, 0xfc, 0xa5, 0x6c, 0xfc, 0x1b, 0xe8, 0xde, 0x3d,
+	0x97, 0x36, 0x0c, 0x48, 0x6c, 0xef, 0xfb, 0x23, 0x8a, 0xfc, 0xf1, 0xd7, 0x50, 0x99, 0x0d, 0x7a,
+	0x5a, 0xec, 0xbc, 0x23, 0xa7, 0xb3, 0x2d, 0xf9, 0xdd, 0x7a, 0xf6, 0x53, 0x41, 0x76, 0x1e, 0x6d,
+	0xfd, 0x0c, 0xf2, 0xd0, 0x5e, 0xe3, 0xd6, 0xd4, 0x6a, 0xaa, 0xe6, 0x65, 0x23, 0x4a, 0xbf, 0x84,
+	0xb2, 0xc3, 0x1b, 0xdb, 0xe2, 0xa5, 0x5d, 0xd6, 0x47, 0x1c, 0x8d, 0x93, 0xb1, 0x5a, 0xea, 0xe7,
+	0x50, 0x04, 0x4b, 0x1c, 0x8d, 0xe4, 0x57, 0x96, 0x24, 0xa0, 0xdb, 0x1d, 0x07, 0xc7, 0x29, 0x88,
+	0x72, 0xb5, 0xd4, 0x4f, 0x21, 0x0b, 0x64, 0x08, 0xeb, 0x8c, 0xed, 0x24, 0xa2, 0x7b, 0x63, 0x36,
+	0x7b, 0xac, 0xf3, 0xa9, 0x9a, 0xab, 0x26, 0x09, 0xfd, 0x16, 0x4e, 0x02, 0x19, 0x4f, 0x97, 0x01,
+	0x5b, 0xd7, 0x77, 0xa1, 0x2e, 0xa6, 0x6a, 0x3e, 0x6a, 0x26, 0x6c, 0x5e, 0x24, 0x4f, 0xbf, 0x86,
+	0x0a, 0xfb, 0xee, 0xae, 0x32, 0xe6, 0x0a, 0x60, 0xdf, 0x49, 0x61, 0x76, 0x06, 0x15, 0x3f, 0x61,
+	0x83, 0x61, 0xbf, 0x21, 0xfd, 0x0e, 0x72, 0xcf, 0x57, 0xad, 0xa6, 0xa3, 0x79, 0xf5, 0x69, 0xb2,
+	0x60, 0x12, 0x8b, 0xd4, 0x91, 0x6c, 0xf6, 0xe3, 0x08, 0x26, 0x5f, 0x1d, 0xd9, 0xef, 0xb6, 0x35,
+	0x64, 0x5d, 0x1f, 0xf1, 0x90, 0xf1, 0x57, 0x48, 0x03, 0x9e, 0xa4, 0xa2, 0xbf, 0x45, 0xba, 0x76,
+	0x9d, 0xb0, 0x11, 0xa5, 0x6b, 0x28, 0x4c, 0xd7, 0x79, 0x0c, 0x41, 0xc8, 0x0c, 0x52, 0x6b, 0x38,
+	0x5e, 0xbb, 0xee, 0x56, 0xb8, 0xf0, 0xcd, 0xf0, 0xc9, 0xd0, 0x3e, 0x08, 0x16, 0x51, 0xfa, 0x05,
+	0x8c, 0x0d, 0x11, 0x6e, 0x77, 0x14, 0x18, 0x4d, 0xd6, 0xdc, 0xe9, 0xc8, 0x0c, 0xbd, 0x77, 0x9e,
+	0xa9, 0x94, 0x4d, 0x12, 0xfa, 0x03, 0x3c, 0x6a, 0x3d, 0x1a, 0xc2, 0x43, 0x24, 0xa7, 0x62, 0x0f,
+	0xdc, 0xde, 0xc0, 0x24, 0x60, 0xff, 0x87, 0x6d, 0xc9, 0xad, 0x2a, 0x7a, 0x03, 0xb9, 0x73, 0xd0,
+	0xf7, 0x19, 0x08, 0xc0, 0x8f, 0x07, 0x00, 0x9f, 0x08, 0xc0, 0x07, 0xd5, 0x81, 0xe3, 0x2f, 0x05,
+	0xc5, 0x85, 0xdd, 0x60, 0xdf, 0xa2, 0x7e, 0x05, 0x10, 0xd2, 0x19, 0x67, 0xa1, 0xf8, 0xff, 0x4a,
+	0x71, 0x56, 0xcb, 0xff, 0x1c, 0xda, 0x63, 0x18, 0x91, 0xb9, 0x12, 0x98, 0xf1, 0xbc, 0x3f, 0xbd,
+	0xec, 0xc1, 0xf4, 0xfe, 0x9a, 0x53, 0xfe, 0xef, 0x39, 0x15, 0x87, 0x73, 0x8a, 0xaf, 0xca, 0xa3,
+	0x09, 0xae, 0x67, 0xae, 0x65, 0x23, 0x6a, 0xf6, 0x19, 0x4e, 0xe4, 0x41, 0x85, 0xd3, 0xfb, 0x03,
+	0x4e, 0xa7, 0xc2, 0x69, 0x68, 0x49, 0xfa, 0xa5, 0xf8, 0x96, 0xbe, 0xc5, 0x75, 0xce, 0x5f, 0xe6,
+	0xd9, 0xef, 0x01, 0x00, 0x2a, 0x92, 0x4a, 0x1f, 0xa8, 0x03, 0x00, 0x00,
+}
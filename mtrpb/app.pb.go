@@ -10,10 +10,16 @@ It is generated from these files:
 	data.proto
 	field.proto
 	tag.proto
+	retention.proto
+	alert.proto
 
 It has these top-level messages:
 	AppIDSummary
 	AppIDSummaryResult
+	AppType
+	AppTypeResult
+	PrometheusUnmatched
+	PrometheusUnmatchedResult
 	DataLatencySummary
 	DataLatencySummaryResult
 	DataSite
@@ -22,6 +28,10 @@ It has these top-level messages:
 	DataLatencyTagResult
 	DataLatencyThreshold
 	DataLatencyThresholdResult
+	DataLatencyLate
+	DataLatencyLateResult
+	DataLatencyAnomaly
+	DataLatencyAnomalyResult
 	DataType
 	DataTypeResult
 	DataLatency
@@ -30,12 +40,23 @@ It has these top-level messages:
 	DataCompletenessSummaryResult
 	DataCompletenessTag
 	DataCompletenessTagResult
+	DataLatencyBatch
+	DataLatencyBatchValue
+	DataCompletenessBatch
+	DataCompletenessBatchValue
+	DataBatchResult
 	FieldMetricSummary
 	FieldMetricSummaryResult
 	FieldMetricTag
 	FieldMetricTagResult
 	FieldMetricThreshold
 	FieldMetricThresholdResult
+	FieldModelThreshold
+	FieldModelThresholdResult
+	FieldMetricLate
+	FieldMetricLateResult
+	FieldMetricAnomaly
+	FieldMetricAnomalyResult
 	FieldModel
 	FieldModelResult
 	FieldDevice
@@ -44,13 +65,29 @@ It has these top-level messages:
 	FieldTypeResult
 	FieldState
 	FieldStateResult
+	FieldStateValue
+	FieldStateValueResult
 	FieldStateTag
 	FieldStateTagResult
 	FieldMetric
 	FieldMetricResult
+	FieldMetricBatch
+	FieldMetricBatchValue
+	BatchStatus
+	FieldMetricBatchResult
 	Tag
 	TagResult
 	TagSearchResult
+	Retention
+	RetentionResult
+	Archive
+	ArchiveResult
+	Alert
+	AlertResult
+	Notification
+	NotificationResult
+	Silence
+	SilenceResult
 */
 package mtrpb
 
@@ -95,20 +132,97 @@ func (m *AppIDSummaryResult) GetResult() []*AppIDSummary {
 	return nil
 }
 
+type AppType struct {
+	// The typePK in the table app.type.  Use it as the typeID for application metrics and counters.
+	TypePK int32 `protobuf:"varint,1,opt,name=type_pK,json=typePK" json:"type_pK,omitempty"`
+	// The typeID in the table app.type e.g., MemSys
+	TypeID      string `protobuf:"bytes,2,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	Description string `protobuf:"bytes,3,opt,name=description" json:"description,omitempty"`
+	// The unit for values of the type e.g., bytes
+	Unit string `protobuf:"bytes,4,opt,name=unit" json:"unit,omitempty"`
+}
+
+func (m *AppType) Reset()                    { *m = AppType{} }
+func (m *AppType) String() string            { return proto.CompactTextString(m) }
+func (*AppType) ProtoMessage()               {}
+func (*AppType) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+type AppTypeResult struct {
+	Result []*AppType `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *AppTypeResult) Reset()                    { *m = AppTypeResult{} }
+func (m *AppTypeResult) String() string            { return proto.CompactTextString(m) }
+func (*AppTypeResult) ProtoMessage()               {}
+func (*AppTypeResult) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *AppTypeResult) GetResult() []*AppType {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+// PrometheusUnmatched counts the series sent with Prometheus remote write
+// that did not match a mapping rule.
+type PrometheusUnmatched struct {
+	// The metric name (the __name__ label) for the series e.g., go_goroutines
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	// The number of series received that did not match.
+	Count int64 `protobuf:"varint,2,opt,name=count" json:"count,omitempty"`
+	// Unix time in seconds the series was last received.
+	Seconds int64 `protobuf:"varint,3,opt,name=seconds" json:"seconds,omitempty"`
+}
+
+func (m *PrometheusUnmatched) Reset()                    { *m = PrometheusUnmatched{} }
+func (m *PrometheusUnmatched) String() string            { return proto.CompactTextString(m) }
+func (*PrometheusUnmatched) ProtoMessage()               {}
+func (*PrometheusUnmatched) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+type PrometheusUnmatchedResult struct {
+	Result []*PrometheusUnmatched `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *PrometheusUnmatchedResult) Reset()                    { *m = PrometheusUnmatchedResult{} }
+func (m *PrometheusUnmatchedResult) String() string            { return proto.CompactTextString(m) }
+func (*PrometheusUnmatchedResult) ProtoMessage()               {}
+func (*PrometheusUnmatchedResult) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *PrometheusUnmatchedResult) GetResult() []*PrometheusUnmatched {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*AppIDSummary)(nil), "mtrpb.AppIDSummary")
 	proto.RegisterType((*AppIDSummaryResult)(nil), "mtrpb.AppIDSummaryResult")
+	proto.RegisterType((*AppType)(nil), "mtrpb.AppType")
+	proto.RegisterType((*AppTypeResult)(nil), "mtrpb.AppTypeResult")
+	proto.RegisterType((*PrometheusUnmatched)(nil), "mtrpb.PrometheusUnmatched")
+	proto.RegisterType((*PrometheusUnmatchedResult)(nil), "mtrpb.PrometheusUnmatchedResult")
 }
 
 var fileDescriptor0 = []byte{
-	// 132 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0x4c, 0x2c, 0x28, 0xd0,
-	0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0xcd, 0x2d, 0x29, 0x2a, 0x48, 0x52, 0x32, 0xe5, 0xe2,
-	0x71, 0x2c, 0x28, 0xf0, 0x74, 0x09, 0x2e, 0xcd, 0xcd, 0x4d, 0x2c, 0xaa, 0x14, 0x52, 0xe5, 0xe2,
-	0x03, 0xaa, 0xc9, 0xc9, 0x4c, 0x4e, 0x2c, 0xc9, 0xcc, 0xcf, 0x8b, 0xcf, 0x74, 0x91, 0x60, 0x54,
-	0x60, 0xd4, 0xe0, 0x0c, 0xe2, 0x45, 0x12, 0xf5, 0x74, 0x51, 0x72, 0xe4, 0x12, 0x42, 0xd6, 0x16,
-	0x94, 0x5a, 0x5c, 0x9a, 0x53, 0x22, 0xa4, 0xcd, 0xc5, 0x56, 0x04, 0x66, 0x01, 0x35, 0x31, 0x6b,
-	0x70, 0x1b, 0x09, 0xeb, 0x81, 0x2d, 0xd1, 0x43, 0x51, 0x0a, 0x55, 0xe2, 0xc4, 0x1e, 0x05, 0x71,
-	0x42, 0x12, 0x1b, 0xd8, 0x41, 0xc6, 0x80, 0x00, 0x00, 0x00, 0xff, 0xff, 0x4d, 0x1e, 0xa5, 0xab,
-	0x9d, 0x00, 0x00, 0x00,
+	// 294 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x91, 0x41, 0x6b, 0x02, 0x31,
+	0x10, 0x85, 0xb1, 0xab, 0x2e, 0x8e, 0xd5, 0x43, 0x2c, 0x34, 0xed, 0x49, 0x16, 0x5a, 0x84, 0x82,
+	0x07, 0x4b, 0xe9, 0xd9, 0xb2, 0x17, 0xf1, 0x50, 0xd9, 0xb6, 0x87, 0xf6, 0x22, 0x71, 0x0d, 0x18,
+	0x30, 0xc9, 0x34, 0x9b, 0x3d, 0xec, 0xbf, 0x2f, 0x3b, 0xc6, 0x76, 0x2b, 0xde, 0x66, 0xe6, 0xbd,
+	0xc9, 0xfb, 0xc8, 0x40, 0x4f, 0x20, 0x4e, 0xd1, 0x59, 0x6f, 0x59, 0x47, 0x7b, 0x87, 0x9b, 0xe4,
+	0x09, 0x2e, 0xe7, 0x88, 0x8b, 0xf4, 0xad, 0xd4, 0x5a, 0xb8, 0x8a, 0xdd, 0xc1, 0x50, 0x20, 0xee,
+	0x55, 0x2e, 0xbc, 0xb2, 0x66, 0xad, 0x52, 0xde, 0x1a, 0xb7, 0x26, 0xbd, 0x6c, 0xd0, 0x98, 0x2e,
+	0xd2, 0x64, 0x0e, 0xac, 0xb9, 0x96, 0xc9, 0xa2, 0xdc, 0x7b, 0xf6, 0x00, 0x5d, 0x47, 0x15, 0x6f,
+	0x8d, 0xa3, 0x49, 0x7f, 0x36, 0x9a, 0x52, 0xc8, 0xf4, 0x9f, 0x35, 0x58, 0x92, 0x6f, 0x88, 0xe7,
+	0x88, 0xef, 0x15, 0x4a, 0x76, 0x0d, 0xb1, 0xaf, 0x50, 0xae, 0x71, 0x49, 0x69, 0x9d, 0xac, 0x5b,
+	0xb7, 0xab, 0xe5, 0xaf, 0xa0, 0x52, 0x7e, 0x41, 0x18, 0x24, 0x2c, 0x52, 0x36, 0x86, 0xfe, 0x56,
+	0x16, 0xb9, 0x53, 0x58, 0x03, 0xf1, 0x88, 0xc4, 0xe6, 0x88, 0x31, 0x68, 0x97, 0x46, 0x79, 0xde,
+	0x26, 0x89, 0xea, 0xe4, 0x19, 0x06, 0x21, 0x32, 0x00, 0xdf, 0x9f, 0x00, 0x0f, 0xff, 0x80, 0xc9,
+	0x75, 0x64, 0xfd, 0x84, 0xd1, 0xca, 0x59, 0x2d, 0xfd, 0x4e, 0x96, 0xc5, 0x87, 0xd1, 0xc2, 0xe7,
+	0x3b, 0xb9, 0xad, 0x33, 0x8c, 0xd0, 0x32, 0x7c, 0x11, 0xd5, 0xec, 0x0a, 0x3a, 0xb9, 0x2d, 0x8d,
+	0x27, 0xe0, 0x28, 0x3b, 0x34, 0x8c, 0x43, 0x5c, 0xc8, 0xdc, 0x9a, 0x6d, 0x41, 0xac, 0x51, 0x76,
+	0x6c, 0x93, 0x57, 0xb8, 0x39, 0xf3, 0x74, 0xe0, 0x9b, 0x9d, 0xf0, 0xdd, 0x06, 0xbe, 0x73, 0x1b,
+	0xc1, 0xf9, 0x12, 0x7f, 0x1d, 0x4e, 0xbb, 0xe9, 0xd2, 0xa1, 0x1f, 0x7f, 0x06, 0x00, 0x99, 0x71,
+	0xf7, 0xa6, 0xf5, 0x01, 0x00, 0x00,
 }
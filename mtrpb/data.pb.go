@@ -35,6 +35,22 @@ type DataLatencySummary struct {
 	Lower int32 `protobuf:"varint,8,opt,name=lower" json:"lower,omitempty"`
 	// the scale factor to apply to the threshold values
 	Scale float64 `protobuf:"fixed64,9,opt,name=scale" json:"scale,omitempty"`
+	// true if the site was auto registered and has not been confirmed.
+	Pending bool `protobuf:"varint,10,opt,name=pending" json:"pending,omitempty"`
+	// The values without rounding.  mean, fifty, ninety, upper, and lower are rounded for older clients.
+	MeanDouble   float64 `protobuf:"fixed64,11,opt,name=mean_double,json=meanDouble" json:"mean_double,omitempty"`
+	FiftyDouble  float64 `protobuf:"fixed64,12,opt,name=fifty_double,json=fiftyDouble" json:"fifty_double,omitempty"`
+	NinetyDouble float64 `protobuf:"fixed64,13,opt,name=ninety_double,json=ninetyDouble" json:"ninety_double,omitempty"`
+	UpperDouble  float64 `protobuf:"fixed64,14,opt,name=upper_double,json=upperDouble" json:"upper_double,omitempty"`
+	LowerDouble  float64 `protobuf:"fixed64,15,opt,name=lower_double,json=lowerDouble" json:"lower_double,omitempty"`
+	// true if there hasn't been a value for longer than the late window for the latency.
+	Late bool `protobuf:"varint,16,opt,name=late" json:"late,omitempty"`
+	// true if the latency is bad or late but silenced for maintenance (see Silence).
+	Maintenance bool `protobuf:"varint,17,opt,name=maintenance" json:"maintenance,omitempty"`
+	// true if the mean has been outside the thresholds for the for duration and hasn't come back inside the recovery band.
+	Bad bool `protobuf:"varint,18,opt,name=bad" json:"bad,omitempty"`
+	// rate or baseline if the mean broke the DataLatencyAnomaly thresholds for the latency, otherwise empty.
+	Anomaly string `protobuf:"bytes,19,opt,name=anomaly" json:"anomaly,omitempty"`
 }
 
 func (m *DataLatencySummary) Reset()                    { *m = DataLatencySummary{} }
@@ -65,6 +81,9 @@ type DataSite struct {
 	Latitude float64 `protobuf:"fixed64,2,opt,name=latitude" json:"latitude,omitempty"`
 	// The site longitude - not usually accurate enough for meta data
 	Longitude float64 `protobuf:"fixed64,3,opt,name=longitude" json:"longitude,omitempty"`
+	// true if the site was auto registered and has not been confirmed.
+	// The location is unknown.
+	Pending bool `protobuf:"varint,4,opt,name=pending" json:"pending,omitempty"`
 }
 
 func (m *DataSite) Reset()                    { *m = DataSite{} }
@@ -129,6 +148,13 @@ type DataLatencyThreshold struct {
 	Upper int32 `protobuf:"varint,4,opt,name=upper" json:"upper,omitempty"`
 	// the scale factor to apply to the threshold values
 	Scale float64 `protobuf:"fixed64,5,opt,name=scale" json:"scale,omitempty"`
+	// The lower and upper thresholds without rounding.
+	LowerDouble float64 `protobuf:"fixed64,6,opt,name=lower_double,json=lowerDouble" json:"lower_double,omitempty"`
+	UpperDouble float64 `protobuf:"fixed64,7,opt,name=upper_double,json=upperDouble" json:"upper_double,omitempty"`
+	// The seconds the mean must stay outside the thresholds before the latency is bad.
+	ForSeconds int32 `protobuf:"varint,8,opt,name=for_seconds,json=forSeconds" json:"for_seconds,omitempty"`
+	// A bad latency is good again once the mean is inside lower + hysteresis and upper - hysteresis.
+	Hysteresis float64 `protobuf:"fixed64,9,opt,name=hysteresis" json:"hysteresis,omitempty"`
 }
 
 func (m *DataLatencyThreshold) Reset()                    { *m = DataLatencyThreshold{} }
@@ -152,17 +178,96 @@ func (m *DataLatencyThresholdResult) GetResult() []*DataLatencyThreshold {
 	return nil
 }
 
+// DataLatencyLate is the late window for a site and type.  It overrides the late window for the type.
+type DataLatencyLate struct {
+	// The siteID for the latency e.g., TAUP
+	SiteID string `protobuf:"bytes,1,opt,name=site_iD,json=siteID" json:"site_iD,omitempty"`
+	// The typeID for the latency e.g., latency.strong
+	TypeID string `protobuf:"bytes,2,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	// The latency is late when there hasn't been a value for this many seconds.
+	Late int32 `protobuf:"varint,3,opt,name=late" json:"late,omitempty"`
+}
+
+func (m *DataLatencyLate) Reset()                    { *m = DataLatencyLate{} }
+func (m *DataLatencyLate) String() string            { return proto.CompactTextString(m) }
+func (*DataLatencyLate) ProtoMessage()               {}
+func (*DataLatencyLate) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{8} }
+
+type DataLatencyLateResult struct {
+	Result []*DataLatencyLate `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *DataLatencyLateResult) Reset()                    { *m = DataLatencyLateResult{} }
+func (m *DataLatencyLateResult) String() string            { return proto.CompactTextString(m) }
+func (*DataLatencyLateResult) ProtoMessage()               {}
+func (*DataLatencyLateResult) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{9} }
+
+func (m *DataLatencyLateResult) GetResult() []*DataLatencyLate {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+// DataLatencyAnomaly is the rate of change and baseline thresholds for a site and type.
+// They are checked as well as the lower and upper thresholds.
+type DataLatencyAnomaly struct {
+	// The siteID for the latency e.g., TAUP
+	SiteID string `protobuf:"bytes,1,opt,name=site_iD,json=siteID" json:"site_iD,omitempty"`
+	// The typeID for the latency e.g., latency.strong
+	TypeID string `protobuf:"bytes,2,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	// The largest change in the mean per hour.  0 for none.
+	Rate float64 `protobuf:"fixed64,3,opt,name=rate" json:"rate,omitempty"`
+	// The mean is bad if it is more than deviations standard deviations from the mean for the same hour
+	// on the last days days.  0 for none.
+	Deviations float64 `protobuf:"fixed64,4,opt,name=deviations" json:"deviations,omitempty"`
+	Days       int32   `protobuf:"varint,5,opt,name=days" json:"days,omitempty"`
+}
+
+func (m *DataLatencyAnomaly) Reset()                    { *m = DataLatencyAnomaly{} }
+func (m *DataLatencyAnomaly) String() string            { return proto.CompactTextString(m) }
+func (*DataLatencyAnomaly) ProtoMessage()               {}
+func (*DataLatencyAnomaly) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{10} }
+
+type DataLatencyAnomalyResult struct {
+	Result []*DataLatencyAnomaly `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *DataLatencyAnomalyResult) Reset()                    { *m = DataLatencyAnomalyResult{} }
+func (m *DataLatencyAnomalyResult) String() string            { return proto.CompactTextString(m) }
+func (*DataLatencyAnomalyResult) ProtoMessage()               {}
+func (*DataLatencyAnomalyResult) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{11} }
+
+func (m *DataLatencyAnomalyResult) GetResult() []*DataLatencyAnomaly {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
 type DataType struct {
 	// The TypeID in the table data.type
 	TypeID string `protobuf:"bytes,1,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
 	// The display field in the table data.type (the y label for plotting)
 	Display string `protobuf:"bytes,2,opt,name=display" json:"display,omitempty"`
+	// The minimum number of seconds between values for the type.
+	MinInterval int32 `protobuf:"varint,3,opt,name=min_interval,json=minInterval" json:"min_interval,omitempty"`
+	// description in the table data.type
+	Description string `protobuf:"bytes,4,opt,name=description" json:"description,omitempty"`
+	// unit in the table data.type, the units the values are stored in e.g., ms
+	Unit string `protobuf:"bytes,5,opt,name=unit" json:"unit,omitempty"`
+	// scale in the table data.type, multiply the stored values by scale to convert them to display
+	Scale float64 `protobuf:"fixed64,6,opt,name=scale" json:"scale,omitempty"`
+	// expected in the table data.completeness_type, the number of values expected per day
+	Expected int32 `protobuf:"varint,7,opt,name=expected" json:"expected,omitempty"`
+	// late in the table data.type, latencies are late when there hasn't been a value for this many seconds.
+	Late int32 `protobuf:"varint,8,opt,name=late" json:"late,omitempty"`
 }
 
 func (m *DataType) Reset()                    { *m = DataType{} }
 func (m *DataType) String() string            { return proto.CompactTextString(m) }
 func (*DataType) ProtoMessage()               {}
-func (*DataType) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{8} }
+func (*DataType) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{12} }
 
 type DataTypeResult struct {
 	Result []*DataType `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
@@ -171,7 +276,7 @@ type DataTypeResult struct {
 func (m *DataTypeResult) Reset()                    { *m = DataTypeResult{} }
 func (m *DataTypeResult) String() string            { return proto.CompactTextString(m) }
 func (*DataTypeResult) ProtoMessage()               {}
-func (*DataTypeResult) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{9} }
+func (*DataTypeResult) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{13} }
 
 func (m *DataTypeResult) GetResult() []*DataType {
 	if m != nil {
@@ -190,12 +295,16 @@ type DataLatency struct {
 	Fifty int32 `protobuf:"varint,3,opt,name=fifty" json:"fifty,omitempty"`
 	// The ninetieth percentile value.  Might be unknown (0)
 	Ninety int32 `protobuf:"varint,4,opt,name=ninety" json:"ninety,omitempty"`
+	// The values with double precision.
+	MeanDouble   float64 `protobuf:"fixed64,5,opt,name=mean_double,json=meanDouble" json:"mean_double,omitempty"`
+	FiftyDouble  float64 `protobuf:"fixed64,6,opt,name=fifty_double,json=fiftyDouble" json:"fifty_double,omitempty"`
+	NinetyDouble float64 `protobuf:"fixed64,7,opt,name=ninety_double,json=ninetyDouble" json:"ninety_double,omitempty"`
 }
 
 func (m *DataLatency) Reset()                    { *m = DataLatency{} }
 func (m *DataLatency) String() string            { return proto.CompactTextString(m) }
 func (*DataLatency) ProtoMessage()               {}
-func (*DataLatency) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{10} }
+func (*DataLatency) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{14} }
 
 type DataLatencyResult struct {
 	// The siteID for the metric e.g., TAUP
@@ -209,12 +318,15 @@ type DataLatencyResult struct {
 	Result []*DataLatency `protobuf:"bytes,5,rep,name=result" json:"result,omitempty"`
 	// the scale factor to apply to the threshold values
 	Scale float64 `protobuf:"fixed64,6,opt,name=scale" json:"scale,omitempty"`
+	// The upper and lower thresholds without rounding.
+	UpperDouble float64 `protobuf:"fixed64,7,opt,name=upper_double,json=upperDouble" json:"upper_double,omitempty"`
+	LowerDouble float64 `protobuf:"fixed64,8,opt,name=lower_double,json=lowerDouble" json:"lower_double,omitempty"`
 }
 
 func (m *DataLatencyResult) Reset()                    { *m = DataLatencyResult{} }
 func (m *DataLatencyResult) String() string            { return proto.CompactTextString(m) }
 func (*DataLatencyResult) ProtoMessage()               {}
-func (*DataLatencyResult) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{11} }
+func (*DataLatencyResult) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{15} }
 
 func (m *DataLatencyResult) GetResult() []*DataLatency {
 	if m != nil {
@@ -225,9 +337,12 @@ func (m *DataLatencyResult) GetResult() []*DataLatency {
 
 // DataCompletenessSummary is metrics to let us determine if all the data had arrived.
 // The "completenss" value is derived from:
-//    {count in a period of time (no less than 5 minutes)} / { expected count im a period of time }
+//
+//	{count in a period of time (no less than 5 minutes)} / { expected count im a period of time }
+//
 // For example, a site(type) expects 300 counts in 5 minutes (1hz),
-//    but got 270 counts for the latest 5 minutes then its latest completeness will be 0.9 .
+//
+//	but got 270 counts for the latest 5 minutes then its latest completeness will be 0.9 .
 type DataCompletenessSummary struct {
 	// The siteID for the completeness e.g., TAUP
 	SiteID string `protobuf:"bytes,1,opt,name=site_iD,json=siteID" json:"site_iD,omitempty"`
@@ -237,12 +352,14 @@ type DataCompletenessSummary struct {
 	Seconds int64 `protobuf:"varint,3,opt,name=seconds" json:"seconds,omitempty"`
 	// The completeness for a given period of time
 	Completeness float32 `protobuf:"fixed32,4,opt,name=completeness" json:"completeness,omitempty"`
+	// true if the site was auto registered and has not been confirmed.
+	Pending bool `protobuf:"varint,5,opt,name=pending" json:"pending,omitempty"`
 }
 
 func (m *DataCompletenessSummary) Reset()                    { *m = DataCompletenessSummary{} }
 func (m *DataCompletenessSummary) String() string            { return proto.CompactTextString(m) }
 func (*DataCompletenessSummary) ProtoMessage()               {}
-func (*DataCompletenessSummary) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{12} }
+func (*DataCompletenessSummary) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{16} }
 
 type DataCompletenessSummaryResult struct {
 	Result []*DataCompletenessSummary `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
@@ -251,7 +368,7 @@ type DataCompletenessSummaryResult struct {
 func (m *DataCompletenessSummaryResult) Reset()                    { *m = DataCompletenessSummaryResult{} }
 func (m *DataCompletenessSummaryResult) String() string            { return proto.CompactTextString(m) }
 func (*DataCompletenessSummaryResult) ProtoMessage()               {}
-func (*DataCompletenessSummaryResult) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{13} }
+func (*DataCompletenessSummaryResult) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{17} }
 
 func (m *DataCompletenessSummaryResult) GetResult() []*DataCompletenessSummary {
 	if m != nil {
@@ -272,7 +389,7 @@ type DataCompletenessTag struct {
 func (m *DataCompletenessTag) Reset()                    { *m = DataCompletenessTag{} }
 func (m *DataCompletenessTag) String() string            { return proto.CompactTextString(m) }
 func (*DataCompletenessTag) ProtoMessage()               {}
-func (*DataCompletenessTag) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{14} }
+func (*DataCompletenessTag) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{18} }
 
 type DataCompletenessTagResult struct {
 	Result []*DataCompletenessTag `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
@@ -281,7 +398,7 @@ type DataCompletenessTagResult struct {
 func (m *DataCompletenessTagResult) Reset()                    { *m = DataCompletenessTagResult{} }
 func (m *DataCompletenessTagResult) String() string            { return proto.CompactTextString(m) }
 func (*DataCompletenessTagResult) ProtoMessage()               {}
-func (*DataCompletenessTagResult) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{15} }
+func (*DataCompletenessTagResult) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{19} }
 
 func (m *DataCompletenessTagResult) GetResult() []*DataCompletenessTag {
 	if m != nil {
@@ -290,6 +407,107 @@ func (m *DataCompletenessTagResult) GetResult() []*DataCompletenessTag {
 	return nil
 }
 
+// DataLatencyBatch is for sending many latency values in a single request.
+type DataLatencyBatch struct {
+	Value []*DataLatencyBatchValue `protobuf:"bytes,1,rep,name=value" json:"value,omitempty"`
+}
+
+func (m *DataLatencyBatch) Reset()                    { *m = DataLatencyBatch{} }
+func (m *DataLatencyBatch) String() string            { return proto.CompactTextString(m) }
+func (*DataLatencyBatch) ProtoMessage()               {}
+func (*DataLatencyBatch) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{20} }
+
+func (m *DataLatencyBatch) GetValue() []*DataLatencyBatchValue {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+type DataLatencyBatchValue struct {
+	// The siteID for the latency e.g., TAUP
+	SiteID string `protobuf:"bytes,1,opt,name=site_iD,json=siteID" json:"site_iD,omitempty"`
+	// The typeID for the latency e.g., latency.strong
+	TypeID string `protobuf:"bytes,2,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	// Unix time in seconds for the latency value (don't need nanos).
+	Seconds int64 `protobuf:"varint,3,opt,name=seconds" json:"seconds,omitempty"`
+	// The mean latency
+	Mean int32 `protobuf:"varint,4,opt,name=mean" json:"mean,omitempty"`
+	// The minimum latency.  Might be unknown (0)
+	Min int32 `protobuf:"varint,5,opt,name=min" json:"min,omitempty"`
+	// The maximum latency.  Might be unknown (0)
+	Max int32 `protobuf:"varint,6,opt,name=max" json:"max,omitempty"`
+	// The fiftieth percentile value.  Might be unknown (0)
+	Fifty int32 `protobuf:"varint,7,opt,name=fifty" json:"fifty,omitempty"`
+	// The ninetieth percentile value.  Might be unknown (0)
+	Ninety int32 `protobuf:"varint,8,opt,name=ninety" json:"ninety,omitempty"`
+	// The values with a fraction.  Used instead of mean, min, max, fifty, and ninety when doubles is true
+	// or any of them are not 0.
+	MeanDouble   float64 `protobuf:"fixed64,9,opt,name=mean_double,json=meanDouble" json:"mean_double,omitempty"`
+	MinDouble    float64 `protobuf:"fixed64,10,opt,name=min_double,json=minDouble" json:"min_double,omitempty"`
+	MaxDouble    float64 `protobuf:"fixed64,11,opt,name=max_double,json=maxDouble" json:"max_double,omitempty"`
+	FiftyDouble  float64 `protobuf:"fixed64,12,opt,name=fifty_double,json=fiftyDouble" json:"fifty_double,omitempty"`
+	NinetyDouble float64 `protobuf:"fixed64,13,opt,name=ninety_double,json=ninetyDouble" json:"ninety_double,omitempty"`
+	// Set when the values are in the _double fields.  Needed if they can all be 0.
+	Doubles bool `protobuf:"varint,14,opt,name=doubles" json:"doubles,omitempty"`
+}
+
+func (m *DataLatencyBatchValue) Reset()                    { *m = DataLatencyBatchValue{} }
+func (m *DataLatencyBatchValue) String() string            { return proto.CompactTextString(m) }
+func (*DataLatencyBatchValue) ProtoMessage()               {}
+func (*DataLatencyBatchValue) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{21} }
+
+// DataCompletenessBatch is for sending many completeness counts in a single request.
+type DataCompletenessBatch struct {
+	Value []*DataCompletenessBatchValue `protobuf:"bytes,1,rep,name=value" json:"value,omitempty"`
+}
+
+func (m *DataCompletenessBatch) Reset()                    { *m = DataCompletenessBatch{} }
+func (m *DataCompletenessBatch) String() string            { return proto.CompactTextString(m) }
+func (*DataCompletenessBatch) ProtoMessage()               {}
+func (*DataCompletenessBatch) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{22} }
+
+func (m *DataCompletenessBatch) GetValue() []*DataCompletenessBatchValue {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+type DataCompletenessBatchValue struct {
+	// The siteID for the completeness e.g., TAUP
+	SiteID string `protobuf:"bytes,1,opt,name=site_iD,json=siteID" json:"site_iD,omitempty"`
+	// The typeID for the completeness e.g., completeness.gnss.1hz
+	TypeID string `protobuf:"bytes,2,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	// Unix time in seconds for the count (don't need nanos).
+	Seconds int64 `protobuf:"varint,3,opt,name=seconds" json:"seconds,omitempty"`
+	// The count for the period
+	Count int32 `protobuf:"varint,4,opt,name=count" json:"count,omitempty"`
+}
+
+func (m *DataCompletenessBatchValue) Reset()                    { *m = DataCompletenessBatchValue{} }
+func (m *DataCompletenessBatchValue) String() string            { return proto.CompactTextString(m) }
+func (*DataCompletenessBatchValue) ProtoMessage()               {}
+func (*DataCompletenessBatchValue) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{23} }
+
+// DataBatchResult has a BatchStatus for each value in a DataLatencyBatch or
+// DataCompletenessBatch, in the same order.
+type DataBatchResult struct {
+	Result []*BatchStatus `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *DataBatchResult) Reset()                    { *m = DataBatchResult{} }
+func (m *DataBatchResult) String() string            { return proto.CompactTextString(m) }
+func (*DataBatchResult) ProtoMessage()               {}
+func (*DataBatchResult) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{24} }
+
+func (m *DataBatchResult) GetResult() []*BatchStatus {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*DataLatencySummary)(nil), "mtrpb.DataLatencySummary")
 	proto.RegisterType((*DataLatencySummaryResult)(nil), "mtrpb.DataLatencySummaryResult")
@@ -299,6 +517,10 @@ func init() {
 	proto.RegisterType((*DataLatencyTagResult)(nil), "mtrpb.DataLatencyTagResult")
 	proto.RegisterType((*DataLatencyThreshold)(nil), "mtrpb.DataLatencyThreshold")
 	proto.RegisterType((*DataLatencyThresholdResult)(nil), "mtrpb.DataLatencyThresholdResult")
+	proto.RegisterType((*DataLatencyLate)(nil), "mtrpb.DataLatencyLate")
+	proto.RegisterType((*DataLatencyLateResult)(nil), "mtrpb.DataLatencyLateResult")
+	proto.RegisterType((*DataLatencyAnomaly)(nil), "mtrpb.DataLatencyAnomaly")
+	proto.RegisterType((*DataLatencyAnomalyResult)(nil), "mtrpb.DataLatencyAnomalyResult")
 	proto.RegisterType((*DataType)(nil), "mtrpb.DataType")
 	proto.RegisterType((*DataTypeResult)(nil), "mtrpb.DataTypeResult")
 	proto.RegisterType((*DataLatency)(nil), "mtrpb.DataLatency")
@@ -307,43 +529,81 @@ func init() {
 	proto.RegisterType((*DataCompletenessSummaryResult)(nil), "mtrpb.DataCompletenessSummaryResult")
 	proto.RegisterType((*DataCompletenessTag)(nil), "mtrpb.DataCompletenessTag")
 	proto.RegisterType((*DataCompletenessTagResult)(nil), "mtrpb.DataCompletenessTagResult")
+	proto.RegisterType((*DataLatencyBatch)(nil), "mtrpb.DataLatencyBatch")
+	proto.RegisterType((*DataLatencyBatchValue)(nil), "mtrpb.DataLatencyBatchValue")
+	proto.RegisterType((*DataCompletenessBatch)(nil), "mtrpb.DataCompletenessBatch")
+	proto.RegisterType((*DataCompletenessBatchValue)(nil), "mtrpb.DataCompletenessBatchValue")
+	proto.RegisterType((*DataBatchResult)(nil), "mtrpb.DataBatchResult")
 }
 
 var fileDescriptor1 = []byte{
-	// 553 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xb4, 0x55, 0xdb, 0x8a, 0x13, 0x41,
-	0x10, 0xa5, 0x77, 0x2e, 0x49, 0x6a, 0xc5, 0x4b, 0xbb, 0xba, 0xb3, 0xf1, 0x82, 0xcc, 0x8b, 0x8b,
-	0x60, 0xc0, 0x5d, 0x10, 0x7c, 0xf0, 0x45, 0xe3, 0x83, 0xa0, 0x88, 0xb3, 0x01, 0x51, 0x10, 0xe9,
-	0xcd, 0xf4, 0x66, 0x07, 0xe6, 0xc6, 0x4c, 0x07, 0x99, 0x4f, 0xd0, 0xdf, 0xf1, 0x97, 0xfc, 0x10,
-	0xfb, 0x9a, 0xed, 0x74, 0x26, 0x20, 0x41, 0xdf, 0xa6, 0x4e, 0x55, 0x75, 0x9f, 0xaa, 0x53, 0xd5,
-	0x03, 0x90, 0x12, 0x46, 0x26, 0x75, 0x53, 0xb1, 0x0a, 0x07, 0x05, 0x6b, 0xea, 0xf3, 0xf8, 0x37,
-	0x02, 0x3c, 0xe5, 0xe8, 0x3b, 0xc2, 0x68, 0x39, 0xef, 0xce, 0x96, 0x45, 0x41, 0x9a, 0x0e, 0x1f,
-	0xc2, 0xa0, 0xcd, 0x18, 0xfd, 0x96, 0x4d, 0x23, 0xf4, 0x08, 0x1d, 0x8f, 0x92, 0x50, 0x98, 0x6f,
-	0xa7, 0xc2, 0xc1, 0xba, 0x5a, 0x3a, 0xf6, 0x94, 0x43, 0x98, 0xdc, 0x11, 0xf1, 0x0c, 0x3a, 0xaf,
-	0xca, 0xb4, 0x8d, 0x3c, 0xee, 0xf0, 0x12, 0x63, 0x62, 0x0c, 0x7e, 0x41, 0x49, 0x19, 0xf9, 0x1c,
-	0x0e, 0x12, 0xf9, 0x8d, 0x0f, 0x20, 0xb8, 0xc8, 0x2e, 0x58, 0x17, 0x05, 0x12, 0x54, 0x06, 0xbe,
-	0x0b, 0x61, 0x99, 0x95, 0x94, 0xc3, 0xa1, 0x84, 0xb5, 0x25, 0xa2, 0x97, 0x75, 0x4d, 0x9b, 0x68,
-	0xa0, 0xa2, 0xa5, 0x21, 0xd0, 0xbc, 0xfa, 0xce, 0xd1, 0xa1, 0x42, 0xa5, 0x21, 0xd0, 0x76, 0x4e,
-	0x72, 0x1a, 0x8d, 0x38, 0x8a, 0x12, 0x65, 0xc4, 0xef, 0x21, 0xda, 0xac, 0x32, 0xa1, 0xed, 0x32,
-	0x67, 0xf8, 0x19, 0x84, 0x8d, 0xfc, 0xe2, 0xa5, 0x7a, 0xc7, 0xfb, 0x27, 0x47, 0x13, 0xd9, 0x9a,
-	0x49, 0x4f, 0x82, 0x0e, 0x8c, 0xbf, 0xc2, 0x50, 0x78, 0xcf, 0x78, 0x4f, 0xb6, 0xb7, 0x6a, 0x0c,
-	0xc3, 0x9c, 0xb0, 0x8c, 0x2d, 0x53, 0x2a, 0x7b, 0x85, 0x92, 0x95, 0x8d, 0xef, 0xc3, 0x28, 0xaf,
-	0xca, 0x85, 0x72, 0x7a, 0xd2, 0x79, 0x05, 0xc4, 0x2f, 0xe0, 0xba, 0x39, 0x5e, 0x73, 0x7c, 0xec,
-	0x70, 0xbc, 0x61, 0x71, 0x94, 0x61, 0x86, 0xd9, 0x4c, 0xa5, 0x6a, 0xde, 0x33, 0xb2, 0xd8, 0x41,
-	0xca, 0x9b, 0xe0, 0x31, 0xb2, 0x90, 0xb4, 0x46, 0x89, 0xf8, 0x8c, 0xdf, 0xc0, 0xc1, 0xfa, 0xa9,
-	0x9a, 0xd6, 0x53, 0x87, 0xd6, 0x9d, 0xcd, 0xd6, 0x89, 0x60, 0x43, 0xee, 0x27, 0x5a, 0x3f, 0xe7,
-	0x92, 0xe3, 0x97, 0x55, 0x9e, 0xee, 0xc0, 0x71, 0x25, 0xbe, 0xe7, 0x88, 0xaf, 0x06, 0xc5, 0x77,
-	0x06, 0x45, 0x8d, 0x44, 0x60, 0x8f, 0xc4, 0x47, 0x18, 0xf7, 0x71, 0xd1, 0x95, 0x9d, 0x3a, 0x95,
-	0xdd, 0xeb, 0xa9, 0x6c, 0x95, 0x62, 0xea, 0x7b, 0xa9, 0xc6, 0x62, 0xc6, 0x29, 0xda, 0xcc, 0x91,
-	0xbb, 0x28, 0x69, 0xd6, 0xd6, 0x39, 0xe9, 0x74, 0x49, 0xc6, 0x34, 0xb2, 0x8b, 0xf4, 0xbf, 0x90,
-	0x5d, 0x86, 0x99, 0x9b, 0x33, 0xd8, 0xb7, 0x98, 0xd9, 0xcb, 0x88, 0xfa, 0x97, 0x51, 0x5c, 0xbd,
-	0xe7, 0x2e, 0xa3, 0xd7, 0xbf, 0x8c, 0xbe, 0xbd, 0x8c, 0xf1, 0x2f, 0x04, 0xb7, 0xac, 0xbb, 0x34,
-	0xd3, 0x9d, 0x14, 0x54, 0x5a, 0x79, 0xbd, 0x4b, 0xed, 0xdb, 0xba, 0x3e, 0x59, 0xf5, 0x21, 0x90,
-	0x7d, 0xc0, 0x9b, 0x6a, 0x98, 0x56, 0x5c, 0xa9, 0x1d, 0xda, 0x6a, 0xff, 0x40, 0x70, 0x28, 0xa2,
-	0x5f, 0x57, 0x45, 0x9d, 0x53, 0x9e, 0x41, 0xdb, 0xf6, 0x7f, 0x3c, 0x76, 0x31, 0x5c, 0x9b, 0x5b,
-	0x57, 0xc8, 0x32, 0xf6, 0x92, 0x35, 0x2c, 0xfe, 0x04, 0x0f, 0xb6, 0x50, 0xd1, 0xcd, 0x7c, 0xee,
-	0xc8, 0xfe, 0xd0, 0x2a, 0xb7, 0x2f, 0xcb, 0x4c, 0xc1, 0x67, 0xb8, 0xed, 0x86, 0xfc, 0xab, 0x17,
-	0xe0, 0x03, 0x1c, 0xf5, 0x1c, 0xad, 0xf9, 0x9e, 0x38, 0x7c, 0xc7, 0x5b, 0xf8, 0x5a, 0x6f, 0xc1,
-	0xab, 0xc1, 0x17, 0xf5, 0x07, 0x3a, 0x0f, 0xe5, 0xff, 0xe8, 0xf4, 0x4f, 0x00, 0x00, 0x00, 0xff,
-	0xff, 0xa6, 0x96, 0x8b, 0xc4, 0x9d, 0x06, 0x00, 0x00,
+	// 1088 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x57, 0xcd, 0x6e, 0x24, 0x35,
+	0x10, 0x56, 0xa7, 0xa7, 0xe7, 0xa7, 0x26, 0x9b, 0x64, 0x7b, 0x93, 0xdd, 0xde, 0x61, 0x7f, 0x66,
+	0x9b, 0x03, 0xa3, 0x95, 0x88, 0x44, 0x56, 0x02, 0x71, 0xe0, 0xc0, 0x12, 0x40, 0x91, 0x40, 0x40,
+	0x27, 0x62, 0x05, 0x97, 0xc8, 0x99, 0xf6, 0x24, 0x96, 0xfa, 0x4f, 0xdd, 0x9e, 0x6c, 0xfa, 0xc2,
+	0x03, 0x70, 0x00, 0xf1, 0x0c, 0xbc, 0x11, 0x67, 0x5e, 0x84, 0x1b, 0x72, 0xd9, 0x9e, 0xf1, 0xb8,
+	0x7b, 0x20, 0x1a, 0x65, 0x4f, 0xe3, 0x2a, 0x7f, 0x76, 0x7f, 0x2e, 0x57, 0x7d, 0xe5, 0x01, 0x88,
+	0x09, 0x27, 0x87, 0x45, 0x99, 0xf3, 0xdc, 0xf7, 0x52, 0x5e, 0x16, 0x17, 0xa3, 0xe1, 0x8c, 0xd1,
+	0x24, 0x96, 0xbe, 0xf0, 0xf7, 0x0e, 0xf8, 0xc7, 0x84, 0x93, 0x6f, 0x08, 0xa7, 0xd9, 0xb4, 0x3e,
+	0x9d, 0xa7, 0x29, 0x29, 0x6b, 0xff, 0x11, 0xf4, 0x2a, 0xc6, 0xe9, 0x39, 0x3b, 0x0e, 0x9c, 0xb1,
+	0x33, 0x19, 0x44, 0x5d, 0x61, 0x9e, 0x1c, 0x8b, 0x09, 0x5e, 0x17, 0x38, 0xb1, 0x25, 0x27, 0x84,
+	0x79, 0x72, 0xec, 0x07, 0xd0, 0xab, 0xe8, 0x34, 0xcf, 0xe2, 0x2a, 0x70, 0xc7, 0xce, 0xc4, 0x8d,
+	0xb4, 0xe9, 0xfb, 0xd0, 0x49, 0x29, 0xc9, 0x82, 0xce, 0xd8, 0x99, 0x78, 0x11, 0x8e, 0xfd, 0x7d,
+	0xf0, 0x66, 0x6c, 0xc6, 0xeb, 0xc0, 0x43, 0xa7, 0x34, 0xfc, 0x87, 0xd0, 0xcd, 0x58, 0x46, 0x79,
+	0x1d, 0x74, 0xd1, 0xad, 0x2c, 0x81, 0x9e, 0x17, 0x05, 0x2d, 0x83, 0x9e, 0x44, 0xa3, 0x21, 0xbc,
+	0x49, 0xfe, 0x96, 0x96, 0x41, 0x5f, 0x7a, 0xd1, 0x10, 0xde, 0x6a, 0x4a, 0x12, 0x1a, 0x0c, 0xc6,
+	0xce, 0xc4, 0x89, 0xa4, 0x21, 0xd8, 0x15, 0x34, 0x8b, 0x59, 0x76, 0x19, 0xc0, 0xd8, 0x99, 0xf4,
+	0x23, 0x6d, 0xfa, 0xcf, 0x61, 0x28, 0x18, 0x9d, 0xc7, 0xf9, 0xfc, 0x22, 0xa1, 0xc1, 0x10, 0x57,
+	0x81, 0x70, 0x1d, 0xa3, 0xc7, 0x7f, 0x01, 0xdb, 0xc8, 0x4e, 0x23, 0xb6, 0x11, 0x31, 0x44, 0x9f,
+	0x82, 0xbc, 0x0f, 0xf7, 0x24, 0x53, 0x8d, 0xb9, 0x87, 0x98, 0x6d, 0xe9, 0x5c, 0xee, 0x83, 0xbc,
+	0x35, 0x66, 0x47, 0xee, 0x83, 0xbe, 0x25, 0x04, 0x0f, 0xa1, 0x21, 0xbb, 0x12, 0x82, 0x3e, 0x05,
+	0xf1, 0xa1, 0x93, 0x10, 0x4e, 0x83, 0x3d, 0x3c, 0x05, 0x8e, 0xfd, 0x31, 0x0c, 0x53, 0xc2, 0x32,
+	0x4e, 0x33, 0x92, 0x4d, 0x69, 0x70, 0x1f, 0xa7, 0x4c, 0x97, 0xbf, 0x07, 0xee, 0x05, 0x89, 0x03,
+	0x1f, 0x67, 0xc4, 0x50, 0x04, 0x84, 0x64, 0x79, 0x4a, 0x92, 0x3a, 0x78, 0x80, 0xf7, 0xa8, 0xcd,
+	0xf0, 0x5b, 0x08, 0x9a, 0x09, 0x11, 0xd1, 0x6a, 0x9e, 0x70, 0xff, 0x23, 0xe8, 0x96, 0x38, 0x0a,
+	0x9c, 0xb1, 0x3b, 0x19, 0x1e, 0x3d, 0x3e, 0xc4, 0x94, 0x3a, 0x6c, 0x59, 0xa0, 0x80, 0xe1, 0x5b,
+	0xe8, 0x8b, 0xd9, 0x53, 0xc6, 0xe9, 0xfa, 0xac, 0x1a, 0x41, 0x3f, 0x21, 0x9c, 0xf1, 0x79, 0x4c,
+	0x31, 0xad, 0x9c, 0x68, 0x61, 0xfb, 0x4f, 0x60, 0x90, 0xe4, 0xd9, 0xa5, 0x9c, 0x74, 0x71, 0x72,
+	0xe9, 0x30, 0x2f, 0xb6, 0xb3, 0x72, 0xb1, 0xe1, 0xa7, 0xb0, 0xa3, 0x3f, 0xac, 0xd8, 0x7f, 0x60,
+	0xb1, 0xdf, 0x35, 0xd8, 0x23, 0x4c, 0x73, 0x3e, 0x83, 0x1d, 0xe3, 0x44, 0x67, 0xe4, 0x72, 0x83,
+	0x7a, 0xd8, 0x03, 0x97, 0x93, 0x4b, 0x24, 0x3c, 0x88, 0xc4, 0x30, 0xfc, 0x12, 0xf6, 0x57, 0x77,
+	0x55, 0xb4, 0x3e, 0xb4, 0x68, 0x1d, 0x34, 0x83, 0x2a, 0xc0, 0x9a, 0xdc, 0x1f, 0x5b, 0xab, 0xfb,
+	0x5c, 0x95, 0xb4, 0xba, 0xca, 0x93, 0x78, 0x03, 0x8e, 0x8b, 0x0a, 0x72, 0xad, 0x0a, 0x92, 0xd5,
+	0xd6, 0xb1, 0xaa, 0x4d, 0xd6, 0x95, 0x67, 0xd6, 0x95, 0x9d, 0xb1, 0xdd, 0x66, 0xc6, 0xda, 0x79,
+	0xdf, 0x6b, 0xe6, 0xfd, 0x73, 0x18, 0xce, 0xf2, 0xf2, 0x5c, 0xeb, 0x87, 0xac, 0x67, 0x98, 0xe5,
+	0xe5, 0xa9, 0xf4, 0xf8, 0xcf, 0x00, 0xae, 0xea, 0x8a, 0xd3, 0x92, 0x56, 0xac, 0x52, 0x95, 0x6d,
+	0x78, 0xc2, 0x1f, 0x60, 0xd4, 0x16, 0x12, 0x15, 0xe0, 0x57, 0x56, 0x80, 0xdf, 0x6b, 0x09, 0xf0,
+	0x62, 0x89, 0x0e, 0xf3, 0x1b, 0xd8, 0x35, 0xe6, 0xc5, 0xcf, 0x06, 0x01, 0xd6, 0xd5, 0x2a, 0xe3,
+	0x8b, 0xe3, 0xf0, 0x6b, 0x38, 0xb0, 0x36, 0x56, 0x34, 0x0f, 0x2d, 0x9a, 0x0f, 0x9b, 0x34, 0x11,
+	0xad, 0x19, 0xfe, 0xe6, 0xac, 0x48, 0xf7, 0xe7, 0xb2, 0x7e, 0x37, 0x63, 0x59, 0x6a, 0x96, 0x4e,
+	0x84, 0x63, 0x11, 0xf1, 0x98, 0x5e, 0x33, 0xc2, 0x59, 0x9e, 0x55, 0x98, 0x09, 0x4e, 0x64, 0x78,
+	0xc4, 0x9a, 0x98, 0xd4, 0x95, 0xd2, 0x6f, 0x1c, 0x5b, 0xca, 0xa1, 0xf8, 0xdc, 0x5e, 0x39, 0xf4,
+	0x02, 0x7d, 0xbe, 0xbf, 0x1d, 0x29, 0x1d, 0x67, 0x75, 0x41, 0x4d, 0xf2, 0x8e, 0xdd, 0x77, 0x62,
+	0x56, 0x15, 0x09, 0xa9, 0xd5, 0xa9, 0xb4, 0x29, 0x12, 0x2f, 0x65, 0xd9, 0xb9, 0x50, 0xc1, 0xf2,
+	0x9a, 0x24, 0xea, 0x12, 0x86, 0x29, 0xcb, 0x4e, 0x94, 0x4b, 0x28, 0x67, 0x4c, 0xab, 0x69, 0xc9,
+	0x0a, 0x71, 0x2a, 0x3c, 0xe6, 0x20, 0x32, 0x5d, 0xe2, 0x9c, 0xf3, 0x8c, 0x71, 0x3c, 0xe7, 0x20,
+	0xc2, 0xf1, 0xb2, 0x14, 0xba, 0x66, 0x29, 0x8c, 0xa0, 0x4f, 0x6f, 0x0a, 0x3a, 0xe5, 0x34, 0x56,
+	0x7d, 0x6a, 0x61, 0x2f, 0xf2, 0xa0, 0x6f, 0xe4, 0x81, 0xd2, 0x27, 0x71, 0xba, 0x5b, 0xe8, 0x13,
+	0xc2, 0x74, 0x64, 0xfe, 0x72, 0x60, 0x68, 0x04, 0xce, 0xec, 0xbd, 0x4e, 0x7b, 0xef, 0x15, 0xa1,
+	0xd9, 0xb2, 0x7b, 0xaf, 0xdb, 0xde, 0x7b, 0x3b, 0x2b, 0xbd, 0xd7, 0xea, 0x8f, 0xde, 0xff, 0xf6,
+	0xc7, 0xee, 0x2d, 0xfa, 0x63, 0xaf, 0xd9, 0x1f, 0xc3, 0x7f, 0x1c, 0xb8, 0x6f, 0x1c, 0x4a, 0xc5,
+	0x64, 0x23, 0x51, 0x93, 0xf2, 0xe5, 0xb6, 0x3e, 0x16, 0x3a, 0xa6, 0xd4, 0xbd, 0x5c, 0x44, 0xdc,
+	0xc3, 0x88, 0xfb, 0xcd, 0xac, 0xd4, 0x41, 0x5f, 0x73, 0xeb, 0xb7, 0x50, 0x37, 0x5b, 0x23, 0xfb,
+	0x0d, 0x8d, 0x0c, 0xff, 0x74, 0xe0, 0x91, 0xf8, 0xe6, 0x17, 0x79, 0x5a, 0x24, 0x94, 0xd3, 0x8c,
+	0x56, 0xd5, 0xbb, 0x78, 0x8a, 0x85, 0xb0, 0x3d, 0x35, 0x3e, 0x81, 0xc1, 0xd8, 0x8a, 0x56, 0x7c,
+	0x66, 0x47, 0xf5, 0x56, 0x3b, 0xea, 0x1b, 0x78, 0xba, 0x86, 0xa4, 0xba, 0xac, 0x8f, 0xad, 0x04,
+	0x7e, 0x66, 0x84, 0xb3, 0x6d, 0x95, 0xce, 0xe7, 0x9f, 0xe0, 0x81, 0x0d, 0xb9, 0xab, 0xa6, 0xfb,
+	0x1d, 0x3c, 0x6e, 0xd9, 0x5a, 0xf1, 0x3d, 0xb2, 0xf8, 0x8e, 0xd6, 0xf0, 0x35, 0xdb, 0xef, 0x57,
+	0xb0, 0x67, 0x64, 0xc7, 0x6b, 0xc2, 0xa7, 0x57, 0xfe, 0x11, 0x78, 0xd7, 0x24, 0x99, 0x53, 0xb5,
+	0xcd, 0x93, 0x66, 0x16, 0x21, 0xee, 0x47, 0x81, 0x89, 0x24, 0x34, 0xfc, 0xd5, 0x85, 0x83, 0x56,
+	0xc0, 0x3b, 0x7f, 0x7b, 0xef, 0x81, 0x9b, 0xb2, 0x4c, 0x29, 0xb7, 0x18, 0xa2, 0x87, 0xdc, 0xa8,
+	0x47, 0xb7, 0x18, 0x2e, 0x35, 0xa2, 0xd7, 0xae, 0x11, 0xfd, 0xff, 0xd2, 0x88, 0x41, 0x43, 0x23,
+	0x9e, 0x02, 0xa4, 0x6c, 0x31, 0x0f, 0xf2, 0x11, 0x97, 0x32, 0x73, 0x9a, 0xdc, 0xac, 0x3e, 0xc1,
+	0x07, 0x29, 0xb9, 0xb9, 0xe3, 0x17, 0xb8, 0x68, 0x15, 0x38, 0xaa, 0xf0, 0xf1, 0xdd, 0x8f, 0xb4,
+	0x19, 0x7e, 0x0f, 0x07, 0xf6, 0x9d, 0xcb, 0x9b, 0xfd, 0x64, 0xf5, 0x66, 0x5f, 0xac, 0x49, 0x90,
+	0xe6, 0xf5, 0xfe, 0x02, 0xa3, 0xf5, 0xa0, 0x3b, 0xbd, 0xe2, 0x7d, 0xf0, 0xa6, 0xf9, 0x3c, 0xe3,
+	0x5a, 0xd9, 0xd0, 0x08, 0x3f, 0x93, 0xcf, 0x17, 0xfc, 0xa6, 0xca, 0xf6, 0x97, 0x56, 0xb6, 0x6b,
+	0xb1, 0x43, 0xcc, 0x29, 0x27, 0x7c, 0x5e, 0xe9, 0x2c, 0x7f, 0xdd, 0xfb, 0x59, 0xfe, 0x59, 0xbc,
+	0xe8, 0xe2, 0xdf, 0xc4, 0x57, 0xff, 0x0e, 0x00, 0xcb, 0xda, 0xef, 0xa3, 0x48, 0x0e, 0x00, 0x00,
 }
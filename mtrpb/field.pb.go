@@ -32,6 +32,23 @@ type FieldMetricSummary struct {
 	ModelID string `protobuf:"bytes,7,opt,name=model_iD,json=modelID" json:"model_iD,omitempty"`
 	// the scale factor to apply to the threshold values
 	Scale float64 `protobuf:"fixed64,8,opt,name=scale" json:"scale,omitempty"`
+	// true if the device was auto registered and has not been confirmed.
+	Pending bool `protobuf:"varint,9,opt,name=pending" json:"pending,omitempty"`
+	// The value, upper, and lower without rounding.  value, upper, and lower are rounded for older clients.
+	ValueDouble float64 `protobuf:"fixed64,10,opt,name=value_double,json=valueDouble" json:"value_double,omitempty"`
+	UpperDouble float64 `protobuf:"fixed64,11,opt,name=upper_double,json=upperDouble" json:"upper_double,omitempty"`
+	LowerDouble float64 `protobuf:"fixed64,12,opt,name=lower_double,json=lowerDouble" json:"lower_double,omitempty"`
+	// true if there hasn't been a value for longer than the late window for the metric.
+	Late bool `protobuf:"varint,13,opt,name=late" json:"late,omitempty"`
+	// true if the metric is bad or late but silenced for maintenance (see Silence).
+	Maintenance bool `protobuf:"varint,14,opt,name=maintenance" json:"maintenance,omitempty"`
+	// Where the thresholds come from: device (FieldMetricThreshold), model (FieldModelThreshold),
+	// or empty if no threshold has been set.
+	ThresholdSource string `protobuf:"bytes,15,opt,name=threshold_source,json=thresholdSource" json:"threshold_source,omitempty"`
+	// true if the value has been outside the thresholds for the for duration and hasn't come back inside the recovery band.
+	Bad bool `protobuf:"varint,16,opt,name=bad" json:"bad,omitempty"`
+	// rate or baseline if the value broke the FieldMetricAnomaly thresholds for the metric, otherwise empty.
+	Anomaly string `protobuf:"bytes,17,opt,name=anomaly" json:"anomaly,omitempty"`
 }
 
 func (m *FieldMetricSummary) Reset()                    { *m = FieldMetricSummary{} }
@@ -96,6 +113,13 @@ type FieldMetricThreshold struct {
 	Upper int32 `protobuf:"varint,4,opt,name=upper" json:"upper,omitempty"`
 	// The scale to multiply the thresholds by
 	Scale float64 `protobuf:"fixed64,5,opt,name=scale" json:"scale,omitempty"`
+	// The lower and upper thresholds without rounding.
+	LowerDouble float64 `protobuf:"fixed64,6,opt,name=lower_double,json=lowerDouble" json:"lower_double,omitempty"`
+	UpperDouble float64 `protobuf:"fixed64,7,opt,name=upper_double,json=upperDouble" json:"upper_double,omitempty"`
+	// The seconds a value must stay outside the thresholds before the metric is bad.
+	ForSeconds int32 `protobuf:"varint,8,opt,name=for_seconds,json=forSeconds" json:"for_seconds,omitempty"`
+	// A bad metric is good again once the value is inside lower + hysteresis and upper - hysteresis.
+	Hysteresis float64 `protobuf:"fixed64,9,opt,name=hysteresis" json:"hysteresis,omitempty"`
 }
 
 func (m *FieldMetricThreshold) Reset()                    { *m = FieldMetricThreshold{} }
@@ -119,6 +143,113 @@ func (m *FieldMetricThresholdResult) GetResult() []*FieldMetricThreshold {
 	return nil
 }
 
+// FieldModelThreshold is the default threshold for a type for all devices of a model.
+// A FieldMetricThreshold for a device overrides it.
+type FieldModelThreshold struct {
+	// The modelID e.g., Trimble NetR9
+	ModelID string `protobuf:"bytes,1,opt,name=model_iD,json=modelID" json:"model_iD,omitempty"`
+	// The typeID for the metric e.g., voltage
+	TypeID string `protobuf:"bytes,2,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	// The lower threshold for the metric to be good.
+	Lower float64 `protobuf:"fixed64,3,opt,name=lower" json:"lower,omitempty"`
+	// The upper threshold for the metric to be good.
+	Upper float64 `protobuf:"fixed64,4,opt,name=upper" json:"upper,omitempty"`
+	// The scale to multiply the thresholds by
+	Scale float64 `protobuf:"fixed64,5,opt,name=scale" json:"scale,omitempty"`
+	// The seconds a value must stay outside the thresholds before the metric is bad.
+	ForSeconds int32 `protobuf:"varint,6,opt,name=for_seconds,json=forSeconds" json:"for_seconds,omitempty"`
+	// A bad metric is good again once the value is inside lower + hysteresis and upper - hysteresis.
+	Hysteresis float64 `protobuf:"fixed64,7,opt,name=hysteresis" json:"hysteresis,omitempty"`
+}
+
+func (m *FieldModelThreshold) Reset()                    { *m = FieldModelThreshold{} }
+func (m *FieldModelThreshold) String() string            { return proto.CompactTextString(m) }
+func (*FieldModelThreshold) ProtoMessage()               {}
+func (*FieldModelThreshold) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{6} }
+
+type FieldModelThresholdResult struct {
+	Result []*FieldModelThreshold `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *FieldModelThresholdResult) Reset()                    { *m = FieldModelThresholdResult{} }
+func (m *FieldModelThresholdResult) String() string            { return proto.CompactTextString(m) }
+func (*FieldModelThresholdResult) ProtoMessage()               {}
+func (*FieldModelThresholdResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{7} }
+
+func (m *FieldModelThresholdResult) GetResult() []*FieldModelThreshold {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+// FieldMetricLate is the late window for a device and type.  It overrides the late window for the type.
+type FieldMetricLate struct {
+	// The deviceID for the metric e.g., idu-birchfarm
+	DeviceID string `protobuf:"bytes,1,opt,name=device_iD,json=deviceID" json:"device_iD,omitempty"`
+	// The typeID for the metric e.g., conn
+	TypeID string `protobuf:"bytes,2,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	// The metric is late when there hasn't been a value for this many seconds.
+	Late int32 `protobuf:"varint,3,opt,name=late" json:"late,omitempty"`
+}
+
+func (m *FieldMetricLate) Reset()                    { *m = FieldMetricLate{} }
+func (m *FieldMetricLate) String() string            { return proto.CompactTextString(m) }
+func (*FieldMetricLate) ProtoMessage()               {}
+func (*FieldMetricLate) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{8} }
+
+type FieldMetricLateResult struct {
+	Result []*FieldMetricLate `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *FieldMetricLateResult) Reset()                    { *m = FieldMetricLateResult{} }
+func (m *FieldMetricLateResult) String() string            { return proto.CompactTextString(m) }
+func (*FieldMetricLateResult) ProtoMessage()               {}
+func (*FieldMetricLateResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{9} }
+
+func (m *FieldMetricLateResult) GetResult() []*FieldMetricLate {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+// FieldMetricAnomaly is the rate of change and baseline thresholds for a device and type.
+// They are checked as well as the lower and upper thresholds.
+type FieldMetricAnomaly struct {
+	// The deviceID for the metric e.g., idu-birchfarm
+	DeviceID string `protobuf:"bytes,1,opt,name=device_iD,json=deviceID" json:"device_iD,omitempty"`
+	// The typeID for the metric e.g., voltage
+	TypeID string `protobuf:"bytes,2,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	// The largest change in the value per hour.  0 for none.
+	Rate float64 `protobuf:"fixed64,3,opt,name=rate" json:"rate,omitempty"`
+	// The value is bad if it is more than deviations standard deviations from the mean for the same hour
+	// on the last days days.  0 for none.
+	Deviations float64 `protobuf:"fixed64,4,opt,name=deviations" json:"deviations,omitempty"`
+	Days       int32   `protobuf:"varint,5,opt,name=days" json:"days,omitempty"`
+}
+
+func (m *FieldMetricAnomaly) Reset()                    { *m = FieldMetricAnomaly{} }
+func (m *FieldMetricAnomaly) String() string            { return proto.CompactTextString(m) }
+func (*FieldMetricAnomaly) ProtoMessage()               {}
+func (*FieldMetricAnomaly) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{10} }
+
+type FieldMetricAnomalyResult struct {
+	Result []*FieldMetricAnomaly `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *FieldMetricAnomalyResult) Reset()                    { *m = FieldMetricAnomalyResult{} }
+func (m *FieldMetricAnomalyResult) String() string            { return proto.CompactTextString(m) }
+func (*FieldMetricAnomalyResult) ProtoMessage()               {}
+func (*FieldMetricAnomalyResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{11} }
+
+func (m *FieldMetricAnomalyResult) GetResult() []*FieldMetricAnomaly {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
 type FieldModel struct {
 	// the modelID for the field threshold
 	ModelID string `protobuf:"bytes,1,opt,name=model_iD,json=modelID" json:"model_iD,omitempty"`
@@ -127,7 +258,7 @@ type FieldModel struct {
 func (m *FieldModel) Reset()                    { *m = FieldModel{} }
 func (m *FieldModel) String() string            { return proto.CompactTextString(m) }
 func (*FieldModel) ProtoMessage()               {}
-func (*FieldModel) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{6} }
+func (*FieldModel) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{12} }
 
 type FieldModelResult struct {
 	Result []*FieldModel `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
@@ -136,7 +267,7 @@ type FieldModelResult struct {
 func (m *FieldModelResult) Reset()                    { *m = FieldModelResult{} }
 func (m *FieldModelResult) String() string            { return proto.CompactTextString(m) }
 func (*FieldModelResult) ProtoMessage()               {}
-func (*FieldModelResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{7} }
+func (*FieldModelResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{13} }
 
 func (m *FieldModelResult) GetResult() []*FieldModel {
 	if m != nil {
@@ -153,12 +284,15 @@ type FieldDevice struct {
 	// Decimal Latitude and Longitude, only uses three digits of precision after decimal
 	Latitude  float32 `protobuf:"fixed32,3,opt,name=latitude" json:"latitude,omitempty"`
 	Longitude float32 `protobuf:"fixed32,4,opt,name=longitude" json:"longitude,omitempty"`
+	// true if the device was auto registered and has not been confirmed.
+	// The model and location are unknown.
+	Pending bool `protobuf:"varint,5,opt,name=pending" json:"pending,omitempty"`
 }
 
 func (m *FieldDevice) Reset()                    { *m = FieldDevice{} }
 func (m *FieldDevice) String() string            { return proto.CompactTextString(m) }
 func (*FieldDevice) ProtoMessage()               {}
-func (*FieldDevice) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{8} }
+func (*FieldDevice) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{14} }
 
 type FieldDeviceResult struct {
 	Result []*FieldDevice `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
@@ -167,7 +301,7 @@ type FieldDeviceResult struct {
 func (m *FieldDeviceResult) Reset()                    { *m = FieldDeviceResult{} }
 func (m *FieldDeviceResult) String() string            { return proto.CompactTextString(m) }
 func (*FieldDeviceResult) ProtoMessage()               {}
-func (*FieldDeviceResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{9} }
+func (*FieldDeviceResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{15} }
 
 func (m *FieldDeviceResult) GetResult() []*FieldDevice {
 	if m != nil {
@@ -181,12 +315,22 @@ type FieldType struct {
 	TypeID string `protobuf:"bytes,1,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
 	// display in the table field.type, the units to display when plotting
 	Display string `protobuf:"bytes,2,opt,name=display" json:"display,omitempty"`
+	// The minimum number of seconds between values for the type.
+	MinInterval int32 `protobuf:"varint,3,opt,name=min_interval,json=minInterval" json:"min_interval,omitempty"`
+	// description in the table field.type
+	Description string `protobuf:"bytes,4,opt,name=description" json:"description,omitempty"`
+	// unit in the table field.type, the units the values are stored in e.g., mV
+	Unit string `protobuf:"bytes,5,opt,name=unit" json:"unit,omitempty"`
+	// scale in the table field.type, multiply the stored values by scale to convert them to display
+	Scale float64 `protobuf:"fixed64,6,opt,name=scale" json:"scale,omitempty"`
+	// late in the table field.type, metrics are late when there hasn't been a value for this many seconds.
+	Late int32 `protobuf:"varint,7,opt,name=late" json:"late,omitempty"`
 }
 
 func (m *FieldType) Reset()                    { *m = FieldType{} }
 func (m *FieldType) String() string            { return proto.CompactTextString(m) }
 func (*FieldType) ProtoMessage()               {}
-func (*FieldType) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{10} }
+func (*FieldType) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{16} }
 
 type FieldTypeResult struct {
 	Result []*FieldType `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
@@ -195,7 +339,7 @@ type FieldTypeResult struct {
 func (m *FieldTypeResult) Reset()                    { *m = FieldTypeResult{} }
 func (m *FieldTypeResult) String() string            { return proto.CompactTextString(m) }
 func (*FieldTypeResult) ProtoMessage()               {}
-func (*FieldTypeResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{11} }
+func (*FieldTypeResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{17} }
 
 func (m *FieldTypeResult) GetResult() []*FieldType {
 	if m != nil {
@@ -211,14 +355,18 @@ type FieldState struct {
 	TypeID string `protobuf:"bytes,2,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
 	// Unix time in seconds for the state in field.state (don't need nanos).
 	Seconds int64 `protobuf:"varint,3,opt,name=seconds" json:"seconds,omitempty"`
-	// the on/off value state in field.state
+	// the on/off value state in field.state.  For enumerated states true when the severity is ok.
 	Value bool `protobuf:"varint,4,opt,name=value" json:"value,omitempty"`
+	// the enumerated value in field.state e.g., running.  Empty for on/off states.
+	State string `protobuf:"bytes,5,opt,name=state" json:"state,omitempty"`
+	// the severity of the state: 0 ok, 1 warning, 2 critical.  On is ok and off is critical for on/off states.
+	Severity int32 `protobuf:"varint,6,opt,name=severity" json:"severity,omitempty"`
 }
 
 func (m *FieldState) Reset()                    { *m = FieldState{} }
 func (m *FieldState) String() string            { return proto.CompactTextString(m) }
 func (*FieldState) ProtoMessage()               {}
-func (*FieldState) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{12} }
+func (*FieldState) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{18} }
 
 type FieldStateResult struct {
 	Result []*FieldState `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
@@ -227,7 +375,7 @@ type FieldStateResult struct {
 func (m *FieldStateResult) Reset()                    { *m = FieldStateResult{} }
 func (m *FieldStateResult) String() string            { return proto.CompactTextString(m) }
 func (*FieldStateResult) ProtoMessage()               {}
-func (*FieldStateResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{13} }
+func (*FieldStateResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{19} }
 
 func (m *FieldStateResult) GetResult() []*FieldState {
 	if m != nil {
@@ -236,6 +384,37 @@ func (m *FieldStateResult) GetResult() []*FieldState {
 	return nil
 }
 
+// FieldStateValue is an allowed value for an enumerated state type.
+type FieldStateValue struct {
+	// the typeID in field.state_type e.g., generator
+	TypeID string `protobuf:"bytes,1,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	// the value e.g., running
+	Value string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+	// 0 ok, 1 warning, 2 critical
+	Severity int32 `protobuf:"varint,3,opt,name=severity" json:"severity,omitempty"`
+}
+
+func (m *FieldStateValue) Reset()                    { *m = FieldStateValue{} }
+func (m *FieldStateValue) String() string            { return proto.CompactTextString(m) }
+func (*FieldStateValue) ProtoMessage()               {}
+func (*FieldStateValue) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{20} }
+
+type FieldStateValueResult struct {
+	Result []*FieldStateValue `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *FieldStateValueResult) Reset()                    { *m = FieldStateValueResult{} }
+func (m *FieldStateValueResult) String() string            { return proto.CompactTextString(m) }
+func (*FieldStateValueResult) ProtoMessage()               {}
+func (*FieldStateValueResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{21} }
+
+func (m *FieldStateValueResult) GetResult() []*FieldStateValue {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
 type FieldStateTag struct {
 	// The deviceID for the metric e.g., idu-birchfarm
 	DeviceID string `protobuf:"bytes,1,opt,name=device_iD,json=deviceID" json:"device_iD,omitempty"`
@@ -248,7 +427,7 @@ type FieldStateTag struct {
 func (m *FieldStateTag) Reset()                    { *m = FieldStateTag{} }
 func (m *FieldStateTag) String() string            { return proto.CompactTextString(m) }
 func (*FieldStateTag) ProtoMessage()               {}
-func (*FieldStateTag) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{14} }
+func (*FieldStateTag) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{22} }
 
 type FieldStateTagResult struct {
 	Result []*FieldStateTag `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
@@ -257,7 +436,7 @@ type FieldStateTagResult struct {
 func (m *FieldStateTagResult) Reset()                    { *m = FieldStateTagResult{} }
 func (m *FieldStateTagResult) String() string            { return proto.CompactTextString(m) }
 func (*FieldStateTagResult) ProtoMessage()               {}
-func (*FieldStateTagResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{15} }
+func (*FieldStateTagResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{23} }
 
 func (m *FieldStateTagResult) GetResult() []*FieldStateTag {
 	if m != nil {
@@ -271,12 +450,14 @@ type FieldMetric struct {
 	Seconds int64 `protobuf:"varint,1,opt,name=seconds" json:"seconds,omitempty"`
 	// The value
 	Value float32 `protobuf:"fixed32,2,opt,name=value" json:"value,omitempty"`
+	// The value with double precision.
+	ValueDouble float64 `protobuf:"fixed64,3,opt,name=value_double,json=valueDouble" json:"value_double,omitempty"`
 }
 
 func (m *FieldMetric) Reset()                    { *m = FieldMetric{} }
 func (m *FieldMetric) String() string            { return proto.CompactTextString(m) }
 func (*FieldMetric) ProtoMessage()               {}
-func (*FieldMetric) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{16} }
+func (*FieldMetric) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{24} }
 
 type FieldMetricResult struct {
 	// The deviceID for the metric e.g., idu-birchfarm
@@ -294,12 +475,17 @@ type FieldMetricResult struct {
 	Result []*FieldMetric `protobuf:"bytes,7,rep,name=result" json:"result,omitempty"`
 	// the scale factor to multiply the threshold values by
 	Scale float64 `protobuf:"fixed64,8,opt,name=scale" json:"scale,omitempty"`
+	// The upper and lower thresholds without rounding.
+	UpperDouble float64 `protobuf:"fixed64,9,opt,name=upper_double,json=upperDouble" json:"upper_double,omitempty"`
+	LowerDouble float64 `protobuf:"fixed64,10,opt,name=lower_double,json=lowerDouble" json:"lower_double,omitempty"`
+	// Where the thresholds come from: device, model, or empty if no threshold has been set.
+	ThresholdSource string `protobuf:"bytes,11,opt,name=threshold_source,json=thresholdSource" json:"threshold_source,omitempty"`
 }
 
 func (m *FieldMetricResult) Reset()                    { *m = FieldMetricResult{} }
 func (m *FieldMetricResult) String() string            { return proto.CompactTextString(m) }
 func (*FieldMetricResult) ProtoMessage()               {}
-func (*FieldMetricResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{17} }
+func (*FieldMetricResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{25} }
 
 func (m *FieldMetricResult) GetResult() []*FieldMetric {
 	if m != nil {
@@ -308,6 +494,73 @@ func (m *FieldMetricResult) GetResult() []*FieldMetric {
 	return nil
 }
 
+// FieldMetricBatch is for sending many field metric values in a single request.
+type FieldMetricBatch struct {
+	Value []*FieldMetricBatchValue `protobuf:"bytes,1,rep,name=value" json:"value,omitempty"`
+}
+
+func (m *FieldMetricBatch) Reset()                    { *m = FieldMetricBatch{} }
+func (m *FieldMetricBatch) String() string            { return proto.CompactTextString(m) }
+func (*FieldMetricBatch) ProtoMessage()               {}
+func (*FieldMetricBatch) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{26} }
+
+func (m *FieldMetricBatch) GetValue() []*FieldMetricBatchValue {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+type FieldMetricBatchValue struct {
+	// The deviceID for the metric e.g., idu-birchfarm
+	DeviceID string `protobuf:"bytes,1,opt,name=device_iD,json=deviceID" json:"device_iD,omitempty"`
+	// The typeID for the metric e.g., conn
+	TypeID string `protobuf:"bytes,2,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	// Unix time in seconds for the metric value (don't need nanos).
+	Seconds int64 `protobuf:"varint,3,opt,name=seconds" json:"seconds,omitempty"`
+	// The value
+	Value int32 `protobuf:"varint,4,opt,name=value" json:"value,omitempty"`
+	// The value with a fraction e.g., 21.5  Used instead of value when doubles is true or it is not 0.
+	ValueDouble float64 `protobuf:"fixed64,5,opt,name=value_double,json=valueDouble" json:"value_double,omitempty"`
+	// Set when the value is in value_double.  Needed if it can be 0.
+	Doubles bool `protobuf:"varint,6,opt,name=doubles" json:"doubles,omitempty"`
+}
+
+func (m *FieldMetricBatchValue) Reset()                    { *m = FieldMetricBatchValue{} }
+func (m *FieldMetricBatchValue) String() string            { return proto.CompactTextString(m) }
+func (*FieldMetricBatchValue) ProtoMessage()               {}
+func (*FieldMetricBatchValue) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{27} }
+
+// BatchStatus is the outcome for a single value sent in a batch.
+type BatchStatus struct {
+	// The HTTP status code for the value e.g., 200 for success, 429 if there is already data for the interval.
+	Code int32 `protobuf:"varint,1,opt,name=code" json:"code,omitempty"`
+	// Any error message for the value.
+	Msg string `protobuf:"bytes,2,opt,name=msg" json:"msg,omitempty"`
+}
+
+func (m *BatchStatus) Reset()                    { *m = BatchStatus{} }
+func (m *BatchStatus) String() string            { return proto.CompactTextString(m) }
+func (*BatchStatus) ProtoMessage()               {}
+func (*BatchStatus) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{28} }
+
+// FieldMetricBatchResult has a BatchStatus for each value in a FieldMetricBatch, in the same order.
+type FieldMetricBatchResult struct {
+	Result []*BatchStatus `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *FieldMetricBatchResult) Reset()                    { *m = FieldMetricBatchResult{} }
+func (m *FieldMetricBatchResult) String() string            { return proto.CompactTextString(m) }
+func (*FieldMetricBatchResult) ProtoMessage()               {}
+func (*FieldMetricBatchResult) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{29} }
+
+func (m *FieldMetricBatchResult) GetResult() []*BatchStatus {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*FieldMetricSummary)(nil), "mtrpb.FieldMetricSummary")
 	proto.RegisterType((*FieldMetricSummaryResult)(nil), "mtrpb.FieldMetricSummaryResult")
@@ -315,6 +568,12 @@ func init() {
 	proto.RegisterType((*FieldMetricTagResult)(nil), "mtrpb.FieldMetricTagResult")
 	proto.RegisterType((*FieldMetricThreshold)(nil), "mtrpb.FieldMetricThreshold")
 	proto.RegisterType((*FieldMetricThresholdResult)(nil), "mtrpb.FieldMetricThresholdResult")
+	proto.RegisterType((*FieldModelThreshold)(nil), "mtrpb.FieldModelThreshold")
+	proto.RegisterType((*FieldModelThresholdResult)(nil), "mtrpb.FieldModelThresholdResult")
+	proto.RegisterType((*FieldMetricLate)(nil), "mtrpb.FieldMetricLate")
+	proto.RegisterType((*FieldMetricLateResult)(nil), "mtrpb.FieldMetricLateResult")
+	proto.RegisterType((*FieldMetricAnomaly)(nil), "mtrpb.FieldMetricAnomaly")
+	proto.RegisterType((*FieldMetricAnomalyResult)(nil), "mtrpb.FieldMetricAnomalyResult")
 	proto.RegisterType((*FieldModel)(nil), "mtrpb.FieldModel")
 	proto.RegisterType((*FieldModelResult)(nil), "mtrpb.FieldModelResult")
 	proto.RegisterType((*FieldDevice)(nil), "mtrpb.FieldDevice")
@@ -323,47 +582,86 @@ func init() {
 	proto.RegisterType((*FieldTypeResult)(nil), "mtrpb.FieldTypeResult")
 	proto.RegisterType((*FieldState)(nil), "mtrpb.FieldState")
 	proto.RegisterType((*FieldStateResult)(nil), "mtrpb.FieldStateResult")
+	proto.RegisterType((*FieldStateValue)(nil), "mtrpb.FieldStateValue")
+	proto.RegisterType((*FieldStateValueResult)(nil), "mtrpb.FieldStateValueResult")
 	proto.RegisterType((*FieldStateTag)(nil), "mtrpb.FieldStateTag")
 	proto.RegisterType((*FieldStateTagResult)(nil), "mtrpb.FieldStateTagResult")
 	proto.RegisterType((*FieldMetric)(nil), "mtrpb.FieldMetric")
 	proto.RegisterType((*FieldMetricResult)(nil), "mtrpb.FieldMetricResult")
+	proto.RegisterType((*FieldMetricBatch)(nil), "mtrpb.FieldMetricBatch")
+	proto.RegisterType((*FieldMetricBatchValue)(nil), "mtrpb.FieldMetricBatchValue")
+	proto.RegisterType((*BatchStatus)(nil), "mtrpb.BatchStatus")
+	proto.RegisterType((*FieldMetricBatchResult)(nil), "mtrpb.FieldMetricBatchResult")
 }
 
 var fileDescriptor2 = []byte{
-	// 553 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xcc, 0x55, 0xc1, 0x6e, 0xd3, 0x40,
-	0x10, 0xd5, 0xc6, 0x71, 0x6c, 0x4f, 0x04, 0xa4, 0x4b, 0x10, 0x6e, 0xcb, 0x01, 0xf9, 0x42, 0x40,
-	0x10, 0x09, 0x7a, 0x44, 0x05, 0x09, 0x02, 0x12, 0x87, 0x1e, 0x70, 0x2b, 0x81, 0xb8, 0x20, 0x37,
-	0x5e, 0x52, 0x4b, 0x9b, 0xda, 0xb2, 0xd7, 0x45, 0x39, 0xf1, 0x07, 0xfc, 0x1e, 0x9f, 0xc0, 0x6f,
-	0xb0, 0x9e, 0x5d, 0x3b, 0x6b, 0x27, 0x20, 0x14, 0x81, 0xd4, 0x5b, 0xe6, 0xcd, 0xac, 0xdf, 0x9b,
-	0x79, 0xb3, 0x1b, 0x18, 0x7e, 0x49, 0x18, 0x8f, 0xa7, 0x59, 0x9e, 0x8a, 0x94, 0xda, 0x4b, 0x91,
-	0x67, 0xe7, 0xc1, 0x0f, 0x02, 0xf4, 0x6d, 0x05, 0x9f, 0x30, 0x91, 0x27, 0xf3, 0xd3, 0x72, 0xb9,
-	0x8c, 0xf2, 0x15, 0x3d, 0x04, 0x2f, 0x66, 0x57, 0xc9, 0x9c, 0x7d, 0x4e, 0x66, 0x3e, 0xb9, 0x4f,
-	0x26, 0x5e, 0xe8, 0x2a, 0xe0, 0xdd, 0x8c, 0xde, 0x05, 0x47, 0xac, 0x32, 0x4c, 0xf5, 0x30, 0x35,
-	0xa8, 0x42, 0x99, 0xf0, 0xc1, 0x29, 0xd8, 0x3c, 0xbd, 0x8c, 0x0b, 0xdf, 0x92, 0x09, 0x2b, 0xac,
-	0x43, 0x3a, 0x06, 0xfb, 0x2a, 0xe2, 0x25, 0xf3, 0xfb, 0x12, 0xb7, 0x43, 0x15, 0x54, 0x68, 0x99,
-	0x65, 0x2c, 0xf7, 0x6d, 0x85, 0x62, 0x50, 0xa1, 0x3c, 0xfd, 0x2a, 0xd1, 0x81, 0x42, 0x31, 0xa0,
-	0xfb, 0xe0, 0x2e, 0xd3, 0x98, 0xf1, 0x8a, 0xd5, 0x41, 0x56, 0x07, 0x63, 0x49, 0x2b, 0x0f, 0x14,
-	0xf3, 0x88, 0x33, 0xdf, 0x95, 0x38, 0x09, 0x55, 0x10, 0x9c, 0x80, 0xbf, 0xd9, 0x58, 0xc8, 0x8a,
-	0x92, 0x0b, 0xfa, 0x14, 0x06, 0x39, 0xfe, 0x92, 0xbd, 0x59, 0x93, 0xe1, 0xb3, 0xfd, 0x29, 0x4e,
-	0x63, 0xba, 0xe5, 0x80, 0x2e, 0x0c, 0x3e, 0xc2, 0x4d, 0x23, 0x7b, 0x16, 0x2d, 0x76, 0x9c, 0xd1,
-	0x08, 0x2c, 0x11, 0x2d, 0x70, 0x3e, 0x5e, 0x58, 0xfd, 0x0c, 0xde, 0xc0, 0xb8, 0xfd, 0x65, 0x2d,
-	0xf2, 0x49, 0x47, 0xe4, 0x9d, 0x4d, 0x91, 0x55, 0x71, 0x2d, 0xf0, 0x3b, 0x69, 0x7f, 0xe7, 0x42,
-	0xe2, 0x17, 0x29, 0x8f, 0x77, 0xd4, 0xd9, 0xb8, 0x60, 0x99, 0x2e, 0x34, 0x8e, 0xf5, 0x3b, 0x8e,
-	0x29, 0x03, 0x6c, 0xd3, 0x80, 0xf7, 0x70, 0xb0, 0x4d, 0x8f, 0xee, 0xee, 0xa8, 0xd3, 0xdd, 0xe1,
-	0x96, 0xee, 0x9a, 0x23, 0x75, 0x8f, 0x0f, 0x00, 0x54, 0xbe, 0x72, 0xbe, 0xb5, 0x12, 0xa4, 0xb5,
-	0x12, 0xc1, 0x31, 0x8c, 0xd6, 0x85, 0x9a, 0xf1, 0x61, 0x87, 0x71, 0xaf, 0xc5, 0x88, 0x85, 0x35,
-	0xcf, 0x37, 0x18, 0x22, 0x3a, 0xc3, 0x31, 0xfd, 0x79, 0x82, 0xa6, 0x8a, 0x5e, 0x7b, 0x31, 0x0f,
-	0xc0, 0xe5, 0x91, 0x48, 0x44, 0x19, 0x33, 0x1c, 0x63, 0x2f, 0x6c, 0x62, 0x7a, 0x0f, 0x3c, 0x9e,
-	0x5e, 0x2e, 0x54, 0xb2, 0x8f, 0xc9, 0x35, 0x10, 0xbc, 0x84, 0x3d, 0x43, 0x80, 0x6e, 0xe0, 0x51,
-	0xa7, 0x01, 0x6a, 0x36, 0xa0, 0x2b, 0xeb, 0x0e, 0x5e, 0x80, 0x87, 0xf0, 0x99, 0x74, 0xd3, 0x34,
-	0x99, 0x74, 0x2f, 0x6c, 0x9c, 0x14, 0x19, 0x8f, 0x56, 0xb5, 0x74, 0x1d, 0x06, 0xcf, 0xe1, 0x56,
-	0x73, 0x5e, 0xd3, 0x4f, 0x3a, 0xf4, 0x23, 0x93, 0x1e, 0xeb, 0x6a, 0xf2, 0x5c, 0xdb, 0x74, 0x2a,
-	0x22, 0xc1, 0xfe, 0xef, 0x5b, 0xe2, 0xea, 0xb7, 0xa4, 0x71, 0x1c, 0x39, 0xff, 0xc6, 0x71, 0x55,
-	0x58, 0x4b, 0xfe, 0x00, 0x37, 0xd6, 0xe8, 0xbf, 0xbc, 0xdd, 0xaf, 0xe1, 0x76, 0xeb, 0xc3, 0x5a,
-	0xda, 0xe3, 0x8e, 0xb4, 0xf1, 0x86, 0x34, 0xf3, 0x6e, 0x1f, 0xeb, 0x7d, 0x54, 0xf7, 0xc2, 0x9c,
-	0x0d, 0xf9, 0xcd, 0x6c, 0x7a, 0xb8, 0x51, 0x7a, 0x36, 0x3f, 0x89, 0x5e, 0x27, 0x75, 0x5e, 0x4b,
-	0xb8, 0x7e, 0x6f, 0xfc, 0x7a, 0xc1, 0x9d, 0xcd, 0x05, 0xd7, 0xda, 0x75, 0xc5, 0xf6, 0x47, 0xff,
-	0x95, 0xf3, 0x49, 0xfd, 0xaf, 0x9d, 0x0f, 0xf0, 0x5f, 0xee, 0xe8, 0x57, 0x00, 0x00, 0x00, 0xff,
-	0xff, 0x5e, 0xb2, 0xd3, 0x0d, 0xf4, 0x06, 0x00, 0x00,
+	// 1082 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xcc, 0x57, 0xdd, 0x6e, 0xe4, 0x34,
+	0x14, 0x96, 0x67, 0x3a, 0x3f, 0x39, 0xd9, 0xdd, 0x99, 0x66, 0xdb, 0x25, 0xed, 0xae, 0x60, 0xc8,
+	0x0d, 0xb3, 0x08, 0x2a, 0xd1, 0x5e, 0x22, 0x84, 0x58, 0x86, 0x45, 0x95, 0x58, 0x21, 0xd2, 0x15,
+	0x20, 0x40, 0x1a, 0xd2, 0xc4, 0x9d, 0x46, 0xca, 0x9f, 0xf2, 0x53, 0x34, 0xaf, 0x81, 0xc4, 0x05,
+	0xf7, 0x3c, 0x05, 0x77, 0xdc, 0xf3, 0x00, 0xbc, 0x01, 0xaf, 0x81, 0x7c, 0x6c, 0x27, 0x8e, 0x33,
+	0x6d, 0x47, 0x23, 0x84, 0xb8, 0xf3, 0x39, 0x3e, 0x8e, 0xbf, 0xf3, 0xf9, 0xf3, 0xf1, 0x09, 0x98,
+	0x57, 0x21, 0x8d, 0x82, 0x93, 0x2c, 0x4f, 0xcb, 0xd4, 0x1a, 0xc4, 0x65, 0x9e, 0x5d, 0x3a, 0x7f,
+	0xf7, 0xc1, 0x7a, 0xc9, 0xdc, 0xaf, 0x68, 0x99, 0x87, 0xfe, 0x45, 0x15, 0xc7, 0x5e, 0xbe, 0xb6,
+	0x9e, 0x82, 0x11, 0xd0, 0x9b, 0xd0, 0xa7, 0xcb, 0x70, 0x61, 0x93, 0x19, 0x99, 0x1b, 0xee, 0x98,
+	0x3b, 0xce, 0x17, 0xd6, 0x1b, 0x30, 0x2a, 0xd7, 0x19, 0x4e, 0xf5, 0x70, 0x6a, 0xc8, 0xcc, 0xf3,
+	0x85, 0x65, 0xc3, 0xa8, 0xa0, 0x7e, 0x9a, 0x04, 0x85, 0xdd, 0x9f, 0x91, 0x79, 0xdf, 0x95, 0xa6,
+	0x75, 0x00, 0x83, 0x1b, 0x2f, 0xaa, 0xa8, 0xbd, 0x37, 0x23, 0xf3, 0x81, 0xcb, 0x0d, 0xe6, 0xad,
+	0xb2, 0x8c, 0xe6, 0xf6, 0x80, 0x7b, 0xd1, 0x60, 0xde, 0x28, 0xfd, 0x89, 0xe6, 0xf6, 0x90, 0x7b,
+	0xd1, 0xb0, 0x8e, 0x60, 0x1c, 0xa7, 0x01, 0x8d, 0xd8, 0xae, 0x23, 0xdc, 0x75, 0x84, 0xf6, 0xf9,
+	0x82, 0x2d, 0x28, 0x7c, 0x2f, 0xa2, 0xf6, 0x78, 0x46, 0xe6, 0xc4, 0xe5, 0x06, 0x03, 0x93, 0xd1,
+	0x24, 0x08, 0x93, 0x95, 0x6d, 0xcc, 0xc8, 0x7c, 0xec, 0x4a, 0xd3, 0x7a, 0x1b, 0x1e, 0xe0, 0xfe,
+	0xcb, 0x20, 0xad, 0x2e, 0x23, 0x6a, 0x03, 0x2e, 0x33, 0xd1, 0xb7, 0x40, 0x17, 0x0b, 0x41, 0x30,
+	0x32, 0xc4, 0xe4, 0x21, 0xe8, 0x6b, 0x42, 0x10, 0x99, 0x0c, 0x79, 0xc0, 0x43, 0xd0, 0x27, 0x42,
+	0x2c, 0xd8, 0x8b, 0xbc, 0x92, 0xda, 0x0f, 0x71, 0x7f, 0x1c, 0x5b, 0x33, 0x30, 0x63, 0x2f, 0x4c,
+	0x4a, 0x9a, 0x78, 0x89, 0x4f, 0xed, 0x47, 0x38, 0xa5, 0xba, 0xac, 0xe7, 0x30, 0x2d, 0xaf, 0x73,
+	0x5a, 0x5c, 0xa7, 0x51, 0xb0, 0x2c, 0xd2, 0x2a, 0xf7, 0xa9, 0x3d, 0xc1, 0x8c, 0x27, 0xb5, 0xff,
+	0x02, 0xdd, 0xd6, 0x14, 0xfa, 0x97, 0x5e, 0x60, 0x4f, 0xf1, 0x23, 0x6c, 0xc8, 0xb2, 0xf6, 0x92,
+	0x34, 0xf6, 0xa2, 0xb5, 0xbd, 0xcf, 0x59, 0x12, 0xa6, 0xf3, 0x0a, 0xec, 0xee, 0x41, 0xbb, 0xb4,
+	0xa8, 0xa2, 0xd2, 0xfa, 0x00, 0x86, 0x39, 0x8e, 0x6c, 0x32, 0xeb, 0xcf, 0xcd, 0xd3, 0xa3, 0x13,
+	0x54, 0xc7, 0xc9, 0x86, 0x05, 0x22, 0xd0, 0xf9, 0x16, 0x1e, 0x29, 0xb3, 0xaf, 0xbd, 0xd5, 0x8e,
+	0x9a, 0x99, 0x42, 0xbf, 0xf4, 0x56, 0xa8, 0x17, 0xc3, 0x65, 0x43, 0xe7, 0x33, 0x38, 0x68, 0x7f,
+	0x59, 0x80, 0x7c, 0x5f, 0x03, 0x79, 0xd8, 0x05, 0xc9, 0x82, 0x25, 0xc0, 0x5f, 0x7a, 0xed, 0xef,
+	0x48, 0xea, 0x76, 0xc4, 0x59, 0xab, 0xb2, 0xaf, 0xaa, 0xb2, 0x56, 0xf0, 0x9e, 0xa6, 0x60, 0x2e,
+	0xc8, 0x81, 0x2a, 0x48, 0x5d, 0x30, 0xc3, 0xae, 0x60, 0x74, 0xd9, 0x8d, 0xba, 0xb2, 0x7b, 0x0b,
+	0xcc, 0xab, 0x34, 0x5f, 0xca, 0x7b, 0x36, 0xc6, 0x7d, 0xe1, 0x2a, 0xcd, 0x2f, 0xb8, 0xc7, 0x7a,
+	0x13, 0xe0, 0x7a, 0x5d, 0x94, 0x34, 0xa7, 0x45, 0x58, 0xa0, 0xf4, 0x89, 0xab, 0x78, 0x9c, 0xaf,
+	0xe0, 0x78, 0x13, 0x2d, 0x82, 0xe4, 0x33, 0x8d, 0xe4, 0xa7, 0x1b, 0x48, 0xae, 0x97, 0x48, 0xaa,
+	0xff, 0x24, 0xf0, 0x98, 0x07, 0xb0, 0x1b, 0xd9, 0x30, 0xad, 0xde, 0x59, 0xd2, 0xbe, 0xb3, 0xdb,
+	0xf1, 0x4c, 0x36, 0xf2, 0x4c, 0xee, 0xe6, 0x59, 0x63, 0x68, 0x78, 0x0f, 0x43, 0xa3, 0x0e, 0x43,
+	0x5f, 0xc2, 0xd1, 0x86, 0x6c, 0x04, 0x41, 0xa7, 0x1a, 0x41, 0xc7, 0x2d, 0x82, 0xda, 0x2b, 0x24,
+	0x3f, 0xdf, 0xc3, 0x44, 0xe1, 0xef, 0x0b, 0x56, 0x06, 0x76, 0x13, 0xa1, 0x2c, 0x28, 0x5c, 0x83,
+	0x38, 0x76, 0x3e, 0x87, 0x43, 0xed, 0xe3, 0x02, 0xe9, 0x89, 0x86, 0xf4, 0x49, 0xf7, 0x28, 0x31,
+	0x5a, 0xa2, 0xfc, 0x99, 0xb4, 0x9e, 0x82, 0x4f, 0x78, 0xdd, 0xd8, 0x1d, 0x69, 0x2e, 0x91, 0x12,
+	0x17, 0xc7, 0x8c, 0x77, 0xb6, 0xd0, 0x2b, 0xc3, 0x34, 0x29, 0xc4, 0x49, 0x2a, 0x1e, 0xb6, 0x26,
+	0xf0, 0xd6, 0x85, 0x78, 0x0d, 0x70, 0xac, 0x55, 0x2d, 0x81, 0x69, 0xfb, 0xaa, 0x25, 0x17, 0xc8,
+	0x1c, 0xdf, 0x01, 0x68, 0x0e, 0xea, 0x0e, 0x7d, 0x3a, 0x1f, 0xc1, 0xb4, 0x09, 0x14, 0xfb, 0x3d,
+	0xd7, 0xf6, 0xdb, 0xef, 0x1c, 0x7d, 0xbd, 0xcf, 0xaf, 0x04, 0x4c, 0x74, 0x2f, 0x90, 0xa9, 0xbb,
+	0x49, 0x54, 0x61, 0xf4, 0xda, 0xd7, 0xe4, 0x18, 0xc6, 0x91, 0x57, 0x86, 0x65, 0x15, 0x70, 0x2a,
+	0x7b, 0x6e, 0x6d, 0x5b, 0xcf, 0xc0, 0x88, 0xd2, 0x64, 0xc5, 0x27, 0xf7, 0x70, 0xb2, 0x71, 0xa8,
+	0xcf, 0xdf, 0xa0, 0xf5, 0xfc, 0x39, 0x1f, 0xc3, 0xbe, 0x02, 0x4d, 0xe4, 0xf6, 0xae, 0x96, 0x9b,
+	0xa5, 0xe6, 0x26, 0x22, 0x65, 0x72, 0x7f, 0x10, 0x30, 0xd0, 0xff, 0x7a, 0x9d, 0x51, 0x55, 0x02,
+	0x44, 0xef, 0x06, 0x82, 0xb0, 0xc8, 0x22, 0x6f, 0x2d, 0xb3, 0x12, 0x26, 0x2b, 0x73, 0x71, 0x98,
+	0x2c, 0xd9, 0x93, 0x97, 0xdf, 0x78, 0x91, 0x90, 0xb3, 0x19, 0x87, 0xc9, 0xb9, 0x70, 0xb1, 0x67,
+	0x32, 0xa0, 0x85, 0x9f, 0x87, 0x19, 0xd3, 0x06, 0xa6, 0x67, 0xb8, 0xaa, 0x8b, 0xa9, 0xa5, 0x4a,
+	0xc2, 0x12, 0xb3, 0x33, 0x5c, 0x1c, 0x37, 0x05, 0x61, 0xa8, 0x16, 0x04, 0x79, 0x6b, 0x46, 0xca,
+	0xad, 0xf9, 0x10, 0x26, 0x75, 0x0a, 0x82, 0x82, 0xb9, 0x46, 0xc1, 0x54, 0xa5, 0x00, 0xe3, 0x24,
+	0x01, 0xbf, 0x11, 0x21, 0xa3, 0x8b, 0x72, 0xf7, 0xbb, 0xbc, 0x65, 0xb3, 0x34, 0x56, 0x9a, 0xa5,
+	0x82, 0x6d, 0x27, 0x12, 0xe6, 0x06, 0x13, 0x48, 0x41, 0x6f, 0x68, 0x1e, 0x96, 0x6b, 0x51, 0xe9,
+	0x6a, 0xbb, 0xd6, 0x30, 0xa2, 0xdc, 0x46, 0xc3, 0x3c, 0x50, 0x66, 0xf9, 0x03, 0x4c, 0x1a, 0xef,
+	0xd7, 0x88, 0xe1, 0xd6, 0xb3, 0xae, 0x21, 0xf3, 0x1c, 0x05, 0x64, 0x15, 0x5c, 0x5f, 0x03, 0x27,
+	0xcb, 0x56, 0xf3, 0xf5, 0x6d, 0xca, 0x96, 0x12, 0x2d, 0x61, 0x7e, 0x03, 0x0f, 0x9b, 0xa9, 0x7f,
+	0xb3, 0x0f, 0xf9, 0x14, 0x1e, 0xb7, 0x3e, 0x2c, 0xf0, 0xbd, 0xa7, 0xe1, 0x3b, 0xe8, 0xe0, 0x53,
+	0xbb, 0x90, 0x1f, 0xc1, 0x54, 0xca, 0x91, 0x7a, 0xe8, 0xe4, 0x96, 0x43, 0xef, 0xe1, 0x4d, 0xe6,
+	0x46, 0xa7, 0x55, 0xed, 0x77, 0x5a, 0x55, 0xe7, 0xaf, 0x1e, 0xec, 0x2b, 0x5b, 0x08, 0x94, 0xff,
+	0xbf, 0x06, 0xbe, 0xa9, 0x30, 0xa3, 0x6e, 0x85, 0x11, 0xd8, 0x45, 0xc4, 0x2d, 0x1d, 0xbd, 0xde,
+	0x1d, 0x19, 0xf7, 0x37, 0xe5, 0xd0, 0xed, 0xb1, 0x36, 0xb5, 0xd7, 0xe6, 0xc6, 0xf6, 0xda, 0x79,
+	0x09, 0x53, 0x05, 0xdd, 0x0b, 0xaf, 0xf4, 0xaf, 0xad, 0x53, 0x49, 0x04, 0x3f, 0xfd, 0x67, 0xdd,
+	0x2c, 0x30, 0x8e, 0x6b, 0x94, 0x87, 0x3a, 0xbf, 0x13, 0x38, 0xdc, 0x18, 0xf0, 0x1f, 0x1d, 0x93,
+	0xae, 0xa2, 0x41, 0xf7, 0x87, 0x87, 0x15, 0x6b, 0x1c, 0xf1, 0x86, 0x69, 0xec, 0x4a, 0xd3, 0x39,
+	0x03, 0x13, 0x01, 0x33, 0x69, 0x57, 0xf8, 0x48, 0xfb, 0x69, 0x40, 0x11, 0xec, 0xc0, 0xc5, 0x31,
+	0xbb, 0x3b, 0x71, 0xb1, 0x12, 0x20, 0xd9, 0xd0, 0x59, 0xc0, 0x13, 0x3d, 0xe1, 0x7b, 0x1e, 0x1a,
+	0x65, 0x0f, 0x29, 0x83, 0x17, 0xa3, 0xef, 0xf8, 0x5f, 0xea, 0xe5, 0x10, 0xff, 0x59, 0xcf, 0xfe,
+	0x19, 0x00, 0x07, 0x78, 0xa8, 0x0b, 0xc2, 0x0e, 0x00, 0x00,
 }
@@ -0,0 +1,102 @@
+// Code generated by protoc-gen-go.
+// source: retention.proto
+// DO NOT EDIT!
+
+package mtrpb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type Retention struct {
+	// The schema for the retention: field, data, or app.
+	Schema string `protobuf:"bytes,1,opt,name=schema" json:"schema,omitempty"`
+	// The typeID in the schema, empty for the default retention for the schema.
+	TypeID string `protobuf:"bytes,2,opt,name=type_iD,json=typeID" json:"type_iD,omitempty"`
+	// The number of days raw values are kept for.
+	Days int32 `protobuf:"varint,3,opt,name=days" json:"days,omitempty"`
+}
+
+func (m *Retention) Reset()                    { *m = Retention{} }
+func (m *Retention) String() string            { return proto.CompactTextString(m) }
+func (*Retention) ProtoMessage()               {}
+func (*Retention) Descriptor() ([]byte, []int) { return fileDescriptor4, []int{0} }
+
+type RetentionResult struct {
+	Result []*Retention `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *RetentionResult) Reset()                    { *m = RetentionResult{} }
+func (m *RetentionResult) String() string            { return proto.CompactTextString(m) }
+func (*RetentionResult) ProtoMessage()               {}
+func (*RetentionResult) Descriptor() ([]byte, []int) { return fileDescriptor4, []int{1} }
+
+func (m *RetentionResult) GetResult() []*Retention {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+type Archive struct {
+	// The archive file relative to the archive directory e.g., field/metric_20160102.csv.gz
+	File string `protobuf:"bytes,1,opt,name=file" json:"file,omitempty"`
+	// The table the values were archived from e.g., field.metric
+	Table string `protobuf:"bytes,2,opt,name=table" json:"table,omitempty"`
+	// The day (UTC) of the archived values, Unix seconds.
+	Seconds int64 `protobuf:"varint,3,opt,name=seconds" json:"seconds,omitempty"`
+	// The size of the file in bytes.
+	Size int64 `protobuf:"varint,4,opt,name=size" json:"size,omitempty"`
+}
+
+func (m *Archive) Reset()                    { *m = Archive{} }
+func (m *Archive) String() string            { return proto.CompactTextString(m) }
+func (*Archive) ProtoMessage()               {}
+func (*Archive) Descriptor() ([]byte, []int) { return fileDescriptor4, []int{2} }
+
+type ArchiveResult struct {
+	Result []*Archive `protobuf:"bytes,1,rep,name=result" json:"result,omitempty"`
+}
+
+func (m *ArchiveResult) Reset()                    { *m = ArchiveResult{} }
+func (m *ArchiveResult) String() string            { return proto.CompactTextString(m) }
+func (*ArchiveResult) ProtoMessage()               {}
+func (*ArchiveResult) Descriptor() ([]byte, []int) { return fileDescriptor4, []int{3} }
+
+func (m *ArchiveResult) GetResult() []*Archive {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Retention)(nil), "mtrpb.Retention")
+	proto.RegisterType((*RetentionResult)(nil), "mtrpb.RetentionResult")
+	proto.RegisterType((*Archive)(nil), "mtrpb.Archive")
+	proto.RegisterType((*ArchiveResult)(nil), "mtrpb.ArchiveResult")
+}
+
+var fileDescriptor4 = []byte{
+	// 229 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x90, 0x31, 0x4b, 0xc4, 0x40,
+	0x10, 0x85, 0x89, 0xb9, 0x24, 0xdc, 0x88, 0x9e, 0x0c, 0xa2, 0x5b, 0x86, 0x14, 0xb2, 0x55, 0x0a,
+	0x2d, 0x2c, 0xac, 0x94, 0x6b, 0xec, 0x64, 0x4b, 0x1b, 0xd9, 0xe4, 0x46, 0x6e, 0x21, 0x97, 0x0d,
+	0xbb, 0xab, 0x70, 0xfe, 0x7a, 0xc9, 0xee, 0x44, 0xe1, 0xba, 0xf7, 0xe6, 0x0d, 0x6f, 0x3e, 0x06,
+	0x36, 0x8e, 0x02, 0x8d, 0xc1, 0xd8, 0xb1, 0x9d, 0x9c, 0x0d, 0x16, 0x8b, 0x43, 0x70, 0x53, 0xd7,
+	0xbc, 0xc1, 0x5a, 0x2d, 0x09, 0xde, 0x40, 0xe9, 0xfb, 0x3d, 0x1d, 0xb4, 0xc8, 0xea, 0x4c, 0xae,
+	0x15, 0x3b, 0xbc, 0x85, 0x2a, 0x1c, 0x27, 0xfa, 0x30, 0x5b, 0x71, 0x96, 0x82, 0xd9, 0xbe, 0x6e,
+	0x11, 0x61, 0xb5, 0xd3, 0x47, 0x2f, 0xf2, 0x3a, 0x93, 0x85, 0x8a, 0xba, 0x79, 0x82, 0xcd, 0x5f,
+	0xa3, 0x22, 0xff, 0x35, 0x04, 0x94, 0x50, 0xba, 0xa8, 0x44, 0x56, 0xe7, 0xf2, 0xfc, 0xfe, 0xaa,
+	0x8d, 0xc7, 0xdb, 0xff, 0x3d, 0xce, 0x1b, 0x0d, 0xd5, 0xb3, 0xeb, 0xf7, 0xe6, 0x9b, 0xe6, 0xee,
+	0x4f, 0x33, 0x10, 0xa3, 0x44, 0x8d, 0xd7, 0x50, 0x04, 0xdd, 0x0d, 0xc4, 0x18, 0xc9, 0xa0, 0x80,
+	0xca, 0x53, 0x6f, 0xc7, 0x5d, 0x02, 0xc9, 0xd5, 0x62, 0xe7, 0x0e, 0x6f, 0x7e, 0x48, 0xac, 0xe2,
+	0x38, 0xea, 0xe6, 0x11, 0x2e, 0xf8, 0x04, 0xd3, 0xdd, 0x9d, 0xd0, 0x5d, 0x32, 0xdd, 0xb2, 0xc5,
+	0xe9, 0x4b, 0xf5, 0x9e, 0x7e, 0xd6, 0x95, 0xf1, 0x83, 0x0f, 0xbf, 0x03, 0x00, 0xa2, 0x21, 0x54,
+	0x89, 0x54, 0x01, 0x00, 0x00,
+}
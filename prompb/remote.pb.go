@@ -0,0 +1,127 @@
+// Code generated by protoc-gen-go.
+// source: remote.proto
+// DO NOT EDIT!
+
+/*
+Package prompb is a generated protocol buffer package.
+
+The subset of the Prometheus remote write protocol used by mtr-api.
+https://github.com/prometheus/prometheus/blob/master/prompb/remote.proto
+https://github.com/prometheus/prometheus/blob/master/prompb/types.proto
+
+It is generated from these files:
+	remote.proto
+
+It has these top-level messages:
+	WriteRequest
+	TimeSeries
+	Label
+	Sample
+*/
+package prompb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+// WriteRequest is the body of a remote write request (after snappy decompression).
+type WriteRequest struct {
+	Timeseries []*TimeSeries `protobuf:"bytes,1,rep,name=timeseries" json:"timeseries,omitempty"`
+}
+
+func (m *WriteRequest) Reset()                    { *m = WriteRequest{} }
+func (m *WriteRequest) String() string            { return proto.CompactTextString(m) }
+func (*WriteRequest) ProtoMessage()               {}
+func (*WriteRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *WriteRequest) GetTimeseries() []*TimeSeries {
+	if m != nil {
+		return m.Timeseries
+	}
+	return nil
+}
+
+// TimeSeries is a series of samples identified by its labels.
+type TimeSeries struct {
+	Labels  []*Label  `protobuf:"bytes,1,rep,name=labels" json:"labels,omitempty"`
+	Samples []*Sample `protobuf:"bytes,2,rep,name=samples" json:"samples,omitempty"`
+}
+
+func (m *TimeSeries) Reset()                    { *m = TimeSeries{} }
+func (m *TimeSeries) String() string            { return proto.CompactTextString(m) }
+func (*TimeSeries) ProtoMessage()               {}
+func (*TimeSeries) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *TimeSeries) GetLabels() []*Label {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *TimeSeries) GetSamples() []*Sample {
+	if m != nil {
+		return m.Samples
+	}
+	return nil
+}
+
+type Label struct {
+	// The label name e.g., __name__, job, instance.
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	// The label value.
+	Value string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *Label) Reset()                    { *m = Label{} }
+func (m *Label) String() string            { return proto.CompactTextString(m) }
+func (*Label) ProtoMessage()               {}
+func (*Label) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+type Sample struct {
+	// The sample value.
+	Value float64 `protobuf:"fixed64,1,opt,name=value" json:"value,omitempty"`
+	// Unix time in milliseconds.
+	Timestamp int64 `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"`
+}
+
+func (m *Sample) Reset()                    { *m = Sample{} }
+func (m *Sample) String() string            { return proto.CompactTextString(m) }
+func (*Sample) ProtoMessage()               {}
+func (*Sample) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func init() {
+	proto.RegisterType((*WriteRequest)(nil), "prompb.WriteRequest")
+	proto.RegisterType((*TimeSeries)(nil), "prompb.TimeSeries")
+	proto.RegisterType((*Label)(nil), "prompb.Label")
+	proto.RegisterType((*Sample)(nil), "prompb.Sample")
+}
+
+var fileDescriptor0 = []byte{
+	// 212 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x4c, 0x90, 0x31, 0x4b, 0x04, 0x31,
+	0x10, 0x85, 0xc9, 0x9d, 0x17, 0xbd, 0xf1, 0xb4, 0x18, 0x2c, 0x52, 0x58, 0x1c, 0x01, 0x61, 0xab,
+	0x05, 0xcf, 0xd6, 0xea, 0x6a, 0xab, 0x9c, 0x20, 0x08, 0x16, 0x59, 0x98, 0x22, 0x90, 0x98, 0x98,
+	0x64, 0xfd, 0xfd, 0xb2, 0xb3, 0x1b, 0xd6, 0x2e, 0x79, 0xdf, 0xfb, 0x42, 0x78, 0x70, 0xc8, 0x14,
+	0x62, 0xa5, 0x3e, 0xe5, 0x58, 0x23, 0xca, 0x94, 0x63, 0x48, 0x83, 0x3e, 0xc3, 0xe1, 0x23, 0xbb,
+	0x4a, 0x86, 0x7e, 0x46, 0x2a, 0x15, 0x4f, 0x00, 0xd5, 0x05, 0x2a, 0x94, 0x1d, 0x15, 0x25, 0x8e,
+	0xdb, 0xee, 0xf6, 0x84, 0xfd, 0x5c, 0xee, 0xdf, 0x5d, 0xa0, 0x0b, 0x13, 0xf3, 0xaf, 0xa5, 0xbf,
+	0x00, 0x56, 0x82, 0x4f, 0x20, 0xbd, 0x1d, 0xc8, 0x37, 0xfb, 0xae, 0xd9, 0x6f, 0x53, 0x6a, 0x16,
+	0x88, 0x1d, 0x5c, 0x17, 0x1b, 0x92, 0xa7, 0xa2, 0x36, 0xdc, 0xbb, 0x6f, 0xbd, 0x0b, 0xc7, 0xa6,
+	0x61, 0xfd, 0x0c, 0x3b, 0x56, 0x11, 0xe1, 0xea, 0xdb, 0x06, 0x52, 0xe2, 0x28, 0xba, 0xbd, 0xe1,
+	0x33, 0x3e, 0xc0, 0xee, 0xd7, 0xfa, 0x91, 0xd4, 0x86, 0xc3, 0xf9, 0xa2, 0x5f, 0x41, 0xce, 0xaf,
+	0xac, 0x7c, 0x92, 0xc4, 0xc2, 0xf1, 0x11, 0xf6, 0xfc, 0xff, 0x6a, 0x43, 0x62, 0x73, 0x6b, 0xd6,
+	0xe0, 0x7c, 0xf3, 0xb9, 0xac, 0x33, 0x48, 0x1e, 0xeb, 0xe5, 0x6f, 0x00, 0x4c, 0x86, 0x65, 0x15,
+	0x3c, 0x01, 0x00, 0x00,
+}
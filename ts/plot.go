@@ -40,6 +40,7 @@ type plt struct {
 	xShift                        int
 	Labels                        []Label
 	ShowLatest                    bool
+	Bands                         []band // for state timelines
 }
 
 type plotKey struct {
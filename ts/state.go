@@ -0,0 +1,111 @@
+package ts
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// SVGState draws a timeline of on and off bands.  Add the state changes as a single Series with
+// Value 1 for on (ok), 0.5 for warning, and 0 for off (critical).  Each state lasts until the next
+// change or the end of the x axis.
+type SVGState struct {
+	template      *template.Template // the name for the template must be "plot"
+	width, height int                // for the data on the plot, not the overall size.
+}
+
+// band is an on, warning, or off period in SVG space.
+type band struct {
+	X, W int
+	Fill string
+}
+
+func (s *SVGState) Draw(p Plot, b *bytes.Buffer) error {
+	p.plt.width = s.width
+	p.plt.height = s.height
+	p.plt.YMin = 0.0
+	p.plt.YMax = 1.0
+
+	var n int
+	for _, d := range p.plt.Data {
+		n += len(d.Series.Points)
+	}
+
+	// can't scale the x axis without a range.
+	if n == 0 || !p.plt.XMax.After(p.plt.XMin) {
+		p.plt.Data = nil
+		return s.template.ExecuteTemplate(b, "plot", p.plt)
+	}
+
+	p.scaleData()
+	p.setAxes()
+
+	for _, d := range p.plt.Data {
+		for i := range d.Pts {
+			x0 := clamp(d.Pts[i].X, 0, s.width)
+			x1 := s.width
+			if i+1 < len(d.Pts) {
+				x1 = clamp(d.Pts[i+1].X, 0, s.width)
+			}
+
+			if x1 > x0 {
+				p.plt.Bands = append(p.plt.Bands, band{X: x0, W: x1 - x0, Fill: stateFill(d.Series.Points[i].Value)})
+			}
+		}
+	}
+
+	return s.template.ExecuteTemplate(b, "plot", p.plt)
+}
+
+func stateFill(v float64) string {
+	switch {
+	case v >= 1.0:
+		return "mediumseagreen"
+	case v > 0.0:
+		return "orange"
+	}
+	return "tomato"
+}
+
+func clamp(x, min, max int) int {
+	switch {
+	case x < min:
+		return min
+	case x > max:
+		return max
+	}
+	return x
+}
+
+// StateTimeline draws on (green), warning (orange), and off (red) bands e.g., for mains power.  The x axis must be set with SetXAxis.
+var StateTimeline = SVGState{
+	template: template.Must(template.New("plot").Funcs(funcMap).Parse(stateTemplate)),
+	width:    780,
+	height:   60,
+}
+
+const stateTemplate = `<?xml version="1.0"?>
+<svg viewBox="0,0,800,160" class="svg" xmlns="http://www.w3.org/2000/svg" font-family="Arial, sans-serif" font-size="12px" fill="lightgray">
+<g transform="translate(10,10)">
+<text x="0" y="0" text-anchor="start" dominant-baseline="hanging" font-size="14px" fill="darkslategray">{{.Axes.Title}}</text>
+<text x="0" y="18" text-anchor="start" dominant-baseline="hanging" font-size="12px" fill="darkslategray">{{.Axes.SubTitle}}</text>
+<text x="780" y="0" text-anchor="end" dominant-baseline="hanging" font-size="10px"><tspan fill="mediumseagreen">on</tspan> <tspan fill="orange">warning</tspan> <tspan fill="tomato">off</tspan></text>
+</g>
+
+<g transform="translate(10,60)">
+{{if .Bands}}
+{{range .Bands}}<rect x="{{.X}}" y="0" width="{{.W}}" height="60" fill="{{.Fill}}"/>{{end}}
+{{else}}
+<text x="0" y="0" text-anchor="start" dominant-baseline="hanging" font-size="14px" fill="lightgrey">NO DATA</text>
+{{end}}
+<polyline fill="none" stroke="lightgray" stroke-width="1" points="0,60 780,60"/>
+{{range .Axes.X}}
+{{if .L}}
+<polyline fill="none" stroke="lightgray" stroke-width="1" points="{{.X}},60 {{.X}},66"/>
+<text x="{{.X}}" y="70" text-anchor="middle" dominant-baseline="hanging" font-size="10px">{{.L}}</text>
+{{end}}
+{{end}}
+<text x="{{400}}" y="86" text-anchor="middle" dominant-baseline="hanging">{{.Axes.Xlabel}}</text>
+</g>
+
+</svg>
+`